@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/models/pagination"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// The /api/admin routes are restricted to administrators by the route
+// registry.
+
+func AdminUsers(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	queryParams := r.URL.Query()
+	search := models.NewUserSearch(state)
+	err := pagination.ParsePagination(state.Logger, queryParams, search)
+	if err != nil {
+		e.WriteError(w, err, http.StatusBadRequest)
+		return err
+	}
+	err = search.SetFilterCriteria(queryParams)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	users, err := search.Search()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("users", users)
+	return resp.Respond(w)
+}
+
+func AdminUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getAdminUser(w, r, state)
+	case http.MethodDelete:
+		return deleteAdminUser(w, r, state)
+	}
+
+	return nil
+}
+
+func getAdminUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	user := models.NewUser(state)
+	err = user.GetUserForAdmin(id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	user.Password = ""
+
+	resp := response.New(true, "success")
+	resp.Set("user", user)
+	return resp.Respond(w)
+}
+
+func deleteAdminUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	adminID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewUser(state).DeleteUser(adminID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return response.New(true, "User has been deleted").Respond(w)
+}
+
+// SetUserState confirms, disables or re-enables a user.
+func SetUserState(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	var req struct {
+		State datalayer.UserState `json:"state"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	adminID := r.Context().Value(auth.UserKey).(int64)
+	user := models.NewUser(state)
+	err = user.SetState(adminID, id, req.State)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	user.Password = ""
+
+	resp := response.New(true, "success")
+	resp.Set("user", user)
+	return resp.Respond(w)
+}
+
+// ResendUserConfirmation emails a new confirmation link to an unconfirmed
+// user.
+func ResendUserConfirmation(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	adminID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewUser(state).ResendConfirmation(adminID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return response.New(true, "Confirmation email has been sent").Respond(w)
+}
+
+// UnlockUserLogin ends a lockout of a user caused by failed logins.
+func UnlockUserLogin(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	adminID := r.Context().Value(auth.UserKey).(int64)
+	user := models.NewUser(state)
+	err = user.UnlockLogin(adminID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	user.Password = ""
+
+	resp := response.New(true, "User has been unlocked")
+	resp.Set("user", user)
+	return resp.Respond(w)
+}
+
+// GetUserAudit lists the actions administrators took on a user, including
+// one who has been deleted.
+func GetUserAudit(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	records, err := models.NewUser(state).GetAuditRecords(id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("audit", records)
+	return resp.Respond(w)
+}
@@ -0,0 +1,150 @@
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type AdminControllerResponse struct {
+	Message string                    `json:"message"`
+	Status  bool                      `json:"status"`
+	User    models.User               `json:"user"`
+	Users   []models.User             `json:"users"`
+	Audit   []*models.UserAuditRecord `json:"audit"`
+}
+
+func TestAdminUsers(t *testing.T) {
+	cl := new(http.Client)
+	messages := make(chan string, 10)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		messages <- message
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	subzero := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	subzeroID := tokenUserID(t, subzero.Token.AccessToken)
+	usersURL := state.URL + "/api/admin/users"
+
+	resp := adminRequest(t, ctx, cl, subzero, http.MethodGet, usersURL, nil, http.StatusOK)
+	require.Len(t, resp.Users, 2)
+	assert.Empty(t, resp.Users[0].Password)
+
+	resp = adminRequest(t, ctx, cl, subzero, http.MethodGet, usersURL+"?q=NETHER", nil, http.StatusOK)
+	require.Len(t, resp.Users, 1)
+	reptile := resp.Users[0]
+	assert.Equal(t, "reptile@netherrealm.com", reptile.Email)
+	assert.Equal(t, "UNCONFIRMED", reptile.State)
+	reptileURL := fmt.Sprintf("%s/%d", usersURL, reptile.ID)
+
+	resp = adminRequest(t, ctx, cl, subzero, http.MethodGet, usersURL+"?state=confirmed", nil, http.StatusOK)
+	require.Len(t, resp.Users, 1)
+	assert.Equal(t, subzeroID, resp.Users[0].ID)
+	resp = adminRequest(t, ctx, cl, subzero, http.MethodGet, usersURL+"?q=%25", nil, http.StatusOK)
+	assert.Empty(t, resp.Users)
+	adminRequest(t, ctx, cl, subzero, http.MethodGet, usersURL+"?state=ASLEEP", nil, http.StatusBadRequest)
+
+	resp = adminRequest(t, ctx, cl, subzero, http.MethodGet, usersURL+"?sortField=email&sortDir=desc&page=1&count=1", nil, http.StatusOK)
+	require.Len(t, resp.Users, 1)
+	assert.Equal(t, reptile.ID, resp.Users[0].ID)
+	adminRequest(t, ctx, cl, subzero, http.MethodGet, usersURL+"?sortField=password", nil, http.StatusBadRequest)
+
+	// Confirmation emails can be sent again until the user confirms
+	adminRequest(t, ctx, cl, subzero, http.MethodPost, reptileURL+"/confirmation", nil, http.StatusOK)
+	select {
+	case message := <-messages:
+		assert.Contains(t, message, "/api/users/confirm/")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "confirmation was not sent again")
+	}
+	require.Eventually(t, func() bool {
+		resp := adminRequest(t, ctx, cl, subzero, http.MethodGet, reptileURL, nil, http.StatusOK)
+		return resp.User.State == "PENDING"
+	}, 5*time.Second, 50*time.Millisecond)
+	adminRequest(t, ctx, cl, subzero, http.MethodPost, fmt.Sprintf("%s/%d/confirmation", usersURL, subzeroID), nil,
+		http.StatusConflict)
+
+	adminRequest(t, ctx, cl, subzero, http.MethodPut, reptileURL+"/state", map[string]string{"state": "PENDING"},
+		http.StatusBadRequest)
+	resp = adminRequest(t, ctx, cl, subzero, http.MethodPut, reptileURL+"/state", map[string]string{"state": "CONFIRMED"},
+		http.StatusOK)
+	assert.Equal(t, "CONFIRMED", resp.User.State)
+
+	// Only administrators may use the admin API
+	reptileAuth := householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+	resp = adminRequest(t, ctx, cl, reptileAuth, http.MethodGet, usersURL, nil, http.StatusForbidden)
+	assert.Equal(t, "Forbidden, the ADMIN role is required", resp.Message)
+
+	// Disabled users can neither sign in nor refresh their tokens
+	adminRequest(t, ctx, cl, subzero, http.MethodPut, fmt.Sprintf("%s/%d/state", usersURL, subzeroID),
+		map[string]string{"state": "DISABLED"}, http.StatusBadRequest)
+	resp = adminRequest(t, ctx, cl, subzero, http.MethodPut, reptileURL+"/state", map[string]string{"state": "disabled"},
+		http.StatusOK)
+	assert.Equal(t, "DISABLED", resp.User.State)
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   models.User{Email: "reptile@netherrealm.com", Password: "secret"},
+		expHTTPStatus: http.StatusForbidden,
+		expLoginResp:  AuthResponse{Message: "User account is disabled"},
+	})
+	refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: reptileAuth.Token.RefreshToken,
+		},
+		expHTTPStatus: http.StatusUnauthorized,
+		expResponse:   AuthResponse{Message: "User account is disabled"},
+	})
+	adminRequest(t, ctx, cl, subzero, http.MethodPost, reptileURL+"/confirmation", nil, http.StatusForbidden)
+
+	adminRequest(t, ctx, cl, subzero, http.MethodPut, reptileURL+"/state", map[string]string{"state": "CONFIRMED"},
+		http.StatusOK)
+	householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+
+	// Deleted users disappear but their audit remains
+	adminRequest(t, ctx, cl, subzero, http.MethodDelete, fmt.Sprintf("%s/%d", usersURL, subzeroID), nil,
+		http.StatusBadRequest)
+	adminRequest(t, ctx, cl, subzero, http.MethodDelete, reptileURL, nil, http.StatusOK)
+	adminRequest(t, ctx, cl, subzero, http.MethodGet, reptileURL, nil, http.StatusNotFound)
+	adminRequest(t, ctx, cl, subzero, http.MethodDelete, reptileURL, nil, http.StatusNotFound)
+	resp = adminRequest(t, ctx, cl, subzero, http.MethodGet, usersURL, nil, http.StatusOK)
+	require.Len(t, resp.Users, 1)
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   models.User{Email: "reptile@netherrealm.com", Password: "secret"},
+		expHTTPStatus: http.StatusForbidden,
+		expLoginResp:  AuthResponse{Message: "Invalid login credentials"},
+	})
+
+	resp = adminRequest(t, ctx, cl, subzero, http.MethodGet, reptileURL+"/audit", nil, http.StatusOK)
+	var actions []string
+	for _, record := range resp.Audit {
+		assert.Equal(t, subzeroID, record.ActorUserID)
+		assert.Equal(t, reptile.ID, record.UserID)
+		actions = append(actions, record.Action+" "+record.Detail)
+	}
+	assert.Equal(t, []string{
+		"DELETED reptile@netherrealm.com",
+		"STATE_CHANGED DISABLED -> CONFIRMED",
+		"STATE_CHANGED CONFIRMED -> DISABLED",
+		"STATE_CHANGED PENDING -> CONFIRMED",
+		"CONFIRMATION_RESENT reptile@netherrealm.com",
+	}, actions)
+}
+
+func adminRequest(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	method, url string, body interface{}, expHTTPStatus int) *AdminControllerResponse {
+	t.Helper()
+
+	gotResp := new(AdminControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
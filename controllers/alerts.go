@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+func AlertRules(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getAlertRules(w, r, state)
+	case http.MethodPost:
+		return createAlertRule(w, r, state)
+	}
+
+	return nil
+}
+
+func AlertRule(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getAlertRule(w, r, state)
+	case http.MethodPut:
+		return updateAlertRule(w, r, state)
+	case http.MethodDelete:
+		return deleteAlertRule(w, r, state)
+	}
+
+	return nil
+}
+
+func getAlertRules(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := r.Context().Value(auth.UserKey).(int64)
+	rules, err := models.NewAlertRule(state).GetAlertRulesByUserID(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("alertRules", rules)
+	return resp.Respond(w)
+}
+
+func createAlertRule(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	rule := models.NewAlertRule(state)
+	err := json.NewDecoder(r.Body).Decode(rule)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := rule.CreateAlertRule(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("alertRule", data)
+	return resp.Respond(w)
+}
+
+func getAlertRule(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := models.NewAlertRule(state).GetAlertRule(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("alertRule", data)
+	return resp.Respond(w)
+}
+
+func updateAlertRule(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	rule := models.NewAlertRule(state)
+	err = json.NewDecoder(r.Body).Decode(rule)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := rule.UpdateAlertRule(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("alertRule", data)
+	return resp.Respond(w)
+}
+
+func deleteAlertRule(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewAlertRule(state).DeleteAlertRule(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	return resp.Respond(w)
+}
+
+// GetAlertHistory lists the user's recent alert firings, optionally only
+// those of the ruleId or cardTransactionId query parameter.
+func GetAlertHistory(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	ruleID, err := queryID(r, "ruleId")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	cardTransactionID, err := queryID(r, "cardTransactionId")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	firings, err := models.NewAlertRule(state).GetAlertHistory(userID, ruleID, cardTransactionID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("alerts", firings)
+	return resp.Respond(w)
+}
+
+// queryID parses an optional id query parameter, returning zero when it is
+// absent.
+func queryID(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, e.NewError("Query parameter '"+name+"' is invalid", []types.ErrorField{
+			{Name: name, Message: "must be a positive integer"},
+		}, http.StatusBadRequest)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,200 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type AlertControllerResponse struct {
+	Message    string               `json:"message"`
+	Status     bool                 `json:"status"`
+	Fields     []types.ErrorField   `json:"fields"`
+	AlertRule  models.AlertRule     `json:"alertRule"`
+	AlertRules []models.AlertRule   `json:"alertRules"`
+	Alerts     []models.AlertFiring `json:"alerts"`
+}
+
+func TestAlerts(t *testing.T) {
+	cl := new(http.Client)
+	subjects := make(chan string, 10)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		subjects <- subject
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	// Validation
+	gotResp := alertRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/alerts", map[string]interface{}{
+		"name":            "Nothing",
+		"amountAbove":     "-5",
+		"cooldownMinutes": -1,
+	}, http.StatusBadRequest)
+	assert.Equal(t, "Alert rule is invalid", gotResp.Message)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "amountAbove", Message: "must be a positive amount such as 1000.00"},
+		{Name: "cooldownMinutes", Message: "must be between 0 and 43200"},
+	}, gotResp.Fields)
+
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/alerts", map[string]interface{}{
+		"name": "Nothing",
+	}, http.StatusBadRequest)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "rule", Message: "at least one condition is required"},
+	}, gotResp.Fields)
+
+	// A large purchase fires the rule and sends an email
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/alerts", map[string]interface{}{
+		"name":            "Large purchase",
+		"amountAbove":     "100",
+		"cooldownMinutes": 60,
+	}, http.StatusOK)
+	largePurchase := gotResp.AlertRule
+	assert.True(t, largePurchase.Active)
+	assert.True(t, largePurchase.NotifyEmail)
+	assert.False(t, largePurchase.LastFiredAt.Valid)
+
+	createAlertTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Big Store", 5000)
+	createAlertTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Big Store", 15000)
+	assert.Equal(t, "Alert: Large purchase", receiveAlertEmail(t, subjects))
+
+	alerts := awaitAlerts(t, ctx, cl, gotAuthResp, state.URL+"/api/me/alerts/history", 1)
+	assert.Equal(t, largePurchase.ID, alerts[0].AlertRuleID)
+	assert.Equal(t, "Large purchase", alerts[0].RuleName)
+	assert.NotZero(t, alerts[0].CardTransactionID)
+	assert.Contains(t, alerts[0].Message, "150.00 ZAR at Big Store")
+
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodGet,
+		state.URL+"/api/me/alerts/history?cardTransactionId="+strconv.FormatInt(alerts[0].CardTransactionID, 10), nil, http.StatusOK)
+	require.Len(t, gotResp.Alerts, 1)
+
+	// The rule is cooling down, so a second large purchase is not alerted
+	createAlertTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Big Store", 20000)
+
+	// A merchant seen before does not fire the new merchant rule but a new one does
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/alerts", map[string]interface{}{
+		"name":        "New merchant",
+		"newMerchant": true,
+		"notifyEmail": false,
+	}, http.StatusOK)
+	newMerchant := gotResp.AlertRule
+	assert.False(t, newMerchant.NotifyEmail)
+
+	createAlertTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Big Store", 1000)
+	createAlertTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Fresh Deli", 1000)
+	alerts = awaitAlerts(t, ctx, cl, gotAuthResp, state.URL+"/api/me/alerts/history", 2)
+	assert.Equal(t, "New merchant", alerts[0].RuleName)
+	assert.Contains(t, alerts[0].Message, "Fresh Deli")
+	assert.Equal(t, "Large purchase", alerts[1].RuleName)
+
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodGet,
+		state.URL+"/api/me/alerts/history?ruleId="+strconv.FormatInt(largePurchase.ID, 10), nil, http.StatusOK)
+	require.Len(t, gotResp.Alerts, 1)
+	select {
+	case subject := <-subjects:
+		assert.Fail(t, "unexpected alert email", subject)
+	default:
+	}
+
+	// Rules can be listed, updated and deleted
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodGet, state.URL+"/api/me/alerts", nil, http.StatusOK)
+	require.Len(t, gotResp.AlertRules, 2)
+	assert.Equal(t, "Large purchase", gotResp.AlertRules[0].Name)
+	assert.True(t, gotResp.AlertRules[0].LastFiredAt.Valid)
+
+	ruleURL := state.URL + "/api/me/alerts/" + strconv.FormatInt(newMerchant.ID, 10)
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodPut, ruleURL, map[string]interface{}{
+		"name":            "Foreign groceries",
+		"categoryCodes":   []string{"5411"},
+		"homeCountryCode": "za",
+		"active":          false,
+	}, http.StatusOK)
+	assert.Equal(t, "ZA", gotResp.AlertRule.HomeCountryCode)
+	assert.Equal(t, []string{"5411"}, gotResp.AlertRule.CategoryCodes)
+	assert.False(t, gotResp.AlertRule.NewMerchant)
+	assert.False(t, gotResp.AlertRule.Active)
+
+	alertRequest(t, ctx, cl, gotAuthResp, http.MethodDelete, ruleURL, nil, http.StatusOK)
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodGet, ruleURL, nil, http.StatusNotFound)
+	assert.Equal(t, "Alert rule not found", gotResp.Message)
+
+	gotResp = alertRequest(t, ctx, cl, gotAuthResp, http.MethodGet, state.URL+"/api/me/alerts/history?ruleId=x", nil, http.StatusBadRequest)
+	assert.Equal(t, "Query parameter 'ruleId' is invalid", gotResp.Message)
+}
+
+func createAlertTestTransaction(t *testing.T, ctx context.Context, cl *http.Client, url string, auth *AuthResponse,
+	merchantName string, cents int64) {
+	t.Helper()
+
+	createCardTransaction(t, ctx, cl, url, auth, &CreateCardTransactionParameters{
+		request: models.CardTransaction{
+			DateTime:     time.Date(2020, 04, 25, 19, 46, 23, 0, time.UTC),
+			Amount:       models.CurrencyValue{Value: cents, Scale: 2},
+			CurrencyCode: "ZAR",
+			Reference:    "simulation",
+			MerchantName: merchantName,
+		},
+		expResponse: CreateCardTransactionControllerResponse{
+			Message:         "success",
+			Status:          true,
+			CardTransaction: models.CardTransaction{Amount: models.CurrencyValue{Value: cents, Scale: 2}},
+		},
+	})
+}
+
+func receiveAlertEmail(t *testing.T, subjects chan string) string {
+	t.Helper()
+
+	select {
+	case subject := <-subjects:
+		return subject
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "alert email was not sent")
+	}
+	return ""
+}
+
+// awaitAlerts polls the alert history until it holds count firings, as rules
+// are evaluated after the card transaction has been stored.
+func awaitAlerts(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	historyURL string, count int) []models.AlertFiring {
+	t.Helper()
+
+	var alerts []models.AlertFiring
+	assert.Eventually(t, func() bool {
+		alerts = alertRequest(t, ctx, cl, auth, http.MethodGet, historyURL, nil, http.StatusOK).Alerts
+		return len(alerts) >= count
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Len(t, alerts, count)
+	return alerts
+}
+
+func alertRequest(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	method, url string, body interface{}, expHTTPStatus int) *AlertControllerResponse {
+	t.Helper()
+
+	gotResp := new(AlertControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
@@ -0,0 +1,120 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnomalies(t *testing.T) {
+	cl := new(http.Client)
+	subjects := make(chan string, 10)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		subjects <- subject
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	// High scores can be alerted on through a rule's filter
+	alertRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/alerts", map[string]interface{}{
+		"name":   "Unusual spend",
+		"filter": "anomalyScore >= 70",
+	}, http.StatusOK)
+
+	// Build up a history of regular coffee purchases
+	for _, cents := range []int64{4000, 4500, 5000, 4200, 4800} {
+		createAnomalyTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Corner Cafe", "ZA", cents)
+	}
+	createAnomalyTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Corner Cafe", "ZA", 90000)
+	createAnomalyTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Le Bistro", "FR", 4500)
+	createAnomalyTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Corner Cafe", "ZA", 4600)
+
+	var cardTransactions []models.CardTransaction
+	assert.Eventually(t, func() bool {
+		cardTransactions = getAnomalies(t, ctx, cl, state.URL, gotAuthResp, url.Values{
+			"filter":    {"anomalyScore >= 70"},
+			"sortField": {"anomalyScore"},
+			"sortDir":   {"desc"},
+		})
+		return len(cardTransactions) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Len(t, cardTransactions, 2)
+
+	assert.Equal(t, "Corner Cafe", cardTransactions[0].MerchantName)
+	assert.Equal(t, int64(90000), cardTransactions[0].Amount.Value)
+	assert.Equal(t, 90, cardTransactions[0].AnomalyScore)
+	assert.Equal(t, []string{models.AnomalyAmount}, cardTransactions[0].AnomalyReasons)
+
+	assert.Equal(t, "Le Bistro", cardTransactions[1].MerchantName)
+	assert.Equal(t, 80, cardTransactions[1].AnomalyScore)
+	assert.Equal(t, []string{models.AnomalyCountry}, cardTransactions[1].AnomalyReasons)
+
+	assert.Eventually(t, func() bool {
+		cardTransactions = getAnomalies(t, ctx, cl, state.URL, gotAuthResp, url.Values{"filter": {"anomalyScore < 70"}})
+		return len(cardTransactions) == 6
+	}, 5*time.Second, 50*time.Millisecond)
+	for _, cardTransaction := range cardTransactions {
+		assert.Zero(t, cardTransaction.AnomalyScore, cardTransaction.ID)
+		assert.Empty(t, cardTransaction.AnomalyReasons)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case subject := <-subjects:
+			assert.Equal(t, "Alert: Unusual spend", subject)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "anomaly alert was not sent")
+		}
+	}
+}
+
+func createAnomalyTestTransaction(t *testing.T, ctx context.Context, cl *http.Client, url string, auth *AuthResponse,
+	merchantName, countryCode string, cents int64) {
+	t.Helper()
+
+	createCardTransaction(t, ctx, cl, url, auth, &CreateCardTransactionParameters{
+		request: models.CardTransaction{
+			DateTime:            time.Date(2020, 04, 25, 9, 30, 0, 0, time.UTC),
+			Amount:              models.CurrencyValue{Value: cents, Scale: 2},
+			CurrencyCode:        "ZAR",
+			Reference:           "simulation",
+			MerchantName:        merchantName,
+			MerchantCountryCode: countryCode,
+		},
+		expResponse: CreateCardTransactionControllerResponse{
+			Message:         "success",
+			Status:          true,
+			CardTransaction: models.CardTransaction{Amount: models.CurrencyValue{Value: cents, Scale: 2}},
+		},
+	})
+}
+
+func getAnomalies(t *testing.T, ctx context.Context, cl *http.Client, url string, auth *AuthResponse,
+	query url.Values) []models.CardTransaction {
+	t.Helper()
+
+	gotResp := new(GetCardTransactionControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, http.MethodGet, url+"/api/me/card-transactions?"+query.Encode(), nil,
+		http.StatusOK, gotResp)
+	return gotResp.CardTransactions
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+func APITokens(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getAPITokens(w, r, state)
+	case http.MethodPost:
+		return createAPIToken(w, r, state)
+	}
+
+	return nil
+}
+
+func APIToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodDelete:
+		return revokeAPIToken(w, r, state)
+	}
+
+	return nil
+}
+
+func getAPITokens(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := r.Context().Value(auth.UserKey).(int64)
+	tokens, err := models.NewAPIToken(state).GetAPITokensByUserID(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("apiTokens", tokens)
+	resp.Set("scopes", auth.KnownScopes)
+	return resp.Respond(w)
+}
+
+func createAPIToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	token := models.NewAPIToken(state)
+	err := json.NewDecoder(r.Body).Decode(token)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := token.CreateAPIToken(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("apiToken", data)
+	return resp.Respond(w)
+}
+
+func revokeAPIToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewAPIToken(state).RevokeAPIToken(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	return resp.Respond(w)
+}
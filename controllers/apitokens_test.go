@@ -0,0 +1,124 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type APITokenControllerResponse struct {
+	Message   string             `json:"message"`
+	Status    bool               `json:"status"`
+	Fields    []types.ErrorField `json:"fields"`
+	APIToken  models.APIToken    `json:"apiToken"`
+	APITokens []models.APIToken  `json:"apiTokens"`
+	Scopes    []string           `json:"scopes"`
+}
+
+func TestAPITokens(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers, confirmSeedUsers)
+	ctx := state.Context
+	tokensURL := state.URL + "/api/me/api-tokens"
+	transactionsURL := state.URL + "/api/me/card-transactions"
+	newTransactionURL := state.URL + "/api/card-transactions/new"
+
+	subzero := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	reptile := householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+	session := subzero.Token.AccessToken
+
+	// The retired endpoint no longer mints tokens
+	resp := apiTokenRequest(t, ctx, cl, session, http.MethodGet, state.URL+"/api/auth/api-token", nil, http.StatusGone)
+	assert.Equal(t, "This endpoint has been removed, create an API token with POST /api/me/api-tokens instead", resp.Message)
+
+	// Validation
+	resp = apiTokenRequest(t, ctx, cl, session, http.MethodPost, tokensURL, map[string]interface{}{
+		"name":          " ",
+		"scopes":        []string{"transactions:write", "everything"},
+		"expiresInDays": 400,
+	}, http.StatusBadRequest)
+	assert.Equal(t, "API token is invalid", resp.Message)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "name", Message: "a name of up to 64 characters is required"},
+		{Name: "scopes", Message: `"everything" is not a scope`},
+		{Name: "expiresInDays", Message: "must be between 1 and 365 days"},
+	}, resp.Fields)
+
+	// The token is only shown when it is created
+	resp = apiTokenRequest(t, ctx, cl, session, http.MethodPost, tokensURL, map[string]interface{}{
+		"name":   "Card reader",
+		"scopes": []string{"transactions:write", "transactions:write"},
+	}, http.StatusOK)
+	cardReader := resp.APIToken
+	require.True(t, strings.HasPrefix(cardReader.Token, "gws_"))
+	assert.Equal(t, cardReader.Token[:12], cardReader.Hint)
+	assert.Equal(t, []string{"transactions:write"}, cardReader.Scopes)
+	assert.False(t, cardReader.LastUsedAt.Valid)
+
+	resp = apiTokenRequest(t, ctx, cl, session, http.MethodPost, tokensURL, map[string]interface{}{
+		"name":          "Dashboard",
+		"scopes":        []string{"transactions:read", "profile:read"},
+		"expiresInDays": 7,
+	}, http.StatusOK)
+	dashboard := resp.APIToken
+
+	// Tokens are held to their scopes
+	apiTokenRequest(t, ctx, cl, cardReader.Token, http.MethodPost, newTransactionURL,
+		householdCardTransaction("Kombat Kafe", 1200), http.StatusOK)
+	resp = apiTokenRequest(t, ctx, cl, cardReader.Token, http.MethodGet, transactionsURL, nil, http.StatusForbidden)
+	assert.Equal(t, "Forbidden, the transactions:read scope is required", resp.Message)
+	apiTokenRequest(t, ctx, cl, dashboard.Token, http.MethodGet, transactionsURL, nil, http.StatusOK)
+	apiTokenRequest(t, ctx, cl, dashboard.Token, http.MethodGet, state.URL+"/api/users/current", nil, http.StatusOK)
+	resp = apiTokenRequest(t, ctx, cl, dashboard.Token, http.MethodPost, newTransactionURL,
+		householdCardTransaction("Kombat Kafe", 1200), http.StatusForbidden)
+	assert.Equal(t, "Forbidden, the transactions:write scope is required", resp.Message)
+
+	// Routes without a scope only take sessions, so tokens cannot mint tokens
+	resp = apiTokenRequest(t, ctx, cl, dashboard.Token, http.MethodGet, tokensURL, nil, http.StatusForbidden)
+	assert.Equal(t, "Forbidden, API tokens cannot be used here", resp.Message)
+	resp = apiTokenRequest(t, ctx, cl, "gws_0123456789", http.MethodGet, transactionsURL, nil, http.StatusForbidden)
+	assert.Equal(t, "Token rejected, API token is not valid", resp.Message)
+
+	// Listing shows when tokens were last used, but never the tokens
+	resp = apiTokenRequest(t, ctx, cl, session, http.MethodGet, tokensURL, nil, http.StatusOK)
+	require.Len(t, resp.APITokens, 2)
+	assert.Contains(t, resp.Scopes, "households:write")
+	for _, token := range resp.APITokens {
+		assert.Empty(t, token.Token)
+		assert.True(t, token.LastUsedAt.Valid)
+	}
+	assert.Equal(t, "Card reader", resp.APITokens[0].Name)
+	assert.Equal(t, dashboard.ExpiresAt.Unix(), resp.APITokens[1].ExpiresAt.Unix())
+
+	// Revoked tokens stop working at once, and only their owner may revoke
+	dashboardURL := tokensURL + "/" + strconv.FormatInt(dashboard.ID, 10)
+	resp = apiTokenRequest(t, ctx, cl, reptile.Token.AccessToken, http.MethodDelete, dashboardURL, nil,
+		http.StatusNotFound)
+	assert.Equal(t, "API token not found", resp.Message)
+	apiTokenRequest(t, ctx, cl, session, http.MethodDelete, dashboardURL, nil, http.StatusOK)
+	apiTokenRequest(t, ctx, cl, session, http.MethodDelete, dashboardURL, nil, http.StatusNotFound)
+	resp = apiTokenRequest(t, ctx, cl, dashboard.Token, http.MethodGet, transactionsURL, nil, http.StatusForbidden)
+	assert.Equal(t, "Token has been revoked", resp.Message)
+	resp = apiTokenRequest(t, ctx, cl, session, http.MethodGet, tokensURL, nil, http.StatusOK)
+	require.Len(t, resp.APITokens, 1)
+	assert.Equal(t, cardReader.ID, resp.APITokens[0].ID)
+}
+
+func apiTokenRequest(t *testing.T, ctx context.Context, cl *http.Client, token string,
+	method, url string, body interface{}, expHTTPStatus int) *APITokenControllerResponse {
+	t.Helper()
+
+	gotResp := new(APITokenControllerResponse)
+	apiRequest(t, ctx, cl, token, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
@@ -8,7 +8,10 @@ import (
 	models_auth "github.com/donohutcheon/gowebserver/models/auth"
 	"github.com/donohutcheon/gowebserver/router/auth"
 	"github.com/donohutcheon/gowebserver/state"
+	"io"
+	"net"
 	"net/http"
+	"strings"
 )
 
 func Authenticate(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
@@ -30,17 +33,52 @@ func Authenticate(w http.ResponseWriter, r *http.Request, state *state.ServerSta
 		return err
 	}
 
-	data, err := user.Login(user.Email, user.Password)
+	data, challenge, err := user.Login(user.Email, user.Password, clientIP(r, state))
 	if err != nil {
-		errors.WriteError(w, err)
+		writeLoginError(w, err)
 		return err
 	}
+	if challenge != nil {
+		resp := response.New(true, "Two-factor code required")
+		resp.Set("challenge", challenge)
+		return resp.Respond(w)
+	}
 
 	resp := response.New(true, "Logged In")
 	resp["token"] = data
 	return resp.Respond(w)
 }
 
+// AuthenticateTwoFactor completes the sign in of a user with two-factor
+// authentication, exchanging the challenge token Authenticate gave them and a
+// code for tokens.
+func AuthenticateTwoFactor(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	var challengeReq struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&challengeReq)
+	if err != nil {
+		err = errors.Wrap("Invalid request format", http.StatusBadRequest, err)
+		errors.WriteError(w, err)
+		return err
+	}
+
+	data, err := models.NewUser(state).LoginWithCode(challengeReq.ChallengeToken, challengeReq.Code, clientIP(r, state))
+	if err != nil {
+		writeLoginError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Logged In")
+	resp.Set("token", data)
+	return resp.Respond(w)
+}
+
 func RefreshToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
@@ -64,7 +102,7 @@ func RefreshToken(w http.ResponseWriter, r *http.Request, state *state.ServerSta
 		return err
 	}
 
-	data, err := auth.RefreshToken(refreshTokenReq.RefreshToken)
+	data, err := models.NewUser(state).RefreshToken(refreshTokenReq.RefreshToken)
 	if err != nil {
 		errors.WriteError(w, err)
 		return err
@@ -76,28 +114,154 @@ func RefreshToken(w http.ResponseWriter, r *http.Request, state *state.ServerSta
 	return resp.Respond(w)
 }
 
+// GetAPIToken is the retired way of getting an API token, which minted a new
+// one with every scope on each call.  Clients should create named API tokens
+// with POST /api/me/api-tokens instead.
 func GetAPIToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
-	w.Header().Set("X-XSS-Protection", "1; mode=block")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-	//w.Header().Set("Sec-Fetch-Site", "same-site")
+	if r.Method == http.MethodOptions {
+		return nil
+	}
 
+	err := errors.NewError("This endpoint has been removed, create an API token with POST /api/me/api-tokens instead",
+		nil, http.StatusGone)
+	errors.WriteError(w, err)
+	return err
+}
+
+// Logout revokes the caller's session, or every session with
+// {"allSessions": true}.  The body is optional.
+func Logout(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
 	if r.Method == http.MethodOptions {
 		return nil
 	}
 
-	userID := r.Context().Value(models_auth.UserKey).(int64)
+	var logoutReq struct {
+		AllSessions bool `json:"allSessions"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&logoutReq)
+	if err != nil && err != io.EOF {
+		err = errors.Wrap("Invalid request format", http.StatusBadRequest, err)
+		errors.WriteError(w, err)
+		return err
+	}
 
-	user := models.NewUser(state)
-	user.ID = userID
-	data, err := user.GetAPIToken()
+	tk := r.Context().Value(models_auth.TokenKey).(*models_auth.JSONWebToken)
+	err = models.NewUser(state).Logout(tk, logoutReq.AllSessions)
 	if err != nil {
-		errors.WriteError(w, errors.NewError("could not generate API token", nil, http.StatusForbidden))
+		errors.WriteError(w, err)
+		return err
 	}
 
-	resp := response.New(true, "Logged In")
-	resp["token"] = data
+	return response.New(true, "Logged out").Respond(w)
+}
 
-	return resp.Respond(w)
-}
\ No newline at end of file
+// RequestPasswordReset emails a password reset link.  It answers the same
+// whether or not the address has an account.
+func RequestPasswordReset(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	var resetReq struct {
+		Email string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&resetReq)
+	if err != nil {
+		err = errors.Wrap("Invalid request format", http.StatusBadRequest, err)
+		errors.WriteError(w, err)
+		return err
+	}
+
+	err = models.RequestPasswordReset(state, resetReq.Email)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	return response.New(true, "If the address has an account, a password reset link has been sent to it").Respond(w)
+}
+
+// ResendConfirmation emails a new sign-up confirmation link.  It answers the
+// same whether or not the address has an account waiting to be confirmed.
+func ResendConfirmation(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	var resendReq struct {
+		Email string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&resendReq)
+	if err != nil {
+		err = errors.Wrap("Invalid request format", http.StatusBadRequest, err)
+		errors.WriteError(w, err)
+		return err
+	}
+
+	err = models.RequestConfirmationResend(state, resendReq.Email)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	return response.New(true, "If the address is waiting to be confirmed, a confirmation link has been sent to it").Respond(w)
+}
+
+// ConfirmPasswordReset sets a new password with the token from a password
+// reset link, logging the user out everywhere.
+func ConfirmPasswordReset(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	var resetReq struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&resetReq)
+	if err != nil {
+		err = errors.Wrap("Invalid request format", http.StatusBadRequest, err)
+		errors.WriteError(w, err)
+		return err
+	}
+
+	err = models.ResetPassword(state, resetReq.Token, resetReq.Password)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	return response.New(true, "Password has been reset").Respond(w)
+}
+
+// writeLoginError writes the error of a login, telling clients that are
+// being held back by failed logins when to try again.
+func writeLoginError(w http.ResponseWriter, err error) {
+	if err, ok := err.(*errors.ControllerError); ok && err.StatusCode == http.StatusTooManyRequests {
+		for _, field := range err.Fields {
+			if field.Name == "retryAfter" {
+				w.Header().Set("Retry-After", field.Message)
+			}
+		}
+	}
+
+	errors.WriteError(w, err)
+}
+
+// clientIP returns the address a request came from.  Behind a router such as
+// Heroku's, which appends the address it was connected from to
+// X-Forwarded-For, the last one listed there is used when present.
+// Otherwise the header is the client's own and is ignored.
+func clientIP(r *http.Request, state *state.ServerState) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); state.BehindProxy && len(forwarded) > 0 {
+		addresses := strings.Split(forwarded, ",")
+		return strings.TrimSpace(addresses[len(addresses)-1])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
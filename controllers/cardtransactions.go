@@ -33,7 +33,15 @@ func CreateCardTransaction(w http.ResponseWriter, r *http.Request, state *state.
 		return err
 	}
 
-	cardTransaction.UserID = userID
+	// A household member with read-write access may record a transaction on
+	// the owner's behalf by naming them in the owner query parameter.
+	ownerID, err := cardTransaction.WritableOwner(userID, r.URL.Query().Get("owner"))
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	cardTransaction.UserID = ownerID
 	data, err := cardTransaction.CreateCardTransaction()
 	if err != nil {
 		errors.WriteError(w, err)
@@ -51,19 +59,30 @@ func GetCardTransactions(w http.ResponseWriter, r *http.Request, state *state.Se
 		return nil
 	}
 
+	userID := r.Context().Value(auth.UserKey).(int64)
+	queryParams, view, err := models.ApplySavedView(state, userID, r.URL.Query())
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
 	cardTransaction := models.NewCardTransaction(state)
-	err := pagination.ParsePagination(state.Logger, r.URL.Query(), cardTransaction)
+	err = pagination.ParsePagination(state.Logger, queryParams, cardTransaction)
 	if err != nil {
 		errors.WriteError(w, err, http.StatusBadRequest)
 		return err
 	}
-	err = cardTransaction.SetFilterCriteria(r.URL.Query())
+	err = cardTransaction.SetFilterCriteria(queryParams)
 	if err != nil {
 		errors.WriteError(w, err, http.StatusBadRequest)
 		return err
 	}
+	err = cardTransaction.SetOwner(userID, queryParams.Get("owner"))
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
 
-	userID := r.Context().Value(auth.UserKey).(int64)
 	data, err := cardTransaction.GetCardTransactionsByUserID(userID)
 	if err != nil && err != datalayer.ErrNoData {
 		errors.WriteError(w, err, http.StatusInternalServerError)
@@ -72,6 +91,9 @@ func GetCardTransactions(w http.ResponseWriter, r *http.Request, state *state.Se
 
 	resp := response.New(true, "success")
 	resp.Set("cardTransactions", data)
+	if view != nil {
+		resp.Set("view", view)
+	}
 
 	return resp.Respond(w)
 }
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"testing"
 	"time"
 
@@ -40,6 +41,7 @@ type CreateCardTransactionParameters struct {
 
 type GetCardTransactionParameters struct {
 	skip          bool
+	query         url.Values
 	expResponse   GetCardTransactionControllerResponse
 	expHTTPStatus int
 }
@@ -172,6 +174,56 @@ func TestCardTransactions(t *testing.T) {
 				expHTTPStatus: http.StatusOK,
 			},
 		},
+		{
+			name: "Unterminated search phrase",
+			authParameters: AuthParameters{
+				authRequest: models.User{
+					Email:    "subzero@dreamrealm.com",
+					Password: "secret",
+				},
+				expHTTPStatus: http.StatusOK,
+				expLoginResp: AuthResponse{
+					Message: "Logged In",
+					Status:  true,
+				},
+			},
+			createCardTransactionParams: CreateCardTransactionParameters{
+				skip: true,
+			},
+			getCardTransactionParams: GetCardTransactionParameters{
+				query: url.Values{"q": {`"cape town`}},
+				expResponse: GetCardTransactionControllerResponse{
+					Message: "search is invalid",
+					Status:  false,
+				},
+				expHTTPStatus: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Relevance without search",
+			authParameters: AuthParameters{
+				authRequest: models.User{
+					Email:    "subzero@dreamrealm.com",
+					Password: "secret",
+				},
+				expHTTPStatus: http.StatusOK,
+				expLoginResp: AuthResponse{
+					Message: "Logged In",
+					Status:  true,
+				},
+			},
+			createCardTransactionParams: CreateCardTransactionParameters{
+				skip: true,
+			},
+			getCardTransactionParams: GetCardTransactionParameters{
+				query: url.Values{"sortField": {"relevance"}},
+				expResponse: GetCardTransactionControllerResponse{
+					Message: "invalid sort field",
+					Status:  false,
+				},
+				expHTTPStatus: http.StatusBadRequest,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -189,10 +241,96 @@ func TestCardTransactions(t *testing.T) {
 	}
 }
 
+// TestCardTransactionSearch searches transactions with the database's
+// full-text index, which only sees committed rows.
+func TestCardTransactionSearch(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewCommittedForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	var indexes int
+	err := state.DataLayer.(*datalayer.PersistenceDataLayer).GetConn().Get(&indexes,
+		"SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() "+
+			"AND table_name = 'card_transactions' AND index_type = 'FULLTEXT'")
+	require.NoError(t, err)
+	if indexes == 0 {
+		t.Skip("the database has no full-text index on card_transactions")
+	}
+
+	gotAuthResp := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	for _, cardTransaction := range []models.CardTransaction{
+		{Reference: "coffee coffee", MerchantName: "Bean There Coffee", MerchantCity: "Johannesburg"},
+		{Reference: "simulation", MerchantName: "Seattle Coffee Company", MerchantCity: "Cape Town"},
+		{Reference: "simulation", MerchantName: "Pick n Pay", MerchantCity: "Cape Town"},
+	} {
+		cardTransaction.DateTime = time.Date(2020, 04, 25, 9, 30, 0, 0, time.UTC)
+		cardTransaction.Amount = models.CurrencyValue{Value: 4500, Scale: 2}
+		cardTransaction.CurrencyCode = "ZAR"
+		cardTransaction.MerchantCategoryName = "Eating Places"
+		createCardTransaction(t, ctx, cl, state.URL, gotAuthResp, &CreateCardTransactionParameters{
+			request:     cardTransaction,
+			expResponse: CreateCardTransactionControllerResponse{Message: "success", Status: true, CardTransaction: cardTransaction},
+		})
+	}
+
+	// Matches are ranked by relevance, with where they matched highlighted
+	found := searchCardTransactions(t, ctx, cl, state.URL, gotAuthResp, "coffee")
+	require.Len(t, found, 2)
+	assert.Equal(t, "Bean There Coffee", found[0].MerchantName)
+	assert.Equal(t, map[string]string{
+		"reference":    "<em>coffee</em> <em>coffee</em>",
+		"merchantName": "Bean There <em>Coffee</em>",
+	}, found[0].Highlights)
+	assert.Equal(t, "Seattle Coffee Company", found[1].MerchantName)
+	assert.Equal(t, map[string]string{
+		"merchantName": "Seattle <em>Coffee</em> Company",
+	}, found[1].Highlights)
+	assert.Greater(t, found[0].Relevance, found[1].Relevance)
+	assert.Greater(t, found[1].Relevance, 0.0)
+
+	// Excluded words, phrases and prefixes
+	found = searchCardTransactions(t, ctx, cl, state.URL, gotAuthResp, "coffee -seattle")
+	require.Len(t, found, 1)
+	assert.Equal(t, "Bean There Coffee", found[0].MerchantName)
+	found = searchCardTransactions(t, ctx, cl, state.URL, gotAuthResp, `"cape town" pic`)
+	require.Len(t, found, 1)
+	assert.Equal(t, "Pick n Pay", found[0].MerchantName)
+	assert.Equal(t, map[string]string{
+		"merchantName": "<em>Pick</em> n Pay",
+		"merchantCity": "<em>Cape Town</em>",
+	}, found[0].Highlights)
+	assert.Empty(t, searchCardTransactions(t, ctx, cl, state.URL, gotAuthResp, "tea"))
+
+	// The summary covers only the matches
+	getCardTransactionSummary(t, ctx, cl, state.URL, gotAuthResp, &GetCardTransactionSummaryParameters{
+		query: url.Values{"q": {"coffee"}}.Encode(),
+		expResponse: CardTransactionSummaryControllerResponse{Message: "success", Status: true,
+			Categories: []models.CategorySummary{{
+				Category:         "Eating Places",
+				CurrencyCode:     "ZAR",
+				Amount:           models.CurrencyValue{Value: 9000, Scale: 2},
+				TransactionCount: 2,
+			}},
+		},
+		expHTTPStatus: http.StatusOK,
+	})
+}
+
+func searchCardTransactions(t *testing.T, ctx context.Context, cl *http.Client, baseURL string, auth *AuthResponse,
+	q string) []models.CardTransaction {
+	t.Helper()
+
+	gotResp := new(GetCardTransactionControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, http.MethodGet,
+		baseURL+"/api/me/card-transactions?"+url.Values{"q": {q}}.Encode(), nil, http.StatusOK, gotResp)
+	return gotResp.CardTransactions
+}
+
 func createCardTransaction(t *testing.T, ctx context.Context, cl *http.Client,
-	url string, auth *AuthResponse, params *CreateCardTransactionParameters) {
+	url string, auth *AuthResponse, params *CreateCardTransactionParameters) *CreateCardTransactionControllerResponse {
 	if params.skip {
-		return
+		return nil
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/api/card-transactions/new", nil)
@@ -217,6 +355,8 @@ func createCardTransaction(t *testing.T, ctx context.Context, cl *http.Client,
 	assert.Equal(t, params.expResponse.Status, gotResp.Status)
 	assert.Equal(t, params.expResponse.Message, gotResp.Message)
 	assert.Equal(t, params.expResponse.CardTransaction.Amount.Value, gotResp.CardTransaction.Amount.Value)
+
+	return gotResp
 }
 
 func getCardTransactions(t *testing.T, ctx context.Context, cl *http.Client,
@@ -226,7 +366,7 @@ func getCardTransactions(t *testing.T, ctx context.Context, cl *http.Client,
 		return
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/me/card-transactions", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/me/card-transactions?"+params.query.Encode(), nil)
 	assert.NoError(t, err)
 	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
 
@@ -239,6 +379,7 @@ func getCardTransactions(t *testing.T, ctx context.Context, cl *http.Client,
 	err = json.Unmarshal(body, gotResp)
 	require.NoError(t, err)
 
+	assert.Equal(t, params.expHTTPStatus, res.StatusCode)
 	assert.Equal(t, params.expResponse.Status, gotResp.Status)
 	assert.Equal(t, params.expResponse.Message, gotResp.Message)
 	require.Equal(t, len(params.expResponse.CardTransactions), len(gotResp.CardTransactions))
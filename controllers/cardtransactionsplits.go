@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+func CardTransactionSplits(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getCardTransactionSplits(w, r, state)
+	case http.MethodPut:
+		return setCardTransactionSplits(w, r, state)
+	}
+
+	return nil
+}
+
+func getCardTransactionSplits(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	cardTransactionID, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	splits := models.NewCardTransactionSplits(state)
+	err = splits.GetSplits(userID, cardTransactionID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("splits", splits.Splits)
+	return resp.Respond(w)
+}
+
+func setCardTransactionSplits(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	cardTransactionID, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	splits := models.NewCardTransactionSplits(state)
+	err = json.NewDecoder(r.Body).Decode(splits)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = splits.SetSplits(userID, cardTransactionID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("splits", splits.Splits)
+	return resp.Respond(w)
+}
+
+func GetCardTransactionSummary(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	cardTransaction := models.NewCardTransaction(state)
+	err := cardTransaction.SetFilterCriteria(r.URL.Query())
+	if err != nil {
+		e.WriteError(w, err, http.StatusBadRequest)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = cardTransaction.SetOwner(userID, r.URL.Query().Get("owner"))
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	data, err := cardTransaction.GetCategorySummaryByUserID(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("categories", data)
+	return resp.Respond(w)
+}
+
+// pathID reads a numeric identifier from the request's path variables.
+func pathID(r *http.Request, name string) (int64, error) {
+	value, ok := mux.Vars(r)[name]
+	if !ok {
+		return 0, e.NewError("Path variable '"+name+"' is required", []types.ErrorField{
+			{Name: name, Message: "Path variable '" + name + "' is required"},
+		}, http.StatusBadRequest)
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, e.NewError("Path variable '"+name+"' is invalid", []types.ErrorField{
+			{Name: name, Message: "must be a positive integer"},
+		}, http.StatusBadRequest)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,329 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type CardTransactionSplitsControllerResponse struct {
+	Message string                        `json:"message"`
+	Status  bool                          `json:"status"`
+	Fields  []types.ErrorField            `json:"fields"`
+	Splits  []models.CardTransactionSplit `json:"splits"`
+}
+
+type CardTransactionSummaryControllerResponse struct {
+	Message    string                   `json:"message"`
+	Status     bool                     `json:"status"`
+	Categories []models.CategorySummary `json:"categories"`
+}
+
+type SetCardTransactionSplitsParameters struct {
+	splits         []models.CardTransactionSplit
+	splitWithOther bool
+	// otherInHousehold puts the user split with in a household with the
+	// caller.
+	otherInHousehold bool
+	expResponse      CardTransactionSplitsControllerResponse
+	expHTTPStatus    int
+}
+
+type GetCardTransactionSummaryParameters struct {
+	query         string
+	expResponse   CardTransactionSummaryControllerResponse
+	expHTTPStatus int
+}
+
+func TestCardTransactionSplits(t *testing.T) {
+	splitTransaction := models.CardTransaction{
+		DateTime: time.Date(2020, 05, 02, 10, 12, 44, 0, time.UTC),
+		Amount: models.CurrencyValue{
+			Value: 400,
+			Scale: 2,
+		},
+		CurrencyCode:         "ZAR",
+		Reference:            "simulation",
+		MerchantName:         "Pick n Pay",
+		MerchantCity:         "Cape Town",
+		MerchantCountryCode:  "ZA",
+		MerchantCountryName:  "South Africa",
+		MerchantCategoryCode: "grocery_stores_supermarkets",
+		MerchantCategoryName: "Grocery Stores/Supermarkets",
+	}
+
+	tests := []struct {
+		name          string
+		splitParams   SetCardTransactionSplitsParameters
+		summaryParams GetCardTransactionSummaryParameters
+	}{
+		{
+			name: "Golden",
+			splitParams: SetCardTransactionSplitsParameters{
+				splits: []models.CardTransactionSplit{
+					{Amount: models.CurrencyValue{Value: 250, Scale: 2}, Category: "Household", Note: "weekly shop"},
+					{Amount: models.CurrencyValue{Value: 150, Scale: 2}, Category: "Business", Note: "office coffee"},
+				},
+				splitWithOther:   true,
+				otherInHousehold: true,
+				expResponse: CardTransactionSplitsControllerResponse{
+					Message: "success",
+					Status:  true,
+				},
+				expHTTPStatus: http.StatusOK,
+			},
+			summaryParams: GetCardTransactionSummaryParameters{
+				expResponse: CardTransactionSummaryControllerResponse{
+					Message: "success",
+					Status:  true,
+					Categories: []models.CategorySummary{
+						{
+							Category:         "Household",
+							CurrencyCode:     "ZAR",
+							Amount:           models.CurrencyValue{Value: 250, Scale: 2},
+							TransactionCount: 1,
+						},
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			},
+		},
+		{
+			name: "Split with a user outside the caller's households",
+			splitParams: SetCardTransactionSplitsParameters{
+				splits: []models.CardTransactionSplit{
+					{Amount: models.CurrencyValue{Value: 250, Scale: 2}, Category: "Household"},
+					{Amount: models.CurrencyValue{Value: 150, Scale: 2}, Category: "Business"},
+				},
+				splitWithOther: true,
+				expResponse: CardTransactionSplitsControllerResponse{
+					Message: "Card transaction splits are invalid",
+					Status:  false,
+					Fields:  []types.ErrorField{{Name: "splits[1].userID", Message: "user does not exist"}},
+				},
+				expHTTPStatus: http.StatusBadRequest,
+			},
+			summaryParams: GetCardTransactionSummaryParameters{
+				expResponse: CardTransactionSummaryControllerResponse{
+					Message: "success",
+					Status:  true,
+					Categories: []models.CategorySummary{
+						{
+							Category:         "Grocery Stores/Supermarkets",
+							CurrencyCode:     "ZAR",
+							Amount:           models.CurrencyValue{Value: 400, Scale: 2},
+							TransactionCount: 1,
+						},
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			},
+		},
+		{
+			name: "Split with a missing user",
+			splitParams: SetCardTransactionSplitsParameters{
+				splits: []models.CardTransactionSplit{
+					{Amount: models.CurrencyValue{Value: 250, Scale: 2}, Category: "Household"},
+					{Amount: models.CurrencyValue{Value: 150, Scale: 2}, Category: "Business", UserID: 999999},
+				},
+				expResponse: CardTransactionSplitsControllerResponse{
+					Message: "Card transaction splits are invalid",
+					Status:  false,
+					Fields:  []types.ErrorField{{Name: "splits[1].userID", Message: "user does not exist"}},
+				},
+				expHTTPStatus: http.StatusBadRequest,
+			},
+			summaryParams: GetCardTransactionSummaryParameters{
+				expResponse: CardTransactionSummaryControllerResponse{
+					Message: "success",
+					Status:  true,
+					Categories: []models.CategorySummary{
+						{
+							Category:         "Grocery Stores/Supermarkets",
+							CurrencyCode:     "ZAR",
+							Amount:           models.CurrencyValue{Value: 400, Scale: 2},
+							TransactionCount: 1,
+						},
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			},
+		},
+		{
+			name: "Amounts do not add up",
+			splitParams: SetCardTransactionSplitsParameters{
+				splits: []models.CardTransactionSplit{
+					{Amount: models.CurrencyValue{Value: 250, Scale: 2}, Category: "Household"},
+				},
+				expResponse: CardTransactionSplitsControllerResponse{
+					Message: "Card transaction splits are invalid",
+					Status:  false,
+				},
+				expHTTPStatus: http.StatusBadRequest,
+			},
+			summaryParams: GetCardTransactionSummaryParameters{
+				expResponse: CardTransactionSummaryControllerResponse{
+					Message: "success",
+					Status:  true,
+					Categories: []models.CategorySummary{
+						{
+							Category:         "Grocery Stores/Supermarkets",
+							CurrencyCode:     "ZAR",
+							Amount:           models.CurrencyValue{Value: 400, Scale: 2},
+							TransactionCount: 1,
+						},
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cl := new(http.Client)
+			callbacks := state.NewMockCallbacks(mailCallback)
+			state := facotory.NewForTesting(t, callbacks, seedUsers)
+			ctx := state.Context
+
+			gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+				authRequest: models.User{
+					Email:    "subzero@dreamrealm.com",
+					Password: "secret",
+				},
+				expHTTPStatus: http.StatusOK,
+				expLoginResp: AuthResponse{
+					Message: "Logged In",
+					Status:  true,
+				},
+			})
+
+			created := createCardTransaction(t, ctx, cl, state.URL, gotAuthResp, &CreateCardTransactionParameters{
+				request: splitTransaction,
+				expResponse: CreateCardTransactionControllerResponse{
+					Message:         "success",
+					Status:          true,
+					CardTransaction: splitTransaction,
+				},
+				expHTTPStatus: http.StatusOK,
+			})
+
+			if test.splitParams.splitWithOther {
+				dl := state.DataLayer
+				other, err := dl.GetUserByEmail("reptile@netherrealm.com")
+				require.NoError(t, err)
+				test.splitParams.splits[len(test.splitParams.splits)-1].UserID = other.ID
+
+				if test.splitParams.otherInHousehold {
+					ownerID := tokenUserID(t, gotAuthResp.Token.AccessToken)
+					householdID, err := dl.CreateHousehold(&datalayer.Household{Name: "Outworld", OwnerUserID: ownerID})
+					require.NoError(t, err)
+					invitation := &datalayer.HouseholdInvitation{
+						HouseholdID:     householdID,
+						InvitedByUserID: ownerID,
+						Email:           other.Email.String,
+						TokenHash:       "outworld",
+						ExpiresAt:       time.Now().Add(time.Hour),
+					}
+					invitation.ID, err = dl.CreateHouseholdInvitation(invitation)
+					require.NoError(t, err)
+					accepted, err := dl.AcceptHouseholdInvitation(invitation, other.ID, time.Now())
+					require.NoError(t, err)
+					require.True(t, accepted)
+				}
+			}
+
+			setCardTransactionSplits(t, ctx, cl, state.URL, gotAuthResp, created.CardTransaction.ID, &test.splitParams)
+			getCardTransactionSummary(t, ctx, cl, state.URL, gotAuthResp, &test.summaryParams)
+
+			// Reports total merchants the way the summary totals categories
+			report, err := models.BuildReport(state, tokenUserID(t, gotAuthResp.Token.AccessToken),
+				datalayer.ReportCadenceWeekly, splitTransaction.DateTime, splitTransaction.DateTime.AddDate(0, 0, 1))
+			require.NoError(t, err)
+			require.Len(t, report.Totals, 1)
+			require.Len(t, report.Merchants, 1)
+			assert.Equal(t, "Pick n Pay", report.Merchants[0].Name)
+			assert.Equal(t, report.Totals[0].Amount, report.Merchants[0].Amount)
+			assert.Equal(t, int64(1), report.Merchants[0].TransactionCount)
+		})
+	}
+}
+
+func setCardTransactionSplits(t *testing.T, ctx context.Context, cl *http.Client,
+	url string, auth *AuthResponse, cardTransactionID int64, params *SetCardTransactionSplitsParameters) {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]interface{}{"splits": params.splits})
+	require.NoError(t, err)
+
+	endpoint := fmt.Sprintf("%s/api/me/card-transactions/%d/splits", url, cardTransactionID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(b))
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(CardTransactionSplitsControllerResponse)
+	err = json.Unmarshal(body, gotResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, params.expHTTPStatus, res.StatusCode)
+	assert.Equal(t, params.expResponse.Status, gotResp.Status)
+	assert.Equal(t, params.expResponse.Message, gotResp.Message)
+	if params.expResponse.Fields != nil {
+		assert.Equal(t, params.expResponse.Fields, gotResp.Fields)
+	}
+	if params.expHTTPStatus != http.StatusOK {
+		return
+	}
+
+	require.Equal(t, len(params.splits), len(gotResp.Splits))
+	for i, x := range params.splits {
+		assert.Equal(t, cardTransactionID, gotResp.Splits[i].CardTransactionID)
+		assert.Equal(t, x.Amount, gotResp.Splits[i].Amount)
+		assert.Equal(t, x.Category, gotResp.Splits[i].Category)
+		assert.Equal(t, x.Note, gotResp.Splits[i].Note)
+		assert.Equal(t, x.UserID, gotResp.Splits[i].UserID)
+	}
+}
+
+func getCardTransactionSummary(t *testing.T, ctx context.Context, cl *http.Client,
+	url string, auth *AuthResponse, params *GetCardTransactionSummaryParameters) {
+	t.Helper()
+
+	summaryURL := url + "/api/me/card-transactions/summary"
+	if params.query != "" {
+		summaryURL += "?" + params.query
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, summaryURL, nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(CardTransactionSummaryControllerResponse)
+	err = json.Unmarshal(body, gotResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, params.expHTTPStatus, res.StatusCode)
+	assert.Equal(t, params.expResponse, *gotResp)
+}
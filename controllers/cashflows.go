@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+func CashFlows(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getCashFlows(w, r, state)
+	case http.MethodPost:
+		return createCashFlow(w, r, state)
+	}
+
+	return nil
+}
+
+func CashFlow(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getCashFlow(w, r, state)
+	case http.MethodPut:
+		return updateCashFlow(w, r, state)
+	case http.MethodDelete:
+		return deleteCashFlow(w, r, state)
+	}
+
+	return nil
+}
+
+func getCashFlows(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := r.Context().Value(auth.UserKey).(int64)
+	cashFlows, err := models.NewCashFlow(state).GetCashFlowsByUserID(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("cashFlows", cashFlows)
+	return resp.Respond(w)
+}
+
+func createCashFlow(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	cashFlow := models.NewCashFlow(state)
+	err := json.NewDecoder(r.Body).Decode(cashFlow)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := cashFlow.CreateCashFlow(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("cashFlow", data)
+	return resp.Respond(w)
+}
+
+func getCashFlow(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := models.NewCashFlow(state).GetCashFlow(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("cashFlow", data)
+	return resp.Respond(w)
+}
+
+func updateCashFlow(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	cashFlow := models.NewCashFlow(state)
+	err = json.NewDecoder(r.Body).Decode(cashFlow)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := cashFlow.UpdateCashFlow(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("cashFlow", data)
+	return resp.Respond(w)
+}
+
+func deleteCashFlow(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewCashFlow(state).DeleteCashFlow(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	return resp.Respond(w)
+}
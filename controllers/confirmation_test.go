@@ -0,0 +1,124 @@
+package controllers_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/services/users"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type confirmationEmail struct {
+	to   string
+	link string
+}
+
+func TestResendConfirmation(t *testing.T) {
+	cl := new(http.Client)
+	emails := make(chan confirmationEmail, 10)
+	linkPattern := regexp.MustCompile(`https?://.*/api/users/confirm/[a-z0-9]+`)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		if subject != "Welcome to this app!" {
+			return
+		}
+		link := linkPattern.FindString(message)
+		require.NotEmpty(t, link)
+		emails <- confirmationEmail{to: to[0], link: link}
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+	dl := state.DataLayer
+	resendURL := state.URL + "/api/auth/resend-confirmation"
+	sent := "If the address is waiting to be confirmed, a confirmation link has been sent to it"
+
+	resp := credentialsRequest(t, ctx, cl, "", http.MethodPost, resendURL, map[string]string{"email": "nobody"},
+		http.StatusBadRequest)
+	assert.Equal(t, "Email address is required", resp.Message)
+	resp = credentialsRequest(t, ctx, cl, "", http.MethodPost, resendURL,
+		map[string]string{"email": "reptile@netherrealm.com"}, http.StatusOK)
+	assert.Equal(t, sent, resp.Message)
+	reptileEmail := receiveConfirmationEmail(t, emails)
+	assert.Equal(t, "reptile@netherrealm.com", reptileEmail.to)
+	reptile, err := dl.GetUserByEmail("reptile@netherrealm.com")
+	require.NoError(t, err)
+	assert.Equal(t, string(datalayer.UserStatePending), reptile.State.String)
+
+	// Only a hash of the nonce in the link is stored
+	confirmation, err := dl.GetLatestSignUpConfirmationByUserID(reptile.ID)
+	require.NoError(t, err)
+	assert.Equal(t, hashToken(path.Base(reptileEmail.link)), confirmation.NonceHash)
+
+	// Addresses that were just sent one, are confirmed or have no account
+	// get the same answer but no email.  Requests are handled in turn, so
+	// the next email is the one asked for last.
+	jadeID, err := dl.CreateUser("jade@edenia.com", "$2a$10$NkTUeL6hkTRZ7M13tKYLqOmg7pAQaGPdpch9b5UoTSoO77MHjbPjm")
+	require.NoError(t, err)
+	for _, email := range []string{"reptile@netherrealm.com", "subzero@dreamrealm.com", "kano@outworld.com", "jade@edenia.com"} {
+		resp = credentialsRequest(t, ctx, cl, "", http.MethodPost, resendURL, map[string]string{"email": email},
+			http.StatusOK)
+		assert.Equal(t, sent, resp.Message)
+	}
+	assert.Equal(t, "jade@edenia.com", receiveConfirmationEmail(t, emails).to)
+
+	// Links work once
+	resp = credentialsRequest(t, ctx, cl, "", http.MethodGet, reptileEmail.link, nil, http.StatusOK)
+	assert.Equal(t, "User's email has been confirmed", resp.Message)
+	resp = credentialsRequest(t, ctx, cl, "", http.MethodGet, reptileEmail.link, nil, http.StatusBadRequest)
+	assert.Equal(t, "Confirmation link has expired or has already been used", resp.Message)
+	householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+
+	// and only until they expire, after which they are swept away
+	_, err = dl.CreateSignUpConfirmation(hashToken("0123456789abcdef0123456789abcdef"), jadeID, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	expiredURL := state.URL + "/api/users/confirm/0123456789abcdef0123456789abcdef"
+	resp = credentialsRequest(t, ctx, cl, "", http.MethodGet, expiredURL, nil, http.StatusBadRequest)
+	assert.Equal(t, "Confirmation link has expired or has already been used", resp.Message)
+
+	// Users whose email was never sent are sent one by the sweep
+	require.NoError(t, dl.SetUserStateByID(jadeID, datalayer.UserStateProcessing))
+	users.SweepConfirmations(state, time.Now().Add(10*time.Minute))
+	jadeEmail := receiveConfirmationEmail(t, emails)
+	assert.Equal(t, "jade@edenia.com", jadeEmail.to)
+	jade, err := dl.GetUserByID(jadeID)
+	require.NoError(t, err)
+	assert.Equal(t, string(datalayer.UserStatePending), jade.State.String)
+	resp = credentialsRequest(t, ctx, cl, "", http.MethodGet, expiredURL, nil, http.StatusBadRequest)
+	assert.Equal(t, "No match found for nonce", resp.Message)
+
+	credentialsRequest(t, ctx, cl, "", http.MethodGet, jadeEmail.link, nil, http.StatusOK)
+	householdLogin(t, ctx, cl, state.URL, "jade@edenia.com")
+	users.SweepConfirmations(state, time.Now().Add(10*time.Minute))
+	select {
+	case email := <-emails:
+		assert.Fail(t, "confirmed user was sent another email", email.to)
+	default:
+	}
+}
+
+// hashToken hashes a token the way the server stores it.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func receiveConfirmationEmail(t *testing.T, emails chan confirmationEmail) confirmationEmail {
+	t.Helper()
+
+	select {
+	case email := <-emails:
+		return email
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "confirmation email was not sent")
+	}
+	return confirmationEmail{}
+}
@@ -1,7 +1,9 @@
 package controllers_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -29,4 +31,31 @@ func mailCallback(t *testing.T, ctx context.Context, to []string, from, subject,
 	body, err := ioutil.ReadAll(res.Body)
 	require.NoError(t, err)
 	t.Log("Confirmation response body: ", string(body))
-}
\ No newline at end of file
+}
+
+// apiRequest sends body as JSON with token as the bearer token, when one is
+// given, requires the expected status and decodes the response into gotResp.
+func apiRequest(t *testing.T, ctx context.Context, cl *http.Client, token, method, url string, body interface{},
+	expHTTPStatus int, gotResp interface{}) {
+	t.Helper()
+
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+	require.NoError(t, err)
+	if len(token) > 0 {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, expHTTPStatus, res.StatusCode, url)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(gotResp))
+}
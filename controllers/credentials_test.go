@@ -0,0 +1,171 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/services/users"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type CredentialsControllerResponse struct {
+	Message string             `json:"message"`
+	Status  bool               `json:"status"`
+	Token   auth.TokenResponse `json:"token"`
+	User    models.User        `json:"user"`
+}
+
+type sentEmail struct {
+	to      string
+	subject string
+	message string
+}
+
+func TestChangePassword(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers, confirmSeedUsers)
+	ctx := state.Context
+	passwordURL := state.URL + "/api/me/password"
+	currentUserURL := state.URL + "/api/users/current"
+
+	session := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	other := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+
+	resp := credentialsRequest(t, ctx, cl, session.Token.AccessToken, http.MethodPut, passwordURL,
+		map[string]string{"currentPassword": "guess", "newPassword": "frozen"}, http.StatusForbidden)
+	assert.Equal(t, "Current password is incorrect", resp.Message)
+	resp = credentialsRequest(t, ctx, cl, session.Token.AccessToken, http.MethodPut, passwordURL,
+		map[string]string{"currentPassword": "secret", "newPassword": "ice"}, http.StatusBadRequest)
+	assert.Equal(t, "Password is required", resp.Message)
+
+	// Other sessions end, and the caller carries on with new tokens
+	resp = credentialsRequest(t, ctx, cl, session.Token.AccessToken, http.MethodPut, passwordURL,
+		map[string]string{"currentPassword": "secret", "newPassword": "frozen"}, http.StatusOK)
+	assert.Equal(t, "Password changed", resp.Message)
+	require.NotEmpty(t, resp.Token.AccessToken)
+	credentialsRequest(t, ctx, cl, resp.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusOK)
+	for _, token := range []string{session.Token.AccessToken, other.Token.AccessToken} {
+		credentialsRequest(t, ctx, cl, token, http.MethodGet, currentUserURL, nil, http.StatusForbidden)
+	}
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   models.User{Email: "subzero@dreamrealm.com", Password: "frozen"},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+	})
+
+	// Hashes of a lower cost are upgraded on login
+	weak, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	reptile, err := state.DataLayer.GetUserByEmail("reptile@netherrealm.com")
+	require.NoError(t, err)
+	require.NoError(t, state.DataLayer.SetUserPasswordByID(reptile.ID, string(weak)))
+	householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+	reptile, err = state.DataLayer.GetUserByEmail("reptile@netherrealm.com")
+	require.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(reptile.Password.String))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+	householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+}
+
+func TestChangeEmail(t *testing.T) {
+	cl := new(http.Client)
+	emails := make(chan sentEmail, 10)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		emails <- sentEmail{to: to[0], subject: subject, message: message}
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers, confirmSeedUsers)
+	ctx := state.Context
+	emailURL := state.URL + "/api/me/email"
+	currentUserURL := state.URL + "/api/users/current"
+
+	session := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	token := session.Token.AccessToken
+
+	resp := credentialsRequest(t, ctx, cl, token, http.MethodPut, emailURL,
+		map[string]string{"email": "subzero@linkuei.com", "currentPassword": "guess"}, http.StatusForbidden)
+	assert.Equal(t, "Current password is incorrect", resp.Message)
+	resp = credentialsRequest(t, ctx, cl, token, http.MethodPut, emailURL,
+		map[string]string{"email": "reptile@netherrealm.com", "currentPassword": "secret"}, http.StatusBadRequest)
+	assert.Equal(t, "Email address already exists", resp.Message)
+
+	// The new address is confirmed before the switch
+	resp = credentialsRequest(t, ctx, cl, token, http.MethodPut, emailURL,
+		map[string]string{"email": "subzero@linkuei.com", "currentPassword": "secret"}, http.StatusOK)
+	assert.Equal(t, "A confirmation link has been sent to the new address", resp.Message)
+	email := receiveEmail(t, emails)
+	assert.Equal(t, "subzero@linkuei.com", email.to)
+	assert.Equal(t, "Confirm your new email address", email.subject)
+	confirmURL := regexp.MustCompile(`https?://\S+/api/users/confirm/[0-9a-f]+`).FindString(email.message)
+	require.NotEmpty(t, confirmURL)
+
+	resp = credentialsRequest(t, ctx, cl, token, http.MethodGet, currentUserURL, nil, http.StatusOK)
+	assert.Equal(t, "subzero@dreamrealm.com", resp.User.Email)
+	assert.Equal(t, "subzero@linkuei.com", resp.User.PendingEmail)
+	householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+
+	resp = credentialsRequest(t, ctx, cl, "", http.MethodGet, confirmURL, nil, http.StatusOK)
+	assert.Equal(t, "User's email has been confirmed", resp.Message)
+	email = receiveEmail(t, emails)
+	assert.Equal(t, "subzero@dreamrealm.com", email.to)
+	assert.Equal(t, "Your email address has changed", email.subject)
+
+	resp = credentialsRequest(t, ctx, cl, token, http.MethodGet, currentUserURL, nil, http.StatusOK)
+	assert.Equal(t, "subzero@linkuei.com", resp.User.Email)
+	assert.Empty(t, resp.User.PendingEmail)
+	householdLogin(t, ctx, cl, state.URL, "subzero@linkuei.com")
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   models.User{Email: "subzero@dreamrealm.com", Password: "secret"},
+		expHTTPStatus: http.StatusForbidden,
+		expLoginResp:  AuthResponse{Message: "Invalid login credentials"},
+	})
+
+	// Each link works once
+	credentialsRequest(t, ctx, cl, "", http.MethodGet, confirmURL, nil, http.StatusBadRequest)
+
+	// Changes whose email was never sent are sent one by the sweep
+	subzero, err := state.DataLayer.GetUserByEmail("subzero@linkuei.com")
+	require.NoError(t, err)
+	require.NoError(t, state.DataLayer.SetUserPendingEmailByID(subzero.ID, "subzero@outworld.com"))
+	users.SweepConfirmations(state, time.Now().Add(10*time.Minute))
+	email = receiveEmail(t, emails)
+	assert.Equal(t, "subzero@outworld.com", email.to)
+	assert.Equal(t, "Confirm your new email address", email.subject)
+	users.SweepConfirmations(state, time.Now().Add(10*time.Minute))
+	select {
+	case email := <-emails:
+		assert.Fail(t, "email change was confirmed twice", email.to)
+	default:
+	}
+}
+
+func receiveEmail(t *testing.T, emails chan sentEmail) sentEmail {
+	t.Helper()
+
+	select {
+	case email := <-emails:
+		return email
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "email was not sent")
+	}
+	return sentEmail{}
+}
+
+func credentialsRequest(t *testing.T, ctx context.Context, cl *http.Client, token string,
+	method, url string, body interface{}, expHTTPStatus int) *CredentialsControllerResponse {
+	t.Helper()
+
+	gotResp := new(CredentialsControllerResponse)
+	apiRequest(t, ctx, cl, token, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// eventHeartbeat is how often an idle event stream writes a comment to keep
+// proxies from closing it.
+const eventHeartbeat = 15 * time.Second
+
+// revokingEvents are the account events after which a stream checks its
+// token straight away rather than at the next heartbeat.
+var revokingEvents = map[string]bool{
+	events.UserLoggedOut:       true,
+	events.UserPasswordChanged: true,
+	events.UserDisabled:        true,
+}
+
+// isStreamRevoked reports whether the token a stream was opened with has
+// been revoked since.  The stream is kept open if the check fails, to be
+// checked again.
+func isStreamRevoked(r *http.Request, state *state.ServerState) bool {
+	revoked, err := models.IsRequestRevoked(state, r.Context())
+	if err != nil {
+		state.Logger.Printf("failed to check revocation of event stream: %v", err)
+		return false
+	}
+	return revoked
+}
+
+// eventReplayLimit caps the card transactions replayed to a client resuming
+// with Last-Event-ID.  A client that is further behind should reload the list.
+const eventReplayLimit = 1000
+
+// GetEvents streams the user's events as Server-Sent Events.  A client that
+// reconnects with a Last-Event-ID header (or lastEventId query parameter) is
+// first sent the card transactions it missed.  The stream ends when the
+// client goes away, falls too far behind, its token is revoked, or the server
+// shuts down.
+func GetEvents(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err := e.NewError("Streaming is not supported", nil, http.StatusInternalServerError)
+		e.WriteError(w, err)
+		return err
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if len(lastEventID) == 0 {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var lastID int64
+	if len(lastEventID) > 0 {
+		var err error
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			err := e.NewError("Last event id is invalid", []types.ErrorField{
+				{Name: "Last-Event-ID", Message: "must be the id of a previous event"},
+			}, http.StatusBadRequest)
+			e.WriteError(w, err)
+			return err
+		}
+	}
+
+	// Subscribe before replaying so that nothing created in between is lost;
+	// anything replayed is skipped when it arrives live.
+	userID := r.Context().Value(auth.UserKey).(int64)
+	sub := state.Events.Subscribe(userID)
+	defer sub.Unsubscribe()
+
+	var missed []*models.CardTransaction
+	if lastID > 0 {
+		var err error
+		missed, err = models.NewCardTransaction(state).GetCardTransactionsAfterID(userID, lastID, eventReplayLimit)
+		if err != nil {
+			e.WriteError(w, err)
+			return err
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, cardTransaction := range missed {
+		err := writeEvent(w, events.Event{
+			ID:     cardTransaction.ID,
+			Type:   events.CardTransactionCreated,
+			UserID: userID,
+			Data:   cardTransaction,
+		})
+		if err != nil {
+			return err
+		}
+		lastID = cardTransaction.ID
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Dropped() {
+					state.Logger.Printf("event stream for user %d dropped, the client is too slow", userID)
+				}
+				return nil
+			}
+			if revokingEvents[event.Type] && isStreamRevoked(r, state) {
+				return nil
+			}
+			if event.Type == events.CardTransactionCreated && event.ID <= lastID {
+				continue
+			}
+			err := writeEvent(w, event)
+			if err != nil {
+				return err
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if isStreamRevoked(r, state) {
+				return nil
+			}
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			if err != nil {
+				return err
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return nil
+		case <-state.Context.Done():
+			return nil
+		}
+	}
+}
+
+// writeEvent writes one event in the text/event-stream format.  Only card
+// transaction events carry an id, as they are the ones that can be replayed.
+func writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	if event.Type == events.CardTransactionCreated {
+		_, err = fmt.Fprintf(w, "id: %d\n", event.ID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
@@ -0,0 +1,162 @@
+package controllers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ServerSentEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+func TestEvents(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	newCardTransaction := func(merchantName string) *CreateCardTransactionParameters {
+		return &CreateCardTransactionParameters{
+			request: models.CardTransaction{
+				DateTime:     time.Date(2020, 04, 25, 19, 46, 23, 0, time.UTC),
+				Amount:       models.CurrencyValue{Value: 400, Scale: 2},
+				CurrencyCode: "ZAR",
+				Reference:    "simulation",
+				MerchantName: merchantName,
+			},
+			expResponse: CreateCardTransactionControllerResponse{
+				Message:         "success",
+				Status:          true,
+				CardTransaction: models.CardTransaction{Amount: models.CurrencyValue{Value: 400, Scale: 2}},
+			},
+		}
+	}
+
+	// Live delivery
+	streamCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	stream := openEventStream(t, streamCtx, cl, state.URL, gotAuthResp, "")
+	first := createCardTransaction(t, ctx, cl, state.URL, gotAuthResp, newCardTransaction("The Coders Bakery"))
+	event := stream.next(t)
+	cancel()
+
+	assert.Equal(t, strconv.FormatInt(first.CardTransaction.ID, 10), event.ID)
+	assert.Equal(t, "cardTransaction.created", event.Event)
+	cardTransaction := new(models.CardTransaction)
+	require.NoError(t, json.Unmarshal([]byte(event.Data), cardTransaction))
+	assert.Equal(t, "The Coders Bakery", cardTransaction.MerchantName)
+
+	// Resuming replays what was missed while disconnected
+	second := createCardTransaction(t, ctx, cl, state.URL, gotAuthResp, newCardTransaction("Monkey Business"))
+	streamCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	stream = openEventStream(t, streamCtx, cl, state.URL, gotAuthResp, event.ID)
+	event = stream.next(t)
+
+	assert.Equal(t, strconv.FormatInt(second.CardTransaction.ID, 10), event.ID)
+	require.NoError(t, json.Unmarshal([]byte(event.Data), cardTransaction))
+	assert.Equal(t, "Monkey Business", cardTransaction.MerchantName)
+
+	// An invalid Last-Event-ID is rejected
+	res := eventStreamRequest(t, ctx, cl, state.URL, gotAuthResp, "not-a-number")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// Logging out ends the streams of the session, and only those
+	other := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	streamCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	stream = openEventStream(t, streamCtx, cl, state.URL, gotAuthResp, "")
+	otherStream := openEventStream(t, streamCtx, cl, state.URL, other, "")
+	logoutRequest(t, ctx, cl, gotAuthResp.Token.AccessToken, http.MethodPost, state.URL+"/api/auth/logout", nil,
+		http.StatusOK)
+	for stream.scanner.Scan() {
+	}
+	require.NoError(t, stream.scanner.Err())
+
+	assert.Equal(t, "user.loggedOut", otherStream.next(t).Event)
+	createCardTransaction(t, ctx, cl, state.URL, other, newCardTransaction("Dwelms en Dinges"))
+	assert.Equal(t, "cardTransaction.created", otherStream.next(t).Event)
+}
+
+type eventStream struct {
+	scanner *bufio.Scanner
+}
+
+func eventStreamRequest(t *testing.T, ctx context.Context, cl *http.Client,
+	url string, auth *AuthResponse, lastEventID string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/me/events", nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+	if len(lastEventID) > 0 {
+		req.Header.Add("Last-Event-ID", lastEventID)
+	}
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	return res
+}
+
+func openEventStream(t *testing.T, ctx context.Context, cl *http.Client,
+	url string, auth *AuthResponse, lastEventID string) *eventStream {
+	t.Helper()
+
+	res := eventStreamRequest(t, ctx, cl, url, auth, lastEventID)
+	t.Cleanup(func() { res.Body.Close() })
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	return &eventStream{scanner: bufio.NewScanner(res.Body)}
+}
+
+// next reads the next event, skipping comments such as heartbeats.
+func (s *eventStream) next(t *testing.T) ServerSentEvent {
+	t.Helper()
+
+	var event ServerSentEvent
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case len(line) == 0:
+			if len(event.Event) > 0 {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	require.NoError(t, s.scanner.Err())
+	require.Fail(t, "event stream ended before an event was received")
+	return event
+}
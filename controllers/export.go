@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/models/pagination"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// exportWriter holds back the download headers until the first byte of the
+// export is written, so that a failure before then can still be reported as
+// a JSON error.
+type exportWriter struct {
+	http.ResponseWriter
+	format  models.ExportFormat
+	started bool
+}
+
+func (x *exportWriter) start() {
+	x.started = true
+	x.Header().Set("Content-Type", x.format.ContentType())
+	x.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", x.format.FileName(time.Now())))
+	x.WriteHeader(http.StatusOK)
+}
+
+func (x *exportWriter) Write(b []byte) (int, error) {
+	if !x.started {
+		x.start()
+	}
+	return x.ResponseWriter.Write(b)
+}
+
+// ExportCardTransactions downloads the user's card transactions as CSV, OFX
+// or JSON Lines.  The filter and sort parameters are those of
+// GetCardTransactions, including view=; paging parameters are ignored and
+// every match is exported.
+func ExportCardTransactions(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	queryParams, _, err := models.ApplySavedView(state, userID, r.URL.Query())
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	format, err := models.ParseExportFormat(queryParams.Get("format"))
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	cardTransaction := models.NewCardTransaction(state)
+	err = pagination.ParsePagination(state.Logger, queryParams, cardTransaction)
+	if err != nil {
+		e.WriteError(w, err, http.StatusBadRequest)
+		return err
+	}
+	err = cardTransaction.SetFilterCriteria(queryParams)
+	if err != nil {
+		e.WriteError(w, err, http.StatusBadRequest)
+		return err
+	}
+	err = cardTransaction.SetOwner(userID, queryParams.Get("owner"))
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	x := &exportWriter{ResponseWriter: w, format: format}
+	err = cardTransaction.ExportCardTransactionsByUserID(userID, format, x)
+	if err != nil && !x.started {
+		e.WriteError(w, e.Wrap("Failed to export card transactions", http.StatusInternalServerError, err))
+		return err
+	} else if err != nil {
+		// The download is already under way and the error can only be logged.
+		return err
+	}
+
+	if !x.started {
+		x.start()
+	}
+
+	return nil
+}
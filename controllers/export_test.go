@@ -0,0 +1,195 @@
+package controllers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exportSeedCSV = `dateTime,amount,currencyCode,reference,merchantName
+2020-04-25T10:00:00Z,-100.00,ZAR,ref-1,The Coders Bakery
+2020-04-26T10:00:00Z,-1250.50,ZAR,ref-2,Dwelms en Dinges
+2020-05-01T10:00:00Z,-20.00,USD,ref-3,Monkey Business
+`
+
+type ExportParameters struct {
+	query          url.Values
+	expHTTPStatus  int
+	expContentType string
+	expExtension   string
+	expBody        []string
+	expMessage     string
+}
+
+func TestExportCardTransactions(t *testing.T) {
+	tests := []struct {
+		name         string
+		exportParams ExportParameters
+	}{
+		{
+			name: "CSV sorted by amount",
+			exportParams: ExportParameters{
+				query:          url.Values{"format": {"csv"}, "sortField": {"amount"}, "sortDir": {"desc"}},
+				expHTTPStatus:  http.StatusOK,
+				expContentType: "text/csv; charset=utf-8",
+				expExtension:   ".csv",
+				expBody: []string{
+					"id,dateTime,amount,currencyCode,reference,merchantName,merchantCity,merchantCountryCode,merchantCountryName,merchantCategoryCode,merchantCategoryName",
+					",2020-04-26T10:00:00Z,-1250.50,ZAR,ref-2,Dwelms en Dinges,,,,,",
+					",2020-04-25T10:00:00Z,-100.00,ZAR,ref-1,The Coders Bakery,,,,,",
+					",2020-05-01T10:00:00Z,-20.00,USD,ref-3,Monkey Business,,,,,",
+				},
+			},
+		},
+		{
+			name: "NDJSON filtered by date",
+			exportParams: ExportParameters{
+				query:          url.Values{"format": {"ndjson"}, "dateTime": {"1587859200-1590969600"}},
+				expHTTPStatus:  http.StatusOK,
+				expContentType: "application/x-ndjson",
+				expExtension:   ".ndjson",
+				expBody:        []string{"Dwelms en Dinges", "Monkey Business"},
+			},
+		},
+		{
+			name: "OFX",
+			exportParams: ExportParameters{
+				query:          url.Values{"format": {"ofx"}},
+				expHTTPStatus:  http.StatusOK,
+				expContentType: "application/x-ofx",
+				expExtension:   ".ofx",
+			},
+		},
+		{
+			name: "Unknown format",
+			exportParams: ExportParameters{
+				query:         url.Values{"format": {"xls"}},
+				expHTTPStatus: http.StatusBadRequest,
+				expMessage:    "Unsupported export format",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cl := new(http.Client)
+			callbacks := state.NewMockCallbacks(mailCallback)
+			state := facotory.NewForTesting(t, callbacks, seedUsers)
+			ctx := state.Context
+
+			gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+				authRequest: models.User{
+					Email:    "subzero@dreamrealm.com",
+					Password: "secret",
+				},
+				expHTTPStatus: http.StatusOK,
+				expLoginResp: AuthResponse{
+					Message: "Logged In",
+					Status:  true,
+				},
+			})
+
+			createImport(t, ctx, cl, state.URL, gotAuthResp, &CreateImportParameters{
+				query: url.Values{"format": {"csv"}},
+				file:  exportSeedCSV,
+				expResponse: ImportControllerResponse{
+					Message: "Statement imported",
+					Status:  true,
+					Import: models.Import{
+						Format:   "csv",
+						Parsed:   3,
+						Imported: 3,
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			})
+
+			exportCardTransactions(t, ctx, cl, state.URL, gotAuthResp, &test.exportParams)
+		})
+	}
+}
+
+func exportCardTransactions(t *testing.T, ctx context.Context, cl *http.Client,
+	url string, auth *AuthResponse, params *ExportParameters) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/me/card-transactions/export?"+params.query.Encode(), nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, params.expHTTPStatus, res.StatusCode)
+	if params.expHTTPStatus != http.StatusOK {
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		gotResp := new(ImportControllerResponse)
+		require.NoError(t, json.Unmarshal(body, gotResp))
+		assert.False(t, gotResp.Status)
+		assert.Equal(t, params.expMessage, gotResp.Message)
+		return
+	}
+
+	assert.Equal(t, params.expContentType, res.Header.Get("Content-Type"))
+	disposition := res.Header.Get("Content-Disposition")
+	assert.True(t, strings.HasPrefix(disposition, `attachment; filename="card-transactions-`))
+	assert.True(t, strings.HasSuffix(disposition, params.expExtension+`"`))
+
+	switch params.expContentType {
+	case "application/x-ofx":
+		createImport(t, ctx, cl, url, auth, &CreateImportParameters{
+			fileName: "export.ofx",
+			file:     readAll(t, res),
+			expResponse: ImportControllerResponse{
+				Message: "Statement imported",
+				Status:  true,
+				Import: models.Import{
+					Format:     "ofx",
+					Parsed:     3,
+					Imported:   0,
+					Duplicates: 3,
+				},
+			},
+			expHTTPStatus: http.StatusOK,
+		})
+	case "application/x-ndjson":
+		var got []string
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			cardTransaction := new(models.CardTransaction)
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), cardTransaction))
+			got = append(got, cardTransaction.MerchantName)
+		}
+		require.NoError(t, scanner.Err())
+		assert.Equal(t, params.expBody, got)
+	default:
+		lines := strings.Split(strings.TrimSpace(readAll(t, res)), "\n")
+		require.Equal(t, len(params.expBody), len(lines))
+		assert.Equal(t, params.expBody[0], lines[0])
+		for i, line := range lines[1:] {
+			// Strip the generated id before comparing.
+			assert.Equal(t, params.expBody[i+1], line[strings.Index(line, ","):])
+		}
+	}
+}
+
+func readAll(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(body)
+}
@@ -0,0 +1,174 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const filterSeedCSV = `dateTime,amount,currencyCode,reference,merchantName
+2020-04-25T10:00:00Z,-100.00,ZAR,ref-1,The Coders Bakery
+2020-04-26T10:00:00Z,-1250.50,ZAR,ref-2,Dwelms en Dinges
+2020-05-01T10:00:00Z,-20.00,USD,ref-3,Monkey Business
+2020-05-02T10:00:00Z,30.00,ZAR,ref-4,Refund
+`
+
+type FilterParameters struct {
+	query         url.Values
+	expHTTPStatus int
+	expMessage    string
+	expFieldName  string
+	expMerchants  []string
+}
+
+func TestFilterCardTransactions(t *testing.T) {
+	tests := []struct {
+		name         string
+		filterParams FilterParameters
+	}{
+		{
+			name: "And",
+			filterParams: FilterParameters{
+				query:         url.Values{"filter": {`amount >= 100 and currencyCode = "ZAR"`}},
+				expHTTPStatus: http.StatusOK,
+				expMerchants:  []string{"The Coders Bakery", "Dwelms en Dinges"},
+			},
+		},
+		{
+			name: "Or with a negative amount",
+			filterParams: FilterParameters{
+				query:         url.Values{"filter": {`merchantName = "Monkey Business" or amount <= -30`}},
+				expHTTPStatus: http.StatusOK,
+				expMerchants:  []string{"Monkey Business", "Refund"},
+			},
+		},
+		{
+			name: "ISO date and not in",
+			filterParams: FilterParameters{
+				query:         url.Values{"filter": {`dateTime >= "2020-04-26" and (currencyCode not in ("USD", "EUR"))`}},
+				expHTTPStatus: http.StatusOK,
+				expMerchants:  []string{"Dwelms en Dinges", "Refund"},
+			},
+		},
+		{
+			name: "Decimal amount",
+			filterParams: FilterParameters{
+				query:         url.Values{"filter": {`amount = 1250.5`}},
+				expHTTPStatus: http.StatusOK,
+				expMerchants:  []string{"Dwelms en Dinges"},
+			},
+		},
+		{
+			name: "Wrong value type",
+			filterParams: FilterParameters{
+				query:         url.Values{"filter": {`amount >= "lots"`}},
+				expHTTPStatus: http.StatusBadRequest,
+				expMessage:    "filter is invalid",
+				expFieldName:  "filter.amount",
+			},
+		},
+		{
+			name: "Unknown field",
+			filterParams: FilterParameters{
+				query:         url.Values{"filter": {`colour = "red"`}},
+				expHTTPStatus: http.StatusBadRequest,
+				expMessage:    "filter is invalid",
+				expFieldName:  "filter.colour",
+			},
+		},
+		{
+			name: "Unbalanced parentheses",
+			filterParams: FilterParameters{
+				query:         url.Values{"filter": {`(amount > 1 or amount < -1`}},
+				expHTTPStatus: http.StatusBadRequest,
+				expMessage:    "filter is invalid",
+				expFieldName:  "filter",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cl := new(http.Client)
+			callbacks := state.NewMockCallbacks(mailCallback)
+			state := facotory.NewForTesting(t, callbacks, seedUsers)
+			ctx := state.Context
+
+			gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+				authRequest: models.User{
+					Email:    "subzero@dreamrealm.com",
+					Password: "secret",
+				},
+				expHTTPStatus: http.StatusOK,
+				expLoginResp: AuthResponse{
+					Message: "Logged In",
+					Status:  true,
+				},
+			})
+
+			createImport(t, ctx, cl, state.URL, gotAuthResp, &CreateImportParameters{
+				query: url.Values{"format": {"csv"}},
+				file:  filterSeedCSV,
+				expResponse: ImportControllerResponse{
+					Message: "Statement imported",
+					Status:  true,
+					Import: models.Import{
+						Format:   "csv",
+						Parsed:   4,
+						Imported: 4,
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			})
+
+			filterCardTransactions(t, ctx, cl, state.URL, gotAuthResp, &test.filterParams)
+		})
+	}
+}
+
+func filterCardTransactions(t *testing.T, ctx context.Context, cl *http.Client,
+	url string, auth *AuthResponse, params *FilterParameters) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/me/card-transactions?"+params.query.Encode(), nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(struct {
+		GetCardTransactionControllerResponse
+		Fields []struct {
+			Name    string `json:"name"`
+			Message string `json:"message"`
+		} `json:"fields"`
+	})
+	err = json.Unmarshal(body, gotResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, params.expHTTPStatus, res.StatusCode)
+	if params.expHTTPStatus != http.StatusOK {
+		assert.Equal(t, params.expMessage, gotResp.Message)
+		require.Equal(t, 1, len(gotResp.Fields))
+		assert.Equal(t, params.expFieldName, gotResp.Fields[0].Name)
+		return
+	}
+
+	var gotMerchants []string
+	for _, cardTransaction := range gotResp.CardTransactions {
+		gotMerchants = append(gotMerchants, cardTransaction.MerchantName)
+	}
+	assert.Equal(t, params.expMerchants, gotMerchants)
+}
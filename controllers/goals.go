@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+func Goals(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getGoals(w, r, state)
+	case http.MethodPost:
+		return createGoal(w, r, state)
+	}
+
+	return nil
+}
+
+func Goal(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getGoal(w, r, state)
+	case http.MethodPut:
+		return updateGoal(w, r, state)
+	case http.MethodDelete:
+		return deleteGoal(w, r, state)
+	}
+
+	return nil
+}
+
+func getGoals(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := r.Context().Value(auth.UserKey).(int64)
+	goals, err := models.NewGoal(state).GetGoalsByUserID(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("goals", goals)
+	return resp.Respond(w)
+}
+
+func createGoal(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	goal := models.NewGoal(state)
+	err := json.NewDecoder(r.Body).Decode(goal)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := goal.CreateGoal(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("goal", data)
+	return resp.Respond(w)
+}
+
+func getGoal(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := models.NewGoal(state).GetGoal(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("goal", data)
+	return resp.Respond(w)
+}
+
+func updateGoal(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	goal := models.NewGoal(state)
+	err = json.NewDecoder(r.Body).Decode(goal)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := goal.UpdateGoal(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("goal", data)
+	return resp.Respond(w)
+}
+
+func deleteGoal(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewGoal(state).DeleteGoal(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	return resp.Respond(w)
+}
+
+// GetForecast projects the user's balance in the currencyCode query parameter
+// from the balance parameter, day by day until the until parameter.
+func GetForecast(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	query := r.URL.Query()
+	params := models.ForecastParameters{
+		Balance:      query.Get("balance"),
+		CurrencyCode: query.Get("currencyCode"),
+		Until:        query.Get("until"),
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	forecast, err := models.NewForecast(state).GetForecast(userID, params, time.Now())
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("forecast", forecast)
+	return resp.Respond(w)
+}
@@ -0,0 +1,188 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type GoalControllerResponse struct {
+	Message   string             `json:"message"`
+	Status    bool               `json:"status"`
+	Fields    []types.ErrorField `json:"fields"`
+	Goal      models.Goal        `json:"goal"`
+	Goals     []models.Goal      `json:"goals"`
+	CashFlow  models.CashFlow    `json:"cashFlow"`
+	CashFlows []models.CashFlow  `json:"cashFlows"`
+	Forecast  models.Forecast    `json:"forecast"`
+}
+
+func TestGoals(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	now := time.Now().UTC()
+	targetDate := time.Date(now.Year(), now.Month()+10, 1, 0, 0, 0, 0, time.UTC)
+	resp := goalRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/goals", map[string]interface{}{
+		"name":         "Holiday",
+		"targetAmount": map[string]interface{}{"value": 1200000, "scale": 2},
+		"savedAmount":  map[string]interface{}{"value": 20000, "scale": 1},
+		"currencyCode": "zar",
+		"targetDate":   targetDate,
+	}, http.StatusOK)
+	goal := resp.Goal
+	require.NotZero(t, goal.ID)
+	assert.Equal(t, "ZAR", goal.CurrencyCode)
+	assert.Equal(t, models.CurrencyValue{Value: 200000, Scale: 2}, goal.SavedAmount)
+	assert.Equal(t, 16, goal.Progress)
+	require.NotNil(t, goal.MonthlySavingRequired)
+	assert.Equal(t, models.CurrencyValue{Value: 100000, Scale: 2}, *goal.MonthlySavingRequired)
+
+	goalURL := state.URL + "/api/me/goals/" + strconv.FormatInt(goal.ID, 10)
+	resp = goalRequest(t, ctx, cl, gotAuthResp, http.MethodPut, goalURL, map[string]interface{}{
+		"name":         "Holiday",
+		"targetAmount": map[string]interface{}{"value": 1200000, "scale": 2},
+		"savedAmount":  map[string]interface{}{"value": 1300000, "scale": 2},
+		"currencyCode": "ZAR",
+	}, http.StatusOK)
+	assert.Equal(t, 100, resp.Goal.Progress)
+	assert.Nil(t, resp.Goal.MonthlySavingRequired)
+
+	resp = goalRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/goals", map[string]interface{}{
+		"targetAmount": map[string]interface{}{"value": -1, "scale": 2},
+		"currencyCode": "rand",
+	}, http.StatusBadRequest)
+	assert.Equal(t, "Goal is invalid", resp.Message)
+	assert.Len(t, resp.Fields, 3)
+
+	resp = goalRequest(t, ctx, cl, gotAuthResp, http.MethodGet, state.URL+"/api/me/goals", nil, http.StatusOK)
+	assert.Len(t, resp.Goals, 1)
+
+	goalRequest(t, ctx, cl, gotAuthResp, http.MethodDelete, goalURL, nil, http.StatusOK)
+	resp = goalRequest(t, ctx, cl, gotAuthResp, http.MethodGet, goalURL, nil, http.StatusNotFound)
+	assert.Equal(t, "Goal not found", resp.Message)
+}
+
+func TestForecast(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	now := time.Now().UTC()
+	tomorrow, dayAfter := now.AddDate(0, 0, 1), now.AddDate(0, 0, 2)
+	goalRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/cash-flows", map[string]interface{}{
+		"name":         "Salary",
+		"kind":         "income",
+		"amount":       map[string]interface{}{"value": 2000000, "scale": 2},
+		"currencyCode": "ZAR",
+		"dayOfMonth":   tomorrow.Day(),
+	}, http.StatusOK)
+	resp := goalRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/cash-flows", map[string]interface{}{
+		"name":         "Streaming",
+		"kind":         "PAYMENT",
+		"amount":       map[string]interface{}{"value": 15000, "scale": 2},
+		"currencyCode": "ZAR",
+		"dayOfMonth":   dayAfter.Day(),
+		"merchantName": "Netflix",
+	}, http.StatusOK)
+	assert.Equal(t, "Netflix", resp.CashFlow.MerchantName)
+
+	resp = goalRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/cash-flows", map[string]interface{}{
+		"name":       "Rent",
+		"kind":       "RENT",
+		"dayOfMonth": 32,
+	}, http.StatusBadRequest)
+	assert.Equal(t, "Cash flow is invalid", resp.Message)
+	assert.Len(t, resp.Fields, 4)
+
+	// Card spend of 900.00 over the last ninety days is 10.00 a day.  The
+	// recurring payment's merchant is not counted.
+	for _, transaction := range []struct {
+		merchantName string
+		cents        int64
+	}{{"Corner Cafe", 45000}, {"Corner Cafe", 45000}, {"NETFLIX", 15000}} {
+		createCardTransaction(t, ctx, cl, state.URL, gotAuthResp, &CreateCardTransactionParameters{
+			request: models.CardTransaction{
+				DateTime:     now.AddDate(0, 0, -10),
+				Amount:       models.CurrencyValue{Value: transaction.cents, Scale: 2},
+				CurrencyCode: "ZAR",
+				Reference:    "simulation",
+				MerchantName: transaction.merchantName,
+			},
+			expResponse: CreateCardTransactionControllerResponse{
+				Message:         "success",
+				Status:          true,
+				CardTransaction: models.CardTransaction{Amount: models.CurrencyValue{Value: transaction.cents, Scale: 2}},
+			},
+		})
+	}
+
+	query := url.Values{
+		"balance":      {"1000.5"},
+		"currencyCode": {"ZAR"},
+		"until":        {dayAfter.Format("2006-01-02")},
+	}
+	resp = goalRequest(t, ctx, cl, gotAuthResp, http.MethodGet, state.URL+"/api/me/forecast?"+query.Encode(), nil, http.StatusOK)
+	forecast := resp.Forecast
+	assert.Equal(t, models.CurrencyValue{Value: 100050, Scale: 2}, forecast.StartingBalance)
+	assert.Equal(t, models.CurrencyValue{Value: 1000, Scale: 2}, forecast.DiscretionaryDailySpend)
+	require.Len(t, forecast.Days, 3)
+	assert.Equal(t, now.Format("2006-01-02"), forecast.Days[0].Date)
+	assert.Equal(t, int64(100050), forecast.Days[0].Balance.Value)
+	assert.Equal(t, int64(2000000), forecast.Days[1].Income.Value)
+	assert.Equal(t, int64(2099050), forecast.Days[1].Balance.Value)
+	assert.Equal(t, int64(15000), forecast.Days[2].Payments.Value)
+	assert.Equal(t, int64(1000), forecast.Days[2].Discretionary.Value)
+	assert.Equal(t, int64(2083050), forecast.Days[2].Balance.Value)
+	assert.Equal(t, models.CurrencyValue{Value: 2083050, Scale: 2}, forecast.EndBalance)
+
+	resp = goalRequest(t, ctx, cl, gotAuthResp, http.MethodGet, state.URL+"/api/me/forecast?until=yesterday", nil, http.StatusBadRequest)
+	assert.Equal(t, "Forecast parameters are invalid", resp.Message)
+	assert.Len(t, resp.Fields, 2)
+}
+
+func goalRequest(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	method, url string, body interface{}, expHTTPStatus int) *GoalControllerResponse {
+	t.Helper()
+
+	gotResp := new(GoalControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+func Households(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getHouseholds(w, r, state)
+	case http.MethodPost:
+		return createHousehold(w, r, state)
+	}
+
+	return nil
+}
+
+func Household(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getHousehold(w, r, state)
+	case http.MethodDelete:
+		return deleteHousehold(w, r, state)
+	}
+
+	return nil
+}
+
+func getHouseholds(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := r.Context().Value(auth.UserKey).(int64)
+	households, err := models.NewHousehold(state).GetHouseholdsByUserID(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("households", households)
+	return resp.Respond(w)
+}
+
+func createHousehold(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	household := models.NewHousehold(state)
+	err := json.NewDecoder(r.Body).Decode(household)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := household.CreateHousehold(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("household", data)
+	return resp.Respond(w)
+}
+
+func getHousehold(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := models.NewHousehold(state).GetHousehold(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("household", data)
+	return resp.Respond(w)
+}
+
+func deleteHousehold(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewHousehold(state).DeleteHousehold(userID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	return resp.Respond(w)
+}
+
+// InviteToHousehold emails an invitation to the email address in the
+// request body.
+func InviteToHousehold(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	var invitation struct {
+		Email string `json:"email"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&invitation)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewHousehold(state).Invite(userID, id, invitation.Email)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	return resp.Respond(w)
+}
+
+// AcceptHouseholdInvitation adds the signed in user to the household of the
+// invitation in the path.
+func AcceptHouseholdInvitation(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := models.NewHousehold(state).AcceptInvitation(userID, mux.Vars(r)["token"])
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("household", data)
+	return resp.Respond(w)
+}
+
+// RemoveHouseholdMember lets a member leave the household, or its owner
+// remove them.
+func RemoveHouseholdMember(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+	memberID, err := pathID(r, "userID")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewHousehold(state).RemoveMember(userID, id, memberID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	return resp.Respond(w)
+}
+
+// SetHouseholdGrant gives the member in the path the access in the request
+// body to the signed in user's card transactions.
+func SetHouseholdGrant(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+	granteeID, err := pathID(r, "userID")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	var grant struct {
+		Access datalayer.HouseholdAccess `json:"access"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&grant)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := models.NewHousehold(state).SetGrant(userID, id, granteeID, grant.Access)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("household", data)
+	return resp.Respond(w)
+}
@@ -0,0 +1,198 @@
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type HouseholdControllerResponse struct {
+	Message          string                        `json:"message"`
+	Status           bool                          `json:"status"`
+	Fields           []types.ErrorField            `json:"fields"`
+	Household        models.Household              `json:"household"`
+	Households       []models.Household            `json:"households"`
+	CardTransaction  models.CardTransaction        `json:"cardTransaction"`
+	CardTransactions []models.CardTransaction      `json:"cardTransactions"`
+	Categories       []models.CategorySummary      `json:"categories"`
+	Splits           []models.CardTransactionSplit `json:"splits"`
+}
+
+func TestHouseholds(t *testing.T) {
+	cl := new(http.Client)
+	messages := make(chan string, 10)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		messages <- message
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers, confirmSeedUsers)
+	ctx := state.Context
+
+	subZero := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	reptile := householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+
+	resp := householdRequest(t, ctx, cl, subZero, http.MethodPost, state.URL+"/api/me/households", map[string]interface{}{
+		"name": "Dream Realm",
+	}, http.StatusOK)
+	household := resp.Household
+	require.Len(t, household.Members, 1)
+	subZeroID := household.Members[0].UserID
+	assert.Equal(t, subZeroID, household.OwnerUserID)
+	householdURL := fmt.Sprintf("%s/api/me/households/%d", state.URL, household.ID)
+
+	// Only members can see the household
+	householdRequest(t, ctx, cl, reptile, http.MethodGet, householdURL, nil, http.StatusNotFound)
+
+	householdRequest(t, ctx, cl, subZero, http.MethodPost, householdURL+"/invitations", map[string]interface{}{
+		"email": "reptile@netherrealm.com",
+	}, http.StatusOK)
+	var message string
+	select {
+	case message = <-messages:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "household invitation was not sent")
+	}
+	match := regexp.MustCompile(`https?://\S*/household-invitation\?token=([A-Za-z0-9_-]+)`).FindStringSubmatch(message)
+	require.Len(t, match, 2, message)
+	invitationURL := state.URL + "/api/me/household-invitations/" + match[1]
+	stored, err := state.DataLayer.GetHouseholdInvitationByTokenHash(match[1])
+	assert.Equal(t, datalayer.ErrNoData, err, "the token is stored hashed")
+	assert.Nil(t, stored)
+
+	// The invitation can only be accepted by the invitee, and only once
+	householdRequest(t, ctx, cl, subZero, http.MethodPost, invitationURL, nil, http.StatusNotFound)
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodPost, invitationURL, nil, http.StatusOK)
+	require.Len(t, resp.Household.Members, 2)
+	reptileID := resp.Household.Members[1].UserID
+	householdRequest(t, ctx, cl, reptile, http.MethodPost, invitationURL, nil, http.StatusConflict)
+
+	// Invitations expire
+	_, err = state.DataLayer.CreateHouseholdInvitation(&datalayer.HouseholdInvitation{
+		HouseholdID:     household.ID,
+		InvitedByUserID: subZeroID,
+		Email:           "reptile@netherrealm.com",
+		TokenHash:       hashToken("expired"),
+		ExpiresAt:       time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodPost, state.URL+"/api/me/household-invitations/expired", nil,
+		http.StatusGone)
+	assert.Equal(t, "Household invitation has expired", resp.Message)
+
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodPost, state.URL+"/api/card-transactions/new",
+		householdCardTransaction("Outworld Grill", 2500), http.StatusOK)
+	reptileTransactionID := resp.CardTransaction.ID
+	resp = householdRequest(t, ctx, cl, subZero, http.MethodPost, state.URL+"/api/card-transactions/new",
+		householdCardTransaction("Lin Kuei Temple", 7500), http.StatusOK)
+	subZeroTransactionID := resp.CardTransaction.ID
+
+	subZeroTransactionsURL := fmt.Sprintf("%s/api/me/card-transactions?owner=%d", state.URL, subZeroID)
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodGet, subZeroTransactionsURL, nil, http.StatusForbidden)
+	assert.Equal(t, "You do not have access to that user's card transactions", resp.Message)
+	householdRequest(t, ctx, cl, reptile, http.MethodGet,
+		fmt.Sprintf("%s/api/me/card-transactions/%d/splits", state.URL, subZeroTransactionID), nil, http.StatusNotFound)
+
+	// Read access shows the owner's transactions on their own or alongside
+	// the member's
+	resp = householdRequest(t, ctx, cl, subZero, http.MethodPut, fmt.Sprintf("%s/grants/%d", householdURL, reptileID),
+		map[string]interface{}{"access": "read"}, http.StatusOK)
+	require.Len(t, resp.Household.Grants, 1)
+	assert.Equal(t, models.HouseholdGrant{
+		GrantorUserID: subZeroID,
+		GranteeUserID: reptileID,
+		Access:        datalayer.HouseholdAccessRead,
+	}, *resp.Household.Grants[0])
+
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodGet, subZeroTransactionsURL, nil, http.StatusOK)
+	require.Len(t, resp.CardTransactions, 1)
+	assert.Equal(t, "Lin Kuei Temple", resp.CardTransactions[0].MerchantName)
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodGet, state.URL+"/api/me/card-transactions?owner=household", nil, http.StatusOK)
+	assert.Len(t, resp.CardTransactions, 2)
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodGet, state.URL+"/api/me/card-transactions/summary?owner=household", nil, http.StatusOK)
+	require.Len(t, resp.Categories, 1)
+	assert.Equal(t, int64(10000), resp.Categories[0].Amount.Value)
+	householdRequest(t, ctx, cl, reptile, http.MethodGet,
+		fmt.Sprintf("%s/api/me/card-transactions/%d/splits", state.URL, subZeroTransactionID), nil, http.StatusOK)
+
+	// The grant is one way
+	householdRequest(t, ctx, cl, subZero, http.MethodGet,
+		fmt.Sprintf("%s/api/me/card-transactions?owner=%d", state.URL, reptileID), nil, http.StatusForbidden)
+	householdRequest(t, ctx, cl, subZero, http.MethodGet,
+		fmt.Sprintf("%s/api/me/card-transactions/%d/splits", state.URL, reptileTransactionID), nil, http.StatusNotFound)
+
+	// Writing on the owner's behalf needs read-write access
+	createURL := fmt.Sprintf("%s/api/card-transactions/new?owner=%d", state.URL, subZeroID)
+	householdRequest(t, ctx, cl, reptile, http.MethodPost, createURL, householdCardTransaction("Shirai Ryu Market", 1200), http.StatusForbidden)
+	householdRequest(t, ctx, cl, reptile, http.MethodPut,
+		fmt.Sprintf("%s/api/me/card-transactions/%d/splits", state.URL, subZeroTransactionID),
+		map[string]interface{}{"splits": []interface{}{}}, http.StatusNotFound)
+	householdRequest(t, ctx, cl, subZero, http.MethodPut, fmt.Sprintf("%s/grants/%d", householdURL, reptileID),
+		map[string]interface{}{"access": "READ_WRITE"}, http.StatusOK)
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodPost, createURL, householdCardTransaction("Shirai Ryu Market", 1200), http.StatusOK)
+	assert.Equal(t, subZeroID, resp.CardTransaction.UserID)
+	resp = householdRequest(t, ctx, cl, subZero, http.MethodGet, state.URL+"/api/me/card-transactions", nil, http.StatusOK)
+	assert.Len(t, resp.CardTransactions, 2)
+
+	// Only the owner may remove other members, and leaving withdraws grants
+	householdRequest(t, ctx, cl, reptile, http.MethodDelete, fmt.Sprintf("%s/members/%d", householdURL, subZeroID), nil, http.StatusForbidden)
+	householdRequest(t, ctx, cl, reptile, http.MethodDelete, householdURL, nil, http.StatusForbidden)
+	householdRequest(t, ctx, cl, reptile, http.MethodDelete, fmt.Sprintf("%s/members/%d", householdURL, reptileID), nil, http.StatusOK)
+	householdRequest(t, ctx, cl, reptile, http.MethodGet, subZeroTransactionsURL, nil, http.StatusForbidden)
+	resp = householdRequest(t, ctx, cl, reptile, http.MethodGet, state.URL+"/api/me/households", nil, http.StatusOK)
+	assert.Empty(t, resp.Households)
+
+	householdRequest(t, ctx, cl, subZero, http.MethodDelete, householdURL, nil, http.StatusOK)
+	householdRequest(t, ctx, cl, subZero, http.MethodGet, householdURL, nil, http.StatusNotFound)
+}
+
+func confirmSeedUsers(t *testing.T, dl datalayer.DataLayer) {
+	t.Helper()
+	user, err := dl.GetUserByEmail("reptile@netherrealm.com")
+	require.NoError(t, err)
+	require.NoError(t, dl.SetUserStateByID(user.ID, datalayer.UserStateConfirmed))
+}
+
+func householdLogin(t *testing.T, ctx context.Context, cl *http.Client, url, email string) *AuthResponse {
+	t.Helper()
+	return login(t, ctx, cl, url, AuthParameters{
+		authRequest: models.User{
+			Email:    email,
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+}
+
+func householdCardTransaction(merchantName string, cents int64) models.CardTransaction {
+	return models.CardTransaction{
+		DateTime:             time.Date(2020, 04, 25, 9, 30, 0, 0, time.UTC),
+		Amount:               models.CurrencyValue{Value: cents, Scale: 2},
+		CurrencyCode:         "ZAR",
+		Reference:            "simulation",
+		MerchantName:         merchantName,
+		MerchantCategoryName: "Dining",
+	}
+}
+
+func householdRequest(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	method, url string, body interface{}, expHTTPStatus int) *HouseholdControllerResponse {
+	t.Helper()
+
+	gotResp := new(HouseholdControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/lib/statement"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// maxImportSize bounds the statement upload.
+const maxImportSize = 20 << 20
+
+// CreateImport streams a CSV, OFX or QIF statement into the user's card
+// transactions.  The statement is either the raw request body or the "file"
+// part of a multipart form; options are passed as query parameters.
+func CreateImport(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	queryParams := r.URL.Query()
+	imp := models.NewImport(state)
+	imp.CurrencyCode = queryParams.Get("currencyCode")
+
+	if _, ok := queryParams["dryRun"]; ok {
+		dryRun, err := strconv.ParseBool(queryParams.Get("dryRun"))
+		if err != nil {
+			err := e.NewError("Invalid import options", []types.ErrorField{
+				{Name: "dryRun", Message: "must be true or false"},
+			}, http.StatusBadRequest)
+			e.WriteError(w, err)
+			return err
+		}
+		imp.DryRun = dryRun
+	}
+
+	mapping := statement.DefaultColumnMapping
+	if _, ok := queryParams["mapping"]; ok {
+		mapping = statement.ColumnMapping{}
+		err := json.Unmarshal([]byte(queryParams.Get("mapping")), &mapping)
+		if err != nil {
+			err := e.NewError("Invalid import options", []types.ErrorField{
+				{Name: "mapping", Message: "mapping must be a JSON object of field to column name"},
+			}, http.StatusBadRequest)
+			e.WriteError(w, err)
+			return err
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, fileName, err := importFile(r)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	imp.Format, err = models.ParseImportFormat(queryParams.Get("format"), fileName)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	reader, err := imp.OpenStatement(file, mapping)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = imp.Run(userID, reader)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	message := "Statement imported"
+	if imp.DryRun {
+		message = "Statement import preview"
+	}
+	resp := response.New(true, message)
+	resp.Set("import", imp)
+	return resp.Respond(w)
+}
+
+// importFile locates the statement in the request without buffering it.
+func importFile(r *http.Request) (io.Reader, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return r.Body, "", nil
+	}
+
+	multipartReader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", e.Wrap("Invalid multipart request", http.StatusBadRequest, err)
+	}
+
+	for {
+		part, err := multipartReader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, "", e.Wrap("Invalid multipart request", http.StatusBadRequest, err)
+		}
+
+		if part.FormName() == "file" {
+			return part, part.FileName(), nil
+		}
+	}
+
+	return nil, "", e.NewError("Statement file is required", []types.ErrorField{
+		{Name: "file", Message: "a multipart part named 'file' is required"},
+	}, http.StatusBadRequest)
+}
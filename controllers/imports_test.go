@@ -0,0 +1,243 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ImportControllerResponse struct {
+	Message string        `json:"message"`
+	Status  bool          `json:"status"`
+	Import  models.Import `json:"import"`
+}
+
+type CreateImportParameters struct {
+	query         url.Values
+	fileName      string
+	file          string
+	expResponse   ImportControllerResponse
+	expPreview    int
+	expHTTPStatus int
+}
+
+const importCSV = `Date,Description,Amount,Currency,Category
+2020-04-25,The Coders Bakery,-100.00,ZAR,Bakeries
+2020-04-26,Dwelms en Dinges,"-1,250.50",ZAR,Contraband
+not a date,Broken Row,-1.00,ZAR,Errors
+`
+
+const importQIF = `!Type:Bank
+D04/25/2020
+T-100.00
+PThe Coders Bakery
+LBakeries
+^
+D04/25/2020
+T-100.00
+PThe Coders Bakery
+LBakeries
+^
+`
+
+const importOFX = `OFXHEADER:100
+DATA:OFXSGML
+
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>ZAR
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT
+<DTPOSTED>20200425113941
+<TRNAMT>-50.00
+<FITID>201
+<NAME>The Coders Bakery
+</STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>
+`
+
+func TestCreateImport(t *testing.T) {
+	csvMapping := `{"dateTime":"date","amount":"amount","merchantName":"description","currencyCode":"currency","merchantCategoryName":"category"}`
+
+	tests := []struct {
+		name         string
+		importParams CreateImportParameters
+		expStored    int
+	}{
+		{
+			name: "CSV dry run",
+			importParams: CreateImportParameters{
+				query: url.Values{"format": {"csv"}, "dryRun": {"true"}, "mapping": {csvMapping}},
+				file:  importCSV,
+				expResponse: ImportControllerResponse{
+					Message: "Statement import preview",
+					Status:  true,
+					Import: models.Import{
+						Format:   "csv",
+						DryRun:   true,
+						Parsed:   2,
+						Imported: 2,
+						Failed:   1,
+					},
+				},
+				expPreview:    2,
+				expHTTPStatus: http.StatusOK,
+			},
+			expStored: 0,
+		},
+		{
+			name: "QIF with duplicates",
+			importParams: CreateImportParameters{
+				query:    url.Values{"currencyCode": {"ZAR"}},
+				fileName: "statement.qif",
+				file:     importQIF,
+				expResponse: ImportControllerResponse{
+					Message: "Statement imported",
+					Status:  true,
+					Import: models.Import{
+						Format:       "qif",
+						CurrencyCode: "ZAR",
+						Parsed:       2,
+						Imported:     1,
+						Duplicates:   1,
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			},
+			expStored: 1,
+		},
+		{
+			name: "OFX upload",
+			importParams: CreateImportParameters{
+				fileName: "statement.ofx",
+				file:     importOFX,
+				expResponse: ImportControllerResponse{
+					Message: "Statement imported",
+					Status:  true,
+					Import: models.Import{
+						Format:   "ofx",
+						Parsed:   1,
+						Imported: 1,
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			},
+			expStored: 1,
+		},
+		{
+			name: "Unknown format",
+			importParams: CreateImportParameters{
+				query: url.Values{"format": {"xls"}},
+				file:  importCSV,
+				expResponse: ImportControllerResponse{
+					Message: "Unsupported statement format",
+					Status:  false,
+				},
+				expHTTPStatus: http.StatusBadRequest,
+			},
+			expStored: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cl := new(http.Client)
+			callbacks := state.NewMockCallbacks(mailCallback)
+			state := facotory.NewForTesting(t, callbacks, seedUsers)
+			ctx := state.Context
+
+			gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+				authRequest: models.User{
+					Email:    "subzero@dreamrealm.com",
+					Password: "secret",
+				},
+				expHTTPStatus: http.StatusOK,
+				expLoginResp: AuthResponse{
+					Message: "Logged In",
+					Status:  true,
+				},
+			})
+
+			createImport(t, ctx, cl, state.URL, gotAuthResp, &test.importParams)
+
+			assert.Equal(t, test.expStored, countCardTransactions(t, ctx, cl, state.URL, gotAuthResp))
+		})
+	}
+}
+
+func createImport(t *testing.T, ctx context.Context, cl *http.Client,
+	url string, auth *AuthResponse, params *CreateImportParameters) {
+	t.Helper()
+
+	var body io.Reader = bytes.NewBufferString(params.file)
+	contentType := "text/plain"
+	if len(params.fileName) > 0 {
+		buf := new(bytes.Buffer)
+		form := multipart.NewWriter(buf)
+		part, err := form.CreateFormFile("file", params.fileName)
+		require.NoError(t, err)
+		_, err = part.Write([]byte(params.file))
+		require.NoError(t, err)
+		require.NoError(t, form.Close())
+		body = buf
+		contentType = form.FormDataContentType()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/api/me/imports?"+params.query.Encode(), body)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(ImportControllerResponse)
+	err = json.Unmarshal(b, gotResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, params.expHTTPStatus, res.StatusCode)
+	assert.Equal(t, params.expResponse.Status, gotResp.Status)
+	assert.Equal(t, params.expResponse.Message, gotResp.Message)
+	if params.expHTTPStatus != http.StatusOK {
+		return
+	}
+
+	got := gotResp.Import
+	assert.Equal(t, params.expPreview, len(got.Preview))
+	assert.Equal(t, params.expResponse.Import.Failed, len(got.Errors))
+	got.Preview = nil
+	got.Errors = nil
+	assert.Equal(t, params.expResponse.Import, got)
+}
+
+func countCardTransactions(t *testing.T, ctx context.Context, cl *http.Client, url string, auth *AuthResponse) int {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/me/card-transactions?count=100", nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(GetCardTransactionControllerResponse)
+	err = json.Unmarshal(body, gotResp)
+	require.NoError(t, err)
+	require.True(t, gotResp.Status)
+
+	return len(gotResp.CardTransactions)
+}
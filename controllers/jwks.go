@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// jwksMaxAge is how long, in seconds, verifiers may cache the key set.  Keys
+// are published before they sign anything, so it only needs to be shorter
+// than the notice given of a rotation.
+const jwksMaxAge = "300"
+
+// GetJWKS publishes the public keys that tokens are signed with, in the
+// standard JWKS form rather than the usual response envelope, so that other
+// services can verify tokens.
+func GetJWKS(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+jwksMaxAge)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	return json.NewEncoder(w).Encode(state.Keys.JWKS())
+}
@@ -0,0 +1,47 @@
+package controllers_test
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/donohutcheon/gowebserver/lib/signing"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKS(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, state.URL+"/.well-known/jwks.json", nil)
+	require.NoError(t, err)
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "public, max-age=300", res.Header.Get("Cache-Control"))
+
+	jwks := new(signing.JSONWebKeySet)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(jwks))
+	require.Len(t, jwks.Keys, 1)
+	jwk := jwks.Keys[0]
+	assert.Equal(t, "OKP", jwk.KeyType)
+	assert.Equal(t, "EdDSA", jwk.Algorithm)
+
+	// Another service verifies tokens with nothing but the published key
+	auth := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	_, err = jwt.Parse(auth.Token.AccessToken, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, jwk.ID, token.Header["kid"])
+		assert.Equal(t, jwk.Algorithm, token.Method.Alg())
+		x, err := jwt.DecodeSegment(jwk.X)
+		return ed25519.PublicKey(x), err
+	})
+	assert.NoError(t, err)
+}
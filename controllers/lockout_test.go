@@ -0,0 +1,140 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/lockout"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginLockout(t *testing.T) {
+	cl := new(http.Client)
+	emails := make(chan sentEmail, 10)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		emails <- sentEmail{to: to[0], subject: subject, message: message}
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers, confirmSeedUsers)
+	ctx := state.Context
+	loginURL := state.URL + "/api/auth/login"
+	throttled := "Too many failed login attempts, try again in "
+
+	admin := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+
+	// A few failures are free, after which attempts have to wait, whatever
+	// the password
+	for i := 0; i < lockout.AccountPolicy.FreeAttempts+1; i++ {
+		resp, _ := loginAttempt(t, ctx, cl, loginURL, "reptile@netherrealm.com", "guess", "", http.StatusForbidden)
+		assert.Equal(t, "Invalid login credentials", resp.Message)
+	}
+	resp, header := loginAttempt(t, ctx, cl, loginURL, "Reptile@NetherRealm.com", "secret", "", http.StatusTooManyRequests)
+	assert.Equal(t, throttled+"1 seconds", resp.Message)
+	assert.Equal(t, "1", header.Get("Retry-After"))
+	assert.Empty(t, resp.Token.AccessToken)
+	time.Sleep(time.Second)
+	loginAttempt(t, ctx, cl, loginURL, "reptile@netherrealm.com", "secret", "", http.StatusOK)
+
+	// Accounts without an owner are held back alike
+	for i := 0; i < lockout.AccountPolicy.FreeAttempts+1; i++ {
+		loginAttempt(t, ctx, cl, loginURL, "kano@outworld.com", "guess", "", http.StatusForbidden)
+	}
+	loginAttempt(t, ctx, cl, loginURL, "kano@outworld.com", "guess", "", http.StatusTooManyRequests)
+
+	// The last failure before the limit locks the account and tells its owner
+	require.NoError(t, state.DataLayer.SaveLoginAttempt(&datalayer.LoginAttempt{
+		AttemptKey:    lockout.AccountKey("reptile@netherrealm.com"),
+		Failures:      lockout.AccountPolicy.LockAfter - 1,
+		LastFailureAt: datalayer.JsonNullTime{NullTime: sql.NullTime{Time: time.Now().UTC(), Valid: true}},
+	}))
+	loginAttempt(t, ctx, cl, loginURL, "reptile@netherrealm.com", "guess", "", http.StatusForbidden)
+	resp, header = loginAttempt(t, ctx, cl, loginURL, "reptile@netherrealm.com", "secret", "", http.StatusTooManyRequests)
+	assert.Contains(t, resp.Message, throttled)
+	retryAfter, err := strconv.Atoi(header.Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, lockout.AccountPolicy.LockFor.Seconds(), retryAfter, 5)
+	email := receiveEmail(t, emails)
+	assert.Equal(t, "reptile@netherrealm.com", email.to)
+	assert.Equal(t, "Your account has been locked", email.subject)
+	assert.Contains(t, email.message, "too many failed logins")
+
+	// The lockout is kept in the database, so a restarted server holds to it
+	wait, err := lockout.New(state.DataLayer).Wait("reptile@netherrealm.com", "")
+	require.NoError(t, err)
+	assert.Greater(t, int64(wait), int64(lockout.AccountPolicy.LockFor-time.Minute))
+
+	// Administrators see the lockout and can end it
+	reptile, err := state.DataLayer.GetUserByEmail("reptile@netherrealm.com")
+	require.NoError(t, err)
+	userURL := state.URL + "/api/admin/users/" + strconv.FormatInt(reptile.ID, 10)
+	adminResp := adminRequest(t, ctx, cl, admin, http.MethodGet, userURL, nil, http.StatusOK)
+	require.NotNil(t, adminResp.User.LockedUntil)
+	assert.True(t, adminResp.User.LockedUntil.After(time.Now().Add(lockout.AccountPolicy.LockFor-time.Minute)))
+	adminResp = adminRequest(t, ctx, cl, admin, http.MethodPost, userURL+"/unlock", nil, http.StatusOK)
+	assert.Equal(t, "User has been unlocked", adminResp.Message)
+	assert.Nil(t, adminResp.User.LockedUntil)
+	loginAttempt(t, ctx, cl, loginURL, "reptile@netherrealm.com", "secret", "", http.StatusOK)
+	adminResp = adminRequest(t, ctx, cl, admin, http.MethodGet, userURL+"/audit", nil, http.StatusOK)
+	require.NotEmpty(t, adminResp.Audit)
+	assert.Equal(t, "LOGIN_UNLOCKED", adminResp.Audit[0].Action)
+
+	reptileSession := householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+	adminRequest(t, ctx, cl, reptileSession, http.MethodPost, userURL+"/unlock", nil, http.StatusForbidden)
+
+	// Guessing across accounts from one address locks the address out.
+	// Behind a proxy, the address is the last in X-Forwarded-For
+	state.BehindProxy = true
+	require.NoError(t, state.DataLayer.SaveLoginAttempt(&datalayer.LoginAttempt{
+		AttemptKey:    lockout.IPKey("203.0.113.7"),
+		Failures:      lockout.IPPolicy.LockAfter - 1,
+		LastFailureAt: datalayer.JsonNullTime{NullTime: sql.NullTime{Time: time.Now().UTC(), Valid: true}},
+	}))
+	loginAttempt(t, ctx, cl, loginURL, "shao.kahn@outworld.com", "guess", "10.0.0.1, 203.0.113.7", http.StatusForbidden)
+	loginAttempt(t, ctx, cl, loginURL, "subzero@dreamrealm.com", "secret", "203.0.113.7", http.StatusTooManyRequests)
+	loginAttempt(t, ctx, cl, loginURL, "subzero@dreamrealm.com", "secret", "198.51.100.2", http.StatusOK)
+
+	// Otherwise the header is ignored, so it can neither get around the
+	// lockout of the address connected from nor lock out another
+	state.BehindProxy = false
+	loginAttempt(t, ctx, cl, loginURL, "subzero@dreamrealm.com", "secret", "203.0.113.7", http.StatusOK)
+	for _, ip := range []string{"127.0.0.1", "::1"} {
+		require.NoError(t, state.DataLayer.SaveLoginAttempt(&datalayer.LoginAttempt{
+			AttemptKey:    lockout.IPKey(ip),
+			Failures:      lockout.IPPolicy.LockAfter,
+			LastFailureAt: datalayer.JsonNullTime{NullTime: sql.NullTime{Time: time.Now().UTC(), Valid: true}},
+			BlockedUntil:  datalayer.JsonNullTime{NullTime: sql.NullTime{Time: time.Now().UTC().Add(time.Hour), Valid: true}},
+		}))
+	}
+	loginAttempt(t, ctx, cl, loginURL, "subzero@dreamrealm.com", "secret", "198.51.100.2", http.StatusTooManyRequests)
+}
+
+func loginAttempt(t *testing.T, ctx context.Context, cl *http.Client, url, email, password, forwardedFor string,
+	expHTTPStatus int) (*AuthResponse, http.Header) {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]string{"email": email, "password": password})
+	require.NoError(t, err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	require.NoError(t, err)
+	if len(forwardedFor) > 0 {
+		req.Header.Add("X-Forwarded-For", forwardedFor)
+	}
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, expHTTPStatus, res.StatusCode, email)
+	gotResp := new(AuthResponse)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(gotResp))
+	return gotResp, res.Header
+}
@@ -0,0 +1,105 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type LogoutControllerResponse struct {
+	Message  string `json:"message"`
+	Status   bool   `json:"status"`
+	APIToken struct {
+		Token string `json:"token"`
+	} `json:"apiToken"`
+}
+
+func TestLogout(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers, confirmSeedUsers)
+	ctx := state.Context
+	currentUserURL := state.URL + "/api/users/current"
+	logoutURL := state.URL + "/api/auth/logout"
+
+	first := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	second := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	firstClaims := tokenClaims(t, first.Token.AccessToken)
+	assert.NotEmpty(t, firstClaims.Id)
+	assert.NotEmpty(t, firstClaims.SessionID)
+	assert.Equal(t, firstClaims.SessionID, tokenClaims(t, first.Token.RefreshToken).SessionID)
+	assert.NotEqual(t, firstClaims.Id, tokenClaims(t, first.Token.RefreshToken).Id)
+	assert.NotEqual(t, firstClaims.SessionID, tokenClaims(t, second.Token.AccessToken).SessionID)
+
+	// Refreshed tokens stay in the session they came from
+	refreshed := refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: first.Token.RefreshToken,
+		},
+		expHTTPStatus: http.StatusOK,
+		expResponse:   AuthResponse{Message: "Tokens refreshed", Status: true},
+	})
+	assert.Equal(t, firstClaims.SessionID, tokenClaims(t, refreshed.Token.AccessToken).SessionID)
+
+	// Logging out ends the whole session, and only that session
+	resp := logoutRequest(t, ctx, cl, refreshed.Token.AccessToken, http.MethodPost, logoutURL, nil, http.StatusOK)
+	assert.Equal(t, "Logged out", resp.Message)
+	resp = logoutRequest(t, ctx, cl, first.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusForbidden)
+	assert.Equal(t, "Token has been revoked", resp.Message)
+	logoutRequest(t, ctx, cl, refreshed.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusForbidden)
+	refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: refreshed.Token.RefreshToken,
+		},
+		expHTTPStatus: http.StatusUnauthorized,
+		expResponse:   AuthResponse{Message: "Refresh token has been revoked"},
+	})
+	logoutRequest(t, ctx, cl, second.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusOK)
+
+	// Logging out of every session also ends API tokens and other sessions
+	resp = logoutRequest(t, ctx, cl, second.Token.AccessToken, http.MethodPost, state.URL+"/api/me/api-tokens",
+		map[string]interface{}{"name": "Logout", "scopes": []string{"profile:read"}}, http.StatusOK)
+	apiToken := resp.APIToken.Token
+	require.NotEmpty(t, apiToken)
+	logoutRequest(t, ctx, cl, apiToken, http.MethodGet, currentUserURL, nil, http.StatusOK)
+	reptile := householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+
+	third := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	logoutRequest(t, ctx, cl, third.Token.AccessToken, http.MethodPost, logoutURL,
+		map[string]bool{"allSessions": true}, http.StatusOK)
+	for _, token := range []string{apiToken, second.Token.AccessToken, third.Token.AccessToken} {
+		logoutRequest(t, ctx, cl, token, http.MethodGet, currentUserURL, nil, http.StatusForbidden)
+	}
+	logoutRequest(t, ctx, cl, reptile.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusOK)
+
+	// Tokens issued straight after the logout are good
+	fourth := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	logoutRequest(t, ctx, cl, fourth.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusOK)
+
+	// Tokens of disabled users are refused at once
+	adminRequest(t, ctx, cl, fourth, http.MethodPut, state.URL+"/api/admin/users/17/state",
+		map[string]string{"state": "DISABLED"}, http.StatusOK)
+	logoutRequest(t, ctx, cl, reptile.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusForbidden)
+
+	// and stay refused once they are enabled again
+	adminRequest(t, ctx, cl, fourth, http.MethodPut, state.URL+"/api/admin/users/17/state",
+		map[string]string{"state": "CONFIRMED"}, http.StatusOK)
+	logoutRequest(t, ctx, cl, reptile.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusForbidden)
+}
+
+func logoutRequest(t *testing.T, ctx context.Context, cl *http.Client, token string,
+	method, url string, body interface{}, expHTTPStatus int) *LogoutControllerResponse {
+	t.Helper()
+
+	gotResp := new(LogoutControllerResponse)
+	apiRequest(t, ctx, cl, token, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
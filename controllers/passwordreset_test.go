@@ -0,0 +1,101 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type resetEmail struct {
+	to    string
+	token string
+}
+
+func TestPasswordReset(t *testing.T) {
+	cl := new(http.Client)
+	emails := make(chan resetEmail, 10)
+	tokenPattern := regexp.MustCompile(`reset-password\?token=([0-9a-f]+)`)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		if subject != "Reset your password" {
+			return
+		}
+		match := tokenPattern.FindStringSubmatch(message)
+		require.Len(t, match, 2)
+		emails <- resetEmail{to: to[0], token: match[1]}
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers, confirmSeedUsers)
+	ctx := state.Context
+	resetURL := state.URL + "/api/auth/password-reset"
+	confirmURL := resetURL + "/confirm"
+	sent := "If the address has an account, a password reset link has been sent to it"
+
+	session := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+
+	// Addresses without an account get the same answer but no email
+	resp := logoutRequest(t, ctx, cl, "", http.MethodPost, resetURL, map[string]string{"email": "nobody"},
+		http.StatusBadRequest)
+	assert.Equal(t, "Email address is required", resp.Message)
+	resp = logoutRequest(t, ctx, cl, "", http.MethodPost, resetURL, map[string]string{"email": "kano@outworld.com"},
+		http.StatusOK)
+	assert.Equal(t, sent, resp.Message)
+	resp = logoutRequest(t, ctx, cl, "", http.MethodPost, resetURL,
+		map[string]string{"email": "subzero@dreamrealm.com"}, http.StatusOK)
+	assert.Equal(t, sent, resp.Message)
+	email := receiveResetEmail(t, emails)
+	assert.Equal(t, "subzero@dreamrealm.com", email.to)
+
+	// Asking again straight away sends nothing more
+	logoutRequest(t, ctx, cl, "", http.MethodPost, resetURL, map[string]string{"email": "subzero@dreamrealm.com"},
+		http.StatusOK)
+	logoutRequest(t, ctx, cl, "", http.MethodPost, resetURL, map[string]string{"email": "reptile@netherrealm.com"},
+		http.StatusOK)
+	assert.Equal(t, "reptile@netherrealm.com", receiveResetEmail(t, emails).to)
+
+	resp = logoutRequest(t, ctx, cl, "", http.MethodPost, confirmURL,
+		map[string]string{"token": email.token, "password": "ice"}, http.StatusBadRequest)
+	assert.Equal(t, "Password is required", resp.Message)
+	resp = logoutRequest(t, ctx, cl, "", http.MethodPost, confirmURL,
+		map[string]string{"token": "0123456789abcdef", "password": "frozen"}, http.StatusBadRequest)
+	assert.Equal(t, "Password reset link is invalid or has expired", resp.Message)
+
+	// Resetting logs the user out everywhere and the link works only once
+	resp = logoutRequest(t, ctx, cl, "", http.MethodPost, confirmURL,
+		map[string]string{"token": email.token, "password": "frozen"}, http.StatusOK)
+	assert.Equal(t, "Password has been reset", resp.Message)
+	resp = logoutRequest(t, ctx, cl, session.Token.AccessToken, http.MethodGet, state.URL+"/api/users/current", nil,
+		http.StatusForbidden)
+	assert.Equal(t, "Token has been revoked", resp.Message)
+	logoutRequest(t, ctx, cl, "", http.MethodPost, confirmURL,
+		map[string]string{"token": email.token, "password": "again!"}, http.StatusBadRequest)
+
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   models.User{Email: "subzero@dreamrealm.com", Password: "secret"},
+		expHTTPStatus: http.StatusForbidden,
+		expLoginResp:  AuthResponse{Message: "Invalid login credentials"},
+	})
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   models.User{Email: "subzero@dreamrealm.com", Password: "frozen"},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+	})
+}
+
+func receiveResetEmail(t *testing.T, emails chan resetEmail) resetEmail {
+	t.Helper()
+
+	select {
+	case email := <-emails:
+		return email
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "password reset email was not sent")
+	}
+	return resetEmail{}
+}
@@ -0,0 +1,64 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+	currentUserURL := state.URL + "/api/users/current"
+	refresh := func(refreshToken string, expHTTPStatus int, expMessage string) *AuthResponse {
+		t.Helper()
+		return exchangeRefreshToken(t, ctx, cl, state.URL, refreshToken, expHTTPStatus, expMessage)
+	}
+
+	first := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	other := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	assert.Equal(t, "access", tokenClaims(t, first.Token.AccessToken).Type)
+	assert.Equal(t, "refresh", tokenClaims(t, first.Token.RefreshToken).Type)
+
+	// Tokens are only accepted where their type belongs
+	resp := logoutRequest(t, ctx, cl, first.Token.RefreshToken, http.MethodGet, currentUserURL, nil, http.StatusForbidden)
+	assert.Equal(t, "Token rejected, only access and API tokens authenticate requests", resp.Message)
+	refresh(first.Token.AccessToken, http.StatusUnauthorized, "token is not a refresh token")
+	refresh("garbage", http.StatusUnauthorized, "Token rejected")
+
+	// Each refresh token is exchanged once for the next in its family
+	second := refresh(first.Token.RefreshToken, http.StatusOK, "Tokens refreshed")
+	third := refresh(second.Token.RefreshToken, http.StatusOK, "Tokens refreshed")
+	logoutRequest(t, ctx, cl, third.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusOK)
+
+	// Reusing an exchanged refresh token revokes the whole family
+	refresh(first.Token.RefreshToken, http.StatusUnauthorized,
+		"Refresh token has already been used, the session has been revoked")
+	refresh(third.Token.RefreshToken, http.StatusUnauthorized, "Refresh token has been revoked")
+	logoutRequest(t, ctx, cl, third.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusForbidden)
+
+	// Other sessions are unaffected
+	logoutRequest(t, ctx, cl, other.Token.AccessToken, http.MethodGet, currentUserURL, nil, http.StatusOK)
+	refresh(other.Token.RefreshToken, http.StatusOK, "Tokens refreshed")
+}
+
+// exchangeRefreshToken exchanges a refresh token, expecting the given outcome.
+func exchangeRefreshToken(t *testing.T, ctx context.Context, cl *http.Client, url, token string, expHTTPStatus int,
+	expMessage string) *AuthResponse {
+	t.Helper()
+	return refreshToken(t, ctx, cl, url, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: token,
+		},
+		expHTTPStatus: expHTTPStatus,
+		expResponse:   AuthResponse{Message: expMessage, Status: expHTTPStatus == http.StatusOK},
+	})
+}
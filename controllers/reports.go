@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+func ReportPreferences(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodGet:
+		return getReportPreferences(w, r, state)
+	case http.MethodPut:
+		return updateReportPreferences(w, r, state)
+	}
+
+	return nil
+}
+
+func getReportPreferences(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := r.Context().Value(auth.UserKey).(int64)
+	preferences, err := models.NewReportPreferences(state).GetReportPreferences(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("reportPreferences", preferences)
+	return resp.Respond(w)
+}
+
+func updateReportPreferences(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	preferences := models.NewReportPreferences(state)
+	err := json.NewDecoder(r.Body).Decode(preferences)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := preferences.UpdateReportPreferences(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("reportPreferences", data)
+	return resp.Respond(w)
+}
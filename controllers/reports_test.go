@@ -0,0 +1,213 @@
+package controllers_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/provider/mail"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ReportControllerResponse struct {
+	Message           string                   `json:"message"`
+	Status            bool                     `json:"status"`
+	Fields            []types.ErrorField       `json:"fields"`
+	ReportPreferences models.ReportPreferences `json:"reportPreferences"`
+}
+
+type sentMail struct {
+	to      []string
+	subject string
+	message string
+}
+
+func TestReports(t *testing.T) {
+	cl := new(http.Client)
+	mails := make(chan sentMail, 10)
+	callbacks := state.NewMockCallbacks(func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		mails <- sentMail{to: to, subject: subject, message: message}
+	})
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	preferencesURL := state.URL + "/api/me/report-preferences"
+
+	// Users are not sent reports until they opt in
+	gotResp := reportRequest(t, ctx, cl, gotAuthResp, http.MethodGet, preferencesURL, nil, http.StatusOK)
+	assert.Equal(t, datalayer.ReportCadenceNone, gotResp.ReportPreferences.Cadence)
+	assert.Equal(t, "UTC", gotResp.ReportPreferences.Timezone)
+	assert.False(t, gotResp.ReportPreferences.NextReportAt.Valid)
+
+	gotResp = reportRequest(t, ctx, cl, gotAuthResp, http.MethodPut, preferencesURL, map[string]interface{}{
+		"cadence":  "daily",
+		"timezone": "Mars/Olympus_Mons",
+	}, http.StatusBadRequest)
+	assert.Equal(t, "Report preferences are invalid", gotResp.Message)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "cadence", Message: "must be NONE, WEEKLY or MONTHLY"},
+		{Name: "timezone", Message: "must be a timezone such as Africa/Johannesburg"},
+	}, gotResp.Fields)
+
+	// Weekly reports are sent at eight on Monday morning local time
+	gotResp = reportRequest(t, ctx, cl, gotAuthResp, http.MethodPut, preferencesURL, map[string]interface{}{
+		"cadence":  "weekly",
+		"timezone": "Africa/Johannesburg",
+	}, http.StatusOK)
+	assert.Equal(t, datalayer.ReportCadenceWeekly, gotResp.ReportPreferences.Cadence)
+	require.True(t, gotResp.ReportPreferences.NextReportAt.Valid)
+	loc, err := time.LoadLocation("Africa/Johannesburg")
+	require.NoError(t, err)
+	nextReportAt := gotResp.ReportPreferences.NextReportAt.Time
+	local := nextReportAt.In(loc)
+	assert.Equal(t, time.Monday, local.Weekday())
+	assert.Equal(t, 8, local.Hour())
+	assert.True(t, nextReportAt.After(time.Now()))
+	assert.True(t, nextReportAt.Before(time.Now().AddDate(0, 0, 7)))
+
+	// The report covers the week before it is sent
+	createReportTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Corner Cafe", 4550, local.AddDate(0, 0, -3))
+	createReportTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Corner Cafe", 1500, local.AddDate(0, 0, -2))
+	createReportTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Hardware Barn", 120000, local.AddDate(0, 0, -4))
+	createReportTestTransaction(t, ctx, cl, state.URL, gotAuthResp, "Last Week Books", 9900, local.AddDate(0, 0, -9))
+
+	sent, err := models.SendDueReports(state, nextReportAt.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	// A report that cannot be sent is kept for the next run, and does not
+	// hold up the others
+	dl := state.DataLayer
+	_, err = dl.CreateReportPreference(&datalayer.ReportPreference{
+		UserID:       17,
+		Cadence:      datalayer.ReportCadenceWeekly,
+		Timezone:     "Africa/Johannesburg",
+		NextReportAt: datalayer.JsonNullTime{NullTime: sql.NullTime{Time: nextReportAt, Valid: true}},
+	})
+	require.NoError(t, err)
+	email := state.Providers.Email
+	state.Providers.Email = &failingMail{Client: email, to: "reptile@netherrealm.com"}
+
+	sent, err = models.SendDueReports(state, nextReportAt.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	mail := receiveReport(t, mails)
+	assert.Equal(t, []string{"subzero@dreamrealm.com"}, mail.to)
+	assert.Equal(t, "Your weekly spend report", mail.subject)
+	assert.Contains(t, mail.message, "1260.50 ZAR over 3 transactions")
+	assert.Contains(t, mail.message, "Corner Cafe: 60.50 ZAR (2)")
+	assert.Contains(t, mail.message, "Hardware Barn: 1200.00 ZAR")
+	assert.NotContains(t, mail.message, "Last Week Books")
+
+	reptile, err := dl.GetReportPreferenceByUserID(17)
+	require.NoError(t, err)
+	assert.True(t, nextReportAt.Equal(reptile.NextReportAt.Time))
+	assert.False(t, reptile.LastSentAt.Valid)
+
+	state.Providers.Email = email
+	sent, err = models.SendDueReports(state, nextReportAt.Add(90*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"reptile@netherrealm.com"}, receiveReport(t, mails).to)
+
+	// The report is sent once and the next is scheduled for a week later
+	sent, err = models.SendDueReports(state, nextReportAt.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	gotResp = reportRequest(t, ctx, cl, gotAuthResp, http.MethodGet, preferencesURL, nil, http.StatusOK)
+	assert.Equal(t, local.AddDate(0, 0, 7), gotResp.ReportPreferences.NextReportAt.Time.In(loc))
+	assert.True(t, gotResp.ReportPreferences.LastSentAt.Valid)
+
+	// Monthly reports are sent on the first
+	gotResp = reportRequest(t, ctx, cl, gotAuthResp, http.MethodPut, preferencesURL, map[string]interface{}{
+		"cadence":  "MONTHLY",
+		"timezone": "America/New_York",
+	}, http.StatusOK)
+	loc, err = time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	local = gotResp.ReportPreferences.NextReportAt.Time.In(loc)
+	assert.Equal(t, 1, local.Day())
+	assert.Equal(t, 8, local.Hour())
+
+	gotResp = reportRequest(t, ctx, cl, gotAuthResp, http.MethodPut, preferencesURL, map[string]interface{}{
+		"cadence": "none",
+	}, http.StatusOK)
+	assert.Equal(t, datalayer.ReportCadenceNone, gotResp.ReportPreferences.Cadence)
+	assert.False(t, gotResp.ReportPreferences.NextReportAt.Valid)
+}
+
+func createReportTestTransaction(t *testing.T, ctx context.Context, cl *http.Client, url string, auth *AuthResponse,
+	merchantName string, cents int64, dateTime time.Time) {
+	t.Helper()
+
+	createCardTransaction(t, ctx, cl, url, auth, &CreateCardTransactionParameters{
+		request: models.CardTransaction{
+			DateTime:     dateTime.UTC(),
+			Amount:       models.CurrencyValue{Value: cents, Scale: 2},
+			CurrencyCode: "ZAR",
+			Reference:    "simulation",
+			MerchantName: merchantName,
+		},
+		expResponse: CreateCardTransactionControllerResponse{
+			Message:         "success",
+			Status:          true,
+			CardTransaction: models.CardTransaction{Amount: models.CurrencyValue{Value: cents, Scale: 2}},
+		},
+	})
+}
+
+// failingMail fails to send mail to one address.
+type failingMail struct {
+	mail.Client
+	to string
+}
+
+func (m *failingMail) SendHTMLMail(to []string, from, subject, text, html string) error {
+	if to[0] == m.to {
+		return errors.New("mailbox unavailable")
+	}
+	return m.Client.SendHTMLMail(to, from, subject, text, html)
+}
+
+func receiveReport(t *testing.T, mails chan sentMail) sentMail {
+	t.Helper()
+
+	select {
+	case mail := <-mails:
+		return mail
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "report was not sent")
+	}
+	return sentMail{}
+}
+
+func reportRequest(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	method, url string, body interface{}, expHTTPStatus int) *ReportControllerResponse {
+	t.Helper()
+
+	gotResp := new(ReportControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
@@ -0,0 +1,105 @@
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	models_auth "github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type RolesControllerResponse struct {
+	Message string `json:"message"`
+	Status  bool   `json:"status"`
+	User    struct {
+		ID    int64    `json:"id"`
+		Roles []string `json:"roles"`
+	} `json:"user"`
+}
+
+func TestUserRoles(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers, confirmSeedUsers)
+	ctx := state.Context
+
+	subzero := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	reptile := householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+	assert.Equal(t, []string{"ADMIN", "USER"}, tokenRoles(t, subzero.Token.AccessToken))
+	assert.Equal(t, []string{"USER"}, tokenRoles(t, reptile.Token.AccessToken))
+
+	subzeroID := tokenUserID(t, subzero.Token.AccessToken)
+	reptileID := tokenUserID(t, reptile.Token.AccessToken)
+	rolesURL := func(id int64) string {
+		return fmt.Sprintf("%s/api/admin/users/%d/roles", state.URL, id)
+	}
+
+	// Reptile is not an administrator.
+	resp := rolesRequest(t, ctx, cl, reptile, rolesURL(reptileID), []string{"ADMIN"}, http.StatusForbidden)
+	assert.Equal(t, "Forbidden, the ADMIN role is required", resp.Message)
+
+	resp = rolesRequest(t, ctx, cl, subzero, rolesURL(reptileID), []string{"ROOT"}, http.StatusBadRequest)
+	assert.False(t, resp.Status)
+	resp = rolesRequest(t, ctx, cl, subzero, rolesURL(subzeroID), []string{"USER"}, http.StatusBadRequest)
+	assert.False(t, resp.Status)
+	rolesRequest(t, ctx, cl, subzero, rolesURL(999), []string{"USER"}, http.StatusNotFound)
+
+	resp = rolesRequest(t, ctx, cl, subzero, rolesURL(reptileID), []string{"admin"}, http.StatusOK)
+	assert.Equal(t, reptileID, resp.User.ID)
+	assert.Equal(t, []string{"ADMIN", "USER"}, resp.User.Roles)
+
+	// Roles are carried by tokens, so changing them revokes reptile's
+	// existing tokens and the new roles are picked up by logging in again.
+	resp = rolesRequest(t, ctx, cl, reptile, rolesURL(reptileID), []string{"ADMIN"}, http.StatusForbidden)
+	assert.Equal(t, "Token has been revoked", resp.Message)
+	reptile = householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+	assert.Equal(t, []string{"ADMIN", "USER"}, tokenRoles(t, reptile.Token.AccessToken))
+	rolesRequest(t, ctx, cl, reptile, rolesURL(reptileID), []string{"ADMIN"}, http.StatusOK)
+
+	// Setting the same roles again leaves tokens alone.
+	rolesRequest(t, ctx, cl, subzero, rolesURL(reptileID), []string{"ADMIN", "USER"}, http.StatusOK)
+	adminRequest(t, ctx, cl, reptile, http.MethodGet, state.URL+"/api/admin/users", nil, http.StatusOK)
+
+	// A demoted administrator's tokens no longer reach admin routes.
+	resp = rolesRequest(t, ctx, cl, subzero, rolesURL(reptileID), []string{"USER"}, http.StatusOK)
+	assert.Equal(t, []string{"USER"}, resp.User.Roles)
+	gotResp := adminRequest(t, ctx, cl, reptile, http.MethodGet, state.URL+"/api/admin/users", nil, http.StatusForbidden)
+	assert.Equal(t, "Token has been revoked", gotResp.Message)
+	exchangeRefreshToken(t, ctx, cl, state.URL, reptile.Token.RefreshToken, http.StatusUnauthorized, "Refresh token has been revoked")
+	reptile = householdLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com")
+	rolesRequest(t, ctx, cl, reptile, rolesURL(reptileID), []string{"ADMIN"}, http.StatusForbidden)
+}
+
+func tokenClaims(t *testing.T, accessToken string) *models_auth.JSONWebToken {
+	t.Helper()
+	tk := new(models_auth.JSONWebToken)
+	_, _, err := new(jwt.Parser).ParseUnverified(accessToken, tk)
+	require.NoError(t, err)
+	return tk
+}
+
+func tokenRoles(t *testing.T, accessToken string) []string {
+	t.Helper()
+	return tokenClaims(t, accessToken).Roles
+}
+
+func tokenUserID(t *testing.T, accessToken string) int64 {
+	t.Helper()
+	return tokenClaims(t, accessToken).UserID
+}
+
+func rolesRequest(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	url string, roles []string, expHTTPStatus int) *RolesControllerResponse {
+	t.Helper()
+
+	gotResp := new(RolesControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, http.MethodPut, url, map[string][]string{"roles": roles},
+		expHTTPStatus, gotResp)
+	return gotResp
+}
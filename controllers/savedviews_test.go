@@ -0,0 +1,159 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type SavedViewControllerResponse struct {
+	Message          string                   `json:"message"`
+	Status           bool                     `json:"status"`
+	View             models.SavedView         `json:"view"`
+	Views            []models.SavedView       `json:"views"`
+	CardTransactions []models.CardTransaction `json:"cardTransactions"`
+	Fields           []struct {
+		Name string `json:"name"`
+	} `json:"fields"`
+}
+
+func TestSavedViews(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	createImport(t, ctx, cl, state.URL, gotAuthResp, &CreateImportParameters{
+		query: url.Values{"format": {"csv"}},
+		file:  filterSeedCSV,
+		expResponse: ImportControllerResponse{
+			Message: "Statement imported",
+			Status:  true,
+			Import: models.Import{
+				Format:   "csv",
+				Parsed:   4,
+				Imported: 4,
+			},
+		},
+		expHTTPStatus: http.StatusOK,
+	})
+
+	status, gotResp := savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/views", models.SavedView{
+		Name:    "Big ones",
+		Filter:  `amount >= 50`,
+		Columns: []string{"dateTime", "colour"},
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Saved view is invalid", gotResp.Message)
+	require.Equal(t, 1, len(gotResp.Fields))
+	assert.Equal(t, "columns", gotResp.Fields[0].Name)
+
+	status, gotResp = savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/views", models.SavedView{
+		Name:      "Big ones",
+		Filter:    `amount >= 50`,
+		SortField: "amount",
+		SortDir:   "desc",
+		Columns:   []string{"dateTime", "merchantName", "amount"},
+	})
+	require.Equal(t, http.StatusOK, status)
+	view := gotResp.View
+	assert.Equal(t, "Big ones", view.Name)
+	assert.Equal(t, []string{"dateTime", "merchantName", "amount"}, view.Columns)
+	viewURL := fmt.Sprintf("%s/api/me/views/%d", state.URL, view.ID)
+
+	status, gotResp = savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/views", models.SavedView{
+		Name: "Big ones",
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Saved view name already exists", gotResp.Message)
+
+	// The view's filter and sort apply, and an ad-hoc filter narrows it.
+	status, gotResp = savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodGet,
+		fmt.Sprintf("%s/api/me/card-transactions?view=%d", state.URL, view.ID), nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"Dwelms en Dinges", "The Coders Bakery"}, merchantNames(gotResp.CardTransactions))
+	assert.Equal(t, view.ID, gotResp.View.ID)
+
+	query := url.Values{"view": {fmt.Sprint(view.ID)}, "filter": {`amount < 1000`}, "sortDir": {"asc"}}
+	status, gotResp = savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodGet,
+		state.URL+"/api/me/card-transactions?"+query.Encode(), nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"The Coders Bakery"}, merchantNames(gotResp.CardTransactions))
+
+	view.Name = "Big spend"
+	view.Filter = `amount >= 1000`
+	status, gotResp = savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodPut, viewURL, view)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Big spend", gotResp.View.Name)
+
+	status, gotResp = savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodGet, state.URL+"/api/me/views", nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, 1, len(gotResp.Views))
+	assert.Equal(t, `amount >= 1000`, gotResp.Views[0].Filter)
+
+	status, _ = savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodDelete, viewURL, nil)
+	require.Equal(t, http.StatusOK, status)
+
+	status, gotResp = savedViewRequest(t, ctx, cl, gotAuthResp, http.MethodGet,
+		fmt.Sprintf("%s/api/me/card-transactions?view=%d", state.URL, view.ID), nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "Saved view not found", gotResp.Message)
+}
+
+func savedViewRequest(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	method, url string, body interface{}) (int, *SavedViewControllerResponse) {
+	t.Helper()
+
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(reqBody))
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(SavedViewControllerResponse)
+	err = json.Unmarshal(b, gotResp)
+	require.NoError(t, err)
+
+	return res.StatusCode, gotResp
+}
+
+func merchantNames(cardTransactions []models.CardTransaction) []string {
+	var names []string
+	for _, cardTransaction := range cardTransactions {
+		names = append(names, cardTransaction.MerchantName)
+	}
+	return names
+}
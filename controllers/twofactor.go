@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+type twoFactorReq struct {
+	CurrentPassword string `json:"currentPassword"`
+	Code            string `json:"code"`
+}
+
+func decodeTwoFactorReq(w http.ResponseWriter, r *http.Request) (*twoFactorReq, error) {
+	req := new(twoFactorReq)
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func GetTwoFactor(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	twoFactor := models.NewTwoFactor(state)
+	err := twoFactor.GetTwoFactor(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("twoFactor", twoFactor)
+	return resp.Respond(w)
+}
+
+func TOTP(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	switch r.Method {
+	case http.MethodPost:
+		return enrolTOTP(w, r, state)
+	case http.MethodDelete:
+		return disableTOTP(w, r, state)
+	}
+
+	return nil
+}
+
+// enrolTOTP returns a new secret, and a URI of it to show as a QR code, for
+// the caller to add to their authenticator app before confirming it with
+// EnableTOTP.
+func enrolTOTP(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	req, err := decodeTwoFactorReq(w, r)
+	if err != nil {
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	twoFactor := models.NewTwoFactor(state)
+	err = twoFactor.EnrolTOTP(userID, req.CurrentPassword)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Enter a code from your authenticator app to enable two-factor authentication")
+	resp.Set("twoFactor", twoFactor)
+	return resp.Respond(w)
+}
+
+func disableTOTP(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	req, err := decodeTwoFactorReq(w, r)
+	if err != nil {
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	twoFactor := models.NewTwoFactor(state)
+	err = twoFactor.DisableTOTP(userID, req.CurrentPassword, req.Code)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Two-factor authentication disabled")
+	resp.Set("twoFactor", twoFactor)
+	return resp.Respond(w)
+}
+
+// EnableTOTP turns two-factor authentication on with a code from the secret
+// the caller enrolled, and returns their recovery codes.
+func EnableTOTP(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	req, err := decodeTwoFactorReq(w, r)
+	if err != nil {
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	twoFactor := models.NewTwoFactor(state)
+	err = twoFactor.EnableTOTP(userID, req.Code)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Two-factor authentication enabled")
+	resp.Set("twoFactor", twoFactor)
+	return resp.Respond(w)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes.
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	req, err := decodeTwoFactorReq(w, r)
+	if err != nil {
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	twoFactor := models.NewTwoFactor(state)
+	err = twoFactor.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Recovery codes regenerated")
+	resp.Set("twoFactor", twoFactor)
+	return resp.Respond(w)
+}
@@ -0,0 +1,147 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/lib/totp"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type TwoFactorControllerResponse struct {
+	Message   string                 `json:"message"`
+	Status    bool                   `json:"status"`
+	Token     auth.TokenResponse     `json:"token"`
+	Challenge auth.ChallengeResponse `json:"challenge"`
+	TwoFactor models.TwoFactor       `json:"twoFactor"`
+}
+
+func TestTwoFactor(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+	twoFactorURL := state.URL + "/api/me/2fa"
+	totpURL := twoFactorURL + "/totp"
+	loginURL := state.URL + "/api/auth/login"
+	challengeURL := state.URL + "/api/auth/2fa"
+	credentials := map[string]string{"email": "subzero@dreamrealm.com", "password": "secret"}
+
+	session := householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	token := session.Token.AccessToken
+
+	resp := twoFactorRequest(t, ctx, cl, token, http.MethodGet, twoFactorURL, nil, http.StatusOK)
+	assert.False(t, resp.TwoFactor.Enabled)
+	twoFactorRequest(t, ctx, cl, token, http.MethodPost, totpURL+"/verify",
+		map[string]string{"code": "123456"}, http.StatusConflict)
+
+	// Enrolling takes the password, and a code from the secret to enable
+	twoFactorRequest(t, ctx, cl, token, http.MethodPost, totpURL,
+		map[string]string{"currentPassword": "guess"}, http.StatusForbidden)
+	resp = twoFactorRequest(t, ctx, cl, token, http.MethodPost, totpURL,
+		map[string]string{"currentPassword": "secret"}, http.StatusOK)
+	secret := resp.TwoFactor.Secret
+	require.NotEmpty(t, secret)
+	assert.True(t, strings.HasPrefix(resp.TwoFactor.URI, "otpauth://totp/"))
+	assert.Contains(t, resp.TwoFactor.URI, "secret="+secret)
+	assert.False(t, resp.TwoFactor.Enabled)
+
+	step := totp.Step(time.Now())
+	twoFactorRequest(t, ctx, cl, token, http.MethodPost, totpURL+"/verify",
+		map[string]string{"code": totpCode(t, secret, step+10)}, http.StatusForbidden)
+	resp = twoFactorRequest(t, ctx, cl, token, http.MethodPost, totpURL+"/verify",
+		map[string]string{"code": totpCode(t, secret, step)}, http.StatusOK)
+	assert.True(t, resp.TwoFactor.Enabled)
+	require.Len(t, resp.TwoFactor.RecoveryCodes, 10)
+	recoveryCodes := resp.TwoFactor.RecoveryCodes
+	twoFactorRequest(t, ctx, cl, token, http.MethodPost, totpURL,
+		map[string]string{"currentPassword": "secret"}, http.StatusConflict)
+
+	// The password alone only earns a challenge, used up by a wrong code
+	resp = twoFactorRequest(t, ctx, cl, "", http.MethodPost, loginURL, credentials, http.StatusOK)
+	assert.Equal(t, "Two-factor code required", resp.Message)
+	assert.Empty(t, resp.Token.AccessToken)
+	challenge := resp.Challenge.ChallengeToken
+	require.NotEmpty(t, challenge)
+	twoFactorRequest(t, ctx, cl, challenge, http.MethodGet, state.URL+"/api/users/current", nil, http.StatusForbidden)
+	twoFactorRequest(t, ctx, cl, "", http.MethodPost, challengeURL,
+		map[string]string{"challengeToken": challenge, "code": totpCode(t, secret, step+10)}, http.StatusUnauthorized)
+	twoFactorRequest(t, ctx, cl, "", http.MethodPost, challengeURL,
+		map[string]string{"challengeToken": challenge, "code": totpCode(t, secret, step+1)}, http.StatusUnauthorized)
+
+	// A code of the step used to enable is not accepted again
+	challenge = loginChallenge(t, ctx, cl, loginURL, credentials)
+	twoFactorRequest(t, ctx, cl, "", http.MethodPost, challengeURL,
+		map[string]string{"challengeToken": challenge, "code": totpCode(t, secret, step)}, http.StatusUnauthorized)
+
+	challenge = loginChallenge(t, ctx, cl, loginURL, credentials)
+	resp = twoFactorRequest(t, ctx, cl, "", http.MethodPost, challengeURL,
+		map[string]string{"challengeToken": challenge, "code": totpCode(t, secret, step+1)}, http.StatusOK)
+	assert.Equal(t, "Logged In", resp.Message)
+	require.NotEmpty(t, resp.Token.AccessToken)
+	twoFactorRequest(t, ctx, cl, resp.Token.AccessToken, http.MethodGet, state.URL+"/api/users/current", nil, http.StatusOK)
+	twoFactorRequest(t, ctx, cl, "", http.MethodPost, challengeURL,
+		map[string]string{"challengeToken": challenge, "code": totpCode(t, secret, step+1)}, http.StatusUnauthorized)
+
+	// Recovery codes work once each, however they are typed
+	challenge = loginChallenge(t, ctx, cl, loginURL, credentials)
+	resp = twoFactorRequest(t, ctx, cl, "", http.MethodPost, challengeURL,
+		map[string]string{"challengeToken": challenge, "code": strings.ToUpper(recoveryCodes[0])}, http.StatusOK)
+	require.NotEmpty(t, resp.Token.AccessToken)
+	challenge = loginChallenge(t, ctx, cl, loginURL, credentials)
+	twoFactorRequest(t, ctx, cl, "", http.MethodPost, challengeURL,
+		map[string]string{"challengeToken": challenge, "code": recoveryCodes[0]}, http.StatusUnauthorized)
+	resp = twoFactorRequest(t, ctx, cl, token, http.MethodGet, twoFactorURL, nil, http.StatusOK)
+	assert.True(t, resp.TwoFactor.Enabled)
+	assert.Equal(t, 9, resp.TwoFactor.RecoveryCodesRemaining)
+	assert.Empty(t, resp.TwoFactor.Secret)
+
+	resp = twoFactorRequest(t, ctx, cl, token, http.MethodPost, twoFactorURL+"/recovery-codes",
+		map[string]string{"code": recoveryCodes[1]}, http.StatusOK)
+	require.Len(t, resp.TwoFactor.RecoveryCodes, 10)
+	twoFactorRequest(t, ctx, cl, token, http.MethodDelete, totpURL,
+		map[string]string{"currentPassword": "secret", "code": recoveryCodes[2]}, http.StatusForbidden)
+
+	// Disabling takes the password and a code, after which the password is
+	// enough again
+	recoveryCodes = resp.TwoFactor.RecoveryCodes
+	twoFactorRequest(t, ctx, cl, token, http.MethodDelete, totpURL,
+		map[string]string{"currentPassword": "guess", "code": recoveryCodes[0]}, http.StatusForbidden)
+	resp = twoFactorRequest(t, ctx, cl, token, http.MethodDelete, totpURL,
+		map[string]string{"currentPassword": "secret", "code": recoveryCodes[0]}, http.StatusOK)
+	assert.False(t, resp.TwoFactor.Enabled)
+	householdLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com")
+	twoFactorRequest(t, ctx, cl, token, http.MethodPost, twoFactorURL+"/recovery-codes",
+		map[string]string{"code": recoveryCodes[1]}, http.StatusConflict)
+}
+
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, step)
+	require.NoError(t, err)
+	return code
+}
+
+func loginChallenge(t *testing.T, ctx context.Context, cl *http.Client, url string, credentials map[string]string) string {
+	t.Helper()
+	resp := twoFactorRequest(t, ctx, cl, "", http.MethodPost, url, credentials, http.StatusOK)
+	require.NotEmpty(t, resp.Challenge.ChallengeToken)
+	return resp.Challenge.ChallengeToken
+}
+
+func twoFactorRequest(t *testing.T, ctx context.Context, cl *http.Client, token string,
+	method, url string, body interface{}, expHTTPStatus int) *TwoFactorControllerResponse {
+	t.Helper()
+
+	gotResp := new(TwoFactorControllerResponse)
+	apiRequest(t, ctx, cl, token, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
@@ -101,8 +101,6 @@ func ConfirmUserSignUp(w http.ResponseWriter, r *http.Request, state *state.Serv
 
 	err = user.ConfirmUser(nonce)
 	if err != nil {
-		err := e.NewError("Failed to confirm user", []types.ErrorField{},
-			http.StatusInternalServerError)
 		e.WriteError(w, err)
 		return err
 	}
@@ -111,4 +109,99 @@ func ConfirmUserSignUp(w http.ResponseWriter, r *http.Request, state *state.Serv
 	resp := response.New(true, "User's email has been confirmed")
 
 	return resp.Respond(w)
-}
\ No newline at end of file
+}
+// SetUserRoles replaces the roles of a user.  The route is restricted to
+// administrators.
+func SetUserRoles(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	var req struct {
+		Roles []string `json:"roles"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	adminID := r.Context().Value(auth.UserKey).(int64)
+	user := models.NewUser(state)
+	err = user.SetRoles(adminID, id, req.Roles)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	user.Password = ""
+
+	resp := response.New(true, "success")
+	resp.Set("user", user)
+	return resp.Respond(w)
+}
+
+// ChangePassword sets a new password for the caller, who must give their
+// current one.  Every other session ends, so new tokens are returned.
+func ChangePassword(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	data, err := models.NewUser(state).ChangePassword(userID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Password changed")
+	resp.Set("token", data)
+	return resp.Respond(w)
+}
+
+// ChangeEmail sends a confirmation link to the caller's new address, which
+// replaces the current one once the link is followed.
+func ChangeEmail(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	var req struct {
+		Email           string `json:"email"`
+		CurrentPassword string `json:"currentPassword"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	err = models.NewUser(state).ChangeEmail(userID, req.CurrentPassword, req.Email)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return response.New(true, "A confirmation link has been sent to the new address").Respond(w)
+}
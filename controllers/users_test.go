@@ -263,6 +263,8 @@ func seedUsers(t *testing.T, dl datalayer.DataLayer) {
 	require.NotNil(t, id)
 	err = dl.SetUserStateByID(id, datalayer.UserStateConfirmed)
 	require.NoError(t, err)
+	err = dl.SetUserRolesByID(id, "ADMIN,USER")
+	require.NoError(t, err)
 
 	id, err = dl.CreateUser("reptile@netherrealm.com", "$2a$10$NkTUeL6hkTRZ7M13tKYLqOmg7pAQaGPdpch9b5UoTSoO77MHjbPjm")
 	require.NotNil(t, id)
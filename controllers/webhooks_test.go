@@ -0,0 +1,274 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type WebhookControllerResponse struct {
+	Message    string                   `json:"message"`
+	Status     bool                     `json:"status"`
+	Fields     []types.ErrorField       `json:"fields"`
+	Webhook    models.Webhook           `json:"webhook"`
+	Webhooks   []models.Webhook         `json:"webhooks"`
+	Delivery   models.WebhookDelivery   `json:"delivery"`
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhooks(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	// The receiver listens on loopback.
+	state.AllowPrivateWebhooks = true
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	var status int32 = http.StatusOK
+	received := make(chan receivedWebhook, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		received <- receivedWebhook{header: r.Header, body: body}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		fmt.Fprint(w, "thanks")
+	}))
+	defer receiver.Close()
+
+	// Validation
+	gotResp := webhookRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/webhooks", map[string]interface{}{
+		"url":        "ftp://example.com",
+		"eventTypes": []string{"budget.exceeded"},
+	}, http.StatusBadRequest)
+	assert.Equal(t, "Webhook is invalid", gotResp.Message)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "url", Message: "an http or https URL of up to 2048 characters is required"},
+		{Name: "eventTypes", Message: `"budget.exceeded" is not an event type`},
+	}, gotResp.Fields)
+
+	// Registration returns the secret once
+	gotResp = webhookRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/webhooks", map[string]interface{}{
+		"url":        receiver.URL,
+		"eventTypes": []string{"cardTransaction.created"},
+	}, http.StatusOK)
+	webhook := gotResp.Webhook
+	require.Len(t, webhook.Secret, 64)
+	assert.True(t, webhook.Active)
+	webhookURL := state.URL + "/api/me/webhooks/" + strconv.FormatInt(webhook.ID, 10)
+
+	gotResp = webhookRequest(t, ctx, cl, gotAuthResp, http.MethodGet, webhookURL, nil, http.StatusOK)
+	assert.Empty(t, gotResp.Webhook.Secret)
+	assert.Equal(t, []string{"cardTransaction.created"}, gotResp.Webhook.EventTypes)
+
+	// A new transaction is delivered with a valid signature
+	createWebhookTestTransaction(t, ctx, cl, state.URL, gotAuthResp)
+	delivery := receiveWebhook(t, received)
+	assert.Equal(t, "cardTransaction.created", delivery.header.Get("X-Webhook-Event"))
+	timestamp, err := strconv.ParseInt(delivery.header.Get("X-Webhook-Timestamp"), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, models.SignWebhookPayload(webhook.Secret, timestamp, delivery.body), delivery.header.Get("X-Webhook-Signature"))
+
+	payload := new(struct {
+		Event  string                 `json:"event"`
+		UserID int64                  `json:"userID"`
+		Data   models.CardTransaction `json:"data"`
+	})
+	require.NoError(t, json.Unmarshal(delivery.body, payload))
+	assert.Equal(t, "cardTransaction.created", payload.Event)
+	assert.NotZero(t, payload.UserID)
+	assert.Equal(t, "Webhook Bakery", payload.Data.MerchantName)
+
+	deliveries := awaitWebhookDeliveries(t, ctx, cl, gotAuthResp, webhookURL, func(deliveries []models.WebhookDelivery) bool {
+		return len(deliveries) == 1 && deliveries[0].State == datalayer.WebhookDeliverySucceeded
+	})
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].ResponseStatus)
+	assert.False(t, deliveries[0].NextAttemptAt.Valid)
+
+	// A failed delivery is scheduled for a retry
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	createWebhookTestTransaction(t, ctx, cl, state.URL, gotAuthResp)
+	receiveWebhook(t, received)
+	deliveries = awaitWebhookDeliveries(t, ctx, cl, gotAuthResp, webhookURL, func(deliveries []models.WebhookDelivery) bool {
+		return len(deliveries) == 2 && deliveries[0].Attempts == 1
+	})
+	failed := deliveries[0]
+	assert.Equal(t, datalayer.WebhookDeliveryPending, failed.State)
+	assert.Equal(t, http.StatusServiceUnavailable, failed.ResponseStatus)
+	assert.Equal(t, "webhook responded with status 503", failed.Error)
+	require.True(t, failed.NextAttemptAt.Valid)
+	assert.WithinDuration(t, failed.LastAttemptAt.Time.Add(models.WebhookRetryBackoff(1)), failed.NextAttemptAt.Time, time.Second)
+
+	// Redelivering sends the same payload again straight away
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	gotResp = webhookRequest(t, ctx, cl, gotAuthResp, http.MethodPost,
+		webhookURL+"/deliveries/"+strconv.FormatInt(failed.ID, 10)+"/redeliver", nil, http.StatusOK)
+	redelivered := receiveWebhook(t, received)
+	assert.JSONEq(t, string(failed.Payload), string(redelivered.body))
+	assert.Equal(t, datalayer.WebhookDeliverySucceeded, gotResp.Delivery.State)
+	assert.Equal(t, http.StatusNoContent, gotResp.Delivery.ResponseStatus)
+	assert.NotEqual(t, failed.ID, gotResp.Delivery.ID)
+
+	// Deactivated webhooks receive nothing
+	webhookRequest(t, ctx, cl, gotAuthResp, http.MethodPut, webhookURL, map[string]interface{}{
+		"url":    receiver.URL,
+		"active": false,
+	}, http.StatusOK)
+	createWebhookTestTransaction(t, ctx, cl, state.URL, gotAuthResp)
+	select {
+	case <-received:
+		assert.Fail(t, "deactivated webhook received a delivery")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	webhookRequest(t, ctx, cl, gotAuthResp, http.MethodDelete, webhookURL, nil, http.StatusOK)
+	gotResp = webhookRequest(t, ctx, cl, gotAuthResp, http.MethodGet, webhookURL+"/deliveries", nil, http.StatusNotFound)
+	assert.Equal(t, "Webhook not found", gotResp.Message)
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	var hits int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer receiver.Close()
+
+	// Addresses given in the URL are refused when the webhook is registered
+	for _, url := range []string{
+		receiver.URL,
+		"http://[::1]/hooks",
+		"http://10.0.0.8/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0:8000/hooks",
+		"http://239.255.255.250:1900/hooks",
+		"http://[ff05::c]/hooks",
+	} {
+		gotResp := webhookRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/webhooks", map[string]interface{}{
+			"url": url,
+		}, http.StatusBadRequest)
+		assert.Equal(t, []types.ErrorField{
+			{Name: "url", Message: "a loopback, private, link-local or multicast address is not allowed"},
+		}, gotResp.Fields, url)
+	}
+
+	// Hosts that resolve to them are refused when connecting
+	port := receiver.URL[strings.LastIndex(receiver.URL, ":")+1:]
+	gotResp := webhookRequest(t, ctx, cl, gotAuthResp, http.MethodPost, state.URL+"/api/me/webhooks", map[string]interface{}{
+		"url":        "http://localhost:" + port + "/hooks",
+		"eventTypes": []string{"cardTransaction.created"},
+	}, http.StatusOK)
+	webhookURL := state.URL + "/api/me/webhooks/" + strconv.FormatInt(gotResp.Webhook.ID, 10)
+
+	createWebhookTestTransaction(t, ctx, cl, state.URL, gotAuthResp)
+	deliveries := awaitWebhookDeliveries(t, ctx, cl, gotAuthResp, webhookURL, func(deliveries []models.WebhookDelivery) bool {
+		return len(deliveries) == 1 && deliveries[0].Attempts == 1
+	})
+	assert.Equal(t, datalayer.WebhookDeliveryPending, deliveries[0].State)
+	assert.Zero(t, deliveries[0].ResponseStatus)
+	assert.Contains(t, deliveries[0].Error, "webhook address is not public")
+	assert.Zero(t, atomic.LoadInt32(&hits))
+}
+
+func createWebhookTestTransaction(t *testing.T, ctx context.Context, cl *http.Client, url string, auth *AuthResponse) {
+	t.Helper()
+
+	createCardTransaction(t, ctx, cl, url, auth, &CreateCardTransactionParameters{
+		request: models.CardTransaction{
+			DateTime:     time.Date(2020, 04, 25, 19, 46, 23, 0, time.UTC),
+			Amount:       models.CurrencyValue{Value: 400, Scale: 2},
+			CurrencyCode: "ZAR",
+			Reference:    "simulation",
+			MerchantName: "Webhook Bakery",
+		},
+		expResponse: CreateCardTransactionControllerResponse{
+			Message:         "success",
+			Status:          true,
+			CardTransaction: models.CardTransaction{Amount: models.CurrencyValue{Value: 400, Scale: 2}},
+		},
+	})
+}
+
+func receiveWebhook(t *testing.T, received chan receivedWebhook) receivedWebhook {
+	t.Helper()
+
+	select {
+	case delivery := <-received:
+		return delivery
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "webhook was not delivered")
+	}
+	return receivedWebhook{}
+}
+
+// awaitWebhookDeliveries polls the delivery log until done accepts it, as
+// deliveries are recorded after the receiver has responded.
+func awaitWebhookDeliveries(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	webhookURL string, done func([]models.WebhookDelivery) bool) []models.WebhookDelivery {
+	t.Helper()
+
+	var deliveries []models.WebhookDelivery
+	assert.Eventually(t, func() bool {
+		deliveries = webhookRequest(t, ctx, cl, auth, http.MethodGet, webhookURL+"/deliveries", nil, http.StatusOK).Deliveries
+		return done(deliveries)
+	}, 5*time.Second, 50*time.Millisecond)
+	return deliveries
+}
+
+func webhookRequest(t *testing.T, ctx context.Context, cl *http.Client, auth *AuthResponse,
+	method, url string, body interface{}, expHTTPStatus int) *WebhookControllerResponse {
+	t.Helper()
+
+	gotResp := new(WebhookControllerResponse)
+	apiRequest(t, ctx, cl, auth.Token.AccessToken, method, url, body, expHTTPStatus, gotResp)
+	return gotResp
+}
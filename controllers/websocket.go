@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait is how long a client may take to accept a message.
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long a client may stay silent, and wsPingPeriod how
+	// often it is pinged so that it does not have to.
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsMaxMessageSize bounds a client message.
+	wsMaxMessageSize = 4096
+	// wsMaxSubscriptions bounds the subscriptions held by one connection.
+	wsMaxSubscriptions = 32
+	// wsMaxSubscriptionID bounds the length of a subscription id.
+	wsMaxSubscriptionID = 64
+)
+
+// newUpgrader returns an upgrader that only accepts handshakes from pages
+// served from the configured URL, or from the host handling the request when
+// there is none.  Clients other than browsers send no Origin and are
+// accepted.
+func newUpgrader(state *state.ServerState) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			return checkOrigin(r, state.URL)
+		},
+	}
+}
+
+func checkOrigin(r *http.Request, configuredURL string) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if len(configuredURL) == 0 {
+		return strings.EqualFold(originURL.Host, r.Host)
+	}
+	allowedURL, err := url.Parse(configuredURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(originURL.Scheme, allowedURL.Scheme) && strings.EqualFold(originURL.Host, allowedURL.Host)
+}
+
+// wsClientMessage is sent by the client.  Type is one of subscribe,
+// unsubscribe or ping.
+type wsClientMessage struct {
+	Type   string   `json:"type"`
+	ID     string   `json:"id"`
+	Events []string `json:"events"`
+	Filter string   `json:"filter"`
+}
+
+// wsServerMessage is sent to the client.  Type is one of subscribed,
+// unsubscribed, event, error or pong; ID names the subscription concerned.
+type wsServerMessage struct {
+	Type    string             `json:"type"`
+	ID      string             `json:"id,omitempty"`
+	Event   *events.Event      `json:"event,omitempty"`
+	Message string             `json:"message,omitempty"`
+	Fields  []types.ErrorField `json:"fields,omitempty"`
+}
+
+// wsSubscription selects the events pushed for one subscribe message.  An
+// empty set of types selects every type, and the filter only narrows card
+// transaction events.
+type wsSubscription struct {
+	types  map[string]bool
+	filter filters.Expression
+}
+
+func (s *wsSubscription) matches(event events.Event) bool {
+	if len(s.types) > 0 && !s.types[event.Type] {
+		return false
+	}
+	if s.filter == nil {
+		return true
+	}
+	cardTransaction, ok := event.Data.(*models.CardTransaction)
+	if !ok {
+		return true
+	}
+	return cardTransaction.Matches(s.filter)
+}
+
+// CreateWebSocketTicket exchanges the caller's access token for a ticket to
+// pass as the ticket query parameter of a WebSocket handshake.  Tickets are
+// short-lived and work once.
+func CreateWebSocketTicket(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	tk := r.Context().Value(auth.TokenKey).(*auth.JSONWebToken)
+	ticket, err := models.CreateTicket(state, tk)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("ticket", ticket)
+	return resp.Respond(w)
+}
+
+// GetWebSocket upgrades to a WebSocket over which the client subscribes to
+// the user's events, optionally narrowed by event type and filter expression.
+//
+// The token the socket was opened with is checked again on every ping and
+// account event that may have revoked it, and the socket closed once it has
+// been.
+//
+// Every write has a deadline.  A client that stops reading stalls its
+// connection, which stops draining the event bus; once the bus drops the
+// subscription the connection is closed with "try again later".
+func GetWebSocket(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := r.Context().Value(auth.UserKey).(int64)
+	conn, err := newUpgrader(state).Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with an HTTP error.
+		return err
+	}
+	defer conn.Close()
+
+	sub := state.Events.Subscribe(userID)
+	defer sub.Unsubscribe()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	messages := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			select {
+			case messages <- data:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	write := func(message wsServerMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(message)
+	}
+	closeWith := func(code int, reason string) {
+		message := websocket.FormatCloseMessage(code, reason)
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteWait))
+	}
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	subscriptions := make(map[string]*wsSubscription)
+	for {
+		select {
+		case data := <-messages:
+			err := write(handleWebSocketMessage(data, subscriptions))
+			if err != nil {
+				return err
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Dropped() {
+					closeWith(websocket.CloseTryAgainLater, "client is too slow")
+				} else {
+					closeWith(websocket.CloseGoingAway, "server is shutting down")
+				}
+				return nil
+			}
+			if revokingEvents[event.Type] && isStreamRevoked(r, state) {
+				closeWith(websocket.ClosePolicyViolation, "token has been revoked")
+				return nil
+			}
+			for id, subscription := range subscriptions {
+				if !subscription.matches(event) {
+					continue
+				}
+				event := event
+				err := write(wsServerMessage{Type: "event", ID: id, Event: &event})
+				if err != nil {
+					return err
+				}
+			}
+		case <-ping.C:
+			if isStreamRevoked(r, state) {
+				closeWith(websocket.ClosePolicyViolation, "token has been revoked")
+				return nil
+			}
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				return err
+			}
+		case err := <-readErr:
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return err
+			}
+			return nil
+		case <-state.Context.Done():
+			closeWith(websocket.CloseGoingAway, "server is shutting down")
+			return nil
+		}
+	}
+}
+
+// handleWebSocketMessage applies a client message to the connection's
+// subscriptions and returns the reply.
+func handleWebSocketMessage(data []byte, subscriptions map[string]*wsSubscription) wsServerMessage {
+	var message wsClientMessage
+	err := json.Unmarshal(data, &message)
+	if err != nil {
+		return wsServerMessage{Type: "error", Message: "Message is not valid JSON"}
+	}
+
+	switch message.Type {
+	case "ping":
+		return wsServerMessage{Type: "pong"}
+	case "subscribe":
+		subscription, err := newWebSocketSubscription(message, subscriptions)
+		if err != nil {
+			return webSocketError(message.ID, err)
+		}
+		subscriptions[message.ID] = subscription
+		return wsServerMessage{Type: "subscribed", ID: message.ID}
+	case "unsubscribe":
+		if _, ok := subscriptions[message.ID]; !ok {
+			return webSocketError(message.ID, e.NewError("Subscription not found", []types.ErrorField{
+				{Name: "id", Message: "is not a subscription on this connection"},
+			}, http.StatusNotFound))
+		}
+		delete(subscriptions, message.ID)
+		return wsServerMessage{Type: "unsubscribed", ID: message.ID}
+	}
+
+	return webSocketError(message.ID, e.NewError("Unsupported message type", []types.ErrorField{
+		{Name: "type", Message: "must be one of subscribe, unsubscribe or ping"},
+	}, http.StatusBadRequest))
+}
+
+func newWebSocketSubscription(message wsClientMessage, subscriptions map[string]*wsSubscription) (*wsSubscription, error) {
+	if len(message.ID) == 0 || len(message.ID) > wsMaxSubscriptionID {
+		return nil, e.NewError("Subscription is invalid", []types.ErrorField{
+			{Name: "id", Message: fmt.Sprintf("must be between 1 and %d characters", wsMaxSubscriptionID)},
+		}, http.StatusBadRequest)
+	}
+	if _, ok := subscriptions[message.ID]; ok {
+		return nil, e.NewError("Subscription is invalid", []types.ErrorField{
+			{Name: "id", Message: "is already in use on this connection"},
+		}, http.StatusBadRequest)
+	}
+	if len(subscriptions) >= wsMaxSubscriptions {
+		return nil, e.NewError("Too many subscriptions", []types.ErrorField{
+			{Name: "id", Message: fmt.Sprintf("a connection may hold at most %d subscriptions", wsMaxSubscriptions)},
+		}, http.StatusBadRequest)
+	}
+
+	subscription := &wsSubscription{types: make(map[string]bool)}
+	for _, eventType := range message.Events {
+		if !events.IsType(eventType) {
+			return nil, e.NewError("Subscription is invalid", []types.ErrorField{
+				{Name: "events", Message: fmt.Sprintf("%q is not an event type", eventType)},
+			}, http.StatusBadRequest)
+		}
+		subscription.types[eventType] = true
+	}
+
+	if len(message.Filter) > 0 {
+		expr, err := models.ParseCardTransactionFilter(message.Filter)
+		if err != nil {
+			return nil, err
+		}
+		subscription.filter = expr
+	}
+
+	return subscription, nil
+}
+
+func webSocketError(id string, err error) wsServerMessage {
+	if err, ok := err.(*e.ControllerError); ok {
+		return wsServerMessage{Type: "error", ID: id, Message: err.ErrorMessage, Fields: err.Fields}
+	}
+	return wsServerMessage{Type: "error", ID: id, Message: err.Error()}
+}
@@ -0,0 +1,185 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type WebSocketMessage struct {
+	Type    string             `json:"type"`
+	ID      string             `json:"id,omitempty"`
+	Events  []string           `json:"events,omitempty"`
+	Filter  string             `json:"filter,omitempty"`
+	Event   *WebSocketEvent    `json:"event,omitempty"`
+	Message string             `json:"message,omitempty"`
+	Fields  []types.ErrorField `json:"fields,omitempty"`
+}
+
+type WebSocketEvent struct {
+	ID     int64                  `json:"id"`
+	Type   string                 `json:"type"`
+	UserID int64                  `json:"userID"`
+	Data   models.CardTransaction `json:"data"`
+}
+
+func TestWebSocket(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks, seedUsers)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	socketURL := "ws" + strings.TrimPrefix(state.URL, "http") + "/api/me/socket"
+
+	// Without a token the handshake is refused
+	_, res, err := websocket.DefaultDialer.DialContext(ctx, socketURL, nil)
+	require.Error(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// Browsers pass a ticket as a query parameter rather than the token
+	_, res, err = websocket.DefaultDialer.DialContext(ctx, socketURL+"?access_token="+gotAuthResp.Token.AccessToken, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	ticket := createWebSocketTicket(t, ctx, cl, state.URL, gotAuthResp)
+	header := http.Header{"Origin": {"https://evil.example.com"}}
+	_, res, err = websocket.DefaultDialer.DialContext(ctx, socketURL+"?ticket="+ticket, header)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// which works once, from the server's own origin
+	ticket = createWebSocketTicket(t, ctx, cl, state.URL, gotAuthResp)
+	header = http.Header{"Origin": {state.URL}}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, socketURL+"?ticket="+ticket, header)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, res, err = websocket.DefaultDialer.DialContext(ctx, socketURL+"?ticket="+ticket, header)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	exchange := func(request WebSocketMessage) WebSocketMessage {
+		t.Helper()
+		require.NoError(t, conn.WriteJSON(request))
+		return readWebSocketMessage(t, conn)
+	}
+
+	assert.Equal(t, WebSocketMessage{Type: "pong"}, exchange(WebSocketMessage{Type: "ping"}))
+	assert.Equal(t, WebSocketMessage{Type: "subscribed", ID: "large"}, exchange(WebSocketMessage{
+		Type:   "subscribe",
+		ID:     "large",
+		Events: []string{"cardTransaction.created"},
+		Filter: "amount >= 10",
+	}))
+	assert.Equal(t, WebSocketMessage{
+		Type:    "error",
+		ID:      "large",
+		Message: "Subscription is invalid",
+		Fields:  []types.ErrorField{{Name: "id", Message: "is already in use on this connection"}},
+	}, exchange(WebSocketMessage{Type: "subscribe", ID: "large"}))
+	assert.Equal(t, WebSocketMessage{
+		Type:    "error",
+		ID:      "bad",
+		Message: "filter is invalid",
+		Fields:  []types.ErrorField{{Name: "filter.merchantName", Message: "merchantName: > cannot be used on text, only = and != at position 13"}},
+	}, exchange(WebSocketMessage{Type: "subscribe", ID: "bad", Filter: `merchantName > "M"`}))
+	assert.Equal(t, WebSocketMessage{
+		Type:    "error",
+		ID:      "bad",
+		Message: "Subscription is invalid",
+		Fields:  []types.ErrorField{{Name: "events", Message: `"budget.exceeded" is not an event type`}},
+	}, exchange(WebSocketMessage{Type: "subscribe", ID: "bad", Events: []string{"budget.exceeded"}}))
+	assert.Equal(t, "Subscription not found", exchange(WebSocketMessage{Type: "unsubscribe", ID: "bad"}).Message)
+
+	// Only the transaction matching the filter is pushed
+	for _, value := range []int64{400, 4000} {
+		createCardTransaction(t, ctx, cl, state.URL, gotAuthResp, &CreateCardTransactionParameters{
+			request: models.CardTransaction{
+				DateTime:     time.Date(2020, 04, 25, 19, 46, 23, 0, time.UTC),
+				Amount:       models.CurrencyValue{Value: value, Scale: 2},
+				CurrencyCode: "ZAR",
+				Reference:    "simulation",
+				MerchantName: "Dwelms en Dinges",
+			},
+			expResponse: CreateCardTransactionControllerResponse{
+				Message:         "success",
+				Status:          true,
+				CardTransaction: models.CardTransaction{Amount: models.CurrencyValue{Value: value, Scale: 2}},
+			},
+		})
+	}
+
+	message := readWebSocketMessage(t, conn)
+	assert.Equal(t, "event", message.Type)
+	assert.Equal(t, "large", message.ID)
+	require.NotNil(t, message.Event)
+	assert.Equal(t, "cardTransaction.created", message.Event.Type)
+	assert.Equal(t, int64(4000), message.Event.Data.Amount.Value)
+
+	assert.Equal(t, WebSocketMessage{Type: "unsubscribed", ID: "large"}, exchange(WebSocketMessage{Type: "unsubscribe", ID: "large"}))
+
+	// Logging out closes the socket opened with the session's ticket
+	logoutRequest(t, ctx, cl, gotAuthResp.Token.AccessToken, http.MethodPost, state.URL+"/api/auth/logout", nil,
+		http.StatusOK)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+}
+
+func createWebSocketTicket(t *testing.T, ctx context.Context, cl *http.Client, baseURL string, auth *AuthResponse) string {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/me/socket/tickets", nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var gotResp struct {
+		Ticket struct {
+			ExpiresIn int64  `json:"expiresIn"`
+			Ticket    string `json:"ticket"`
+		} `json:"ticket"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&gotResp))
+	require.NotEmpty(t, gotResp.Ticket.Ticket)
+	return gotResp.Ticket.Ticket
+}
+
+func readWebSocketMessage(t *testing.T, conn *websocket.Conn) WebSocketMessage {
+	t.Helper()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var message WebSocketMessage
+	require.NoError(t, json.Unmarshal(data, &message))
+	return message
+}
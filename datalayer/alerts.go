@@ -0,0 +1,146 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+type AlertRule struct {
+	Model
+	UserID          int64        `json:"userID" db:"user_id"`
+	Name            string       `json:"name" db:"name"`
+	AmountAbove     string       `json:"amountAbove" db:"amount_above"`
+	HomeCountryCode string       `json:"homeCountryCode" db:"home_country_code"`
+	CategoryCodes   string       `json:"categoryCodes" db:"category_codes"`
+	NewMerchant     bool         `json:"newMerchant" db:"new_merchant"`
+	Filter          string       `json:"filter" db:"filter"`
+	NotifyEmail     bool         `json:"notifyEmail" db:"notify_email"`
+	CooldownMinutes int          `json:"cooldownMinutes" db:"cooldown_minutes"`
+	Active          bool         `json:"active" db:"active"`
+	LastFiredAt     JsonNullTime `json:"lastFiredAt" db:"last_fired_at"`
+}
+
+// AlertFiring records that a rule fired for a card transaction.  RuleName is
+// joined from the rule.
+type AlertFiring struct {
+	Model
+	AlertRuleID       int64  `json:"alertRuleID" db:"alert_rule_id"`
+	RuleName          string `json:"ruleName" db:"rule_name"`
+	UserID            int64  `json:"userID" db:"user_id"`
+	CardTransactionID int64  `json:"cardTransactionID" db:"card_transaction_id"`
+	Message           string `json:"message" db:"message"`
+}
+
+func (p *PersistenceDataLayer) CreateAlertRule(rule *AlertRule) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into alert_rules(user_id, name, amount_above, home_country_code, "+
+		"category_codes, new_merchant, filter, notify_email, cooldown_minutes, active) "+
+		"values (:user_id, :name, :amount_above, :home_country_code, :category_codes, :new_merchant, :filter, "+
+		":notify_email, :cooldown_minutes, :active)", rule)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetAlertRuleByID(id int64) (*AlertRule, error) {
+	rule := new(AlertRule)
+	err := p.GetConn().Get(rule, "SELECT * FROM alert_rules WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (p *PersistenceDataLayer) GetAlertRulesByUserID(userID int64) ([]*AlertRule, error) {
+	rules := make([]*AlertRule, 0)
+	err := p.GetConn().Select(&rules, "SELECT * FROM alert_rules WHERE user_id=? ORDER BY name, id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (p *PersistenceDataLayer) UpdateAlertRule(rule *AlertRule) error {
+	_, err := p.GetConn().NamedExec("update alert_rules set name=:name, amount_above=:amount_above, "+
+		"home_country_code=:home_country_code, category_codes=:category_codes, new_merchant=:new_merchant, "+
+		"filter=:filter, notify_email=:notify_email, cooldown_minutes=:cooldown_minutes, active=:active "+
+		"where id=:id and user_id=:user_id", rule)
+	return err
+}
+
+func (p *PersistenceDataLayer) DeleteAlertRule(userID, id int64) error {
+	_, err := p.GetConn().Exec("delete from alert_rules where id=? and user_id=?", id, userID)
+	return err
+}
+
+// ClaimAlertRuleFiring marks the rule as fired at now unless it already fired
+// after cooledDownAt.  It reports false when the rule is still cooling down,
+// which also keeps two servers from firing it for the same transaction.
+func (p *PersistenceDataLayer) ClaimAlertRuleFiring(id int64, now, cooledDownAt time.Time) (bool, error) {
+	result, err := p.GetConn().Exec("update alert_rules set last_fired_at=? "+
+		"where id=? and (last_fired_at is null or last_fired_at<=?)", now, id, cooledDownAt)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (p *PersistenceDataLayer) CreateAlertFiring(firing *AlertFiring) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into alert_firings(alert_rule_id, user_id, card_transaction_id, message) "+
+		"values (:alert_rule_id, :user_id, :card_transaction_id, :message)", firing)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// GetAlertFiringsByUserID returns the user's most recent firings, newest
+// first, optionally only those of one rule or one card transaction.
+func (p *PersistenceDataLayer) GetAlertFiringsByUserID(userID, ruleID, cardTransactionID int64, limit int) ([]*AlertFiring, error) {
+	query := "SELECT f.*, r.name AS rule_name FROM alert_firings f JOIN alert_rules r ON r.id = f.alert_rule_id " +
+		"WHERE f.user_id=?"
+	values := []interface{}{userID}
+	if ruleID > 0 {
+		query += " AND f.alert_rule_id=?"
+		values = append(values, ruleID)
+	}
+	if cardTransactionID > 0 {
+		query += " AND f.card_transaction_id=?"
+		values = append(values, cardTransactionID)
+	}
+	query += " ORDER BY f.id DESC LIMIT ?"
+	values = append(values, limit)
+
+	firings := make([]*AlertFiring, 0)
+	err := p.GetConn().Select(&firings, query, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	return firings, nil
+}
+
+// MerchantSeenBefore reports whether the user has a card transaction from
+// the merchant that was stored before the one with id beforeID.
+func (p *PersistenceDataLayer) MerchantSeenBefore(userID int64, merchantName string, beforeID int64) (bool, error) {
+	var count int
+	err := p.GetConn().Get(&count, "SELECT COUNT(*) FROM card_transactions WHERE user_id=? AND merchant_name=? AND id<?",
+		userID, merchantName, beforeID)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,115 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Dimensions of the spending statistics kept for anomaly detection.
+const (
+	SpendingByMerchant = "MERCHANT"
+	SpendingByCategory = "CATEGORY"
+	SpendingByHour     = "HOUR"
+)
+
+// SpendingStatistic is a rolling mean and variance of the logarithm of a
+// user's spend for one key of a dimension, such as a merchant, in one
+// currency.  Hours of the day only count observations.
+type SpendingStatistic struct {
+	Model
+	UserID       int64   `json:"userID" db:"user_id"`
+	Dimension    string  `json:"dimension" db:"dimension"`
+	StatKey      string  `json:"statKey" db:"stat_key"`
+	CurrencyCode string  `json:"currencyCode" db:"currency_code"`
+	Observations int64   `json:"observations" db:"observations"`
+	Mean         float64 `json:"logMean" db:"log_mean"`
+	Variance     float64 `json:"logVariance" db:"log_variance"`
+}
+
+func (p *PersistenceDataLayer) GetSpendingStatistic(userID int64, dimension, key, currencyCode string) (*SpendingStatistic, error) {
+	statistic := new(SpendingStatistic)
+	err := p.GetConn().Get(statistic, "SELECT * FROM spending_statistics WHERE user_id=? AND dimension=? AND stat_key=? "+
+		"AND currency_code=?", userID, dimension, key, currencyCode)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return statistic, nil
+}
+
+func (p *PersistenceDataLayer) GetSpendingStatisticsByDimension(userID int64, dimension string) ([]*SpendingStatistic, error) {
+	statistics := make([]*SpendingStatistic, 0)
+	err := p.GetConn().Select(&statistics, "SELECT * FROM spending_statistics WHERE user_id=? AND dimension=?",
+		userID, dimension)
+	if err != nil {
+		return nil, err
+	}
+
+	return statistics, nil
+}
+
+// SaveSpendingStatistic stores a new statistic or updates an existing one.
+func (p *PersistenceDataLayer) SaveSpendingStatistic(statistic *SpendingStatistic) error {
+	if statistic.ID == 0 {
+		_, err := p.GetConn().NamedExec("insert into spending_statistics(user_id, dimension, stat_key, currency_code, "+
+			"observations, log_mean, log_variance) values (:user_id, :dimension, :stat_key, :currency_code, :observations, :log_mean, :log_variance)",
+			statistic)
+		return err
+	}
+
+	_, err := p.GetConn().NamedExec("update spending_statistics set observations=:observations, log_mean=:log_mean, log_variance=:log_variance "+
+		"where id=:id", statistic)
+	return err
+}
+
+func (p *PersistenceDataLayer) SetCardTransactionAnomaly(id int64, score int, reasons string) error {
+	_, err := p.GetConn().Exec("update card_transactions set anomaly_score=?, anomaly_reasons=? where id=?",
+		score, reasons, id)
+	return err
+}
+
+// GetUnevaluatedCardTransactions returns up to limit card transactions, of
+// every user, that have not been evaluated yet, oldest first.
+func (p *PersistenceDataLayer) GetUnevaluatedCardTransactions(limit int) ([]*CardTransaction, error) {
+	cardTransactions := make([]*CardTransaction, 0)
+	err := p.GetConn().Select(&cardTransactions, "SELECT * FROM card_transactions WHERE evaluated_at IS NULL "+
+		"ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return cardTransactions, nil
+}
+
+// ClaimCardTransactionEvaluation marks a card transaction evaluated, returning
+// false if it already was, so that servers sharing the database do not both
+// evaluate it.
+func (p *PersistenceDataLayer) ClaimCardTransactionEvaluation(id int64, now time.Time) (bool, error) {
+	result, err := p.GetConn().Exec("update card_transactions set evaluated_at=? where id=? and evaluated_at is null",
+		now, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// CountrySeenBefore reports whether the user has a card transaction from the
+// country that was stored before the one with id beforeID.
+func (p *PersistenceDataLayer) CountrySeenBefore(userID int64, countryCode string, beforeID int64) (bool, error) {
+	var count int
+	err := p.GetConn().Get(&count, "SELECT COUNT(*) FROM card_transactions WHERE user_id=? AND merchant_country_code=? AND id<?",
+		userID, countryCode, beforeID)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
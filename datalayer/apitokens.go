@@ -0,0 +1,88 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// APIToken is a personal access token.  Only a hash of the secret is kept;
+// Hint holds its first characters so that users can tell tokens apart.
+type APIToken struct {
+	Model
+	UserID     int64        `json:"userID" db:"user_id"`
+	Name       string       `json:"name" db:"name"`
+	TokenHash  string       `json:"-" db:"token_hash"`
+	Hint       string       `json:"hint" db:"hint"`
+	Scopes     string       `json:"scopes" db:"scopes"`
+	ExpiresAt  time.Time    `json:"expiresAt" db:"expires_at"`
+	LastUsedAt JsonNullTime `json:"lastUsedAt" db:"last_used_at"`
+	RevokedAt  JsonNullTime `json:"revokedAt" db:"revoked_at"`
+}
+
+func (p *PersistenceDataLayer) CreateAPIToken(token *APIToken) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into api_tokens(user_id, name, token_hash, hint, scopes, expires_at) "+
+		"values (:user_id, :name, :token_hash, :hint, :scopes, :expires_at)", token)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetAPITokenByID(id int64) (*APIToken, error) {
+	token := new(APIToken)
+	err := p.GetConn().Get(token, "SELECT * FROM api_tokens WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (p *PersistenceDataLayer) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	token := new(APIToken)
+	err := p.GetConn().Get(token, "SELECT * FROM api_tokens WHERE token_hash=?", tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetAPITokensByUserID returns the user's tokens that have not been revoked.
+func (p *PersistenceDataLayer) GetAPITokensByUserID(userID int64) ([]*APIToken, error) {
+	tokens := make([]*APIToken, 0)
+	err := p.GetConn().Select(&tokens, "SELECT * FROM api_tokens WHERE user_id=? AND revoked_at IS NULL ORDER BY id",
+		userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (p *PersistenceDataLayer) SetAPITokenLastUsedAt(id int64, lastUsedAt time.Time) error {
+	_, err := p.GetConn().Exec("update api_tokens set last_used_at = ? where id = ?", lastUsedAt, id)
+	return err
+}
+
+func (p *PersistenceDataLayer) RevokeAPIToken(userID, id int64, now time.Time) error {
+	result, err := p.GetConn().Exec("update api_tokens set revoked_at = ? where id = ? and user_id = ? and revoked_at is null",
+		now, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
@@ -35,14 +35,13 @@ var (
 	ErrNoData = sql.ErrNoRows
 )
 
-func NewForTesting(t *testing.T, ctx context.Context) (*PersistenceDataLayer, error)  {
-	t.Helper()
-	username := os.Getenv("db_user")
-	password := os.Getenv("db_pass")
-	dbName := os.Getenv("db_test_name")
-	dbHost := os.Getenv("db_host")
-	dbPort := os.Getenv("db_port")
-	dbPermanent := os.Getenv("db_permanent") == "true"
+// testingServer returns the credentials and address of the database server
+// tests run against.
+func testingServer() (username, password, dbHost, dbPort string) {
+	username = os.Getenv("db_user")
+	password = os.Getenv("db_pass")
+	dbHost = os.Getenv("db_host")
+	dbPort = os.Getenv("db_port")
 	if len(username) == 0 {
 		username = "root"
 	}
@@ -55,6 +54,14 @@ func NewForTesting(t *testing.T, ctx context.Context) (*PersistenceDataLayer, er
 	if len(dbPort) == 0 {
 		dbPort = "3306"
 	}
+	return username, password, dbHost, dbPort
+}
+
+func NewForTesting(t *testing.T, ctx context.Context) (*PersistenceDataLayer, error)  {
+	t.Helper()
+	username, password, dbHost, dbPort := testingServer()
+	dbName := os.Getenv("db_test_name")
+	dbPermanent := os.Getenv("db_permanent") == "true"
 	if len(dbName) == 0 {
 		dbName = "test_" + nonce.GenerateNonce(10)
 		t.Log("ephemeral database name ", dbName)
@@ -87,6 +94,33 @@ func NewForTesting(t *testing.T, ctx context.Context) (*PersistenceDataLayer, er
 	}, nil
 }
 
+// NewCommittedForTesting returns a data layer that commits what it writes,
+// unlike NewForTesting, for tests of what only sees committed rows, such as
+// full-text search.  It always uses a database of its own, which is dropped
+// when the test ends.
+func NewCommittedForTesting(t *testing.T, ctx context.Context) (*PersistenceDataLayer, error) {
+	t.Helper()
+	username, password, dbHost, dbPort := testingServer()
+	dbName := "test_" + nonce.GenerateNonce(10)
+	t.Log("ephemeral database name ", dbName)
+
+	t.Cleanup(func() {
+		cleanupNonPermanentDatabase(t, ctx, username, password, dbHost, dbPort, dbName)
+	})
+	maybeCreateDatabaseForTesting(t, ctx, username, password, dbHost, dbPort, dbName)
+
+	dbURI := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", username, password, dbHost, dbPort, dbName)
+	conn, err := sqlx.Open("mysql", dbURI)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return &PersistenceDataLayer{
+		conn: conn,
+	}, nil
+}
+
 func New(logger *log.Logger) (*PersistenceDataLayer, error){
 	conn, err, ok := tryConnectHerokuJawsDB()
 	if err != nil {
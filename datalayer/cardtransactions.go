@@ -23,13 +23,45 @@ type CardTransaction struct {
 	MerchantCountryName  string    `json:"merchantCountryName" db:"merchant_country_name"`
 	MerchantCategoryCode string    `json:"merchantCategoryCode" db:"merchant_category_code"`
 	MerchantCategoryName string    `json:"merchantCategoryName" db:"merchant_category_name"`
+	Notes                string    `json:"notes" db:"notes"`
 	UserID               int64     `json:"userID" db:"user_id"`
+	AnomalyScore         int       `json:"anomalyScore" db:"anomaly_score"`
+	AnomalyReasons       string    `json:"anomalyReasons" db:"anomaly_reasons"`
+	// EvaluatedAt is set once the transaction has been scored for anomalies
+	// and run through its owner's alert rules.
+	EvaluatedAt JsonNullTime `json:"-" db:"evaluated_at"`
+
+	// Relevance is only selected by a full-text search.
+	Relevance sql.NullFloat64 `json:"relevance" db:"relevance"`
 }
 
+// cardTransactionSortColumns maps the API sort fields onto their columns.
+var cardTransactionSortColumns = map[string]string{
+	"id":                    "id",
+	"amount":                "amount",
+	"currencyCodes":         "currency_code",
+	"dateTime":              "datetime",
+	"references":            "reference",
+	"merchantNames":         "merchant_name",
+	"merchantCities":        "merchant_city",
+	"merchantCountryCodes":  "merchant_country_code",
+	"merchantCountryNames":  "merchant_country_name",
+	"merchantCategoryCodes": "merchant_category_code",
+	"merchantCategoryNames": "merchant_category_name",
+	"anomalyScore":          "anomaly_score",
+	"relevance":             "relevance",
+}
 
+func cardTransactionSortColumn(sortField string) string {
+	column, ok := cardTransactionSortColumns[sortField]
+	if !ok {
+		return "id"
+	}
+	return column
+}
 
 func (p *PersistenceDataLayer) CreateCardTransaction(cardTransaction *CardTransaction) (int64, error) {
-	const cols = "datetime, amount, currency_scale, currency_code, reference, merchant_name, merchant_city, merchant_country_code, merchant_country_name, merchant_category_code, merchant_category_name, user_id"
+	const cols = "datetime, amount, currency_scale, currency_code, reference, merchant_name, merchant_city, merchant_country_code, merchant_country_name, merchant_category_code, merchant_category_name, notes, user_id"
 	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
 
 	sql := fmt.Sprintf("insert into card_transactions(%s) values (%s)", cols, bindCols)
@@ -48,6 +80,35 @@ func (p *PersistenceDataLayer) CreateCardTransaction(cardTransaction *CardTransa
 	return id, nil
 }
 
+// CreateCardTransactions stores every card transaction in a single database
+// transaction, setting the ID of each.  Nothing is stored if any insert fails.
+func (p *PersistenceDataLayer) CreateCardTransactions(cardTransactions []*CardTransaction) error {
+	const cols = "datetime, amount, currency_scale, currency_code, reference, merchant_name, merchant_city, merchant_country_code, merchant_country_name, merchant_category_code, merchant_category_name, notes, user_id"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return err
+	}
+
+	sql := fmt.Sprintf("insert into card_transactions(%s) values (%s)", cols, bindCols)
+	for _, cardTransaction := range cardTransactions {
+		result, err := tx.NamedExec(sql, cardTransaction)
+		if err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+
+		cardTransaction.ID, err = result.LastInsertId()
+		if err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (p *PersistenceDataLayer) GetCardTransactionByID(id int64) (*CardTransaction, error) {
 	cardTransaction := new(CardTransaction)
 	statement := "SELECT * FROM card_transactions WHERE id=?"
@@ -62,12 +123,24 @@ func (p *PersistenceDataLayer) GetCardTransactionByID(id int64) (*CardTransactio
 	return cardTransaction, nil
 }
 
-func (p *PersistenceDataLayer) GetCardTransactionsByUserID(userID int64, sortable pagination.Sortable, filter filters.CardTransactionFilter) ([]*CardTransaction, error) {
+// CardTransactionExists reports whether the user already has a transaction
+// at the same time, for the same amount, merchant and reference.
+func (p *PersistenceDataLayer) CardTransactionExists(userID int64, dateTime time.Time, amount int64, merchantName, reference string) (bool, error) {
+	var count int
+	statement := "SELECT COUNT(*) FROM card_transactions WHERE user_id=? AND datetime=? AND amount=? AND merchant_name=? AND reference=?"
+	err := p.GetConn().Get(&count, statement, userID, dateTime, amount, merchantName, reference)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetCardTransactionsByUserIDs returns the card transactions of the given
+// users that match the filter, one page at a time.
+func (p *PersistenceDataLayer) GetCardTransactionsByUserIDs(userIDs []int64, sortable pagination.Sortable, filter filters.CardTransactionFilter) ([]*CardTransaction, error) {
 	cardTransactions := make([]*CardTransaction, 0)
 	pageParams := sortable.GetPagination()
-	filterSQL, filterValues := GetFilterCriteria(filter)
-
-	dbSortField := pageParams.SortField
 
 	/*var pageFilterDir string
 	if pageParams.SortDir == pagination.SortDirectionDesc {
@@ -78,20 +151,17 @@ func (p *PersistenceDataLayer) GetCardTransactionsByUserID(userID int64, sortabl
 
 	//pagination := fmt.Sprintf(" and id %s ? order by %s %s, id %s limit %d", pageFilterDir, dbSortField, pageParams.SortDir, pageParams.SortDir, pageParams.FetchCount)
 	//offset := pageParams.Page * pageParams.FetchCount
-	pagination := pageParams.BuildPagination(dbSortField)
+	pagination := pageParams.BuildPagination(cardTransactionSortColumn(pageParams.SortField))
 	//pagination := fmt.Sprintf(" order by %s %s, id %s limit %d, %d", dbSortField, pageParams.SortDir, pageParams.SortDir, offset, pageParams.FetchCount)
-	statement := "SELECT * FROM card_transactions WHERE user_id=? " + filterSQL + pagination
-	fmt.Println(statement)
-	var bindValues []interface{}
-	bindValues = append(bindValues, userID)
-	bindValues = append(bindValues, filterValues...)
+	statement, bindValues, err := p.cardTransactionsQuery(userIDs, filter, pagination)
+	if err != nil {
+		return nil, err
+	}
 	//bindValues = append(bindValues, pageParams.FetchFrom)
 	rows, err := p.GetConn().Queryx(statement, bindValues...)
 	if err == sql.ErrNoRows {
-		fmt.Printf("There are no card transactions for user ID [%d]", userID)
 		return nil, ErrNoData
 	} else if err != nil {
-		fmt.Printf("Failed to query card transactions for user ID [%d] from database", userID)
 		return nil, err
 	}
 	defer rows.Close()
@@ -108,22 +178,118 @@ func (p *PersistenceDataLayer) GetCardTransactionsByUserID(userID int64, sortabl
 	return cardTransactions, nil
 }
 
-func GetFilterCriteria(filter filters.CardTransactionFilter) (string, []interface{}) {
+// GetCardTransactionsAfterID returns up to limit of the user's card
+// transactions with an id greater than afterID, oldest first.
+func (p *PersistenceDataLayer) GetCardTransactionsAfterID(userID, afterID int64, limit int) ([]*CardTransaction, error) {
+	cardTransactions := make([]*CardTransaction, 0)
+	statement := "SELECT * FROM card_transactions WHERE user_id=? AND id>? ORDER BY id LIMIT ?"
+	err := p.GetConn().Select(&cardTransactions, statement, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return cardTransactions, nil
+}
+
+// StreamCardTransactionsByUserIDs hands every matching card transaction to fn
+// in sort order without holding the result set in memory.  The query runs
+// before fn is first called, so a failure to query never reaches fn.
+func (p *PersistenceDataLayer) StreamCardTransactionsByUserIDs(userIDs []int64, sortable pagination.Sortable, filter filters.CardTransactionFilter, fn func(*CardTransaction) error) error {
+	pageParams := sortable.GetPagination()
+	ordering := pageParams.BuildOrdering(cardTransactionSortColumn(pageParams.SortField))
+	statement, bindValues, err := p.cardTransactionsQuery(userIDs, filter, ordering)
+	if err != nil {
+		return err
+	}
+	rows, err := p.GetConn().Queryx(statement, bindValues...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cardTransaction := new(CardTransaction)
+		err := rows.StructScan(cardTransaction)
+		if err != nil {
+			return err
+		}
+
+		err = fn(cardTransaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// cardTransactionsQuery selects the users' card transactions that match the
+// filter, adding a relevance column when the filter includes a search.
+func (p *PersistenceDataLayer) cardTransactionsQuery(userIDs []int64, filter filters.CardTransactionFilter, order string) (string, []interface{}, error) {
+	filterSQL, filterValues, err := GetFilterCriteria(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	relevanceSQL, relevanceValues, searchSQL, searchValues := getSearchCriteria(filter, "")
+
+	ownerSQL, ownerValues := userIDsPredicate("user_id", userIDs)
+	statement := "SELECT *" + relevanceSQL + " FROM card_transactions WHERE " + ownerSQL + " " + filterSQL + searchSQL + order
+	var bindValues []interface{}
+	bindValues = append(bindValues, relevanceValues...)
+	bindValues = append(bindValues, ownerValues...)
+	bindValues = append(bindValues, filterValues...)
+	bindValues = append(bindValues, searchValues...)
+	return statement, bindValues, nil
+}
+
+// userIDsPredicate restricts column to the given users.  An empty list
+// matches nothing rather than everybody.
+func userIDsPredicate(column string, userIDs []int64) (string, []interface{}) {
+	if len(userIDs) == 0 {
+		return "1=0", nil
+	}
+
+	placeholders := make([]string, len(userIDs))
+	values := make([]interface{}, len(userIDs))
+	for i, userID := range userIDs {
+		placeholders[i] = "?"
+		values[i] = userID
+	}
+
+	return fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")), values
+}
+
+func GetFilterCriteria(filter filters.CardTransactionFilter) (string, []interface{}, error) {
+	return getFilterCriteria(filter, "")
+}
+
+// getFilterCriteria builds the filter predicates with every column qualified
+// by prefix, for queries that join card_transactions to other tables.
+func getFilterCriteria(filter filters.CardTransactionFilter, prefix string) (string, []interface{}, error) {
 	builder := new(strings.Builder)
 	var values []interface{}
 	if filter.Amount.IsSet {
-		predicate := " and amount >= ? and amount < ? "
+		predicate := fmt.Sprintf(" and %samount >= ? and %samount < ? ", prefix, prefix)
 		builder.WriteString(predicate)
 		values = append(values, filter.Amount.LowerBound)
 		values = append(values, filter.Amount.UpperBound)
 	}
 
 	if filter.DateTime.IsSet {
-		predicate := " and datetime >= ? and datetime < ? "
+		predicate := fmt.Sprintf(" and %sdatetime >= ? and %sdatetime < ? ", prefix, prefix)
 		builder.WriteString(predicate)
 		values = append(values, filter.DateTime.LowerBound)
 		values = append(values, filter.DateTime.UpperBound)
 	}
 
-	return builder.String(), values
+	if filter.Expression != nil {
+		predicate, expressionValues, err := compileFilterExpression(filter.Expression, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		builder.WriteString(" and " + predicate + " ")
+		values = append(values, expressionValues...)
+	}
+
+	return builder.String(), values, nil
 }
\ No newline at end of file
@@ -0,0 +1,102 @@
+package datalayer
+
+import (
+	"database/sql"
+
+	"github.com/donohutcheon/gowebserver/models/filters"
+)
+
+type CardTransactionSplit struct {
+	Model
+	CardTransactionID int64         `json:"cardTransactionID" db:"card_transaction_id"`
+	Amount            int64         `json:"amount" db:"amount"`
+	CurrencyScale     int           `json:"scale" db:"currency_scale"`
+	Category          string        `json:"category" db:"category"`
+	Note              string        `json:"note" db:"note"`
+	UserID            sql.NullInt64 `json:"userID" db:"user_id"`
+}
+
+type CategorySummary struct {
+	Category         string `json:"category" db:"category"`
+	CurrencyCode     string `json:"currencyCode" db:"currency_code"`
+	Amount           int64  `json:"amount" db:"amount"`
+	CurrencyScale    int    `json:"scale" db:"currency_scale"`
+	TransactionCount int64  `json:"transactionCount" db:"transaction_count"`
+}
+
+// ReplaceCardTransactionSplits swaps out every split of a card transaction
+// for the given set in a single database transaction.
+func (p *PersistenceDataLayer) ReplaceCardTransactionSplits(cardTransactionID int64, splits []*CardTransactionSplit) error {
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("delete from card_transaction_splits where card_transaction_id = ?", cardTransactionID)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+
+	for _, split := range splits {
+		split.CardTransactionID = cardTransactionID
+		_, err = tx.NamedExec("insert into card_transaction_splits(card_transaction_id, amount, currency_scale, category, note, user_id) "+
+			"values (:card_transaction_id, :amount, :currency_scale, :category, :note, :user_id)", split)
+		if err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *PersistenceDataLayer) GetCardTransactionSplits(cardTransactionID int64) ([]*CardTransactionSplit, error) {
+	splits := make([]*CardTransactionSplit, 0)
+	err := p.GetConn().Select(&splits, "SELECT * FROM card_transaction_splits WHERE card_transaction_id=? ORDER BY id", cardTransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return splits, nil
+}
+
+// GetCategorySummaryByUserIDs totals the users' spend per category over the
+// transactions matching the filter and its search.  A split transaction
+// contributes its allocations instead of its merchant category, and
+// allocations assigned to another user count towards that user.
+func (p *PersistenceDataLayer) GetCategorySummaryByUserIDs(userIDs []int64, filter filters.CardTransactionFilter) ([]*CategorySummary, error) {
+	summaries := make([]*CategorySummary, 0)
+	filterSQL, filterValues, err := getFilterCriteria(filter, "t.")
+	if err != nil {
+		return nil, err
+	}
+	_, _, searchSQL, searchValues := getSearchCriteria(filter, "t.")
+	filterSQL += searchSQL
+	filterValues = append(filterValues, searchValues...)
+
+	splitOwnerSQL, ownerValues := userIDsPredicate("COALESCE(s.user_id, t.user_id)", userIDs)
+	ownerSQL, _ := userIDsPredicate("t.user_id", userIDs)
+	statement := "SELECT category, currency_code, currency_scale, SUM(amount) AS amount, COUNT(*) AS transaction_count FROM (" +
+		"SELECT s.category AS category, t.currency_code AS currency_code, s.currency_scale AS currency_scale, s.amount AS amount " +
+		"FROM card_transaction_splits s JOIN card_transactions t ON t.id = s.card_transaction_id " +
+		"WHERE " + splitOwnerSQL + " " + filterSQL +
+		"UNION ALL " +
+		"SELECT t.merchant_category_name AS category, t.currency_code AS currency_code, t.currency_scale AS currency_scale, t.amount AS amount " +
+		"FROM card_transactions t " +
+		"WHERE " + ownerSQL + " AND NOT EXISTS (SELECT 1 FROM card_transaction_splits s WHERE s.card_transaction_id = t.id) " + filterSQL +
+		") allocations GROUP BY category, currency_code, currency_scale ORDER BY amount DESC"
+
+	var bindValues []interface{}
+	bindValues = append(bindValues, ownerValues...)
+	bindValues = append(bindValues, filterValues...)
+	bindValues = append(bindValues, ownerValues...)
+	bindValues = append(bindValues, filterValues...)
+
+	err = p.GetConn().Select(&summaries, statement, bindValues...)
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
@@ -1,6 +1,8 @@
 package datalayer
 
 import (
+	"time"
+
 	"github.com/donohutcheon/gowebserver/models/filters"
 	"github.com/donohutcheon/gowebserver/models/pagination"
 )
@@ -13,6 +15,7 @@ const (
 	UserStateProcessing  UserState = "PROCESSING"
 	UserStatePending     UserState = "PENDING"
 	UserStateConfirmed   UserState = "CONFIRMED"
+	UserStateDisabled    UserState = "DISABLED"
 )
 
 type DataLayer interface {
@@ -20,15 +23,163 @@ type DataLayer interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int64) (*User, error)
 	CreateUser(email, password string) (int64, error)
-	GetUnconfirmedUsers() ([]User, error)
+	GetUnconfirmedUsers(createdAfter, createdBefore time.Time) ([]User, error)
+	GetUnsentEmailChanges(changedAfter, changedBefore, now time.Time) ([]User, error)
 	SetUserStateByID(id int64, state UserState) error
+	ChangeUserStateByID(id int64, from, to UserState) (bool, error)
+	SetUserRolesByID(id int64, roles string) error
+	SearchUsers(query string, state UserState, sortable pagination.Sortable) ([]*User, error)
+	DeleteUserByID(id int64, now time.Time) error
+	SetUserLoggedOutAt(id int64, loggedOutAt time.Time) error
+	SetUserPasswordByID(id int64, password string) error
+	SetUserPendingEmailByID(id int64, email string) error
+	ChangeUserEmailByID(id int64, email string) error
+
+	// Revoked tokens
+	RevokeToken(userID int64, tokenID string, expiresAt time.Time) error
+	IsTokenRevoked(tokenID string) (bool, error)
+	DeleteExpiredRevokedTokens(now time.Time) error
+
+	// Refresh tokens
+	CreateRefreshToken(token *RefreshToken) (int64, error)
+	GetRefreshTokenByTokenID(tokenID string) (*RefreshToken, error)
+	UseRefreshToken(tokenID string, now time.Time) (bool, error)
+	DeleteExpiredRefreshTokens(userID int64, now time.Time) error
+
+	// Password resets
+	CreatePasswordReset(reset *PasswordReset) (int64, error)
+	GetPasswordResetByTokenHash(tokenHash string) (*PasswordReset, error)
+	GetLatestPasswordResetByUserID(userID int64) (*PasswordReset, error)
+	UsePasswordReset(id int64, now time.Time) (bool, error)
+	DeletePasswordResetsByUserID(userID int64) error
+
+	// Login attempts
+	GetLoginAttempt(key string) (*LoginAttempt, error)
+	SaveLoginAttempt(attempt *LoginAttempt) error
+	DeleteLoginAttempt(key string) error
+	DeleteLoginAttemptsBefore(before time.Time) error
+
+	// Two-factor authentication
+	CreateTOTP(userID int64, secret string) (int64, error)
+	GetTOTPByUserID(userID int64) (*TOTP, error)
+	EnableTOTP(userID int64, now time.Time) error
+	UseTOTPStep(userID, step int64) (bool, error)
+	DeleteTOTPByUserID(userID int64) error
+	CreateRecoveryCodes(userID int64, codeHashes []string) error
+	UseRecoveryCode(userID int64, codeHash string, now time.Time) (bool, error)
+	CountUnusedRecoveryCodes(userID int64) (int, error)
+	DeleteRecoveryCodesByUserID(userID int64) error
+
+	// API tokens
+	CreateAPIToken(token *APIToken) (int64, error)
+	GetAPITokenByID(id int64) (*APIToken, error)
+	GetAPITokenByHash(tokenHash string) (*APIToken, error)
+	GetAPITokensByUserID(userID int64) ([]*APIToken, error)
+	SetAPITokenLastUsedAt(id int64, lastUsedAt time.Time) error
+	RevokeAPIToken(userID, id int64, now time.Time) error
+
+	// User audit
+	CreateUserAuditRecord(record *UserAuditRecord) (int64, error)
+	GetUserAuditRecordsByUserID(userID int64, limit int) ([]*UserAuditRecord, error)
 
 	// Transactions
 	CreateCardTransaction(*CardTransaction) (int64, error)
+	CreateCardTransactions(cardTransactions []*CardTransaction) error
 	GetCardTransactionByID(id int64) (*CardTransaction, error)
-	GetCardTransactionsByUserID(userID int64, sortable pagination.Sortable, filter filters.CardTransactionFilter) ([]*CardTransaction, error)
+	CardTransactionExists(userID int64, dateTime time.Time, amount int64, merchantName, reference string) (bool, error)
+	GetCardTransactionsByUserIDs(userIDs []int64, sortable pagination.Sortable, filter filters.CardTransactionFilter) ([]*CardTransaction, error)
+	GetCardTransactionsAfterID(userID, afterID int64, limit int) ([]*CardTransaction, error)
+	StreamCardTransactionsByUserIDs(userIDs []int64, sortable pagination.Sortable, filter filters.CardTransactionFilter, fn func(*CardTransaction) error) error
+
+	// Transaction splits
+	ReplaceCardTransactionSplits(cardTransactionID int64, splits []*CardTransactionSplit) error
+	GetCardTransactionSplits(cardTransactionID int64) ([]*CardTransactionSplit, error)
+	GetCategorySummaryByUserIDs(userIDs []int64, filter filters.CardTransactionFilter) ([]*CategorySummary, error)
+
+	// Saved views
+	CreateSavedView(view *SavedView) (int64, error)
+	GetSavedViewByID(id int64) (*SavedView, error)
+	GetSavedViewsByUserID(userID int64) ([]*SavedView, error)
+	SavedViewNameExists(userID int64, name string, excludeID int64) (bool, error)
+	UpdateSavedView(view *SavedView) error
+	DeleteSavedView(userID, id int64) error
+
+	// Webhooks
+	CreateWebhook(webhook *Webhook) (int64, error)
+	GetWebhookByID(id int64) (*Webhook, error)
+	GetWebhooksByUserID(userID int64) ([]*Webhook, error)
+	UpdateWebhook(webhook *Webhook) error
+	DeleteWebhook(userID, id int64) error
+	CreateWebhookDelivery(delivery *WebhookDelivery) (int64, error)
+	GetWebhookDeliveryByID(id int64) (*WebhookDelivery, error)
+	GetWebhookDeliveriesByWebhookID(webhookID int64, limit int) ([]*WebhookDelivery, error)
+	GetDueWebhookDeliveries(now time.Time, limit int) ([]*WebhookDelivery, error)
+	ClaimWebhookDelivery(id int64, now, leaseUntil time.Time) (bool, error)
+	UpdateWebhookDeliveryAttempt(delivery *WebhookDelivery) error
+
+	// Alerts
+	CreateAlertRule(rule *AlertRule) (int64, error)
+	GetAlertRuleByID(id int64) (*AlertRule, error)
+	GetAlertRulesByUserID(userID int64) ([]*AlertRule, error)
+	UpdateAlertRule(rule *AlertRule) error
+	DeleteAlertRule(userID, id int64) error
+	ClaimAlertRuleFiring(id int64, now, cooledDownAt time.Time) (bool, error)
+	CreateAlertFiring(firing *AlertFiring) (int64, error)
+	GetAlertFiringsByUserID(userID, ruleID, cardTransactionID int64, limit int) ([]*AlertFiring, error)
+	MerchantSeenBefore(userID int64, merchantName string, beforeID int64) (bool, error)
+
+	// Anomalies
+	GetSpendingStatistic(userID int64, dimension, key, currencyCode string) (*SpendingStatistic, error)
+	GetSpendingStatisticsByDimension(userID int64, dimension string) ([]*SpendingStatistic, error)
+	SaveSpendingStatistic(statistic *SpendingStatistic) error
+	SetCardTransactionAnomaly(id int64, score int, reasons string) error
+	CountrySeenBefore(userID int64, countryCode string, beforeID int64) (bool, error)
+	GetUnevaluatedCardTransactions(limit int) ([]*CardTransaction, error)
+	ClaimCardTransactionEvaluation(id int64, now time.Time) (bool, error)
+
+	// Reports
+	GetReportPreferenceByUserID(userID int64) (*ReportPreference, error)
+	CreateReportPreference(preference *ReportPreference) (int64, error)
+	UpdateReportPreference(preference *ReportPreference) error
+	GetDueReportPreferences(now time.Time, limit int) ([]*ReportPreference, error)
+	ClaimReport(id int64, scheduledAt, nextReportAt time.Time) (bool, error)
+	ReleaseReport(id int64, scheduledAt, nextReportAt time.Time) error
+	SetReportSent(id int64, sentAt time.Time) error
+	GetMerchantSummaryByUserID(userID int64, from, to time.Time, limit int) ([]*MerchantSummary, error)
+	GetLargestCardTransactionsByUserID(userID int64, from, to time.Time, limit int) ([]*CardTransaction, error)
+
+	// Goals and cash flows
+	CreateGoal(goal *Goal) (int64, error)
+	GetGoalByID(id int64) (*Goal, error)
+	GetGoalsByUserID(userID int64) ([]*Goal, error)
+	UpdateGoal(goal *Goal) error
+	DeleteGoal(userID, id int64) error
+	CreateCashFlow(cashFlow *CashFlow) (int64, error)
+	GetCashFlowByID(id int64) (*CashFlow, error)
+	GetCashFlowsByUserID(userID int64) ([]*CashFlow, error)
+	UpdateCashFlow(cashFlow *CashFlow) error
+	DeleteCashFlow(userID, id int64) error
+
+	// Households
+	CreateHousehold(household *Household) (int64, error)
+	GetHouseholdByID(id int64) (*Household, error)
+	GetHouseholdsByUserID(userID int64) ([]*Household, error)
+	DeleteHousehold(id int64) error
+	GetHouseholdMembers(householdID int64) ([]*HouseholdMember, error)
+	RemoveHouseholdMember(householdID, userID int64) error
+	CreateHouseholdInvitation(invitation *HouseholdInvitation) (int64, error)
+	GetHouseholdInvitationByTokenHash(tokenHash string) (*HouseholdInvitation, error)
+	AcceptHouseholdInvitation(invitation *HouseholdInvitation, userID int64, now time.Time) (bool, error)
+	SetHouseholdGrant(grant *HouseholdGrant) error
+	GetHouseholdGrantsByHouseholdID(householdID int64) ([]*HouseholdGrant, error)
+	GetHouseholdGrantsByGranteeID(granteeUserID int64) ([]*HouseholdGrant, error)
 
 	// SignUpConfirmations
-	CreateSignUpConfirmation(nonce string, userID int64) (int64, error)
-	LookupSignUpConfirmation(nonce string) (*SignUpConfirmation, error)
+	CreateSignUpConfirmation(nonceHash string, userID int64, expiresAt time.Time) (int64, error)
+	GetSignUpConfirmationByNonceHash(nonceHash string) (*SignUpConfirmation, error)
+	CreateEmailChangeConfirmation(nonceHash string, userID int64, email string, expiresAt time.Time) (int64, error)
+	GetLatestSignUpConfirmationByUserID(userID int64) (*SignUpConfirmation, error)
+	UseSignUpConfirmation(id int64, now time.Time) (bool, error)
+	DeleteExpiredSignUpConfirmations(before time.Time) error
+	DeleteSignUpConfirmation(id int64) error
 }
\ No newline at end of file
@@ -0,0 +1,105 @@
+package datalayer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/donohutcheon/gowebserver/models/filters"
+)
+
+// cardTransactionFilterColumns maps the fields of a filter expression onto
+// their columns.  Only fields listed here can reach the SQL.
+var cardTransactionFilterColumns = map[string]string{
+	"id":                   "id",
+	"dateTime":             "datetime",
+	"amount":               "amount",
+	"currencyCode":         "currency_code",
+	"reference":            "reference",
+	"merchantName":         "merchant_name",
+	"merchantCity":         "merchant_city",
+	"merchantCountryCode":  "merchant_country_code",
+	"merchantCountryName":  "merchant_country_name",
+	"merchantCategoryCode": "merchant_category_code",
+	"merchantCategoryName": "merchant_category_name",
+	"notes":                "notes",
+	"anomalyScore":         "anomaly_score",
+}
+
+var comparisonOperators = map[string]string{
+	"=":  "=",
+	"!=": "<>",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+// compileFilterExpression renders a parsed filter as a parameterised SQL
+// predicate with every column qualified by prefix.
+func compileFilterExpression(expr filters.Expression, prefix string) (string, []interface{}, error) {
+	switch x := expr.(type) {
+	case filters.And:
+		return compileBinary(x.Left, x.Right, "AND", prefix)
+	case filters.Or:
+		return compileBinary(x.Left, x.Right, "OR", prefix)
+	case filters.Not:
+		predicate, values, err := compileFilterExpression(x.Expression, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + predicate, values, nil
+	case filters.Comparison:
+		column, placeholder, err := filterOperands(x.Field, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		op, ok := comparisonOperators[x.Operator]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported filter operator %q", x.Operator)
+		}
+		return fmt.Sprintf("(%s %s %s)", column, op, placeholder), []interface{}{x.Value}, nil
+	case filters.In:
+		column, placeholder, err := filterOperands(x.Field, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		placeholders := make([]string, len(x.Values))
+		for i := range x.Values {
+			placeholders[i] = placeholder
+		}
+		op := "IN"
+		if x.Negate {
+			op = "NOT IN"
+		}
+		return fmt.Sprintf("(%s %s (%s))", column, op, strings.Join(placeholders, ", ")), x.Values, nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported filter expression %T", expr)
+}
+
+func compileBinary(left, right filters.Expression, op, prefix string) (string, []interface{}, error) {
+	leftSQL, leftValues, err := compileFilterExpression(left, prefix)
+	if err != nil {
+		return "", nil, err
+	}
+	rightSQL, rightValues, err := compileFilterExpression(right, prefix)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "(" + leftSQL + " " + op + " " + rightSQL + ")", append(leftValues, rightValues...), nil
+}
+
+// filterOperands returns the column and bind placeholder for field.  Amounts
+// are given in whole currency units and scaled to each row's minor units.
+func filterOperands(field, prefix string) (string, string, error) {
+	column, ok := cardTransactionFilterColumns[field]
+	if !ok {
+		return "", "", fmt.Errorf("%s cannot be filtered on", field)
+	}
+
+	if field == "amount" {
+		return prefix + column, fmt.Sprintf("CAST(? AS DECIMAL(30,10)) * POWER(10, %scurrency_scale)", prefix), nil
+	}
+	return prefix + column, "?", nil
+}
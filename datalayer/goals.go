@@ -0,0 +1,128 @@
+package datalayer
+
+import (
+	"database/sql"
+)
+
+type Goal struct {
+	Model
+	UserID        int64        `json:"userID" db:"user_id"`
+	Name          string       `json:"name" db:"name"`
+	TargetAmount  int64        `json:"targetAmount" db:"target_amount"`
+	SavedAmount   int64        `json:"savedAmount" db:"saved_amount"`
+	CurrencyScale int          `json:"scale" db:"currency_scale"`
+	CurrencyCode  string       `json:"currencyCode" db:"currency_code"`
+	TargetDate    JsonNullTime `json:"targetDate" db:"target_date"`
+}
+
+type CashFlowKind string
+
+const (
+	CashFlowIncome  CashFlowKind = "INCOME"
+	CashFlowPayment CashFlowKind = "PAYMENT"
+)
+
+// CashFlow is money that comes in or goes out on the same day every month.
+// A payment made by card names its merchant so that it is not counted again
+// as discretionary spend.
+type CashFlow struct {
+	Model
+	UserID        int64        `json:"userID" db:"user_id"`
+	Name          string       `json:"name" db:"name"`
+	Kind          CashFlowKind `json:"kind" db:"kind"`
+	Amount        int64        `json:"amount" db:"amount"`
+	CurrencyScale int          `json:"scale" db:"currency_scale"`
+	CurrencyCode  string       `json:"currencyCode" db:"currency_code"`
+	DayOfMonth    int          `json:"dayOfMonth" db:"day_of_month"`
+	MerchantName  string       `json:"merchantName" db:"merchant_name"`
+}
+
+func (p *PersistenceDataLayer) CreateGoal(goal *Goal) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into goals(user_id, name, target_amount, saved_amount, currency_scale, "+
+		"currency_code, target_date) values (:user_id, :name, :target_amount, :saved_amount, :currency_scale, "+
+		":currency_code, :target_date)", goal)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetGoalByID(id int64) (*Goal, error) {
+	goal := new(Goal)
+	err := p.GetConn().Get(goal, "SELECT * FROM goals WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return goal, nil
+}
+
+func (p *PersistenceDataLayer) GetGoalsByUserID(userID int64) ([]*Goal, error) {
+	goals := make([]*Goal, 0)
+	err := p.GetConn().Select(&goals, "SELECT * FROM goals WHERE user_id=? ORDER BY target_date, id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+func (p *PersistenceDataLayer) UpdateGoal(goal *Goal) error {
+	_, err := p.GetConn().NamedExec("update goals set name=:name, target_amount=:target_amount, "+
+		"saved_amount=:saved_amount, currency_scale=:currency_scale, currency_code=:currency_code, "+
+		"target_date=:target_date where id=:id and user_id=:user_id", goal)
+	return err
+}
+
+func (p *PersistenceDataLayer) DeleteGoal(userID, id int64) error {
+	_, err := p.GetConn().Exec("delete from goals where id=? and user_id=?", id, userID)
+	return err
+}
+
+func (p *PersistenceDataLayer) CreateCashFlow(cashFlow *CashFlow) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into cash_flows(user_id, name, kind, amount, currency_scale, "+
+		"currency_code, day_of_month, merchant_name) values (:user_id, :name, :kind, :amount, :currency_scale, "+
+		":currency_code, :day_of_month, :merchant_name)", cashFlow)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetCashFlowByID(id int64) (*CashFlow, error) {
+	cashFlow := new(CashFlow)
+	err := p.GetConn().Get(cashFlow, "SELECT * FROM cash_flows WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return cashFlow, nil
+}
+
+func (p *PersistenceDataLayer) GetCashFlowsByUserID(userID int64) ([]*CashFlow, error) {
+	cashFlows := make([]*CashFlow, 0)
+	err := p.GetConn().Select(&cashFlows, "SELECT * FROM cash_flows WHERE user_id=? ORDER BY day_of_month, id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return cashFlows, nil
+}
+
+func (p *PersistenceDataLayer) UpdateCashFlow(cashFlow *CashFlow) error {
+	_, err := p.GetConn().NamedExec("update cash_flows set name=:name, kind=:kind, amount=:amount, "+
+		"currency_scale=:currency_scale, currency_code=:currency_code, day_of_month=:day_of_month, "+
+		"merchant_name=:merchant_name where id=:id and user_id=:user_id", cashFlow)
+	return err
+}
+
+func (p *PersistenceDataLayer) DeleteCashFlow(userID, id int64) error {
+	_, err := p.GetConn().Exec("delete from cash_flows where id=? and user_id=?", id, userID)
+	return err
+}
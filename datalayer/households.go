@@ -0,0 +1,251 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// HouseholdAccess is how much of a member's card transactions another member
+// of the household has been granted.
+type HouseholdAccess string
+
+const (
+	HouseholdAccessNone      HouseholdAccess = "NONE"
+	HouseholdAccessRead      HouseholdAccess = "READ"
+	HouseholdAccessReadWrite HouseholdAccess = "READ_WRITE"
+)
+
+type Household struct {
+	Model
+	Name        string `json:"name" db:"name"`
+	OwnerUserID int64  `json:"ownerUserID" db:"owner_user_id"`
+}
+
+type HouseholdMember struct {
+	Model
+	HouseholdID int64  `json:"householdID" db:"household_id"`
+	UserID      int64  `json:"userID" db:"user_id"`
+	Email       string `json:"email" db:"email"`
+}
+
+// HouseholdInvitation is an emailed link to join a household.  Only a hash
+// of its token is kept.
+type HouseholdInvitation struct {
+	Model
+	HouseholdID     int64        `json:"householdID" db:"household_id"`
+	InvitedByUserID int64        `json:"invitedByUserID" db:"invited_by_user_id"`
+	Email           string       `json:"email" db:"email"`
+	TokenHash       string       `json:"-" db:"token_hash"`
+	ExpiresAt       time.Time    `json:"expiresAt" db:"expires_at"`
+	AcceptedAt      JsonNullTime `json:"acceptedAt" db:"accepted_at"`
+}
+
+// HouseholdGrant gives the grantee access to the grantor's card
+// transactions for as long as both belong to the household.
+type HouseholdGrant struct {
+	Model
+	HouseholdID   int64           `json:"householdID" db:"household_id"`
+	GrantorUserID int64           `json:"grantorUserID" db:"grantor_user_id"`
+	GranteeUserID int64           `json:"granteeUserID" db:"grantee_user_id"`
+	Access        HouseholdAccess `json:"access" db:"access"`
+}
+
+// CreateHousehold stores a household with its owner as the first member.
+func (p *PersistenceDataLayer) CreateHousehold(household *Household) (int64, error) {
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.NamedExec("insert into households(name, owner_user_id) values (:name, :owner_user_id)", household)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return 0, err
+	}
+
+	_, err = tx.Exec("insert into household_members(household_id, user_id) values (?, ?)", id, household.OwnerUserID)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (p *PersistenceDataLayer) GetHouseholdByID(id int64) (*Household, error) {
+	household := new(Household)
+	err := p.GetConn().Get(household, "SELECT * FROM households WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return household, nil
+}
+
+// GetHouseholdsByUserID returns the households the user is a member of.
+func (p *PersistenceDataLayer) GetHouseholdsByUserID(userID int64) ([]*Household, error) {
+	households := make([]*Household, 0)
+	err := p.GetConn().Select(&households, "SELECT h.* FROM households h JOIN household_members m ON m.household_id = h.id "+
+		"WHERE m.user_id=? ORDER BY h.id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return households, nil
+}
+
+func (p *PersistenceDataLayer) DeleteHousehold(id int64) error {
+	_, err := p.GetConn().Exec("delete from households where id=?", id)
+	return err
+}
+
+func (p *PersistenceDataLayer) GetHouseholdMembers(householdID int64) ([]*HouseholdMember, error) {
+	members := make([]*HouseholdMember, 0)
+	err := p.GetConn().Select(&members, "SELECT m.*, u.email AS email FROM household_members m JOIN users u ON u.id = m.user_id "+
+		"WHERE m.household_id=? ORDER BY m.id", householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// RemoveHouseholdMember takes the user out of the household together with
+// every grant they gave or were given in it.
+func (p *PersistenceDataLayer) RemoveHouseholdMember(householdID, userID int64) error {
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("delete from household_grants where household_id=? and (grantor_user_id=? or grantee_user_id=?)",
+		householdID, userID, userID)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+
+	_, err = tx.Exec("delete from household_members where household_id=? and user_id=?", householdID, userID)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *PersistenceDataLayer) CreateHouseholdInvitation(invitation *HouseholdInvitation) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into household_invitations(household_id, invited_by_user_id, email, "+
+		"token_hash, expires_at) values (:household_id, :invited_by_user_id, :email, :token_hash, :expires_at)", invitation)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetHouseholdInvitationByTokenHash(tokenHash string) (*HouseholdInvitation, error) {
+	invitation := new(HouseholdInvitation)
+	err := p.GetConn().Get(invitation, "SELECT * FROM household_invitations WHERE token_hash=?", tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// AcceptHouseholdInvitation marks the invitation accepted and adds the user
+// to its household.  It reports false, changing nothing, when the
+// invitation has already been accepted or has expired.
+func (p *PersistenceDataLayer) AcceptHouseholdInvitation(invitation *HouseholdInvitation, userID int64, now time.Time) (bool, error) {
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec("update household_invitations set accepted_at=? where id=? and accepted_at is null "+
+		"and expires_at > ?", now, invitation.ID, now)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		tx.Rollback() //nolint:errcheck
+		return false, err
+	}
+
+	var count int
+	err = tx.Get(&count, "SELECT COUNT(*) FROM household_members WHERE household_id=? AND user_id=?", invitation.HouseholdID, userID)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return false, err
+	}
+	if count == 0 {
+		_, err = tx.Exec("insert into household_members(household_id, user_id) values (?, ?)", invitation.HouseholdID, userID)
+		if err != nil {
+			tx.Rollback() //nolint:errcheck
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// SetHouseholdGrant stores the grant, replacing any earlier grant between the
+// same members of the household.  A grant of HouseholdAccessNone is removed.
+func (p *PersistenceDataLayer) SetHouseholdGrant(grant *HouseholdGrant) error {
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("delete from household_grants where household_id=? and grantor_user_id=? and grantee_user_id=?",
+		grant.HouseholdID, grant.GrantorUserID, grant.GranteeUserID)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+
+	if grant.Access != HouseholdAccessNone {
+		_, err = tx.NamedExec("insert into household_grants(household_id, grantor_user_id, grantee_user_id, access) "+
+			"values (:household_id, :grantor_user_id, :grantee_user_id, :access)", grant)
+		if err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *PersistenceDataLayer) GetHouseholdGrantsByHouseholdID(householdID int64) ([]*HouseholdGrant, error) {
+	grants := make([]*HouseholdGrant, 0)
+	err := p.GetConn().Select(&grants, "SELECT * FROM household_grants WHERE household_id=? ORDER BY id", householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// GetHouseholdGrantsByGranteeID returns every grant the user has been given,
+// in any household.
+func (p *PersistenceDataLayer) GetHouseholdGrantsByGranteeID(granteeUserID int64) ([]*HouseholdGrant, error) {
+	grants := make([]*HouseholdGrant, 0)
+	err := p.GetConn().Select(&grants, "SELECT * FROM household_grants WHERE grantee_user_id=? ORDER BY id", granteeUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
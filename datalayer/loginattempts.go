@@ -0,0 +1,60 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoginAttempt counts the failed logins of an account or an IP address,
+// named by AttemptKey, and when the next attempt will be let through.
+type LoginAttempt struct {
+	Model
+	AttemptKey    string       `json:"attemptKey" db:"attempt_key"`
+	Failures      int          `json:"failures" db:"failures"`
+	LastFailureAt JsonNullTime `json:"lastFailureAt" db:"last_failure_at"`
+	BlockedUntil  JsonNullTime `json:"blockedUntil" db:"blocked_until"`
+}
+
+func (p *PersistenceDataLayer) GetLoginAttempt(key string) (*LoginAttempt, error) {
+	attempt := new(LoginAttempt)
+	err := p.GetConn().Get(attempt, "SELECT * FROM login_attempts WHERE attempt_key=?", key)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return attempt, nil
+}
+
+// SaveLoginAttempt stores the attempt under its key, replacing any stored
+// before.
+func (p *PersistenceDataLayer) SaveLoginAttempt(attempt *LoginAttempt) error {
+	var count int
+	err := p.GetConn().Get(&count, "SELECT COUNT(*) FROM login_attempts WHERE attempt_key=?", attempt.AttemptKey)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		_, err = p.GetConn().NamedExec("insert into login_attempts(attempt_key, failures, last_failure_at, blocked_until) "+
+			"values (:attempt_key, :failures, :last_failure_at, :blocked_until)", attempt)
+		return err
+	}
+
+	_, err = p.GetConn().NamedExec("update login_attempts set failures = :failures, last_failure_at = :last_failure_at, "+
+		"blocked_until = :blocked_until where attempt_key = :attempt_key", attempt)
+	return err
+}
+
+func (p *PersistenceDataLayer) DeleteLoginAttempt(key string) error {
+	_, err := p.GetConn().Exec("delete from login_attempts where attempt_key = ?", key)
+	return err
+}
+
+// DeleteLoginAttemptsBefore forgets attempts whose last failure was before
+// the given time.
+func (p *PersistenceDataLayer) DeleteLoginAttemptsBefore(before time.Time) error {
+	_, err := p.GetConn().Exec("delete from login_attempts where last_failure_at < ?", before)
+	return err
+}
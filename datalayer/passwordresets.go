@@ -0,0 +1,72 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PasswordReset is an emailed link to choose a new password.  Only a hash of
+// its token is kept.
+type PasswordReset struct {
+	Model
+	UserID    int64        `json:"userID" db:"user_id"`
+	TokenHash string       `json:"-" db:"token_hash"`
+	ExpiresAt time.Time    `json:"expiresAt" db:"expires_at"`
+	UsedAt    JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) CreatePasswordReset(reset *PasswordReset) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into password_resets(user_id, token_hash, expires_at) "+
+		"values (:user_id, :token_hash, :expires_at)", reset)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetPasswordResetByTokenHash(tokenHash string) (*PasswordReset, error) {
+	reset := new(PasswordReset)
+	err := p.GetConn().Get(reset, "SELECT * FROM password_resets WHERE token_hash=?", tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+func (p *PersistenceDataLayer) GetLatestPasswordResetByUserID(userID int64) (*PasswordReset, error) {
+	reset := new(PasswordReset)
+	err := p.GetConn().Get(reset, "SELECT * FROM password_resets WHERE user_id=? ORDER BY id DESC LIMIT 1", userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+// UsePasswordReset marks the reset used, reporting false if it already was or
+// has expired, so that each link works once even when used concurrently.
+func (p *PersistenceDataLayer) UsePasswordReset(id int64, now time.Time) (bool, error) {
+	result, err := p.GetConn().Exec("update password_resets set used_at = ? "+
+		"where id = ? and used_at is null and expires_at > ?", now, id, now)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (p *PersistenceDataLayer) DeletePasswordResetsByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("delete from password_resets where user_id = ?", userID)
+	return err
+}
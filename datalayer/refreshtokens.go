@@ -0,0 +1,65 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RefreshToken is an issued refresh token.  Every refresh replaces the token
+// used with a new one of the same family; UsedAt is set once a token has been
+// exchanged, after which presenting it again is reuse.
+type RefreshToken struct {
+	Model
+	TokenID   string       `json:"tokenID" db:"token_id"`
+	FamilyID  string       `json:"familyID" db:"family_id"`
+	UserID    int64        `json:"userID" db:"user_id"`
+	ExpiresAt time.Time    `json:"expiresAt" db:"expires_at"`
+	UsedAt    JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) CreateRefreshToken(token *RefreshToken) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into refresh_tokens(token_id, family_id, user_id, expires_at) "+
+		"values (:token_id, :family_id, :user_id, :expires_at)", token)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetRefreshTokenByTokenID(tokenID string) (*RefreshToken, error) {
+	token := new(RefreshToken)
+	err := p.GetConn().Get(token, "SELECT * FROM refresh_tokens WHERE token_id=?", tokenID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// UseRefreshToken marks the token exchanged.  It reports false if the token
+// had already been used, which makes the exchange safe against concurrent
+// reuse.
+func (p *PersistenceDataLayer) UseRefreshToken(tokenID string, now time.Time) (bool, error) {
+	result, err := p.GetConn().Exec("update refresh_tokens set used_at = ? where token_id = ? and used_at is null",
+		now, tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// DeleteExpiredRefreshTokens forgets the user's refresh tokens that have
+// expired, used or not.
+func (p *PersistenceDataLayer) DeleteExpiredRefreshTokens(userID int64, now time.Time) error {
+	_, err := p.GetConn().Exec("delete from refresh_tokens where user_id = ? and expires_at < ?", userID, now)
+	return err
+}
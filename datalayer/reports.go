@@ -0,0 +1,146 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ReportCadence string
+
+const (
+	ReportCadenceNone    ReportCadence = "NONE"
+	ReportCadenceWeekly  ReportCadence = "WEEKLY"
+	ReportCadenceMonthly ReportCadence = "MONTHLY"
+)
+
+type ReportPreference struct {
+	Model
+	UserID       int64         `json:"userID" db:"user_id"`
+	Cadence      ReportCadence `json:"cadence" db:"cadence"`
+	Timezone     string        `json:"timezone" db:"timezone"`
+	NextReportAt JsonNullTime  `json:"nextReportAt" db:"next_report_at"`
+	LastSentAt   JsonNullTime  `json:"lastSentAt" db:"last_sent_at"`
+}
+
+// MerchantSummary totals a user's spend at one merchant.
+type MerchantSummary struct {
+	MerchantName     string `json:"merchantName" db:"merchant_name"`
+	CurrencyCode     string `json:"currencyCode" db:"currency_code"`
+	Amount           int64  `json:"amount" db:"amount"`
+	CurrencyScale    int    `json:"scale" db:"currency_scale"`
+	TransactionCount int64  `json:"transactionCount" db:"transaction_count"`
+}
+
+func (p *PersistenceDataLayer) GetReportPreferenceByUserID(userID int64) (*ReportPreference, error) {
+	preference := new(ReportPreference)
+	err := p.GetConn().Get(preference, "SELECT * FROM report_preferences WHERE user_id=?", userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return preference, nil
+}
+
+func (p *PersistenceDataLayer) CreateReportPreference(preference *ReportPreference) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into report_preferences(user_id, cadence, timezone, next_report_at) "+
+		"values (:user_id, :cadence, :timezone, :next_report_at)", preference)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) UpdateReportPreference(preference *ReportPreference) error {
+	_, err := p.GetConn().NamedExec("update report_preferences set cadence=:cadence, timezone=:timezone, "+
+		"next_report_at=:next_report_at where user_id=:user_id", preference)
+	return err
+}
+
+// GetDueReportPreferences returns the preferences whose next report is due,
+// oldest first.
+func (p *PersistenceDataLayer) GetDueReportPreferences(now time.Time, limit int) ([]*ReportPreference, error) {
+	preferences := make([]*ReportPreference, 0)
+	err := p.GetConn().Select(&preferences, "SELECT * FROM report_preferences WHERE cadence<>? AND next_report_at<=? "+
+		"ORDER BY next_report_at, id LIMIT ?", ReportCadenceNone, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return preferences, nil
+}
+
+// ClaimReport moves the preference's next report from scheduledAt to
+// nextReportAt.  It reports false when another server has already claimed
+// the report due at scheduledAt or the preference has since changed.
+func (p *PersistenceDataLayer) ClaimReport(id int64, scheduledAt, nextReportAt time.Time) (bool, error) {
+	result, err := p.GetConn().Exec("update report_preferences set next_report_at=? "+
+		"where id=? and next_report_at=?", nextReportAt, id, scheduledAt)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// ReleaseReport undoes a claim of the report due at scheduledAt that could
+// not be sent, so that it is sent on a later run.  A claim that has since
+// been superseded is left alone.
+func (p *PersistenceDataLayer) ReleaseReport(id int64, scheduledAt, nextReportAt time.Time) error {
+	_, err := p.GetConn().Exec("update report_preferences set next_report_at=? where id=? and next_report_at=?",
+		scheduledAt, id, nextReportAt)
+	return err
+}
+
+// SetReportSent records when the preference's last report was sent.
+func (p *PersistenceDataLayer) SetReportSent(id int64, sentAt time.Time) error {
+	_, err := p.GetConn().Exec("update report_preferences set last_sent_at=? where id=?", sentAt, id)
+	return err
+}
+
+// GetMerchantSummaryByUserID totals the user's spend per merchant between
+// from and to, largest first.  Like GetCategorySummaryByUserIDs it counts
+// the allocations of split transactions assigned to the user rather than
+// the transactions they paid for.
+func (p *PersistenceDataLayer) GetMerchantSummaryByUserID(userID int64, from, to time.Time, limit int) ([]*MerchantSummary, error) {
+	summaries := make([]*MerchantSummary, 0)
+	statement := "SELECT merchant_name, currency_code, currency_scale, SUM(amount) AS amount, " +
+		"COUNT(DISTINCT card_transaction_id) AS transaction_count FROM (" +
+		"SELECT t.id AS card_transaction_id, t.merchant_name AS merchant_name, t.currency_code AS currency_code, " +
+		"s.currency_scale AS currency_scale, s.amount AS amount " +
+		"FROM card_transaction_splits s JOIN card_transactions t ON t.id = s.card_transaction_id " +
+		"WHERE COALESCE(s.user_id, t.user_id)=? AND t.datetime>=? AND t.datetime<? " +
+		"UNION ALL " +
+		"SELECT t.id AS card_transaction_id, t.merchant_name AS merchant_name, t.currency_code AS currency_code, " +
+		"t.currency_scale AS currency_scale, t.amount AS amount " +
+		"FROM card_transactions t " +
+		"WHERE t.user_id=? AND NOT EXISTS (SELECT 1 FROM card_transaction_splits s WHERE s.card_transaction_id = t.id) " +
+		"AND t.datetime>=? AND t.datetime<? " +
+		") allocations GROUP BY merchant_name, currency_code, currency_scale ORDER BY amount DESC, merchant_name LIMIT ?"
+	err := p.GetConn().Select(&summaries, statement, userID, from, to, userID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// GetLargestCardTransactionsByUserID returns the user's largest card
+// transactions between from and to.
+func (p *PersistenceDataLayer) GetLargestCardTransactionsByUserID(userID int64, from, to time.Time, limit int) ([]*CardTransaction, error) {
+	cardTransactions := make([]*CardTransaction, 0)
+	err := p.GetConn().Select(&cardTransactions, "SELECT * FROM card_transactions WHERE user_id=? AND datetime>=? AND datetime<? "+
+		"ORDER BY amount DESC, id LIMIT ?", userID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return cardTransactions, nil
+}
@@ -0,0 +1,38 @@
+package datalayer
+
+import (
+	"time"
+)
+
+// RevokeToken records that the token or session with the given ID may no
+// longer be used.  The record is kept until expiresAt, after which the token
+// would be refused anyway.
+func (p *PersistenceDataLayer) RevokeToken(userID int64, tokenID string, expiresAt time.Time) error {
+	var count int
+	err := p.GetConn().Get(&count, "SELECT COUNT(*) FROM revoked_tokens WHERE token_id=?", tokenID)
+	if err != nil {
+		return err
+	} else if count > 0 {
+		return nil
+	}
+
+	_, err = p.GetConn().Exec("insert into revoked_tokens(token_id, user_id, expires_at) values (?, ?, ?)",
+		tokenID, userID, expiresAt)
+	return err
+}
+
+func (p *PersistenceDataLayer) IsTokenRevoked(tokenID string) (bool, error) {
+	var count int
+	err := p.GetConn().Get(&count, "SELECT COUNT(*) FROM revoked_tokens WHERE token_id=?", tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// DeleteExpiredRevokedTokens forgets revocations of tokens that have expired.
+func (p *PersistenceDataLayer) DeleteExpiredRevokedTokens(now time.Time) error {
+	_, err := p.GetConn().Exec("delete from revoked_tokens where expires_at < ?", now)
+	return err
+}
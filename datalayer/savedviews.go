@@ -0,0 +1,70 @@
+package datalayer
+
+import (
+	"database/sql"
+)
+
+type SavedView struct {
+	Model
+	UserID    int64  `json:"userID" db:"user_id"`
+	Name      string `json:"name" db:"name"`
+	Filter    string `json:"filter" db:"filter"`
+	Search    string `json:"search" db:"search"`
+	SortField string `json:"sortField" db:"sort_field"`
+	SortDir   string `json:"sortDir" db:"sort_dir"`
+	Columns   string `json:"columns" db:"columns"`
+}
+
+func (p *PersistenceDataLayer) CreateSavedView(view *SavedView) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into saved_views(user_id, name, filter, search, sort_field, sort_dir, columns) "+
+		"values (:user_id, :name, :filter, :search, :sort_field, :sort_dir, :columns)", view)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetSavedViewByID(id int64) (*SavedView, error) {
+	view := new(SavedView)
+	err := p.GetConn().Get(view, "SELECT * FROM saved_views WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return view, nil
+}
+
+func (p *PersistenceDataLayer) GetSavedViewsByUserID(userID int64) ([]*SavedView, error) {
+	views := make([]*SavedView, 0)
+	err := p.GetConn().Select(&views, "SELECT * FROM saved_views WHERE user_id=? ORDER BY name, id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return views, nil
+}
+
+// SavedViewNameExists reports whether the user has another view by this name.
+func (p *PersistenceDataLayer) SavedViewNameExists(userID int64, name string, excludeID int64) (bool, error) {
+	var count int
+	err := p.GetConn().Get(&count, "SELECT COUNT(*) FROM saved_views WHERE user_id=? AND name=? AND id<>?", userID, name, excludeID)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (p *PersistenceDataLayer) UpdateSavedView(view *SavedView) error {
+	_, err := p.GetConn().NamedExec("update saved_views set name=:name, filter=:filter, search=:search, "+
+		"sort_field=:sort_field, sort_dir=:sort_dir, columns=:columns where id=:id and user_id=:user_id", view)
+	return err
+}
+
+func (p *PersistenceDataLayer) DeleteSavedView(userID, id int64) error {
+	_, err := p.GetConn().Exec("delete from saved_views where id=? and user_id=?", id, userID)
+	return err
+}
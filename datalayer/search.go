@@ -0,0 +1,30 @@
+package datalayer
+
+import (
+	"strings"
+
+	"github.com/donohutcheon/gowebserver/models/filters"
+)
+
+// cardTransactionSearchColumns are the columns covered by the full-text index
+// on card_transactions.
+var cardTransactionSearchColumns = []string{"reference", "merchant_name", "merchant_city", "merchant_category_name", "notes"}
+
+// getSearchCriteria returns the relevance column to select and the predicate
+// limiting rows to matches, each with its bind values and with every column
+// qualified by prefix.  Both are empty when the filter has no search.  The
+// search uses the FULLTEXT index in boolean mode, so the columns must match
+// the index definition.
+func getSearchCriteria(filter filters.CardTransactionFilter, prefix string) (string, []interface{}, string, []interface{}) {
+	if !filter.Search.IsSet {
+		return "", nil, "", nil
+	}
+
+	columns := make([]string, len(cardTransactionSearchColumns))
+	for i, column := range cardTransactionSearchColumns {
+		columns[i] = prefix + column
+	}
+	match := "MATCH(" + strings.Join(columns, ", ") + ") AGAINST (? IN BOOLEAN MODE)"
+	values := []interface{}{filter.Search.Query.MySQLBoolean()}
+	return ", " + match + " AS relevance", values, " and " + match + " > 0 ", values
+}
@@ -2,37 +2,72 @@ package datalayer
 
 import (
 	"database/sql"
-	"log"
+	"time"
 )
 
+// SignUpConfirmation is a link emailed to confirm an address.  Email is set
+// when it confirms a change of address rather than a sign up.  A link works
+// once, until ExpiresAt.  Only a hash of the nonce in the link is stored, so
+// that the database cannot be used to confirm addresses.
 type SignUpConfirmation struct {
 	Model
-	Nonce  string `json:"name" db:"nonce"`
-	UserID int64  `json:"user_id" db:"user_id"`
+	NonceHash string         `json:"-" db:"nonce_hash"`
+	UserID    int64          `json:"user_id" db:"user_id"`
+	Email     sql.NullString `json:"email" db:"email"`
+	ExpiresAt time.Time      `json:"expiresAt" db:"expires_at"`
+	UsedAt    JsonNullTime   `json:"usedAt" db:"used_at"`
 }
 
-func (p *PersistenceDataLayer) CreateSignUpConfirmation(nonce string, userID int64) (int64, error) {
-	result, err := p.GetConn().Exec("insert into sign_up_confirmations(nonce, user_id) values (?, ?)", nonce, userID)
+func (p *PersistenceDataLayer) CreateSignUpConfirmation(nonceHash string, userID int64, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into sign_up_confirmations(nonce_hash, user_id, expires_at) values (?, ?, ?)",
+		nonceHash, userID, expiresAt)
 	if err != nil {
 		return 0, err
 	}
 
-	id, err := result.LastInsertId()
+	return result.LastInsertId()
+}
+
+// GetSignUpConfirmationByNonceHash returns the confirmation whose link
+// carries the nonce with the given hash.
+func (p *PersistenceDataLayer) GetSignUpConfirmationByNonceHash(nonceHash string) (*SignUpConfirmation, error) {
+	signUp := new(SignUpConfirmation)
+	statement := "SELECT * FROM sign_up_confirmations WHERE nonce_hash=?"
+	row := p.GetConn().QueryRowx(statement, nonceHash)
+	err := row.StructScan(signUp)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return signUp, nil
+}
+
+// CreateEmailChangeConfirmation records a link sent to confirm that the user
+// owns the address they are changing to.
+func (p *PersistenceDataLayer) CreateEmailChangeConfirmation(nonceHash string, userID int64, email string,
+	expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into sign_up_confirmations(nonce_hash, user_id, email, expires_at) values (?, ?, ?, ?)",
+		nonceHash, userID, email, expiresAt)
 	if err != nil {
-		// TODO: remove logging
-		log.Fatal(err)
 		return 0, err
 	}
 
-	return id, nil
+	return result.LastInsertId()
 }
 
+func (p *PersistenceDataLayer) DeleteSignUpConfirmation(id int64) error {
+	_, err := p.GetConn().Exec("delete from sign_up_confirmations where id = ?", id)
+	return err
+}
 
-func (p *PersistenceDataLayer) LookupSignUpConfirmation(nonce string) (*SignUpConfirmation, error) {
+// GetLatestSignUpConfirmationByUserID returns the confirmation of the user's
+// sign up that was sent last.
+func (p *PersistenceDataLayer) GetLatestSignUpConfirmationByUserID(userID int64) (*SignUpConfirmation, error) {
 	signUp := new(SignUpConfirmation)
-	statement := "SELECT * FROM sign_up_confirmations WHERE nonce=?"
-	row := p.GetConn().QueryRowx(statement, nonce)
-	err := row.StructScan(signUp)
+	err := p.GetConn().Get(signUp, "SELECT * FROM sign_up_confirmations WHERE user_id=? AND email IS NULL "+
+		"ORDER BY id DESC LIMIT 1", userID)
 	if err == sql.ErrNoRows {
 		return nil, ErrNoData
 	} else if err != nil {
@@ -40,4 +75,28 @@ func (p *PersistenceDataLayer) LookupSignUpConfirmation(nonce string) (*SignUpCo
 	}
 
 	return signUp, nil
-}
\ No newline at end of file
+}
+
+// UseSignUpConfirmation marks the confirmation used, reporting false if it
+// already was or has expired.
+func (p *PersistenceDataLayer) UseSignUpConfirmation(id int64, now time.Time) (bool, error) {
+	result, err := p.GetConn().Exec("update sign_up_confirmations set used_at = ? "+
+		"where id = ? and used_at is null and expires_at > ?", now, id, now)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// DeleteExpiredSignUpConfirmations deletes confirmations that expired before
+// the given time, used or not.
+func (p *PersistenceDataLayer) DeleteExpiredSignUpConfirmations(before time.Time) error {
+	_, err := p.GetConn().Exec("delete from sign_up_confirmations where expires_at < ?", before)
+	return err
+}
@@ -0,0 +1,113 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// TOTP is a user's authenticator app secret.  It only guards logins once
+// EnabledAt is set, after the user has shown a code from it.  LastUsedStep is
+// the period of the last code accepted, so that no code is accepted twice.
+type TOTP struct {
+	Model
+	UserID       int64        `json:"userID" db:"user_id"`
+	Secret       string       `json:"-" db:"secret"`
+	EnabledAt    JsonNullTime `json:"enabledAt" db:"enabled_at"`
+	LastUsedStep int64        `json:"-" db:"last_used_step"`
+}
+
+// RecoveryCode is a single use code that stands in for an authenticator app
+// code.  Only a hash of it is kept.
+type RecoveryCode struct {
+	Model
+	UserID   int64        `json:"userID" db:"user_id"`
+	CodeHash string       `json:"-" db:"code_hash"`
+	UsedAt   JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) CreateTOTP(userID int64, secret string) (int64, error) {
+	result, err := p.GetConn().Exec("insert into user_totp(user_id, secret) values (?, ?)", userID, secret)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetTOTPByUserID(userID int64) (*TOTP, error) {
+	totp := new(TOTP)
+	err := p.GetConn().Get(totp, "SELECT * FROM user_totp WHERE user_id=?", userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return totp, nil
+}
+
+func (p *PersistenceDataLayer) EnableTOTP(userID int64, now time.Time) error {
+	_, err := p.GetConn().Exec("update user_totp set enabled_at = ? where user_id = ?", now, userID)
+	return err
+}
+
+// UseTOTPStep records that a code of the step was accepted, reporting false
+// if one of it or a later step already was.
+func (p *PersistenceDataLayer) UseTOTPStep(userID, step int64) (bool, error) {
+	result, err := p.GetConn().Exec("update user_totp set last_used_step = ? where user_id = ? and last_used_step < ?",
+		step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (p *PersistenceDataLayer) DeleteTOTPByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("delete from user_totp where user_id = ?", userID)
+	return err
+}
+
+func (p *PersistenceDataLayer) CreateRecoveryCodes(userID int64, codeHashes []string) error {
+	for _, codeHash := range codeHashes {
+		_, err := p.GetConn().Exec("insert into recovery_codes(user_id, code_hash) values (?, ?)", userID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the user's code with the hash used, reporting false if
+// there is no such code or it was used before.
+func (p *PersistenceDataLayer) UseRecoveryCode(userID int64, codeHash string, now time.Time) (bool, error) {
+	result, err := p.GetConn().Exec("update recovery_codes set used_at = ? "+
+		"where user_id = ? and code_hash = ? and used_at is null", now, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (p *PersistenceDataLayer) CountUnusedRecoveryCodes(userID int64) (int, error) {
+	var count int
+	err := p.GetConn().Get(&count, "SELECT COUNT(*) FROM recovery_codes WHERE user_id=? AND used_at IS NULL", userID)
+	return count, err
+}
+
+func (p *PersistenceDataLayer) DeleteRecoveryCodesByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("delete from recovery_codes where user_id = ?", userID)
+	return err
+}
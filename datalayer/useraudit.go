@@ -0,0 +1,37 @@
+package datalayer
+
+import (
+	"database/sql"
+)
+
+// UserAuditRecord records an action an administrator took on a user.
+type UserAuditRecord struct {
+	Model
+	ActorUserID int64          `json:"actorUserID" db:"actor_user_id"`
+	UserID      int64          `json:"userID" db:"user_id"`
+	Action      string         `json:"action" db:"action"`
+	Detail      sql.NullString `json:"detail" db:"detail"`
+}
+
+func (p *PersistenceDataLayer) CreateUserAuditRecord(record *UserAuditRecord) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into user_audit_records(actor_user_id, user_id, action, detail) "+
+		"values (:actor_user_id, :user_id, :action, :detail)", record)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// GetUserAuditRecordsByUserID returns up to limit of the records about the
+// user, newest first.
+func (p *PersistenceDataLayer) GetUserAuditRecordsByUserID(userID int64, limit int) ([]*UserAuditRecord, error) {
+	records := make([]*UserAuditRecord, 0)
+	err := p.GetConn().Select(&records, "SELECT * FROM user_audit_records WHERE user_id=? ORDER BY id DESC LIMIT ?",
+		userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -2,11 +2,18 @@ package datalayer
 
 import (
 	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models/pagination"
 )
 
 type User struct {
 	Model
 	Email    sql.NullString `db:"email"`
+	// PendingEmail is an address the user is changing to that has yet to be
+	// confirmed.
+	PendingEmail sql.NullString `db:"pending_email"`
 	Password sql.NullString `db:"password"`
 	Role     sql.NullString `db:"role"`
 	State     sql.NullString `db:"state"`
@@ -15,7 +22,7 @@ type User struct {
 
 func (p *PersistenceDataLayer) GetUserByEmail(email string) (*User, error) {
 	user := new(User)
-	row := p.GetConn().QueryRowx(`select * from users where email = ?`, email)
+	row := p.GetConn().QueryRowx(`select * from users where email = ? and deleted_at is null`, email)
 	err := row.StructScan(user)
 	if err == sql.ErrNoRows {
 		return nil, ErrNoData
@@ -28,7 +35,7 @@ func (p *PersistenceDataLayer) GetUserByEmail(email string) (*User, error) {
 
 func (p *PersistenceDataLayer) GetUserByID(id int64) (*User, error) {
 	user := new(User)
-	row := p.GetConn().QueryRowx(`SELECT * FROM users WHERE id=?`, id)
+	row := p.GetConn().QueryRowx(`SELECT * FROM users WHERE id=? AND deleted_at IS NULL`, id)
 	err := row.StructScan(user)
 	if err == sql.ErrNoRows {
 		return nil, ErrNoData
@@ -40,7 +47,8 @@ func (p *PersistenceDataLayer) GetUserByID(id int64) (*User, error) {
 }
 
 func (p *PersistenceDataLayer) CreateUser(email, password string) (int64, error){
-	result, err := p.GetConn().Exec("insert into users(email, password, state) values (?, ?, ?)", email, password, UserStateUnconfirmed)
+	result, err := p.GetConn().Exec("insert into users(email, password, role, state) values (?, ?, ?, ?)", email, password,
+		"USER", UserStateUnconfirmed)
 	if err != nil {
 		return 0, err
 	}
@@ -53,9 +61,31 @@ func (p *PersistenceDataLayer) CreateUser(email, password string) (int64, error)
 	return id, nil
 }
 
-func (p *PersistenceDataLayer) GetUnconfirmedUsers() ([]User, error) {
+// GetUnconfirmedUsers returns the users created in the given period whose
+// confirmation email has not been sent, because it has yet to be or because
+// sending it failed.
+func (p *PersistenceDataLayer) GetUnconfirmedUsers(createdAfter, createdBefore time.Time) ([]User, error) {
+	var users []User
+	err := p.GetConn().Select(&users, `SELECT * FROM users WHERE state IN (?, ?) AND created_at > ? AND created_at < ?`,
+		UserStateUnconfirmed, UserStateProcessing, createdAfter, createdBefore)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetUnsentEmailChanges returns the users who changed their email address in
+// the given period and hold no confirmation of it that is still good at now,
+// because it has yet to be sent or sending it failed.
+func (p *PersistenceDataLayer) GetUnsentEmailChanges(changedAfter, changedBefore, now time.Time) ([]User, error) {
 	var users []User
-	err := p.GetConn().Select(&users, `SELECT * FROM users WHERE state=?`, UserStateUnconfirmed)
+	err := p.GetConn().Select(&users, `SELECT * FROM users u WHERE u.pending_email IS NOT NULL `+
+		`AND u.updated_at > ? AND u.updated_at < ? AND NOT EXISTS (SELECT 1 FROM sign_up_confirmations c `+
+		`WHERE c.user_id = u.id AND c.email = u.pending_email AND c.expires_at > ?)`,
+		changedAfter, changedBefore, now)
 	if err == sql.ErrNoRows {
 		return nil, ErrNoData
 	} else if err != nil {
@@ -79,4 +109,115 @@ func (p *PersistenceDataLayer) SetUserStateByID(id int64, state UserState) error
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// ChangeUserStateByID moves the user from one state to another, reporting
+// false if they were no longer in the state they were expected to be in.
+func (p *PersistenceDataLayer) ChangeUserStateByID(id int64, from, to UserState) (bool, error) {
+	result, err := p.GetConn().Exec("update users set state = ? where id = ? and state = ?", to, id, from)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// SetUserRolesByID stores the user's roles as a comma separated list.
+func (p *PersistenceDataLayer) SetUserRolesByID(id int64, roles string) error {
+	_, err := p.GetConn().Exec("update users set role = ? where id = ?", roles, id)
+	return err
+}
+
+// SetUserPasswordByID stores the user's hashed password.
+func (p *PersistenceDataLayer) SetUserPasswordByID(id int64, password string) error {
+	_, err := p.GetConn().Exec("update users set password = ? where id = ?", password, id)
+	return err
+}
+
+// SetUserPendingEmailByID records the address the user is changing to.
+func (p *PersistenceDataLayer) SetUserPendingEmailByID(id int64, email string) error {
+	_, err := p.GetConn().Exec("update users set pending_email = ? where id = ?", email, id)
+	return err
+}
+
+// ChangeUserEmailByID switches the user to a confirmed new address.
+func (p *PersistenceDataLayer) ChangeUserEmailByID(id int64, email string) error {
+	_, err := p.GetConn().Exec("update users set email = ?, pending_email = NULL where id = ?", email, id)
+	return err
+}
+
+// SetUserLoggedOutAt records when the user last logged out of every session.
+func (p *PersistenceDataLayer) SetUserLoggedOutAt(id int64, loggedOutAt time.Time) error {
+	_, err := p.GetConn().Exec("update users set logged_out_at = ? where id = ?", loggedOutAt, id)
+	return err
+}
+
+// userSortColumns maps the API sort fields onto their columns.
+var userSortColumns = map[string]string{
+	"id":        "id",
+	"email":     "email",
+	"state":     "state",
+	"createdAt": "created_at",
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, so that searches match
+// them literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func userSortColumn(sortField string) string {
+	column, ok := userSortColumns[sortField]
+	if !ok {
+		return "id"
+	}
+	return column
+}
+
+// SearchUsers returns a page of the users whose email contains query and,
+// unless state is empty, who are in the given state.
+func (p *PersistenceDataLayer) SearchUsers(query string, state UserState, sortable pagination.Sortable) ([]*User, error) {
+	users := make([]*User, 0)
+	pageParams := sortable.GetPagination()
+
+	statement := "SELECT * FROM users WHERE deleted_at IS NULL"
+	var bindValues []interface{}
+	if len(query) > 0 {
+		statement += " AND LOWER(email) LIKE ?"
+		bindValues = append(bindValues, "%"+likeEscaper.Replace(strings.ToLower(query))+"%")
+	}
+	if len(state) > 0 {
+		statement += " AND state=?"
+		bindValues = append(bindValues, state)
+	}
+	statement += pageParams.BuildPagination(userSortColumn(pageParams.SortField))
+
+	err := p.GetConn().Select(&users, statement, bindValues...)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// DeleteUserByID marks the user deleted and disabled.  Their data is kept,
+// but they can no longer be found or sign in.
+func (p *PersistenceDataLayer) DeleteUserByID(id int64, now time.Time) error {
+	result, err := p.GetConn().Exec("update users set deleted_at = ?, state = ? where id = ? and deleted_at is null",
+		now, UserStateDisabled, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+type WebhookDeliveryState string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryState = "PENDING"
+	WebhookDeliverySucceeded WebhookDeliveryState = "SUCCEEDED"
+	WebhookDeliveryFailed    WebhookDeliveryState = "FAILED"
+)
+
+type Webhook struct {
+	Model
+	UserID     int64  `json:"userID" db:"user_id"`
+	URL        string `json:"url" db:"url"`
+	Secret     string `json:"secret" db:"secret"`
+	EventTypes string `json:"eventTypes" db:"event_types"`
+	Active     bool   `json:"active" db:"active"`
+}
+
+type WebhookDelivery struct {
+	Model
+	WebhookID      int64                `json:"webhookID" db:"webhook_id"`
+	EventType      string               `json:"eventType" db:"event_type"`
+	Payload        string               `json:"payload" db:"payload"`
+	State          WebhookDeliveryState `json:"state" db:"state"`
+	Attempts       int                  `json:"attempts" db:"attempts"`
+	NextAttemptAt  JsonNullTime         `json:"nextAttemptAt" db:"next_attempt_at"`
+	LastAttemptAt  JsonNullTime         `json:"lastAttemptAt" db:"last_attempt_at"`
+	ResponseStatus int                  `json:"responseStatus" db:"response_status"`
+	Error          string               `json:"error" db:"error"`
+}
+
+func (p *PersistenceDataLayer) CreateWebhook(webhook *Webhook) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into webhooks(user_id, url, secret, event_types, active) "+
+		"values (:user_id, :url, :secret, :event_types, :active)", webhook)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetWebhookByID(id int64) (*Webhook, error) {
+	webhook := new(Webhook)
+	err := p.GetConn().Get(webhook, "SELECT * FROM webhooks WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (p *PersistenceDataLayer) GetWebhooksByUserID(userID int64) ([]*Webhook, error) {
+	webhooks := make([]*Webhook, 0)
+	err := p.GetConn().Select(&webhooks, "SELECT * FROM webhooks WHERE user_id=? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (p *PersistenceDataLayer) UpdateWebhook(webhook *Webhook) error {
+	_, err := p.GetConn().NamedExec("update webhooks set url=:url, event_types=:event_types, active=:active "+
+		"where id=:id and user_id=:user_id", webhook)
+	return err
+}
+
+func (p *PersistenceDataLayer) DeleteWebhook(userID, id int64) error {
+	_, err := p.GetConn().Exec("delete from webhooks where id=? and user_id=?", id, userID)
+	return err
+}
+
+func (p *PersistenceDataLayer) CreateWebhookDelivery(delivery *WebhookDelivery) (int64, error) {
+	result, err := p.GetConn().NamedExec("insert into webhook_deliveries(webhook_id, event_type, payload, state, "+
+		"attempts, next_attempt_at) "+
+		"values (:webhook_id, :event_type, :payload, :state, :attempts, :next_attempt_at)", delivery)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (p *PersistenceDataLayer) GetWebhookDeliveryByID(id int64) (*WebhookDelivery, error) {
+	delivery := new(WebhookDelivery)
+	err := p.GetConn().Get(delivery, "SELECT * FROM webhook_deliveries WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// GetWebhookDeliveriesByWebhookID returns a webhook's most recent deliveries,
+// newest first.
+func (p *PersistenceDataLayer) GetWebhookDeliveriesByWebhookID(webhookID int64, limit int) ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+	err := p.GetConn().Select(&deliveries, "SELECT * FROM webhook_deliveries WHERE webhook_id=? "+
+		"ORDER BY id DESC LIMIT ?", webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is
+// due, oldest first.
+func (p *PersistenceDataLayer) GetDueWebhookDeliveries(now time.Time, limit int) ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+	err := p.GetConn().Select(&deliveries, "SELECT * FROM webhook_deliveries WHERE state=? AND next_attempt_at<=? "+
+		"ORDER BY next_attempt_at, id LIMIT ?", WebhookDeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDeliveryAttempt records the outcome of an attempt.
+func (p *PersistenceDataLayer) UpdateWebhookDeliveryAttempt(delivery *WebhookDelivery) error {
+	_, err := p.GetConn().NamedExec("update webhook_deliveries set state=:state, attempts=:attempts, "+
+		"next_attempt_at=:next_attempt_at, last_attempt_at=:last_attempt_at, response_status=:response_status, "+
+		"error=:error where id=:id", delivery)
+	return err
+}
+
+// ClaimWebhookDelivery leases a due delivery to the caller by moving its next
+// attempt to leaseUntil.  It reports false when the delivery is no longer due,
+// such as when another server claimed it first.
+func (p *PersistenceDataLayer) ClaimWebhookDelivery(id int64, now, leaseUntil time.Time) (bool, error) {
+	result, err := p.GetConn().Exec("update webhook_deliveries set next_attempt_at=? "+
+		"where id=? and state=? and next_attempt_at<=?", leaseUntil, id, WebhookDeliveryPending, now)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
@@ -9,6 +9,7 @@ require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/gorilla/mux v1.7.3
+	github.com/gorilla/websocket v1.4.2
 	github.com/heroku/x v0.0.22
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/joho/godotenv v1.3.0
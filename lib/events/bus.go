@@ -0,0 +1,204 @@
+package events
+
+import (
+	"sync"
+)
+
+// Event types published on the bus.
+const (
+	CardTransactionCreated   = "cardTransaction.created"
+	CardTransactionAnomalous = "cardTransaction.anomalous"
+	AlertTriggered           = "alert.triggered"
+	UserConfirmed            = "user.confirmed"
+	UserLoggedIn             = "user.loggedIn"
+	UserLoggedOut            = "user.loggedOut"
+	UserPasswordChanged      = "user.passwordChanged"
+	UserEmailChanged         = "user.emailChanged"
+	UserTwoFactorEnabled     = "user.twoFactorEnabled"
+	UserTwoFactorDisabled    = "user.twoFactorDisabled"
+	UserDisabled             = "user.disabled"
+)
+
+var eventTypes = map[string]bool{
+	CardTransactionCreated:   true,
+	CardTransactionAnomalous: true,
+	AlertTriggered:           true,
+	UserConfirmed:            true,
+	UserLoggedIn:             true,
+	UserLoggedOut:            true,
+	UserPasswordChanged:      true,
+	UserEmailChanged:         true,
+	UserTwoFactorEnabled:     true,
+	UserTwoFactorDisabled:    true,
+	UserDisabled:             true,
+}
+
+// IsType reports whether name is an event type published on the bus.
+func IsType(name string) bool {
+	return eventTypes[name]
+}
+
+// Event is something that happened to a user's data.  ID orders events of
+// the same type; for card transactions it is the transaction's id, which lets
+// a client that missed events catch up from the database.
+type Event struct {
+	ID     int64       `json:"id"`
+	Type   string      `json:"type"`
+	UserID int64       `json:"userID"`
+	Data   interface{} `json:"data"`
+}
+
+// SubscriptionBuffer is the number of events a subscriber may fall behind by
+// before it is dropped.
+const SubscriptionBuffer = 64
+
+// Subscription receives the events of one user, or of every user.  Its
+// channel is closed when the subscriber unsubscribes, falls too far behind,
+// or the bus closes.
+type Subscription struct {
+	bus     *Bus
+	userID  int64
+	all     bool
+	events  chan Event
+	dropped bool
+}
+
+// Events returns the channel events are delivered on.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped reports whether the subscription was closed because its consumer
+// could not keep up, in which case events may have been missed.
+func (s *Subscription) Dropped() bool {
+	s.bus.mu.RLock()
+	defer s.bus.mu.RUnlock()
+	return s.dropped
+}
+
+// Unsubscribe stops delivery and closes the channel.  It is safe to call more
+// than once.
+func (s *Subscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// Bus fans published events out to in-process subscribers.  Publishing never
+// blocks: a subscriber whose buffer is full is dropped instead.
+type Bus struct {
+	mu     sync.RWMutex
+	users  map[int64]map[*Subscription]struct{}
+	all    map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		users: make(map[int64]map[*Subscription]struct{}),
+		all:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe delivers the events of a single user.
+func (b *Bus) Subscribe(userID int64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscription{bus: b, userID: userID, events: make(chan Event, SubscriptionBuffer)}
+	if b.closed {
+		close(s.events)
+		return s
+	}
+	if b.users[userID] == nil {
+		b.users[userID] = make(map[*Subscription]struct{})
+	}
+	b.users[userID][s] = struct{}{}
+	return s
+}
+
+// SubscribeAll delivers the events of every user, for background services.
+func (b *Bus) SubscribeAll(buffer int) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscription{bus: b, all: true, events: make(chan Event, buffer)}
+	if b.closed {
+		close(s.events)
+		return s
+	}
+	b.all[s] = struct{}{}
+	return s
+}
+
+// Publish delivers the event to the user's subscribers and to those of every
+// user.
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	for s := range b.users[event.UserID] {
+		b.deliver(s, event)
+	}
+	for s := range b.all {
+		b.deliver(s, event)
+	}
+}
+
+func (b *Bus) deliver(s *Subscription, event Event) {
+	select {
+	case s.events <- event:
+	default:
+		s.dropped = true
+		b.remove(s)
+	}
+}
+
+// remove must be called with the lock held.
+func (b *Bus) remove(s *Subscription) {
+	if s.all {
+		if _, ok := b.all[s]; !ok {
+			return
+		}
+		delete(b.all, s)
+		close(s.events)
+		return
+	}
+
+	subs, ok := b.users[s.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(b.users, s.userID)
+	}
+	close(s.events)
+}
+
+// Close ends every subscription.  Events published afterwards are discarded.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	for _, subs := range b.users {
+		for s := range subs {
+			close(s.events)
+		}
+	}
+	for s := range b.all {
+		close(s.events)
+	}
+	b.users = make(map[int64]map[*Subscription]struct{})
+	b.all = make(map[*Subscription]struct{})
+}
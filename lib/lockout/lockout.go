@@ -0,0 +1,220 @@
+// Package lockout slows down and then stops password guessing.  Failed
+// logins are counted per account and per IP address; after a few failures
+// each further attempt has to wait twice as long as the one before, and after
+// many the account or address is locked out for a while.
+package lockout
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+// ForgetAfter is how long failures are remembered without another one.
+const ForgetAfter = 24 * time.Hour
+
+// Policy is how failures of one kind of key are punished.
+type Policy struct {
+	// FreeAttempts is the number of failures before attempts are delayed.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure beyond FreeAttempts,
+	// doubling with each one after, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockAfter is the number of failures that locks the key out for
+	// LockFor.  The count starts again once the lockout ends.
+	LockAfter int
+	LockFor   time.Duration
+}
+
+var (
+	// AccountPolicy protects a single account from guessing.
+	AccountPolicy = Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockAfter:    10,
+		LockFor:      30 * time.Minute,
+	}
+	// IPPolicy limits one address guessing across many accounts.  It is more
+	// lenient, as many users may share an address.
+	IPPolicy = Policy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockAfter:    100,
+		LockFor:      time.Hour,
+	}
+)
+
+// Source is where attempts are kept.  The datalayer implements it, which
+// keeps lockouts across restarts and server instances; NewMemorySource keeps
+// them in the process.
+type Source interface {
+	GetLoginAttempt(key string) (*datalayer.LoginAttempt, error)
+	SaveLoginAttempt(attempt *datalayer.LoginAttempt) error
+	DeleteLoginAttempt(key string) error
+	DeleteLoginAttemptsBefore(before time.Time) error
+}
+
+// Guard counts failed logins and decides when the next may be tried.
+type Guard struct {
+	source  Source
+	account Policy
+	ip      Policy
+	now     func() time.Time
+
+	// mu serializes counting within this process, so that concurrent
+	// failures are not lost.
+	mu sync.Mutex
+}
+
+func New(source Source) *Guard {
+	return &Guard{
+		source:  source,
+		account: AccountPolicy,
+		ip:      IPPolicy,
+		now:     time.Now,
+	}
+}
+
+// AccountKey is the key failures of logins as email are counted under,
+// whether or not the address has an account.
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// IPKey is the key failures of logins from the address are counted under.
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Wait returns how long until a login as email from ip may be tried, or zero
+// if it may be tried now.  An empty ip is not checked.
+func (g *Guard) Wait(email, ip string) (time.Duration, error) {
+	now := g.now()
+	wait, err := g.wait(AccountKey(email), now)
+	if err != nil || len(ip) == 0 {
+		return wait, err
+	}
+
+	ipWait, err := g.wait(IPKey(ip), now)
+	if err != nil {
+		return 0, err
+	}
+	if ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait, nil
+}
+
+// Fail counts a failed login as email from ip.  It reports whether this
+// failure locked the account out, so that its owner can be told.
+func (g *Guard) Fail(email, ip string) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Attempts are stored to the second and databases may round fractions
+	// up, which would block for longer than the wait that is reported.
+	now := g.now().Truncate(time.Second)
+	locked, err := g.fail(AccountKey(email), g.account, now)
+	if err != nil {
+		return false, err
+	}
+	if len(ip) > 0 {
+		_, err = g.fail(IPKey(ip), g.ip, now)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return locked, g.source.DeleteLoginAttemptsBefore(now.Add(-ForgetAfter))
+}
+
+// Succeed forgets the failures of the account after a successful login.
+// Those of the address are kept, or a guesser with an account of their own
+// could clear them.
+func (g *Guard) Succeed(email string) error {
+	return g.Unlock(email)
+}
+
+// Unlock forgets the failures of the account, ending any lockout.
+func (g *Guard) Unlock(email string) error {
+	return g.source.DeleteLoginAttempt(AccountKey(email))
+}
+
+// Locked reports until when the account is locked out, if it is.
+func (g *Guard) Locked(email string) (time.Time, bool, error) {
+	attempt, err := g.source.GetLoginAttempt(AccountKey(email))
+	if err == datalayer.ErrNoData {
+		return time.Time{}, false, nil
+	} else if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if attempt.Failures < g.account.LockAfter || !attempt.BlockedUntil.Valid ||
+		!g.now().Before(attempt.BlockedUntil.Time) {
+		return time.Time{}, false, nil
+	}
+
+	return attempt.BlockedUntil.Time, true, nil
+}
+
+func (g *Guard) wait(key string, now time.Time) (time.Duration, error) {
+	attempt, err := g.source.GetLoginAttempt(key)
+	if err == datalayer.ErrNoData {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if !attempt.BlockedUntil.Valid || !now.Before(attempt.BlockedUntil.Time) {
+		return 0, nil
+	}
+
+	return attempt.BlockedUntil.Time.Sub(now), nil
+}
+
+func (g *Guard) fail(key string, policy Policy, now time.Time) (bool, error) {
+	attempt, err := g.source.GetLoginAttempt(key)
+	if err == datalayer.ErrNoData {
+		attempt = &datalayer.LoginAttempt{AttemptKey: key}
+	} else if err != nil {
+		return false, err
+	}
+
+	lockEnded := attempt.Failures >= policy.LockAfter &&
+		(!attempt.BlockedUntil.Valid || !now.Before(attempt.BlockedUntil.Time))
+	forgotten := !attempt.LastFailureAt.Valid || now.Sub(attempt.LastFailureAt.Time) >= ForgetAfter
+	if lockEnded || forgotten {
+		attempt.Failures = 0
+	}
+
+	attempt.Failures++
+	attempt.LastFailureAt.Time, attempt.LastFailureAt.Valid = now, true
+	attempt.BlockedUntil.Valid = false
+	locked := false
+	if attempt.Failures >= policy.LockAfter {
+		attempt.BlockedUntil.Time, attempt.BlockedUntil.Valid = now.Add(policy.LockFor), true
+		locked = attempt.Failures == policy.LockAfter
+	} else if attempt.Failures > policy.FreeAttempts {
+		attempt.BlockedUntil.Time, attempt.BlockedUntil.Valid = now.Add(policy.delay(attempt.Failures)), true
+	}
+
+	return locked, g.source.SaveLoginAttempt(attempt)
+}
+
+// delay is how long to wait after the given number of failures.
+func (p Policy) delay(failures int) time.Duration {
+	doublings := float64(failures - p.FreeAttempts - 1)
+	delay := float64(p.BaseDelay) * math.Pow(2, doublings)
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+
+	return time.Duration(delay)
+}
@@ -0,0 +1,135 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGuard() (*Guard, *time.Time) {
+	now := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	guard := New(NewMemorySource())
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+func TestBackoff(t *testing.T) {
+	guard, now := newTestGuard()
+
+	for i := 0; i < AccountPolicy.FreeAttempts; i++ {
+		locked, err := guard.Fail("Kano@BlackDragon.com", "")
+		require.NoError(t, err)
+		assert.False(t, locked)
+	}
+	wait, err := guard.Wait("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Each further failure doubles the wait
+	for _, expWait := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		_, err = guard.Fail("kano@blackdragon.com", "")
+		require.NoError(t, err)
+		wait, err = guard.Wait("kano@blackdragon.com", "")
+		require.NoError(t, err)
+		assert.Equal(t, expWait, wait)
+		*now = now.Add(wait)
+	}
+	wait, err = guard.Wait("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Other accounts are not held up, and a success starts over
+	wait, err = guard.Wait("sonya@specialforces.com", "")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	require.NoError(t, guard.Succeed("kano@blackdragon.com"))
+	_, err = guard.Fail("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	wait, err = guard.Wait("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Failures are forgotten after a quiet day
+	for i := 0; i < AccountPolicy.FreeAttempts; i++ {
+		_, err = guard.Fail("kano@blackdragon.com", "")
+		require.NoError(t, err)
+	}
+	*now = now.Add(ForgetAfter)
+	_, err = guard.Fail("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	wait, err = guard.Wait("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLockout(t *testing.T) {
+	guard, now := newTestGuard()
+
+	var lockedCount int
+	for i := 0; i < AccountPolicy.LockAfter; i++ {
+		locked, err := guard.Fail("kano@blackdragon.com", "10.0.0.1")
+		require.NoError(t, err)
+		if locked {
+			lockedCount++
+		}
+		*now = now.Add(AccountPolicy.MaxDelay)
+	}
+	assert.Equal(t, 1, lockedCount)
+
+	until, locked, err := guard.Locked("kano@blackdragon.com")
+	require.NoError(t, err)
+	assert.True(t, locked)
+	assert.Equal(t, now.Add(AccountPolicy.LockFor-AccountPolicy.MaxDelay), until)
+	wait, err := guard.Wait("kano@blackdragon.com", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, AccountPolicy.LockFor-AccountPolicy.MaxDelay, wait)
+
+	// The address has not failed often enough to be held up elsewhere
+	wait, err = guard.Wait("sonya@specialforces.com", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Once the lockout ends the count starts again
+	*now = until
+	_, locked, err = guard.Locked("kano@blackdragon.com")
+	require.NoError(t, err)
+	assert.False(t, locked)
+	locked, err = guard.Fail("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	assert.False(t, locked)
+	wait, err = guard.Wait("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Unlocking ends a lockout early
+	for i := 0; i < AccountPolicy.LockAfter; i++ {
+		_, err = guard.Fail("kano@blackdragon.com", "")
+		require.NoError(t, err)
+	}
+	_, locked, err = guard.Locked("kano@blackdragon.com")
+	require.NoError(t, err)
+	assert.True(t, locked)
+	require.NoError(t, guard.Unlock("kano@blackdragon.com"))
+	wait, err = guard.Wait("kano@blackdragon.com", "")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestIPLockout(t *testing.T) {
+	guard, _ := newTestGuard()
+
+	for i := 0; i < IPPolicy.LockAfter; i++ {
+		_, err := guard.Fail("kano@blackdragon.com", "10.0.0.1")
+		require.NoError(t, err)
+		require.NoError(t, guard.Succeed("kano@blackdragon.com"))
+	}
+
+	wait, err := guard.Wait("sonya@specialforces.com", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, IPPolicy.LockFor, wait)
+	wait, err = guard.Wait("sonya@specialforces.com", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
@@ -0,0 +1,60 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+// MemorySource keeps attempts in the process, for a single server that may
+// forget lockouts when it restarts.
+type MemorySource struct {
+	mu       sync.Mutex
+	attempts map[string]datalayer.LoginAttempt
+}
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{
+		attempts: make(map[string]datalayer.LoginAttempt),
+	}
+}
+
+func (m *MemorySource) GetLoginAttempt(key string) (*datalayer.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, ok := m.attempts[key]
+	if !ok {
+		return nil, datalayer.ErrNoData
+	}
+
+	return &attempt, nil
+}
+
+func (m *MemorySource) SaveLoginAttempt(attempt *datalayer.LoginAttempt) error {
+	m.mu.Lock()
+	m.attempts[attempt.AttemptKey] = *attempt
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemorySource) DeleteLoginAttempt(key string) error {
+	m.mu.Lock()
+	delete(m.attempts, key)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemorySource) DeleteLoginAttemptsBefore(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, attempt := range m.attempts {
+		if attempt.LastFailureAt.Time.Before(before) {
+			delete(m.attempts, key)
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,10 @@
 package nonce
 
-import "math/rand"
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"math/rand"
+)
 
 func GenerateNonce(n int) string {
 	const chars = "abcdefghijklmnopqrstuvwxyz01234567890"
@@ -10,4 +14,15 @@ func GenerateNonce(n int) string {
 		b[i] = chars[rand.Intn(len(chars))]
 	}
 	return string(b)
-}
\ No newline at end of file
+}
+// GenerateSecret returns n random bytes from a cryptographically secure
+// source, hex encoded, for values that must not be guessable such as signing
+// keys.
+func GenerateSecret(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := cryptorand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,199 @@
+package revocation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+// DefaultTTL is how long a lookup is cached.  Revocations made through the
+// Store take effect immediately; the TTL bounds how long a revocation made by
+// another server instance goes unnoticed.
+const DefaultTTL = 30 * time.Second
+
+// maxEntries is the cache size from which stale entries are swept.
+const maxEntries = 10000
+
+// Source is where revocations are kept.  The datalayer implements it.
+type Source interface {
+	GetUserByID(id int64) (*datalayer.User, error)
+	SetUserLoggedOutAt(id int64, loggedOutAt time.Time) error
+	RevokeToken(userID int64, tokenID string, expiresAt time.Time) error
+	IsTokenRevoked(tokenID string) (bool, error)
+	DeleteExpiredRevokedTokens(now time.Time) error
+}
+
+type tokenEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+// userEntry is what decides whether any of a user's tokens are still good:
+// tokens of deleted or disabled users are refused, as are tokens issued
+// before the user last logged out of every session.
+type userEntry struct {
+	refused     bool
+	loggedOutAt time.Time
+	checkedAt   time.Time
+}
+
+// Store decides whether tokens have been revoked, caching what it reads from
+// the Source.
+type Store struct {
+	source Source
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]tokenEntry
+	users  map[int64]userEntry
+}
+
+func New(source Source, ttl time.Duration) *Store {
+	return &Store{
+		source: source,
+		ttl:    ttl,
+		now:    time.Now,
+		tokens: make(map[string]tokenEntry),
+		users:  make(map[int64]userEntry),
+	}
+}
+
+// IsRevoked reports whether a token of the user issued at issuedAt may no
+// longer be used.  tokenIDs are the IDs the token answers to, such as its own
+// and that of its session; empty IDs are ignored.
+func (s *Store) IsRevoked(userID int64, issuedAt time.Time, tokenIDs ...string) (bool, error) {
+	user, err := s.user(userID)
+	if err != nil {
+		return false, err
+	}
+	if user.refused || !issuedAt.After(user.loggedOutAt) {
+		return true, nil
+	}
+
+	for _, tokenID := range tokenIDs {
+		if len(tokenID) == 0 {
+			continue
+		}
+		revoked, err := s.token(tokenID)
+		if err != nil {
+			return false, err
+		} else if revoked {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// RevokeToken revokes the token or session with the given ID until
+// expiresAt.
+func (s *Store) RevokeToken(userID int64, tokenID string, expiresAt time.Time) error {
+	err := s.source.RevokeToken(userID, tokenID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	s.tokens[tokenID] = tokenEntry{revoked: true, checkedAt: now}
+	s.mu.Unlock()
+
+	return s.source.DeleteExpiredRevokedTokens(now)
+}
+
+// RevokeAll revokes every token the user was issued until now.
+func (s *Store) RevokeAll(userID int64) error {
+	// The database keeps microseconds and may round anything finer up, which
+	// would refuse tokens issued just after the logout as well.
+	now := s.now().Truncate(time.Microsecond)
+	err := s.source.SetUserLoggedOutAt(userID, now)
+	if err != nil {
+		return err
+	}
+
+	s.Forget(userID)
+	return nil
+}
+
+// Forget drops what is cached about the user, for when their state changes.
+func (s *Store) Forget(userID int64) {
+	s.mu.Lock()
+	delete(s.users, userID)
+	s.mu.Unlock()
+}
+
+func (s *Store) user(userID int64) (userEntry, error) {
+	now := s.now()
+	s.mu.Lock()
+	entry, ok := s.users[userID]
+	s.mu.Unlock()
+	if ok && now.Sub(entry.checkedAt) < s.ttl {
+		return entry, nil
+	}
+
+	entry = userEntry{checkedAt: now}
+	user, err := s.source.GetUserByID(userID)
+	if err == datalayer.ErrNoData {
+		entry.refused = true
+	} else if err != nil {
+		return entry, err
+	} else {
+		entry.refused = datalayer.UserState(user.State.String) == datalayer.UserStateDisabled
+		if user.LoggedOutAt.Valid {
+			entry.loggedOutAt = user.LoggedOutAt.Time
+		}
+	}
+
+	s.mu.Lock()
+	s.sweep(now)
+	s.users[userID] = entry
+	s.mu.Unlock()
+
+	return entry, nil
+}
+
+func (s *Store) token(tokenID string) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	entry, ok := s.tokens[tokenID]
+	s.mu.Unlock()
+	// A revocation is permanent, so it never needs reading again.
+	if ok && (entry.revoked || now.Sub(entry.checkedAt) < s.ttl) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := s.source.IsTokenRevoked(tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.sweep(now)
+	s.tokens[tokenID] = tokenEntry{revoked: revoked, checkedAt: now}
+	s.mu.Unlock()
+
+	return revoked, nil
+}
+
+// sweep drops stale entries once the cache grows large.  Revoked tokens are
+// only kept until the cache would have expired them, by which time the token
+// has usually expired too; if not, the Source still has them.  The caller
+// holds the lock.
+func (s *Store) sweep(now time.Time) {
+	if len(s.tokens)+len(s.users) < maxEntries {
+		return
+	}
+
+	for tokenID, entry := range s.tokens {
+		if now.Sub(entry.checkedAt) >= s.ttl {
+			delete(s.tokens, tokenID)
+		}
+	}
+	for userID, entry := range s.users {
+		if now.Sub(entry.checkedAt) >= s.ttl {
+			delete(s.users, userID)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package revocation
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	users        map[int64]*datalayer.User
+	revoked      map[string]time.Time
+	userReads    int
+	tokenReads   int
+	deletedUntil time.Time
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		users: map[int64]*datalayer.User{
+			1: {State: sql.NullString{String: string(datalayer.UserStateConfirmed), Valid: true}},
+		},
+		revoked: make(map[string]time.Time),
+	}
+}
+
+func (f *fakeSource) GetUserByID(id int64) (*datalayer.User, error) {
+	f.userReads++
+	user, ok := f.users[id]
+	if !ok {
+		return nil, datalayer.ErrNoData
+	}
+	return user, nil
+}
+
+func (f *fakeSource) SetUserLoggedOutAt(id int64, loggedOutAt time.Time) error {
+	f.users[id].LoggedOutAt = datalayer.JsonNullTime{NullTime: sql.NullTime{Time: loggedOutAt, Valid: true}}
+	return nil
+}
+
+func (f *fakeSource) RevokeToken(userID int64, tokenID string, expiresAt time.Time) error {
+	f.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (f *fakeSource) IsTokenRevoked(tokenID string) (bool, error) {
+	f.tokenReads++
+	_, ok := f.revoked[tokenID]
+	return ok, nil
+}
+
+func (f *fakeSource) DeleteExpiredRevokedTokens(now time.Time) error {
+	f.deletedUntil = now
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	source := newFakeSource()
+	store := New(source, time.Minute)
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	issuedAt := now.Add(-time.Hour)
+
+	revoked, err := store.IsRevoked(1, issuedAt, "access", "session")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	revoked, err = store.IsRevoked(1, issuedAt, "access", "session")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	assert.Equal(t, 1, source.userReads, "user lookups are cached")
+	assert.Equal(t, 2, source.tokenReads, "token lookups are cached")
+
+	// A revocation through the store takes effect at once
+	require.NoError(t, store.RevokeToken(1, "session", now.Add(time.Hour)))
+	assert.Equal(t, now, source.deletedUntil)
+	revoked, err = store.IsRevoked(1, issuedAt, "access", "session")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = store.IsRevoked(1, issuedAt, "", "other")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Another instance's revocation is seen once the cache expires
+	source.revoked["other"] = now.Add(time.Hour)
+	revoked, err = store.IsRevoked(1, issuedAt, "other")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	now = now.Add(time.Minute)
+	revoked, err = store.IsRevoked(1, issuedAt, "other")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Logging out of every session refuses tokens issued before or at the
+	// logout, but not after, to the microsecond
+	now = now.Add(500 * time.Millisecond)
+	require.NoError(t, store.RevokeAll(1))
+	revoked, err = store.IsRevoked(1, now.Add(-time.Microsecond), "fresh")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = store.IsRevoked(1, now, "fresh")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = store.IsRevoked(1, now.Add(time.Microsecond), "fresh")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Tokens of disabled or missing users are refused
+	source.users[1].State.String = string(datalayer.UserStateDisabled)
+	store.Forget(1)
+	revoked, err = store.IsRevoked(1, now.Add(time.Second), "fresh")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = store.IsRevoked(2, now, "fresh")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
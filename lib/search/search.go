@@ -0,0 +1,250 @@
+package search
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Term is a single word or quoted phrase of a search.  Excluded terms were
+// written with a leading '-' and must not appear in a match.
+type Term struct {
+	Text    string
+	Phrase  bool
+	Exclude bool
+}
+
+// Query is a parsed search, such as `bakery "cape town" -online`.
+type Query struct {
+	Terms []Term
+}
+
+var (
+	ErrEmptyQuery        = errors.New("search is empty")
+	ErrUnterminatedQuote = errors.New("search has an unterminated quote")
+	ErrOnlyExclusions    = errors.New("search must include at least one term that is not excluded")
+)
+
+// MaxTerms bounds the number of terms in a single search.
+const MaxTerms = 16
+
+// Parse splits a search into words and quoted phrases.  Punctuation that the
+// database engines treat as operators is dropped from the terms.
+func Parse(s string) (Query, error) {
+	var q Query
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		exclude := false
+		if runes[i] == '-' {
+			exclude = true
+			i++
+		}
+
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return Query{}, ErrUnterminatedQuote
+			}
+			words := words(string(runes[i+1 : end]))
+			if len(words) > 0 {
+				q.Terms = append(q.Terms, Term{Text: strings.Join(words, " "), Phrase: len(words) > 1, Exclude: exclude})
+			}
+			i = end + 1
+			continue
+		}
+
+		end := i
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		for _, word := range words(string(runes[i:end])) {
+			q.Terms = append(q.Terms, Term{Text: word, Exclude: exclude})
+		}
+		i = end
+	}
+
+	if len(q.Terms) == 0 {
+		return Query{}, ErrEmptyQuery
+	}
+	if len(q.Included()) == 0 {
+		return Query{}, ErrOnlyExclusions
+	}
+	if len(q.Terms) > MaxTerms {
+		q.Terms = q.Terms[:MaxTerms]
+	}
+
+	return q, nil
+}
+
+// words lowercases s and splits it on anything that is not a letter or digit.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Included returns the terms a match must contain.
+func (q Query) Included() []Term {
+	var terms []Term
+	for _, t := range q.Terms {
+		if !t.Exclude {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// MySQLBoolean renders the query for MATCH ... AGAINST in boolean mode.
+// Every included term is required and single words match as prefixes.
+func (q Query) MySQLBoolean() string {
+	parts := make([]string, 0, len(q.Terms))
+	for _, t := range q.Terms {
+		op := "+"
+		if t.Exclude {
+			op = "-"
+		}
+		switch {
+		case t.Phrase:
+			parts = append(parts, op+`"`+t.Text+`"`)
+		case t.Exclude:
+			parts = append(parts, op+t.Text)
+		default:
+			parts = append(parts, op+t.Text+"*")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// snippetRadius is the number of characters kept either side of the first
+// match when a field is too long to return whole.
+const snippetRadius = 40
+
+// Highlight returns the part of text around the first included term with
+// every included term wrapped in <em> tags, or "" when nothing matches.  The
+// text itself is HTML escaped.
+func (q Query) Highlight(text string) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	type span struct{ start, end int }
+	var spans []span
+
+	for i := 0; i < len(lower); {
+		matched := 0
+		for _, t := range q.Included() {
+			n := matchAt(lower, i, t)
+			if n > matched {
+				matched = n
+			}
+		}
+		if matched > 0 {
+			spans = append(spans, span{i, i + matched})
+			i += matched
+			continue
+		}
+		i++
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+
+	from, to := 0, len(runes)
+	if len(runes) > 2*snippetRadius {
+		from = spans[0].start - snippetRadius
+		if from < 0 {
+			from = 0
+		}
+		to = spans[0].end + snippetRadius
+		if to > len(runes) {
+			to = len(runes)
+		}
+
+		// Do not cut words in half at either end of the snippet.
+		for from > 0 && from < spans[0].start && isWordRune(lower[from-1]) {
+			from++
+		}
+		for from < spans[0].start && !isWordRune(lower[from]) {
+			from++
+		}
+		for to < len(runes) && to > spans[0].end && isWordRune(lower[to]) {
+			to--
+		}
+		for to > spans[0].end && !isWordRune(lower[to-1]) {
+			to--
+		}
+	}
+
+	b := new(strings.Builder)
+	if from > 0 {
+		b.WriteString("…")
+	}
+	at := from
+	for _, s := range spans {
+		if s.start < from || s.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[at:s.start])))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(string(runes[s.start:s.end])))
+		b.WriteString("</em>")
+		at = s.end
+	}
+	b.WriteString(html.EscapeString(string(runes[at:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+// matchAt reports the length of the match of t starting at lower[i], where
+// a term has to start on a word boundary.  Words match as prefixes, as they
+// do in the database; phrases allow any run of separators between words.
+func matchAt(lower []rune, i int, t Term) int {
+	if i > 0 && isWordRune(lower[i-1]) {
+		return 0
+	}
+
+	at := i
+	for n, word := range strings.Fields(t.Text) {
+		if n > 0 {
+			start := at
+			for at < len(lower) && !isWordRune(lower[at]) {
+				at++
+			}
+			if at == start {
+				return 0
+			}
+		}
+		for _, r := range word {
+			if at >= len(lower) || lower[at] != r {
+				return 0
+			}
+			at++
+		}
+	}
+
+	if t.Phrase && at < len(lower) && isWordRune(lower[at]) {
+		return 0
+	}
+	for !t.Phrase && at < len(lower) && isWordRune(lower[at]) {
+		at++
+	}
+
+	return at - i
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,75 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		search   string
+		expTerms []Term
+		expMySQL string
+		expErr   error
+	}{
+		{
+			name:   "Words, phrases and exclusions",
+			search: `Bakery "Cape  Town" -online -"gift card"`,
+			expTerms: []Term{
+				{Text: "bakery"},
+				{Text: "cape town", Phrase: true},
+				{Text: "online", Exclude: true},
+				{Text: "gift card", Phrase: true, Exclude: true},
+			},
+			expMySQL: `+bakery* +"cape town" -online -"gift card"`,
+		},
+		{
+			name:     "Operators are dropped",
+			search:   `+coders* (bakery)~`,
+			expTerms: []Term{{Text: "coders"}, {Text: "bakery"}},
+			expMySQL: `+coders* +bakery*`,
+		},
+		{
+			name:   "Unterminated quote",
+			search: `"cape town`,
+			expErr: ErrUnterminatedQuote,
+		},
+		{
+			name:   "Only exclusions",
+			search: `-online`,
+			expErr: ErrOnlyExclusions,
+		},
+		{
+			name:   "Empty",
+			search: ` "" - `,
+			expErr: ErrEmptyQuery,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := Parse(test.search)
+			if test.expErr != nil {
+				assert.Equal(t, test.expErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expTerms, q.Terms)
+			assert.Equal(t, test.expMySQL, q.MySQLBoolean())
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	q, err := Parse(`bak "cape town" -online`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "The Coders <em>Bakery</em>", q.Highlight("The Coders Bakery"))
+	assert.Equal(t, "<em>Cape-Town</em> &amp; surrounds", q.Highlight("Cape-Town & surrounds"))
+	assert.Equal(t, "", q.Highlight("Kebakery online"))
+	assert.Equal(t, "…the office and a loaf of bread from the <em>bakery</em> on the way home, then petrol on the…",
+		q.Highlight("Coffee beans for the office and a loaf of bread from the bakery on the way home, then petrol on the highway"))
+}
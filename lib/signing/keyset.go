@@ -0,0 +1,337 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ManifestFile lists the keys in a key directory.
+const ManifestFile = "keys.json"
+
+// minRSABits is the smallest RSA key accepted.
+const minRSABits = 2048
+
+var (
+	ErrNoKeys         = errors.New("no signing keys are configured")
+	ErrNoSigningKey   = errors.New("no signing key is active")
+	ErrUnknownKey     = errors.New("token is signed with an unknown key")
+	ErrWrongAlgorithm = errors.New("token is signed with the wrong algorithm")
+)
+
+// Key is a key that tokens are signed or verified with.  Tokens name the key
+// that signed them in their kid header.  Keys without a private half only
+// verify tokens, such as those of a key being retired.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	NotBefore time.Time
+	NotAfter  time.Time
+	private   interface{}
+	public    interface{}
+}
+
+// usable reports whether the key may be used at now: a key is published and
+// verifies tokens until NotAfter, if it has one.
+func (k *Key) usable(now time.Time) bool {
+	return k.NotAfter.IsZero() || now.Before(k.NotAfter)
+}
+
+// manifestEntry describes a key file.  Times are RFC 3339; a key without
+// notBefore signs from when it is loaded, and one without notAfter never
+// retires.
+type manifestEntry struct {
+	ID        string    `json:"kid"`
+	File      string    `json:"file"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+type manifest struct {
+	Keys []manifestEntry `json:"keys"`
+}
+
+// KeySet holds the keys that tokens are signed and verified with.  Tokens are
+// signed with the active key that became active last, so a key listed with a
+// future notBefore is published straight away and takes over signing on
+// schedule.  Keys are read from a directory holding a manifest and PEM files,
+// RSA keys signing with RS256 and Ed25519 keys with EdDSA.
+//
+// A shared secret may also be given.  Without a key directory, tokens are
+// signed with it using HS256, as they always have been.  With one, the secret
+// only verifies tokens signed before keys were introduced.
+type KeySet struct {
+	dir    string
+	secret []byte
+	now    func() time.Time
+
+	mu   sync.RWMutex
+	keys map[string]*Key
+}
+
+// New reads the keys in dir, if given, and takes the shared secret, if
+// given.  One of the two is required.
+func New(dir, secret string) (*KeySet, error) {
+	if len(dir) == 0 && len(secret) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	s := &KeySet{
+		dir:    dir,
+		secret: []byte(secret),
+		now:    time.Now,
+		keys:   make(map[string]*Key),
+	}
+	err := s.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Generate returns a key set of one new Ed25519 key that only lives in
+// memory, for tests.
+func Generate(kid string) (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &KeySet{
+		now: time.Now,
+		keys: map[string]*Key{
+			kid: {ID: kid, Method: SigningMethodEdDSA, private: private, public: public},
+		},
+	}
+	return s, nil
+}
+
+// Reload reads the key directory again, so that keys can be added and
+// retired without a restart.  The keys in use are kept if it fails.
+func (s *KeySet) Reload() error {
+	if len(s.dir) == 0 {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, ManifestFile))
+	if err != nil {
+		return err
+	}
+	m := new(manifest)
+	err = json.Unmarshal(b, m)
+	if err != nil {
+		return fmt.Errorf("invalid key manifest: %w", err)
+	}
+
+	keys := make(map[string]*Key, len(m.Keys))
+	signing := false
+	for _, entry := range m.Keys {
+		if len(entry.ID) == 0 {
+			return fmt.Errorf("key %q has no kid", entry.File)
+		} else if _, ok := keys[entry.ID]; ok {
+			return fmt.Errorf("kid %q is listed twice", entry.ID)
+		}
+
+		key, err := loadKey(filepath.Join(s.dir, filepath.Clean("/"+entry.File)))
+		if err != nil {
+			return fmt.Errorf("key %q: %w", entry.ID, err)
+		}
+		key.ID = entry.ID
+		key.NotBefore = entry.NotBefore
+		key.NotAfter = entry.NotAfter
+		keys[key.ID] = key
+		signing = signing || key.private != nil
+	}
+	if !signing {
+		return ErrNoSigningKey
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+func loadKey(path string) (*Key, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := new(Key)
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.private, key.public = SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.public = SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	if public, ok := key.public.(*rsa.PublicKey); ok && public.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+	}
+
+	return key, nil
+}
+
+// signingKey is the key tokens are signed with now.
+func (s *KeySet) signingKey() *Key {
+	now := s.now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var active *Key
+	for _, key := range s.keys {
+		if key.private == nil || now.Before(key.NotBefore) || !key.usable(now) {
+			continue
+		}
+		if active == nil || key.NotBefore.After(active.NotBefore) ||
+			(key.NotBefore.Equal(active.NotBefore) && key.ID > active.ID) {
+			active = key
+		}
+	}
+
+	return active
+}
+
+// Sign signs the claims with the active key.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := s.signingKey()
+	if key == nil {
+		if len(s.dir) > 0 || len(s.secret) == 0 {
+			return "", ErrNoSigningKey
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// Keyfunc finds the key to verify a token with, for jwt.Parse.  The token
+// must use the algorithm of the key it names, so that a public key is never
+// mistaken for a shared secret.
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if len(kid) == 0 {
+		if len(s.secret) > 0 && token.Method == jwt.SigningMethodHS256 {
+			return s.secret, nil
+		}
+		return nil, ErrUnknownKey
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+	if !ok || !key.usable(s.now()) {
+		return nil, ErrUnknownKey
+	} else if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrWrongAlgorithm
+	}
+
+	return key.public, nil
+}
+
+// JSONWebKey is the public half of a key, as published in a JWKS.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys that tokens may be verified with, including
+// those yet to become active.  The shared secret is never published.
+func (s *KeySet) JWKS() *JSONWebKeySet {
+	now := s.now()
+	s.mu.RLock()
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		if key.usable(now) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].NotBefore.Equal(keys[j].NotBefore) {
+			return keys[i].NotBefore.Before(keys[j].NotBefore)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	set := &JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(keys))}
+	for _, key := range keys {
+		jwk := JSONWebKey{ID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = jwt.EncodeSegment(public.N.Bytes())
+			jwk.E = jwt.EncodeSegment(exponentBytes(public.E))
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = jwt.EncodeSegment(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// exponentBytes encodes an RSA exponent as big-endian bytes without leading
+// zeros.
+func exponentBytes(e int) []byte {
+	var b []byte
+	for ; e > 0; e >>= 8 {
+		b = append([]byte{byte(e)}, b...)
+	}
+	return b
+}
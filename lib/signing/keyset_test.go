@@ -0,0 +1,125 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, file string, key interface{}) {
+	t.Helper()
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, file), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), 0600)
+	require.NoError(t, err)
+}
+
+func writeManifest(t *testing.T, dir string, entries ...manifestEntry) {
+	t.Helper()
+	b, err := json.Marshal(manifest{Keys: entries})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ManifestFile), b, 0600))
+}
+
+func signedKID(t *testing.T, s *KeySet) (string, string) {
+	t.Helper()
+	signed, err := s.Sign(&jwt.StandardClaims{Subject: "subzero"})
+	require.NoError(t, err)
+	claims := new(jwt.StandardClaims)
+	token, err := jwt.ParseWithClaims(signed, claims, s.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "subzero", claims.Subject)
+	kid, _ := token.Header["kid"].(string)
+	return kid, token.Method.Alg()
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "2020-06.pem", rsaKey)
+	writeKey(t, dir, "2020-07.pem", edKey)
+
+	now := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+	rotation := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	writeManifest(t, dir,
+		manifestEntry{ID: "2020-06", File: "2020-06.pem", NotAfter: rotation.AddDate(0, 0, 15)},
+		manifestEntry{ID: "2020-07", File: "2020-07.pem", NotBefore: rotation},
+	)
+	s, err := New(dir, "secret")
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	// The next key is published before it signs anything
+	kid, alg := signedKID(t, s)
+	assert.Equal(t, "2020-06", kid)
+	assert.Equal(t, "RS256", alg)
+	jwks := s.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, JSONWebKey{KeyType: "RSA", ID: "2020-06", Use: "sig", Algorithm: "RS256",
+		N: jwt.EncodeSegment(rsaKey.N.Bytes()), E: "AQAB"}, jwks.Keys[0])
+	assert.Equal(t, JSONWebKey{KeyType: "OKP", ID: "2020-07", Use: "sig", Algorithm: "EdDSA", Curve: "Ed25519",
+		X: jwt.EncodeSegment(edKey.Public().(ed25519.PublicKey))}, jwks.Keys[1])
+	old, err := s.Sign(&jwt.StandardClaims{})
+	require.NoError(t, err)
+
+	// It takes over on schedule, and the old key verifies until it retires
+	now = rotation
+	kid, alg = signedKID(t, s)
+	assert.Equal(t, "2020-07", kid)
+	assert.Equal(t, "EdDSA", alg)
+	_, err = jwt.Parse(old, s.Keyfunc)
+	assert.NoError(t, err)
+	now = rotation.AddDate(0, 0, 15)
+	_, err = jwt.Parse(old, s.Keyfunc)
+	assert.Error(t, err)
+	assert.Len(t, s.JWKS().Keys, 1)
+
+	// Tokens must use the algorithm of the key they name, and the shared
+	// secret only verifies tokens without a kid
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{})
+	forged.Header["kid"] = "2020-07"
+	signed, err := forged.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+	require.NoError(t, err)
+	_, err = jwt.Parse(signed, s.Keyfunc)
+	assert.Error(t, err)
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = jwt.Parse(legacy, s.Keyfunc)
+	assert.NoError(t, err)
+
+	// A broken manifest leaves the keys in use alone
+	writeManifest(t, dir, manifestEntry{ID: "2020-08", File: "missing.pem"})
+	assert.Error(t, s.Reload())
+	kid, _ = signedKID(t, s)
+	assert.Equal(t, "2020-07", kid)
+}
+
+func TestKeySetSecret(t *testing.T) {
+	_, err := New("", "")
+	assert.Equal(t, ErrNoKeys, err)
+
+	s, err := New("", "secret")
+	require.NoError(t, err)
+	kid, alg := signedKID(t, s)
+	assert.Empty(t, kid)
+	assert.Equal(t, "HS256", alg)
+	assert.Empty(t, s.JWKS().Keys)
+}
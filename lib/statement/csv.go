@@ -0,0 +1,167 @@
+package statement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ColumnMapping names the CSV header of each transaction field.  Columns left
+// empty are not read.
+type ColumnMapping struct {
+	DateTime             string `json:"dateTime"`
+	Amount               string `json:"amount"`
+	CurrencyCode         string `json:"currencyCode"`
+	Reference            string `json:"reference"`
+	MerchantName         string `json:"merchantName"`
+	MerchantCity         string `json:"merchantCity"`
+	MerchantCountryCode  string `json:"merchantCountryCode"`
+	MerchantCountryName  string `json:"merchantCountryName"`
+	MerchantCategoryCode string `json:"merchantCategoryCode"`
+	MerchantCategoryName string `json:"merchantCategoryName"`
+
+	// DateFormat is a Go time layout, tried before the common defaults.
+	DateFormat string `json:"dateFormat"`
+	// Delimiter separates fields, defaulting to a comma.
+	Delimiter string `json:"delimiter"`
+	// DecimalComma reads "1.234,56" style amounts.
+	DecimalComma bool `json:"decimalComma"`
+	// DebitsPositive marks statements that list money spent as positive.
+	DebitsPositive bool `json:"debitsPositive"`
+}
+
+// DefaultColumnMapping matches the headers written by the CSV exporter.
+var DefaultColumnMapping = ColumnMapping{
+	DateTime:             "dateTime",
+	Amount:               "amount",
+	CurrencyCode:         "currencyCode",
+	Reference:            "reference",
+	MerchantName:         "merchantName",
+	MerchantCity:         "merchantCity",
+	MerchantCountryCode:  "merchantCountryCode",
+	MerchantCountryName:  "merchantCountryName",
+	MerchantCategoryCode: "merchantCategoryCode",
+	MerchantCategoryName: "merchantCategoryName",
+}
+
+var csvDateLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+	"02/01/2006",
+	"2 Jan 2006",
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	mapping ColumnMapping
+	columns map[string]int
+	row     int
+}
+
+// NewCSVReader reads the header row and resolves the mapped columns.  Rows are
+// numbered from the header, which is row 1.
+func NewCSVReader(r io.Reader, mapping ColumnMapping) (Reader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+	if len(mapping.Delimiter) > 0 {
+		reader.Comma = []rune(mapping.Delimiter)[0]
+	}
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv statement is empty")
+	} else if err != nil {
+		return nil, err
+	}
+
+	c := &csvReader{
+		reader:  reader,
+		mapping: mapping,
+		columns: make(map[string]int, len(header)),
+		row:     1,
+	}
+	for i, name := range header {
+		c.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for field, column := range map[string]string{
+		"dateTime":     mapping.DateTime,
+		"amount":       mapping.Amount,
+		"merchantName": mapping.MerchantName,
+	} {
+		if len(column) == 0 {
+			return nil, fmt.Errorf("a column mapping for %s is required", field)
+		}
+		if _, ok := c.columns[strings.ToLower(column)]; !ok {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the header", column, field)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *csvReader) Read() (*Transaction, error) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	c.row++
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		rowErr := &RowError{Row: c.row}
+		rowErr.add("row", parseErr.Err.Error())
+		return nil, rowErr
+	} else if err != nil {
+		return nil, err
+	}
+
+	value := func(column string) string {
+		i, ok := c.columns[strings.ToLower(column)]
+		if len(column) == 0 || !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rowErr := &RowError{Row: c.row}
+	t := &Transaction{
+		Row:                  c.row,
+		CurrencyCode:         value(c.mapping.CurrencyCode),
+		Reference:            value(c.mapping.Reference),
+		MerchantName:         value(c.mapping.MerchantName),
+		MerchantCity:         value(c.mapping.MerchantCity),
+		MerchantCountryCode:  value(c.mapping.MerchantCountryCode),
+		MerchantCountryName:  value(c.mapping.MerchantCountryName),
+		MerchantCategoryCode: value(c.mapping.MerchantCategoryCode),
+		MerchantCategoryName: value(c.mapping.MerchantCategoryName),
+	}
+
+	layouts := csvDateLayouts
+	if len(c.mapping.DateFormat) > 0 {
+		layouts = append([]string{c.mapping.DateFormat}, csvDateLayouts...)
+	}
+	t.DateTime, err = parseTime(value(c.mapping.DateTime), layouts)
+	if err != nil {
+		rowErr.add("dateTime", err.Error())
+	}
+
+	t.Amount, t.Scale, err = ParseAmount(value(c.mapping.Amount), c.mapping.DecimalComma)
+	if err != nil {
+		rowErr.add("amount", err.Error())
+	}
+	if c.mapping.DebitsPositive {
+		t.Amount = -t.Amount
+	}
+
+	if len(rowErr.Fields) > 0 {
+		return nil, rowErr
+	}
+
+	return t, nil
+}
@@ -0,0 +1,118 @@
+package statement
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		name         string
+		csv          string
+		mapping      ColumnMapping
+		expOpenErr   string
+		expTxns      []*Transaction
+		expRowErrors []*RowError
+	}{
+		{
+			name: "Exported columns",
+			csv: "dateTime,amount,currencyCode,reference,merchantName,merchantCity\n" +
+				"2020-04-25T11:39:41Z,-12.50,ZAR,ref1,Pick n Pay,Cape Town\n",
+			mapping: DefaultColumnMapping,
+			expTxns: []*Transaction{{
+				Row:          2,
+				DateTime:     time.Date(2020, 4, 25, 11, 39, 41, 0, time.UTC),
+				Amount:       -1250,
+				Scale:        2,
+				CurrencyCode: "ZAR",
+				Reference:    "ref1",
+				MerchantName: "Pick n Pay",
+				MerchantCity: "Cape Town",
+			}},
+		},
+		{
+			name: "Custom mapping",
+			csv: "Date;Value;Description\n" +
+				"25.04.2020;1.234,50;Woolworths\n",
+			mapping: ColumnMapping{
+				DateTime:       "date",
+				Amount:         "Value",
+				MerchantName:   "DESCRIPTION",
+				DateFormat:     "02.01.2006",
+				Delimiter:      ";",
+				DecimalComma:   true,
+				DebitsPositive: true,
+			},
+			expTxns: []*Transaction{{
+				Row:          2,
+				DateTime:     time.Date(2020, 4, 25, 0, 0, 0, 0, time.UTC),
+				Amount:       -123450,
+				Scale:        2,
+				MerchantName: "Woolworths",
+			}},
+		},
+		{
+			name: "Bad rows are reported and skipped",
+			csv: "dateTime,amount,merchantName\n" +
+				"yesterday,abc,Spar\n" +
+				"2020/04/26,5,Spar\n" +
+				"\"unterminated,1,Spar\n",
+			mapping: DefaultColumnMapping,
+			expTxns: []*Transaction{{
+				Row:          3,
+				DateTime:     time.Date(2020, 4, 26, 0, 0, 0, 0, time.UTC),
+				Amount:       500,
+				Scale:        2,
+				MerchantName: "Spar",
+			}},
+			expRowErrors: []*RowError{
+				{Row: 2, Fields: []FieldError{
+					{Field: "dateTime", Message: `unrecognised date "yesterday"`},
+					{Field: "amount", Message: `invalid amount "abc"`},
+				}},
+				{Row: 4, Fields: []FieldError{
+					{Field: "row", Message: `extraneous or missing " in quoted-field`},
+				}},
+			},
+		},
+		{
+			name:       "Empty statement",
+			csv:        "",
+			mapping:    DefaultColumnMapping,
+			expOpenErr: "csv statement is empty",
+		},
+		{
+			name:       "Unmapped required column",
+			csv:        "dateTime,amount,merchantName\n",
+			mapping:    ColumnMapping{DateTime: "dateTime", Amount: "amount"},
+			expOpenErr: "a column mapping for merchantName is required",
+		},
+		{
+			name:       "Mapped column missing from header",
+			csv:        "dateTime,amount\n",
+			mapping:    DefaultColumnMapping,
+			expOpenErr: `column "merchantName" mapped to merchantName is not in the header`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := NewCSVReader(strings.NewReader(test.csv), test.mapping)
+			if len(test.expOpenErr) > 0 {
+				require.Error(t, err)
+				assert.Equal(t, test.expOpenErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+
+			txns, rowErrs, err := readAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, test.expTxns, txns)
+			assert.Equal(t, test.expRowErrors, rowErrs)
+		})
+	}
+}
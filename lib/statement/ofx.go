@@ -0,0 +1,157 @@
+package statement
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ofxEntities = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&nbsp;", " ")
+
+var ofxDate = regexp.MustCompile(`^(\d{8})(\d{6})?(?:\.\d+)?(?:\[([+-]?\d+(?:\.\d+)?)(?::[A-Za-z]+)?\])?$`)
+
+type ofxReader struct {
+	reader   *bufio.Reader
+	currency string
+	row      int
+}
+
+// NewOFXReader reads both SGML (OFX 1.x) and XML (OFX 2.x) statements.  The
+// document is tokenised as it is read, so only the current <STMTTRN> is held
+// in memory.  Rows are numbered by transaction.
+func NewOFXReader(r io.Reader) Reader {
+	return &ofxReader{reader: bufio.NewReader(r)}
+}
+
+// next returns the next tag name and the text that follows it up to the
+// following tag.
+func (o *ofxReader) next() (string, string, error) {
+	_, err := o.reader.ReadString('<')
+	if err != nil {
+		return "", "", err
+	}
+
+	tag, err := o.reader.ReadString('>')
+	if err == io.EOF {
+		return "", "", io.ErrUnexpectedEOF
+	} else if err != nil {
+		return "", "", err
+	}
+	tag = strings.ToUpper(strings.TrimSpace(strings.TrimSuffix(tag, ">")))
+
+	text, err := o.reader.ReadString('<')
+	if err == nil {
+		err = o.reader.UnreadByte()
+		text = text[:len(text)-1]
+	} else if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return tag, ofxEntities.Replace(strings.TrimSpace(text)), nil
+}
+
+func (o *ofxReader) Read() (*Transaction, error) {
+	var fields map[string]string
+	for {
+		tag, text, err := o.next()
+		if err == io.EOF && fields == nil {
+			return nil, io.EOF
+		} else if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!"):
+			continue
+		case tag == "CURDEF":
+			o.currency = text
+		case tag == "STMTTRN":
+			fields = make(map[string]string)
+		case tag == "/STMTTRN":
+			if fields == nil {
+				return nil, errors.New("unexpected </STMTTRN>")
+			}
+			o.row++
+			return o.transaction(fields)
+		case fields != nil && !strings.HasPrefix(tag, "/") && len(text) > 0:
+			if _, ok := fields[tag]; !ok {
+				fields[tag] = text
+			}
+		}
+	}
+}
+
+func (o *ofxReader) transaction(fields map[string]string) (*Transaction, error) {
+	rowErr := &RowError{Row: o.row}
+	t := &Transaction{
+		Row:          o.row,
+		CurrencyCode: o.currency,
+		Reference:    fields["MEMO"],
+		MerchantName: fields["NAME"],
+	}
+	if currency, ok := fields["CURSYM"]; ok {
+		t.CurrencyCode = currency
+	}
+	if len(t.Reference) == 0 {
+		t.Reference = fields["FITID"]
+	}
+	if len(t.MerchantName) == 0 {
+		t.MerchantName = fields["MEMO"]
+	}
+	t.MerchantCity = fields["CITY"]
+	t.MerchantCountryCode = fields["COUNTRY"]
+	t.MerchantCategoryCode = fields["SIC"]
+	t.MerchantCategoryName = fields["TRNTYPE"]
+
+	var err error
+	t.DateTime, err = parseOFXDate(fields["DTPOSTED"])
+	if err != nil {
+		rowErr.add("dateTime", err.Error())
+	}
+
+	t.Amount, t.Scale, err = ParseAmount(fields["TRNAMT"], strings.Contains(fields["TRNAMT"], ","))
+	if err != nil {
+		rowErr.add("amount", err.Error())
+	}
+
+	if len(rowErr.Fields) > 0 {
+		return nil, rowErr
+	}
+
+	return t, nil
+}
+
+// parseOFXDate reads dates such as 20200425, 20200425113941 and
+// 20200425113941.422[-5:EST].
+func parseOFXDate(value string) (time.Time, error) {
+	match := ofxDate.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+	}
+
+	clock := match[2]
+	if len(clock) == 0 {
+		clock = "000000"
+	}
+
+	location := time.UTC
+	if len(match[3]) > 0 {
+		hours, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unrecognised time zone in %q", value)
+		}
+		location = time.FixedZone("", int(hours*3600))
+	}
+
+	return time.ParseInLocation("20060102150405", match[1]+clock, location)
+}
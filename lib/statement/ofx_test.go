@@ -0,0 +1,110 @@
+package statement
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOFXDate(t *testing.T) {
+	tests := []struct {
+		value  string
+		exp    time.Time
+		expErr bool
+	}{
+		{value: "20200425", exp: time.Date(2020, 4, 25, 0, 0, 0, 0, time.UTC)},
+		{value: "20200425113941", exp: time.Date(2020, 4, 25, 11, 39, 41, 0, time.UTC)},
+		{value: "20200425113941.422[-5:EST]", exp: time.Date(2020, 4, 25, 16, 39, 41, 0, time.UTC)},
+		{value: "20200425113941[+5.5:IST]", exp: time.Date(2020, 4, 25, 6, 9, 41, 0, time.UTC)},
+		{value: " 20200425120000[0] ", exp: time.Date(2020, 4, 25, 12, 0, 0, 0, time.UTC)},
+		{value: "2020-04-25", expErr: true},
+		{value: "20201325", expErr: true},
+		{value: "", expErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseOFXDate(test.value)
+		if test.expErr {
+			assert.Error(t, err, test.value)
+			continue
+		}
+		require.NoError(t, err, test.value)
+		assert.True(t, test.exp.Equal(got), "%s: got %v", test.value, got)
+	}
+}
+
+func TestOFXReader(t *testing.T) {
+	tests := []struct {
+		name         string
+		ofx          string
+		expTxns      []*Transaction
+		expRowErrors []*RowError
+		expErr       error
+	}{
+		{
+			name: "SGML",
+			ofx: "OFXHEADER:100\nDATA:OFXSGML\n\n<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS>\n" +
+				"<CURDEF>ZAR\n<BANKTRANLIST>\n" +
+				"<STMTTRN>\n<TRNTYPE>DEBIT\n<DTPOSTED>20200425\n<TRNAMT>-12.50\n<FITID>1001\n<NAME>Pick &amp; Pay\n</STMTTRN>\n" +
+				"<STMTTRN>\n<TRNTYPE>CREDIT\n<DTPOSTED>20200426120000\n<TRNAMT>100\n<FITID>1002\n<MEMO>Salary\n<CURRENCY><CURSYM>USD</CURRENCY>\n</STMTTRN>\n" +
+				"</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\n",
+			expTxns: []*Transaction{
+				{
+					Row:                  1,
+					DateTime:             time.Date(2020, 4, 25, 0, 0, 0, 0, time.UTC),
+					Amount:               -1250,
+					Scale:                2,
+					CurrencyCode:         "ZAR",
+					Reference:            "1001",
+					MerchantName:         "Pick & Pay",
+					MerchantCategoryName: "DEBIT",
+				},
+				{
+					Row:                  2,
+					DateTime:             time.Date(2020, 4, 26, 12, 0, 0, 0, time.UTC),
+					Amount:               10000,
+					Scale:                2,
+					CurrencyCode:         "USD",
+					Reference:            "Salary",
+					MerchantName:         "Salary",
+					MerchantCategoryName: "CREDIT",
+				},
+			},
+		},
+		{
+			name: "XML with a bad row",
+			ofx: `<?xml version="1.0"?><?OFX OFXHEADER="200"?><OFX><CURDEF>EUR</CURDEF>` +
+				`<STMTTRN><DTPOSTED>garbage</DTPOSTED><TRNAMT>1,5</TRNAMT><NAME>Bad</NAME></STMTTRN>` +
+				`<STMTTRN><DTPOSTED>20200427</DTPOSTED><TRNAMT>-1,5</TRNAMT><NAME>Café</NAME></STMTTRN></OFX>`,
+			expTxns: []*Transaction{{
+				Row:          2,
+				DateTime:     time.Date(2020, 4, 27, 0, 0, 0, 0, time.UTC),
+				Amount:       -150,
+				Scale:        2,
+				CurrencyCode: "EUR",
+				MerchantName: "Café",
+			}},
+			expRowErrors: []*RowError{{Row: 1, Fields: []FieldError{
+				{Field: "dateTime", Message: `unrecognised date "garbage"`},
+			}}},
+		},
+		{
+			name:   "Truncated transaction",
+			ofx:    "<OFX><STMTTRN><DTPOSTED>20200425<TRNAMT>1",
+			expErr: io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			txns, rowErrs, err := readAll(NewOFXReader(strings.NewReader(test.ofx)))
+			assert.Equal(t, test.expErr, err)
+			assert.Equal(t, test.expTxns, txns)
+			assert.Equal(t, test.expRowErrors, rowErrs)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package statement
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+var qifDateLayouts = []string{
+	"01/02/2006",
+	"1/2/2006",
+	"01/02'06",
+	"1/2'06",
+	"01/02/06",
+	"1/2/06",
+	"2006-01-02",
+	"02.01.2006",
+}
+
+type qifReader struct {
+	scanner      *bufio.Scanner
+	currency     string
+	dateFormat   string
+	decimalComma bool
+	row          int
+}
+
+// NewQIFReader reads a Quicken Interchange Format statement line by line.
+// QIF carries no currency, so every transaction gets currencyCode.  Rows are
+// numbered by transaction.
+func NewQIFReader(r io.Reader, currencyCode, dateFormat string, decimalComma bool) Reader {
+	return &qifReader{
+		scanner:      bufio.NewScanner(r),
+		currency:     currencyCode,
+		dateFormat:   dateFormat,
+		decimalComma: decimalComma,
+	}
+}
+
+func (q *qifReader) Read() (*Transaction, error) {
+	fields := make(map[byte]string)
+	for q.scanner.Scan() {
+		line := strings.TrimRight(q.scanner.Text(), "\r")
+		if len(strings.TrimSpace(line)) == 0 || line[0] == '!' {
+			continue
+		}
+
+		if line[0] == '^' {
+			if len(fields) == 0 {
+				continue
+			}
+			q.row++
+			return q.transaction(fields)
+		}
+
+		// Keep the first occurrence; split lines (S/E/$) repeat codes.
+		if _, ok := fields[line[0]]; !ok {
+			fields[line[0]] = strings.TrimSpace(line[1:])
+		}
+	}
+
+	if err := q.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return nil, io.EOF
+}
+
+func (q *qifReader) transaction(fields map[byte]string) (*Transaction, error) {
+	rowErr := &RowError{Row: q.row}
+	t := &Transaction{
+		Row:                  q.row,
+		CurrencyCode:         q.currency,
+		Reference:            fields['N'],
+		MerchantName:         fields['P'],
+		MerchantCategoryName: fields['L'],
+	}
+	if len(t.Reference) == 0 {
+		t.Reference = fields['M']
+	}
+	if len(t.MerchantName) == 0 {
+		t.MerchantName = fields['M']
+	}
+	if address, ok := fields['A']; ok {
+		t.MerchantCity = address
+	}
+
+	layouts := qifDateLayouts
+	if len(q.dateFormat) > 0 {
+		layouts = append([]string{q.dateFormat}, qifDateLayouts...)
+	}
+	var err error
+	t.DateTime, err = parseTime(fields['D'], layouts)
+	if err != nil {
+		rowErr.add("dateTime", err.Error())
+	}
+
+	amount, ok := fields['T']
+	if !ok {
+		amount = fields['U']
+	}
+	t.Amount, t.Scale, err = ParseAmount(amount, q.decimalComma)
+	if err != nil {
+		rowErr.add("amount", err.Error())
+	}
+
+	if len(rowErr.Fields) > 0 {
+		return nil, rowErr
+	}
+
+	return t, nil
+}
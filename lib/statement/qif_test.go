@@ -0,0 +1,96 @@
+package statement
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQIFReader(t *testing.T) {
+	tests := []struct {
+		name         string
+		qif          string
+		dateFormat   string
+		decimalComma bool
+		expTxns      []*Transaction
+		expRowErrors []*RowError
+		expErr       error
+	}{
+		{
+			name: "Bank account",
+			qif: "!Type:Bank\r\n" +
+				"D04/25/2020\r\nT-12.50\r\nNchq1\r\nPPick n Pay\r\nLGroceries\r\nACape Town\r\n^\r\n" +
+				"D4/26'20\r\nU1,000.00\r\nMSalary\r\n^\r\n",
+			expTxns: []*Transaction{
+				{
+					Row:                  1,
+					DateTime:             time.Date(2020, 4, 25, 0, 0, 0, 0, time.UTC),
+					Amount:               -1250,
+					Scale:                2,
+					CurrencyCode:         "ZAR",
+					Reference:            "chq1",
+					MerchantName:         "Pick n Pay",
+					MerchantCity:         "Cape Town",
+					MerchantCategoryName: "Groceries",
+				},
+				{
+					Row:          2,
+					DateTime:     time.Date(2020, 4, 26, 0, 0, 0, 0, time.UTC),
+					Amount:       100000,
+					Scale:        2,
+					CurrencyCode: "ZAR",
+					Reference:    "Salary",
+					MerchantName: "Salary",
+				},
+			},
+		},
+		{
+			name:         "Date format and decimal comma",
+			qif:          "!Type:CCard\nD25-04-2020\nT-1.234,50\nPSpar\nSFood\n$-1.000,00\nSHome\n$-234,50\n^\n",
+			dateFormat:   "02-01-2006",
+			decimalComma: true,
+			expTxns: []*Transaction{{
+				Row:          1,
+				DateTime:     time.Date(2020, 4, 25, 0, 0, 0, 0, time.UTC),
+				Amount:       -123450,
+				Scale:        2,
+				CurrencyCode: "ZAR",
+				MerchantName: "Spar",
+			}},
+		},
+		{
+			name: "Bad row",
+			qif:  "!Type:Bank\nDsoon\nPSpar\n^\nD2020-04-27\nT5\nPSpar\n^\n",
+			expTxns: []*Transaction{{
+				Row:          2,
+				DateTime:     time.Date(2020, 4, 27, 0, 0, 0, 0, time.UTC),
+				Amount:       500,
+				Scale:        2,
+				CurrencyCode: "ZAR",
+				MerchantName: "Spar",
+			}},
+			expRowErrors: []*RowError{{Row: 1, Fields: []FieldError{
+				{Field: "dateTime", Message: `unrecognised date "soon"`},
+				{Field: "amount", Message: "empty amount"},
+			}}},
+		},
+		{
+			name:   "Missing end of record",
+			qif:    "!Type:Bank\nD04/25/2020\nT-1.00\n",
+			expErr: io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewQIFReader(strings.NewReader(test.qif), "ZAR", test.dateFormat, test.decimalComma)
+			txns, rowErrs, err := readAll(reader)
+			assert.Equal(t, test.expErr, err)
+			assert.Equal(t, test.expTxns, txns)
+			assert.Equal(t, test.expRowErrors, rowErrs)
+		})
+	}
+}
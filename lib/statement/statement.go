@@ -0,0 +1,179 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transaction is a single entry read from a bank statement.  Amounts keep the
+// statement's sign convention: money leaving the account is negative.
+type Transaction struct {
+	Row                  int
+	ID                   int64
+	DateTime             time.Time
+	Amount               int64
+	Scale                int
+	CurrencyCode         string
+	Reference            string
+	MerchantName         string
+	MerchantCity         string
+	MerchantCountryCode  string
+	MerchantCountryName  string
+	MerchantCategoryCode string
+	MerchantCategoryName string
+}
+
+// Reader streams transactions out of a statement one record at a time.
+// Read returns io.EOF once the statement is exhausted and a *RowError for a
+// record that could not be parsed, after which reading may continue.
+type Reader interface {
+	Read() (*Transaction, error)
+}
+
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+type RowError struct {
+	Row    int
+	Fields []FieldError
+}
+
+func (e *RowError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Field+": "+f.Message)
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, strings.Join(messages, ", "))
+}
+
+func (e *RowError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+type Format string
+
+const (
+	FormatCSV Format = "csv"
+	FormatOFX Format = "ofx"
+	FormatQIF Format = "qif"
+)
+
+var ErrUnknownFormat = errors.New("unknown statement format")
+
+// MinimumScale is the number of decimal places amounts are normalised to when
+// the statement carries fewer.
+const MinimumScale = 2
+
+// ParseAmount reads a decimal amount such as "-1,234.5" or "(12.00)" into a
+// value and scale.  With decimalComma set "1.234,50" is accepted instead.
+func ParseAmount(s string, decimalComma bool) (int64, int, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	} else if strings.HasSuffix(s, "-") {
+		negative = !negative
+		s = s[:len(s)-1]
+	}
+
+	decimal, grouping := ".", ","
+	if decimalComma {
+		decimal, grouping = ",", "."
+	}
+	s = strings.ReplaceAll(s, grouping, "")
+	s = strings.ReplaceAll(s, " ", "")
+
+	whole, fraction := s, ""
+	if i := strings.Index(s, decimal); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if len(whole) == 0 && len(fraction) == 0 {
+		return 0, 0, errors.New("empty amount")
+	}
+	if len(whole) == 0 {
+		whole = "0"
+	}
+
+	scale := len(fraction)
+	for scale < MinimumScale {
+		fraction += "0"
+		scale++
+	}
+
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return 0, 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	value, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if negative {
+		value = -value
+	}
+
+	return value, scale, nil
+}
+
+// FormatAmount writes value with scale decimal places, the inverse of
+// ParseAmount.
+func FormatAmount(value int64, scale int) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	digits := strconv.FormatInt(value, 10)
+	if scale <= 0 {
+		return sign + digits
+	}
+	for len(digits) <= scale {
+		digits = "0" + digits
+	}
+
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// parseTime tries each layout in turn, returning the first match.
+func parseTime(value string, layouts []string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+}
+
+// NewReader opens a statement reader for format.  mapping is only used for
+// CSV statements; its DateFormat and DecimalComma also apply to QIF.
+func NewReader(format Format, r io.Reader, mapping ColumnMapping, currencyCode string) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVReader(r, mapping)
+	case FormatOFX:
+		return NewOFXReader(r), nil
+	case FormatQIF:
+		return NewQIFReader(r, currencyCode, mapping.DateFormat, mapping.DecimalComma), nil
+	}
+
+	return nil, ErrUnknownFormat
+}
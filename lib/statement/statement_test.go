@@ -0,0 +1,96 @@
+package statement
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		name         string
+		amount       string
+		decimalComma bool
+		expValue     int64
+		expScale     int
+		expErr       bool
+	}{
+		{name: "Whole number", amount: "12", expValue: 1200, expScale: 2},
+		{name: "Grouped negative", amount: "-1,234.5", expValue: -123450, expScale: 2},
+		{name: "Leading plus", amount: "+0.99", expValue: 99, expScale: 2},
+		{name: "Fraction only", amount: ".5", expValue: 50, expScale: 2},
+		{name: "Three decimal places", amount: "1.125", expValue: 1125, expScale: 3},
+		{name: "Parentheses", amount: "(12.00)", expValue: -1200, expScale: 2},
+		{name: "Trailing minus", amount: "45.10-", expValue: -4510, expScale: 2},
+		{name: "Decimal comma", amount: "1.234,50", decimalComma: true, expValue: 123450, expScale: 2},
+		{name: "Space grouping", amount: " 1 234.56 ", expValue: 123456, expScale: 2},
+		{name: "Empty", amount: "  ", expErr: true},
+		{name: "Sign only", amount: "-", expErr: true},
+		{name: "Letters", amount: "12a.00", expErr: true},
+		{name: "Currency symbol", amount: "R12.00", expErr: true},
+		{name: "Overflow", amount: "99999999999999999999", expErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, scale, err := ParseAmount(test.amount, test.decimalComma)
+			if test.expErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expValue, value)
+			assert.Equal(t, test.expScale, scale)
+		})
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		value int64
+		scale int
+		exp   string
+	}{
+		{123450, 2, "1234.50"},
+		{-5, 2, "-0.05"},
+		{0, 2, "0.00"},
+		{1125, 3, "1.125"},
+		{42, 0, "42"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.exp, FormatAmount(test.value, test.scale))
+
+		value, scale, err := ParseAmount(test.exp, false)
+		require.NoError(t, err)
+		if test.scale >= MinimumScale {
+			assert.Equal(t, test.value, value, test.exp)
+			assert.Equal(t, test.scale, scale, test.exp)
+		}
+	}
+}
+
+func TestNewReaderUnknownFormat(t *testing.T) {
+	_, err := NewReader(Format("xls"), nil, DefaultColumnMapping, "")
+	assert.Equal(t, ErrUnknownFormat, err)
+}
+
+// readAll drains reader, returning the transactions and row errors it
+// produced in order, and the error that stopped it if that was not io.EOF.
+func readAll(reader Reader) ([]*Transaction, []*RowError, error) {
+	var transactions []*Transaction
+	var rowErrs []*RowError
+	for {
+		t, err := reader.Read()
+		if err == io.EOF {
+			return transactions, rowErrs, nil
+		} else if rowErr, ok := err.(*RowError); ok {
+			rowErrs = append(rowErrs, rowErr)
+			continue
+		} else if err != nil {
+			return transactions, rowErrs, err
+		}
+		transactions = append(transactions, t)
+	}
+}
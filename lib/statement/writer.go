@@ -0,0 +1,175 @@
+package statement
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer streams transactions out to a statement.  Close must be called once
+// every transaction has been written to complete the document.
+type Writer interface {
+	Write(*Transaction) error
+	Close() error
+}
+
+// NewWriter opens a statement writer for format.  start and end bound the
+// statement period where the format records one.
+func NewWriter(format Format, w io.Writer, start, end time.Time) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVWriter(w)
+	case FormatOFX:
+		return NewOFXWriter(w, start, end), nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+// NewCSVWriter writes a header of DefaultColumnMapping names, preceded by an
+// id column, so that an export can be imported again without a mapping.
+func NewCSVWriter(w io.Writer) (Writer, error) {
+	c := &csvWriter{writer: csv.NewWriter(w)}
+	m := DefaultColumnMapping
+	err := c.writer.Write([]string{
+		"id", m.DateTime, m.Amount, m.CurrencyCode, m.Reference, m.MerchantName, m.MerchantCity,
+		m.MerchantCountryCode, m.MerchantCountryName, m.MerchantCategoryCode, m.MerchantCategoryName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *csvWriter) Write(t *Transaction) error {
+	c.record = append(c.record[:0],
+		strconv.FormatInt(t.ID, 10),
+		t.DateTime.UTC().Format(time.RFC3339),
+		FormatAmount(t.Amount, t.Scale),
+		t.CurrencyCode,
+		t.Reference,
+		t.MerchantName,
+		t.MerchantCity,
+		t.MerchantCountryCode,
+		t.MerchantCountryName,
+		t.MerchantCategoryCode,
+		t.MerchantCategoryName,
+	)
+	err := c.writer.Write(c.record)
+	if err != nil {
+		return err
+	}
+
+	// Flush per row so that the response streams rather than collecting in
+	// the csv package's buffer.
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+var ofxEscapes = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+const ofxHeader = "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:USASCII\r\n" +
+	"CHARSET:1252\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n"
+
+const ofxDateLayout = "20060102150405"
+
+type ofxWriter struct {
+	writer   io.Writer
+	start    time.Time
+	end      time.Time
+	currency string
+	started  bool
+}
+
+// NewOFXWriter writes an OFX 1.02 SGML bank statement.  The statement currency
+// is taken from the first transaction; any other currency is written against
+// the transaction itself.
+func NewOFXWriter(w io.Writer, start, end time.Time) Writer {
+	return &ofxWriter{writer: w, start: start, end: end}
+}
+
+func (o *ofxWriter) begin() error {
+	o.started = true
+	currency := o.currency
+	if len(currency) == 0 {
+		currency = "USD"
+	}
+
+	_, err := fmt.Fprintf(o.writer, "%s<OFX>\r\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS>"+
+		"<DTSERVER>%s<LANGUAGE>ENG</SONRS></SIGNONMSGSRSV1>\r\n"+
+		"<BANKMSGSRSV1><STMTTRNRS><TRNUID>0<STATUS><CODE>0<SEVERITY>INFO</STATUS>\r\n"+
+		"<STMTRS><CURDEF>%s\r\n<BANKTRANLIST><DTSTART>%s<DTEND>%s\r\n",
+		ofxHeader, time.Now().UTC().Format(ofxDateLayout), ofxEscapes.Replace(currency),
+		o.start.UTC().Format(ofxDateLayout), o.end.UTC().Format(ofxDateLayout))
+	return err
+}
+
+func (o *ofxWriter) Write(t *Transaction) error {
+	if !o.started {
+		o.currency = t.CurrencyCode
+		err := o.begin()
+		if err != nil {
+			return err
+		}
+	}
+
+	trnType := "CREDIT"
+	if t.Amount < 0 {
+		trnType = "DEBIT"
+	}
+
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "<STMTTRN><TRNTYPE>%s<DTPOSTED>%s<TRNAMT>%s<FITID>%d",
+		trnType, t.DateTime.UTC().Format(ofxDateLayout), FormatAmount(t.Amount, t.Scale), t.ID)
+	if len(t.MerchantName) > 0 {
+		fmt.Fprintf(b, "<NAME>%s", ofxEscapes.Replace(truncate(t.MerchantName, 32)))
+	}
+	if len(t.Reference) > 0 {
+		fmt.Fprintf(b, "<MEMO>%s", ofxEscapes.Replace(truncate(t.Reference, 255)))
+	}
+	if len(t.CurrencyCode) > 0 && t.CurrencyCode != o.currency {
+		fmt.Fprintf(b, "<CURRENCY><CURRATE>1<CURSYM>%s</CURRENCY>", ofxEscapes.Replace(t.CurrencyCode))
+	}
+	b.WriteString("</STMTTRN>\r\n")
+
+	_, err := io.WriteString(o.writer, b.String())
+	return err
+}
+
+// Close ends the statement.  OFX requires a ledger balance, which is not
+// known here, so a zero balance as at the end of the period is written.
+func (o *ofxWriter) Close() error {
+	if !o.started {
+		err := o.begin()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(o.writer, "</BANKTRANLIST>\r\n<LEDGERBAL><BALAMT>0.00<DTASOF>%s</LEDGERBAL>\r\n"+
+		"</STMTRS></STMTTRNRS></BANKMSGSRSV1>\r\n</OFX>\r\n", o.end.UTC().Format(ofxDateLayout))
+	return err
+}
+
+// truncate shortens s to at most n runes, the field limits set by OFX.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
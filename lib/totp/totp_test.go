@@ -0,0 +1,54 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The SHA1 test vectors of RFC 6238, truncated to six digits.
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		code, err := Code(secret, Step(time.Unix(test.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, test.code, code, test.unix)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1600000000, 0)
+	step := Step(now)
+	previous, err := Code(secret, step-1)
+	require.NoError(t, err)
+
+	got, ok := Verify(secret, previous, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, got)
+
+	// Codes are not accepted twice, nor from too far away
+	_, ok = Verify(secret, previous, now, step-1)
+	assert.False(t, ok)
+	_, ok = Verify(secret, previous, now.Add(2*Period), 0)
+	assert.False(t, ok)
+	_, ok = Verify(secret, "12345", now, 0)
+	assert.False(t, ok)
+
+	assert.Equal(t, "otpauth://totp/Go%20Webserver:subzero@dreamrealm.com?algorithm=SHA1&digits=6&issuer=Go+Webserver&period=30&secret="+secret,
+		URI("Go Webserver", "subzero@dreamrealm.com", secret))
+}
@@ -0,0 +1,461 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/lib/statement"
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// alertMaxCooldown bounds a rule's cooldown at thirty days.
+	alertMaxCooldown = 30 * 24 * 60
+	// alertHistoryLimit is the number of firings listed.
+	alertHistoryLimit = 100
+)
+
+var (
+	alertAmount      = regexp.MustCompile(`^\d+(\.\d+)?$`)
+	alertCountryCode = regexp.MustCompile(`^[A-Z]{2,3}$`)
+)
+
+// AlertRule fires when a stored card transaction meets every condition that
+// is set: an amount above AmountAbove, in whole currency units; a merchant
+// outside HomeCountryCode; one of CategoryCodes; a merchant never seen
+// before; and a filter expression.  A rule that has fired stays quiet for
+// CooldownMinutes.
+type AlertRule struct {
+	datalayer.Model
+	Name            string                 `json:"name"`
+	AmountAbove     string                 `json:"amountAbove"`
+	HomeCountryCode string                 `json:"homeCountryCode"`
+	CategoryCodes   []string               `json:"categoryCodes"`
+	NewMerchant     bool                   `json:"newMerchant"`
+	Filter          string                 `json:"filter"`
+	NotifyEmail     bool                   `json:"notifyEmail"`
+	CooldownMinutes int                    `json:"cooldownMinutes"`
+	Active          bool                   `json:"active"`
+	LastFiredAt     datalayer.JsonNullTime `json:"lastFiredAt"`
+	serverState     *state.ServerState
+}
+
+// AlertFiring is an entry in the alert history.
+type AlertFiring struct {
+	datalayer.Model
+	AlertRuleID       int64  `json:"alertRuleID"`
+	RuleName          string `json:"ruleName"`
+	CardTransactionID int64  `json:"cardTransactionID"`
+	Message           string `json:"message"`
+}
+
+// AlertNotification is the data of an alert.triggered event.
+type AlertNotification struct {
+	Firing          *AlertFiring     `json:"firing"`
+	CardTransaction *CardTransaction `json:"cardTransaction"`
+}
+
+// NewAlertRule returns a rule that is active and notifies by email unless
+// the request says otherwise.
+func NewAlertRule(state *state.ServerState) *AlertRule {
+	rule := new(AlertRule)
+	rule.serverState = state
+	rule.NotifyEmail = true
+	rule.Active = true
+	return rule
+}
+
+func newFromDBAlertRule(rule *datalayer.AlertRule) *AlertRule {
+	r := new(AlertRule)
+	r.ID = rule.ID
+	r.CreatedAt = rule.CreatedAt
+	r.UpdatedAt = rule.UpdatedAt
+	r.DeletedAt = rule.DeletedAt
+	r.Name = rule.Name
+	r.AmountAbove = rule.AmountAbove
+	r.HomeCountryCode = rule.HomeCountryCode
+	r.CategoryCodes = make([]string, 0)
+	if len(rule.CategoryCodes) > 0 {
+		r.CategoryCodes = strings.Split(rule.CategoryCodes, ",")
+	}
+	r.NewMerchant = rule.NewMerchant
+	r.Filter = rule.Filter
+	r.NotifyEmail = rule.NotifyEmail
+	r.CooldownMinutes = rule.CooldownMinutes
+	r.Active = rule.Active
+	r.LastFiredAt = rule.LastFiredAt
+	return r
+}
+
+func (r *AlertRule) convertToDB(userID int64) *datalayer.AlertRule {
+	rule := new(datalayer.AlertRule)
+	rule.ID = r.ID
+	rule.UserID = userID
+	rule.Name = r.Name
+	rule.AmountAbove = r.AmountAbove
+	rule.HomeCountryCode = r.HomeCountryCode
+	rule.CategoryCodes = strings.Join(r.CategoryCodes, ",")
+	rule.NewMerchant = r.NewMerchant
+	rule.Filter = r.Filter
+	rule.NotifyEmail = r.NotifyEmail
+	rule.CooldownMinutes = r.CooldownMinutes
+	rule.Active = r.Active
+	return rule
+}
+
+func newFromDBAlertFiring(firing *datalayer.AlertFiring) *AlertFiring {
+	f := new(AlertFiring)
+	f.ID = firing.ID
+	f.CreatedAt = firing.CreatedAt
+	f.UpdatedAt = firing.UpdatedAt
+	f.DeletedAt = firing.DeletedAt
+	f.AlertRuleID = firing.AlertRuleID
+	f.RuleName = firing.RuleName
+	f.CardTransactionID = firing.CardTransactionID
+	f.Message = firing.Message
+	return f
+}
+
+func (r *AlertRule) validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.HomeCountryCode = strings.ToUpper(strings.TrimSpace(r.HomeCountryCode))
+
+	var fields []types.ErrorField
+	if len(r.Name) == 0 || len(r.Name) > 255 {
+		fields = append(fields, types.ErrorField{Name: "name", Message: "a name of up to 255 characters is required"})
+	}
+	if len(r.AmountAbove) > 0 && (!alertAmount.MatchString(r.AmountAbove) || len(r.AmountAbove) > 32) {
+		fields = append(fields, types.ErrorField{Name: "amountAbove", Message: "must be a positive amount such as 1000.00"})
+	}
+	if len(r.HomeCountryCode) > 0 && !alertCountryCode.MatchString(r.HomeCountryCode) {
+		fields = append(fields, types.ErrorField{Name: "homeCountryCode", Message: "must be a country code such as ZA"})
+	}
+	for _, code := range r.CategoryCodes {
+		if len(code) == 0 || len(code) > 255 || strings.Contains(code, ",") {
+			fields = append(fields, types.ErrorField{Name: "categoryCodes", Message: fmt.Sprintf("%q is not a category code", code)})
+		}
+	}
+	if len(strings.Join(r.CategoryCodes, ",")) > 1024 {
+		fields = append(fields, types.ErrorField{Name: "categoryCodes", Message: "too many category codes"})
+	}
+	if len(r.Filter) > 0 {
+		_, err := filters.ParseExpression(r.Filter, filters.CardTransactionFields)
+		if err != nil {
+			fields = append(fields, types.ErrorField{Name: "filter", Message: err.Error()})
+		}
+	}
+	if r.CooldownMinutes < 0 || r.CooldownMinutes > alertMaxCooldown {
+		fields = append(fields, types.ErrorField{Name: "cooldownMinutes", Message: fmt.Sprintf("must be between 0 and %d", alertMaxCooldown)})
+	}
+	if len(r.AmountAbove) == 0 && len(r.HomeCountryCode) == 0 && len(r.CategoryCodes) == 0 && !r.NewMerchant && len(r.Filter) == 0 {
+		fields = append(fields, types.ErrorField{Name: "rule", Message: "at least one condition is required"})
+	}
+	if len(fields) > 0 {
+		return e.NewError("Alert rule is invalid", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// condition combines the rule's conditions, other than NewMerchant, into a
+// filter expression.  It returns nil when there are none.
+func (r *AlertRule) condition() (filters.Expression, error) {
+	var conditions []filters.Expression
+	if len(r.AmountAbove) > 0 {
+		conditions = append(conditions, filters.Comparison{Field: "amount", Operator: ">", Value: r.AmountAbove})
+	}
+	if len(r.HomeCountryCode) > 0 {
+		conditions = append(conditions,
+			filters.Comparison{Field: "merchantCountryCode", Operator: "!=", Value: ""},
+			filters.Comparison{Field: "merchantCountryCode", Operator: "!=", Value: r.HomeCountryCode})
+	}
+	if len(r.CategoryCodes) > 0 {
+		values := make([]interface{}, len(r.CategoryCodes))
+		for i, code := range r.CategoryCodes {
+			values[i] = code
+		}
+		conditions = append(conditions, filters.In{Field: "merchantCategoryCode", Values: values})
+	}
+	if len(r.Filter) > 0 {
+		expr, err := filters.ParseExpression(r.Filter, filters.CardTransactionFields)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, expr)
+	}
+
+	var condition filters.Expression
+	for _, c := range conditions {
+		if condition == nil {
+			condition = c
+			continue
+		}
+		condition = filters.And{Left: condition, Right: c}
+	}
+
+	return condition, nil
+}
+
+func (r *AlertRule) CreateAlertRule(userID int64) (*AlertRule, error) {
+	r.ID = 0
+	err := r.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	dl := r.serverState.DataLayer
+	id, err := dl.CreateAlertRule(r.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to store alert rule", http.StatusInternalServerError, err)
+	}
+
+	return r.GetAlertRule(userID, id)
+}
+
+// GetAlertRule looks up one of the user's rules.  Rules belonging to
+// somebody else are reported as not found.
+func (r *AlertRule) GetAlertRule(userID, id int64) (*AlertRule, error) {
+	dl := r.serverState.DataLayer
+	rule, err := dl.GetAlertRuleByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrAlertRuleNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query alert rule [%d] from database", id), http.StatusInternalServerError, err)
+	}
+
+	if rule.UserID != userID {
+		return nil, ErrAlertRuleNotFound
+	}
+
+	alertRule := newFromDBAlertRule(rule)
+	alertRule.serverState = r.serverState
+	return alertRule, nil
+}
+
+func (r *AlertRule) GetAlertRulesByUserID(userID int64) ([]*AlertRule, error) {
+	dl := r.serverState.DataLayer
+	dbRules, err := dl.GetAlertRulesByUserID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query alert rules from database", http.StatusInternalServerError, err)
+	}
+
+	rules := make([]*AlertRule, 0, len(dbRules))
+	for _, rule := range dbRules {
+		rules = append(rules, newFromDBAlertRule(rule))
+	}
+
+	return rules, nil
+}
+
+func (r *AlertRule) UpdateAlertRule(userID, id int64) (*AlertRule, error) {
+	_, err := r.GetAlertRule(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.ID = id
+	err = r.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	dl := r.serverState.DataLayer
+	err = dl.UpdateAlertRule(r.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to update alert rule", http.StatusInternalServerError, err)
+	}
+
+	return r.GetAlertRule(userID, id)
+}
+
+func (r *AlertRule) DeleteAlertRule(userID, id int64) error {
+	_, err := r.GetAlertRule(userID, id)
+	if err != nil {
+		return err
+	}
+
+	dl := r.serverState.DataLayer
+	err = dl.DeleteAlertRule(userID, id)
+	if err != nil {
+		return e.Wrap("Failed to delete alert rule", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// GetAlertHistory returns the user's most recent firings, newest first,
+// optionally only those of one rule or one card transaction.
+func (r *AlertRule) GetAlertHistory(userID, ruleID, cardTransactionID int64) ([]*AlertFiring, error) {
+	dl := r.serverState.DataLayer
+	dbFirings, err := dl.GetAlertFiringsByUserID(userID, ruleID, cardTransactionID, alertHistoryLimit)
+	if err != nil {
+		return nil, e.Wrap("Failed to query alert history from database", http.StatusInternalServerError, err)
+	}
+
+	firings := make([]*AlertFiring, 0, len(dbFirings))
+	for _, firing := range dbFirings {
+		firings = append(firings, newFromDBAlertFiring(firing))
+	}
+
+	return firings, nil
+}
+
+// EvaluateCardTransactions scores each card transaction that has not been
+// evaluated yet for anomalies and then evaluates its owner's alert rules
+// against it, so that rules may select on the anomaly score.  It returns the
+// number evaluated.  Transactions are claimed first so that servers sharing
+// the database do not evaluate the same one twice; one that fails is logged
+// and not retried.
+func EvaluateCardTransactions(state *state.ServerState, now time.Time, limit int) (int, error) {
+	dl := state.DataLayer
+	dbCardTransactions, err := dl.GetUnevaluatedCardTransactions(limit)
+	if err != nil {
+		return 0, e.Wrap("Failed to query unevaluated card transactions", http.StatusInternalServerError, err)
+	}
+
+	evaluated := 0
+	for _, dbCardTransaction := range dbCardTransactions {
+		claimed, err := dl.ClaimCardTransactionEvaluation(dbCardTransaction.ID, now)
+		if err != nil {
+			return evaluated, e.Wrap("Failed to claim card transaction", http.StatusInternalServerError, err)
+		}
+		if !claimed {
+			continue
+		}
+		evaluated++
+
+		cardTransaction := newFromDBCardTransaction(dbCardTransaction)
+		cardTransaction.serverState = state
+		cardTransaction.UserID = dbCardTransaction.UserID
+		scored, err := ScoreCardTransaction(state, cardTransaction)
+		if err != nil {
+			state.Logger.Printf("failed to score card transaction %d: %v", cardTransaction.ID, err)
+			scored = cardTransaction
+		}
+		err = EvaluateAlerts(state, scored)
+		if err != nil {
+			state.Logger.Printf("failed to evaluate alerts for card transaction %d: %v", cardTransaction.ID, err)
+		}
+	}
+
+	return evaluated, nil
+}
+
+// EvaluateAlerts fires the user's active rules that a newly stored card
+// transaction meets.  Each firing is recorded, published as an
+// alert.triggered event, which outgoing webhooks deliver, and emailed when
+// the rule asks for it.
+func EvaluateAlerts(state *state.ServerState, cardTransaction *CardTransaction) error {
+	dl := state.DataLayer
+	rules, err := dl.GetAlertRulesByUserID(cardTransaction.UserID)
+	if err != nil {
+		return e.Wrap("Failed to query alert rules from database", http.StatusInternalServerError, err)
+	}
+
+	var newMerchant *bool
+	for _, dbRule := range rules {
+		if !dbRule.Active {
+			continue
+		}
+
+		rule := newFromDBAlertRule(dbRule)
+		condition, err := rule.condition()
+		if err != nil {
+			state.Logger.Printf("alert rule %d has an invalid condition: %v", rule.ID, err)
+			continue
+		}
+		if condition != nil && !cardTransaction.Matches(condition) {
+			continue
+		}
+		if rule.NewMerchant {
+			if newMerchant == nil {
+				seen, err := dl.MerchantSeenBefore(cardTransaction.UserID, cardTransaction.MerchantName, cardTransaction.ID)
+				if err != nil {
+					return e.Wrap("Failed to look up merchant history", http.StatusInternalServerError, err)
+				}
+				unseen := !seen
+				newMerchant = &unseen
+			}
+			if !*newMerchant {
+				continue
+			}
+		}
+
+		// Timestamps are stored to the second, so work in whole seconds.
+		now := time.Now().UTC().Truncate(time.Second)
+		cooledDownAt := now.Add(-time.Duration(rule.CooldownMinutes) * time.Minute)
+		claimed, err := dl.ClaimAlertRuleFiring(rule.ID, now, cooledDownAt)
+		if err != nil {
+			return e.Wrap("Failed to record alert rule firing", http.StatusInternalServerError, err)
+		}
+		// A rule without a cooldown that already fired this second is not
+		// changed by the claim, which MySQL then reports as unclaimed.
+		if !claimed && rule.CooldownMinutes > 0 {
+			continue
+		}
+
+		err = fireAlert(state, rule, cardTransaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fireAlert(state *state.ServerState, rule *AlertRule, cardTransaction *CardTransaction) error {
+	message := fmt.Sprintf("%s: %s %s at %s on %s", rule.Name,
+		statement.FormatAmount(cardTransaction.Amount.Value, cardTransaction.Amount.Scale), cardTransaction.CurrencyCode,
+		cardTransaction.MerchantName, cardTransaction.DateTime.Format("2 Jan 2006 15:04 MST"))
+
+	dl := state.DataLayer
+	firing := &datalayer.AlertFiring{
+		AlertRuleID:       rule.ID,
+		RuleName:          rule.Name,
+		UserID:            cardTransaction.UserID,
+		CardTransactionID: cardTransaction.ID,
+		Message:           truncateString(message, 1024),
+	}
+	id, err := dl.CreateAlertFiring(firing)
+	if err != nil {
+		return e.Wrap("Failed to store alert firing", http.StatusInternalServerError, err)
+	}
+	firing.ID = id
+	firing.CreatedAt.Time = time.Now().UTC()
+	firing.CreatedAt.Valid = true
+
+	if state.Events != nil {
+		state.Events.Publish(events.Event{
+			ID:     id,
+			Type:   events.AlertTriggered,
+			UserID: cardTransaction.UserID,
+			Data:   AlertNotification{Firing: newFromDBAlertFiring(firing), CardTransaction: cardTransaction},
+		})
+	}
+
+	if !rule.NotifyEmail {
+		return nil
+	}
+
+	user, err := dl.GetUserByID(cardTransaction.UserID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", cardTransaction.UserID), http.StatusInternalServerError, err)
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\nYour alert \"%s\" was triggered by a card transaction.\n\n%s\n\n"+
+		"Manage your alerts at %s", user.Email.String, rule.Name, message, state.URL)
+	err = state.Providers.Email.SendMail([]string{user.Email.String}, "noreply@someapp.com", "Alert: "+rule.Name, body)
+	if err != nil {
+		return e.Wrap("Failed to send alert email", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
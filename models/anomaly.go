@@ -0,0 +1,203 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// AnomalyThreshold is the score from which a transaction is published as
+	// anomalous.
+	AnomalyThreshold = 70
+
+	// anomalyMinHistory is the number of transactions a distribution needs
+	// before it is trusted.
+	anomalyMinHistory = 5
+	// anomalyMinHourHistory is the number of transactions needed before the
+	// hour of day is judged.
+	anomalyMinHourHistory = 20
+	// anomalyWindow is roughly the number of recent transactions the rolling
+	// statistics reflect.
+	anomalyWindow = 50
+	// anomalyMinDeviation keeps a user who always spends the same amount from
+	// being alerted about a cent more, in log10 units (about 12%).
+	anomalyMinDeviation = 0.05
+)
+
+// Anomaly reasons.
+const (
+	AnomalyAmount  = "amount"
+	AnomalyHour    = "hour"
+	AnomalyCountry = "country"
+)
+
+// anomalySignal is one way a transaction is unusual.  Strength runs from 0
+// to 1 and weight caps how much the signal alone can contribute.
+type anomalySignal struct {
+	reason   string
+	weight   float64
+	strength float64
+}
+
+// ScoreCardTransaction rates how unusual a newly stored card transaction is
+// for its user and records the score.  Three signals are combined:
+//
+//   - an amount far above the user's rolling distribution for the merchant,
+//     or for the category when the merchant is new to them;
+//   - an hour of the day at which the user rarely spends;
+//   - a merchant country the user has never spent in.
+//
+// The transaction is then added to the rolling statistics.  Transactions
+// scoring AnomalyThreshold or more are published as
+// cardTransaction.anomalous events.  The scored copy is returned; the
+// argument, which may be shared with other event subscribers, is not
+// modified.
+func ScoreCardTransaction(state *state.ServerState, cardTransaction *CardTransaction) (*CardTransaction, error) {
+	dl := state.DataLayer
+	amount := math.Log10(1 + math.Abs(float64(cardTransaction.Amount.Value))/math.Pow10(cardTransaction.Amount.Scale))
+	hour := cardTransaction.DateTime.UTC().Hour()
+
+	merchant, err := spendingStatistic(dl, cardTransaction.UserID, datalayer.SpendingByMerchant,
+		strings.ToLower(cardTransaction.MerchantName), cardTransaction.CurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+	category, err := spendingStatistic(dl, cardTransaction.UserID, datalayer.SpendingByCategory,
+		cardTransaction.MerchantCategoryCode, cardTransaction.CurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := dl.GetSpendingStatisticsByDimension(cardTransaction.UserID, datalayer.SpendingByHour)
+	if err != nil {
+		return nil, e.Wrap("Failed to query spending statistics from database", http.StatusInternalServerError, err)
+	}
+
+	var signals []anomalySignal
+	if merchant.Observations >= anomalyMinHistory {
+		signals = append(signals, anomalySignal{AnomalyAmount, 0.9, amountStrength(merchant, amount)})
+	} else if len(cardTransaction.MerchantCategoryCode) > 0 && category.Observations >= anomalyMinHistory {
+		signals = append(signals, anomalySignal{AnomalyAmount, 0.9, amountStrength(category, amount)})
+	}
+
+	var history int64
+	counts := make(map[int]int64)
+	for _, h := range hours {
+		n, _ := strconv.Atoi(h.StatKey)
+		counts[n] = h.Observations
+		history += h.Observations
+	}
+	if history >= anomalyMinHourHistory {
+		share := (float64(counts[hour]) + float64(counts[(hour+23)%24]+counts[(hour+1)%24])/2) / float64(history)
+		signals = append(signals, anomalySignal{AnomalyHour, 0.5, clamp((0.03-share)/0.03, 0, 1)})
+	}
+
+	if len(cardTransaction.MerchantCountryCode) > 0 && history >= anomalyMinHistory {
+		seen, err := dl.CountrySeenBefore(cardTransaction.UserID, cardTransaction.MerchantCountryCode, cardTransaction.ID)
+		if err != nil {
+			return nil, e.Wrap("Failed to look up country history", http.StatusInternalServerError, err)
+		}
+		if !seen {
+			signals = append(signals, anomalySignal{AnomalyCountry, 0.8, 1})
+		}
+	}
+
+	normal := 1.0
+	var reasons []string
+	for _, signal := range signals {
+		normal *= 1 - signal.weight*signal.strength
+		if signal.weight*signal.strength >= 0.3 {
+			reasons = append(reasons, signal.reason)
+		}
+	}
+	score := int(math.Round(100 * (1 - normal)))
+
+	err = dl.SetCardTransactionAnomaly(cardTransaction.ID, score, strings.Join(reasons, ","))
+	if err != nil {
+		return nil, e.Wrap("Failed to store anomaly score", http.StatusInternalServerError, err)
+	}
+
+	hourStatistic := &datalayer.SpendingStatistic{
+		UserID:    cardTransaction.UserID,
+		Dimension: datalayer.SpendingByHour,
+		StatKey:   strconv.Itoa(hour),
+	}
+	for _, h := range hours {
+		if h.StatKey == hourStatistic.StatKey {
+			hourStatistic = h
+		}
+	}
+	statistics := []*datalayer.SpendingStatistic{merchant, hourStatistic}
+	if len(cardTransaction.MerchantCategoryCode) > 0 {
+		statistics = append(statistics, category)
+	}
+	for _, statistic := range statistics {
+		observe(statistic, amount)
+		err = dl.SaveSpendingStatistic(statistic)
+		if err != nil {
+			return nil, e.Wrap("Failed to store spending statistics", http.StatusInternalServerError, err)
+		}
+	}
+
+	scored := *cardTransaction
+	scored.AnomalyScore = score
+	scored.AnomalyReasons = reasons
+	if score >= AnomalyThreshold && state.Events != nil {
+		state.Events.Publish(events.Event{
+			ID:     scored.ID,
+			Type:   events.CardTransactionAnomalous,
+			UserID: scored.UserID,
+			Data:   &scored,
+		})
+	}
+
+	return &scored, nil
+}
+
+// spendingStatistic returns the statistic for the key, or a new empty one.
+func spendingStatistic(dl datalayer.DataLayer, userID int64, dimension, key, currencyCode string) (*datalayer.SpendingStatistic, error) {
+	statistic, err := dl.GetSpendingStatistic(userID, dimension, key, currencyCode)
+	if err == datalayer.ErrNoData {
+		return &datalayer.SpendingStatistic{
+			UserID:       userID,
+			Dimension:    dimension,
+			StatKey:      key,
+			CurrencyCode: currencyCode,
+		}, nil
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query %s spending statistics from database", strings.ToLower(dimension)),
+			http.StatusInternalServerError, err)
+	}
+
+	return statistic, nil
+}
+
+// amountStrength grows from nothing at two standard deviations above the
+// mean to full strength at four.
+func amountStrength(statistic *datalayer.SpendingStatistic, amount float64) float64 {
+	deviation := math.Max(math.Sqrt(statistic.Variance), anomalyMinDeviation)
+	z := (amount - statistic.Mean) / deviation
+	return clamp((z-2)/2, 0, 1)
+}
+
+// observe adds a value to an exponentially weighted mean and variance, which
+// behave as plain averages until anomalyWindow values have been seen.
+func observe(statistic *datalayer.SpendingStatistic, value float64) {
+	statistic.Observations++
+	alpha := math.Max(1/float64(statistic.Observations), 1.0/anomalyWindow)
+	diff := value - statistic.Mean
+	increment := alpha * diff
+	statistic.Mean += increment
+	statistic.Variance = (1 - alpha) * (statistic.Variance + diff*increment)
+}
+
+func clamp(x, min, max float64) float64 {
+	return math.Min(math.Max(x, min), max)
+}
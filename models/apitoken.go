@@ -0,0 +1,237 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/nonce"
+	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// APITokenPrefix starts every API token, telling them apart from the
+	// JWTs of sessions.
+	APITokenPrefix = "gws_"
+	// APITokenMaxDays is the longest an API token may be valid for, and
+	// apiTokenDefaultDays how long it is valid for unless asked otherwise.
+	APITokenMaxDays     = 365
+	apiTokenDefaultDays = 90
+	// apiTokenHintLength is the number of characters of the token kept to
+	// tell tokens apart, prefix included.
+	apiTokenHintLength = 12
+	// apiTokenTouchInterval is how stale a token's last use may become before
+	// it is written again, sparing a write on every request.
+	apiTokenTouchInterval = time.Minute
+)
+
+// APIToken is a named personal access token.  It authenticates requests to
+// the routes its scopes cover, until it expires or is revoked.  The token
+// itself is only shown when it is created; only its hash is stored.
+type APIToken struct {
+	datalayer.Model
+	UserID        int64                  `json:"-"`
+	Name          string                 `json:"name"`
+	Token         string                 `json:"token,omitempty"`
+	Hint          string                 `json:"hint"`
+	Scopes        []string               `json:"scopes"`
+	ExpiresInDays int                    `json:"expiresInDays,omitempty"`
+	ExpiresAt     time.Time              `json:"expiresAt"`
+	LastUsedAt    datalayer.JsonNullTime `json:"lastUsedAt"`
+	serverState   *state.ServerState
+}
+
+func NewAPIToken(state *state.ServerState) *APIToken {
+	token := new(APIToken)
+	token.serverState = state
+	return token
+}
+
+func newFromDBAPIToken(token *datalayer.APIToken) *APIToken {
+	t := new(APIToken)
+	t.ID = token.ID
+	t.CreatedAt = token.CreatedAt
+	t.UpdatedAt = token.UpdatedAt
+	t.DeletedAt = token.DeletedAt
+	t.UserID = token.UserID
+	t.Name = token.Name
+	t.Hint = token.Hint
+	t.Scopes = make([]string, 0)
+	if len(token.Scopes) > 0 {
+		t.Scopes = strings.Split(token.Scopes, ",")
+	}
+	t.ExpiresAt = token.ExpiresAt
+	t.LastUsedAt = token.LastUsedAt
+	return t
+}
+
+// HasScope reports whether the token grants the scope.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *APIToken) validate() error {
+	var fields []types.ErrorField
+	t.Name = strings.TrimSpace(t.Name)
+	if len(t.Name) == 0 || len(t.Name) > 64 {
+		fields = append(fields, types.ErrorField{Name: "name", Message: "a name of up to 64 characters is required"})
+	}
+
+	scopes := make([]string, 0, len(t.Scopes))
+	seen := make(map[string]bool)
+	for _, scope := range t.Scopes {
+		if !auth.IsScope(scope) {
+			fields = append(fields, types.ErrorField{Name: "scopes", Message: fmt.Sprintf("%q is not a scope", scope)})
+		} else if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(t.Scopes) == 0 {
+		fields = append(fields, types.ErrorField{Name: "scopes", Message: "at least one scope is required"})
+	}
+	t.Scopes = scopes
+
+	if t.ExpiresInDays == 0 {
+		t.ExpiresInDays = apiTokenDefaultDays
+	} else if t.ExpiresInDays < 0 || t.ExpiresInDays > APITokenMaxDays {
+		fields = append(fields, types.ErrorField{Name: "expiresInDays",
+			Message: fmt.Sprintf("must be between 1 and %d days", APITokenMaxDays)})
+	}
+
+	if len(fields) > 0 {
+		return e.NewError("API token is invalid", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// CreateAPIToken issues a token to the user.  The result is the only time the
+// token can be read.
+func (t *APIToken) CreateAPIToken(userID int64) (*APIToken, error) {
+	err := t.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := nonce.GenerateSecret(32)
+	if err != nil {
+		return nil, e.Wrap("Failed to generate API token", http.StatusInternalServerError, err)
+	}
+	rawToken := APITokenPrefix + secret
+
+	dl := t.serverState.DataLayer
+	id, err := dl.CreateAPIToken(&datalayer.APIToken{
+		UserID:    userID,
+		Name:      t.Name,
+		TokenHash: hashToken(rawToken),
+		Hint:      rawToken[:apiTokenHintLength],
+		Scopes:    strings.Join(t.Scopes, ","),
+		ExpiresAt: time.Now().AddDate(0, 0, t.ExpiresInDays).Truncate(time.Second),
+	})
+	if err != nil {
+		return nil, e.Wrap("Failed to store API token", http.StatusInternalServerError, err)
+	}
+
+	token, err := t.getAPIToken(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	token.Token = rawToken
+
+	return token, nil
+}
+
+func (t *APIToken) getAPIToken(userID, id int64) (*APIToken, error) {
+	dl := t.serverState.DataLayer
+	token, err := dl.GetAPITokenByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrAPITokenNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query API token [%d] from database", id), http.StatusInternalServerError, err)
+	}
+
+	if token.UserID != userID || token.RevokedAt.Valid {
+		return nil, ErrAPITokenNotFound
+	}
+
+	return newFromDBAPIToken(token), nil
+}
+
+// GetAPITokensByUserID lists the user's tokens that have not been revoked,
+// including those that have expired.
+func (t *APIToken) GetAPITokensByUserID(userID int64) ([]*APIToken, error) {
+	dl := t.serverState.DataLayer
+	dbTokens, err := dl.GetAPITokensByUserID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query API tokens from database", http.StatusInternalServerError, err)
+	}
+
+	tokens := make([]*APIToken, 0, len(dbTokens))
+	for _, token := range dbTokens {
+		tokens = append(tokens, newFromDBAPIToken(token))
+	}
+
+	return tokens, nil
+}
+
+func (t *APIToken) RevokeAPIToken(userID, id int64) error {
+	dl := t.serverState.DataLayer
+	err := dl.RevokeAPIToken(userID, id, time.Now())
+	if err == datalayer.ErrNoData {
+		return ErrAPITokenNotFound
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to revoke API token [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// AuthenticateAPIToken looks up the token a request was made with, refusing
+// it if it has been revoked or has expired, and records that it was used.
+// Tokens are also refused when the user logs out of every session or is
+// disabled, which the caller checks as it does for every token.
+func AuthenticateAPIToken(state *state.ServerState, rawToken string) (*APIToken, error) {
+	dl := state.DataLayer
+	dbToken, err := dl.GetAPITokenByHash(hashToken(rawToken))
+	if err == datalayer.ErrNoData {
+		return nil, ErrAPITokenInvalid
+	} else if err != nil {
+		return nil, e.Wrap("Failed to query API token from database", http.StatusInternalServerError, err)
+	}
+
+	now := time.Now()
+	if dbToken.RevokedAt.Valid {
+		return nil, ErrAPITokenRevoked
+	} else if !now.Before(dbToken.ExpiresAt) {
+		return nil, ErrAPITokenExpired
+	}
+
+	if !dbToken.LastUsedAt.Valid || now.Sub(dbToken.LastUsedAt.Time) >= apiTokenTouchInterval {
+		err = dl.SetAPITokenLastUsedAt(dbToken.ID, now)
+		if err != nil {
+			state.Logger.Printf("Failed to record use of API token [%d]: %v", dbToken.ID, err)
+		}
+	}
+
+	return newFromDBAPIToken(dbToken), nil
+}
+
+// hashToken hashes a random token for storage.  The tokens are long and
+// random, so a fast unsalted hash suffices where a password would not.
+func hashToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,4 +2,23 @@ package auth
 
 type UserContextKey string
 
-const UserKey = UserContextKey("userID")
\ No newline at end of file
+const UserKey = UserContextKey("userID")
+
+// RolesKey holds the roles of the caller, from their token.
+const RolesKey = UserContextKey("roles")
+
+// TokenKey holds the claims of the caller's token.
+const TokenKey = UserContextKey("token")
+
+// APITokenKey holds the ID of the caller's API token.  It is not set for
+// callers with an access token or ticket.
+const APITokenKey = UserContextKey("apiToken")
+
+// Roles a user may hold.  Every user holds RoleUser.
+const (
+	RoleAdmin = "ADMIN"
+	RoleUser  = "USER"
+)
+
+// KnownRoles lists every role, in the order they are stored.
+var KnownRoles = []string{RoleAdmin, RoleUser}
@@ -0,0 +1,69 @@
+package auth
+
+import "net/http"
+
+// ScopesKey holds the scopes of the caller's API token.  It is not set for
+// requests made with a session's access token, which may do anything the
+// user can.
+const ScopesKey = UserContextKey("scopes")
+
+// Resources that routes belong to.  A scope grants read or write access to
+// one of them, as in "transactions:write".
+const (
+	ResourceProfile      = "profile"
+	ResourceTransactions = "transactions"
+	ResourceEvents       = "events"
+	ResourceWebhooks     = "webhooks"
+	ResourceAlerts       = "alerts"
+	ResourceReports      = "reports"
+	ResourcePlanning     = "planning"
+	ResourceHouseholds   = "households"
+)
+
+// Access levels of a scope.
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+var resources = []string{
+	ResourceProfile, ResourceTransactions, ResourceEvents, ResourceWebhooks, ResourceAlerts, ResourceReports,
+	ResourcePlanning, ResourceHouseholds,
+}
+
+// KnownScopes lists every scope an API token may hold.
+var KnownScopes = knownScopes()
+
+func knownScopes() []string {
+	scopes := make([]string, 0, 2*len(resources))
+	for _, resource := range resources {
+		scopes = append(scopes, Scope(resource, AccessRead), Scope(resource, AccessWrite))
+	}
+	return scopes
+}
+
+func Scope(resource, access string) string {
+	return resource + ":" + access
+}
+
+// IsScope reports whether scope is one of KnownScopes.
+func IsScope(scope string) bool {
+	for _, s := range KnownScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredScope is the scope needed to call a route of the resource with the
+// method: reads need read access and everything else write access.  Write
+// access does not imply read access, so that a token can be limited to, say,
+// posting transactions.
+func RequiredScope(resource, method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return Scope(resource, AccessRead)
+	}
+	return Scope(resource, AccessWrite)
+}
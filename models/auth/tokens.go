@@ -1,12 +1,46 @@
 package auth
 
-import "github.com/dgrijalva/jwt-go"
+import (
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Token types.  Only access tokens authenticate requests; refresh tokens are
+// only exchanged for new tokens, and challenge tokens, given to users with
+// two-factor authentication in place of tokens at sign in, only for tokens
+// along with a code.  Tickets authenticate a single WebSocket handshake, as
+// browsers cannot set headers on one.  API tokens are not JWTs, see
+// models.APIToken.
+const (
+	TokenTypeAccess    = "access"
+	TokenTypeRefresh   = "refresh"
+	TokenTypeChallenge = "challenge"
+	TokenTypeTicket    = "ticket"
+)
+
+// JSONWebToken is the claims of every token.  Tokens from one sign in share
+// a SessionID, and each has its own ID in the standard jti claim.
 type JSONWebToken struct {
-	UserID int64 `json:"userID"`
+	UserID    int64    `json:"userID"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	// IssuedAtMicro is when the token was issued in Unix microseconds, as
+	// the standard iat claim only carries whole seconds.
+	IssuedAtMicro int64 `json:"iatus,omitempty"`
 	jwt.StandardClaims
 }
 
+// Issued returns when the token was issued, to the microsecond unless the
+// token predates IssuedAtMicro.
+func (t *JSONWebToken) Issued() time.Time {
+	if t.IssuedAtMicro > 0 {
+		return time.Unix(0, t.IssuedAtMicro*int64(time.Microsecond))
+	}
+	return time.Unix(t.IssuedAt, 0)
+}
+
 type RefreshJWTReq struct {
 	GrantType    string `json:"grantType" sql:"-"`
 	RefreshToken string `json:"refreshToken" sql:"-"`
@@ -3,9 +3,11 @@ package models
 import (
 	e "github.com/donohutcheon/gowebserver/controllers/errors"
 	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/lib/search"
 	"github.com/donohutcheon/gowebserver/models/filters"
 	"github.com/donohutcheon/gowebserver/models/pagination"
 	"github.com/donohutcheon/gowebserver/state"
+	"math/big"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -32,10 +34,23 @@ type CardTransaction struct {
 	MerchantCountryName  string        `json:"merchantCountryName" db:"merchant_country_name"`
 	MerchantCategoryCode string        `json:"merchantCategoryCode" db:"merchant_category_code"`
 	MerchantCategoryName string        `json:"merchantCategoryName" db:"merchant_category_name"`
+	Notes                string        `json:"notes" db:"notes"`
 	UserID               int64         `json:"userID" db:"user_id"`
+
+	// AnomalyScore rates from 0 to 100 how unusual the transaction is for the
+	// user, for the AnomalyReasons given.  It is 0 until the transaction has
+	// been scored.
+	AnomalyScore   int      `json:"anomalyScore"`
+	AnomalyReasons []string `json:"anomalyReasons,omitempty"`
+
+	// Relevance and Highlights are only set on the results of a search.
+	Relevance  float64           `json:"relevance,omitempty"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+
 	serverState          *state.ServerState
 	pagination           pagination.Parameters
 	filter               filters.CardTransactionFilter
+	owners               []int64
 }
 
 
@@ -53,6 +68,8 @@ func (c *CardTransaction) GetSortFields() map[string]bool {
 		"merchantCountryNames" : true,
 		"merchantCategoryCodes" : true,
 		"merchantCategoryNames" : true,
+		"anomalyScore" : true,
+		"relevance" : true,
 	}
 }
 
@@ -88,6 +105,12 @@ func newFromDBCardTransaction(cardTransaction *datalayer.CardTransaction) *CardT
 	c.MerchantCountryName = cardTransaction.MerchantCountryName
 	c.MerchantCategoryCode = cardTransaction.MerchantCategoryCode
 	c.MerchantCategoryName = cardTransaction.MerchantCategoryName
+	c.Notes = cardTransaction.Notes
+	c.AnomalyScore = cardTransaction.AnomalyScore
+	if len(cardTransaction.AnomalyReasons) > 0 {
+		c.AnomalyReasons = strings.Split(cardTransaction.AnomalyReasons, ",")
+	}
+	c.Relevance = cardTransaction.Relevance.Float64
 	return c
 }
 
@@ -108,6 +131,7 @@ func (c *CardTransaction) convertToDB() *datalayer.CardTransaction {
 	cardTransaction.MerchantCountryName = c.MerchantCountryName
 	cardTransaction.MerchantCategoryCode = c.MerchantCategoryCode
 	cardTransaction.MerchantCategoryName = c.MerchantCategoryName
+	cardTransaction.Notes = c.Notes
 	cardTransaction.UserID = c.UserID
 	return cardTransaction
 }
@@ -154,6 +178,9 @@ func (c *CardTransaction) CreateCardTransaction() (*CardTransaction, error) {
 	}
 
 	data := newFromDBCardTransaction(dbCardTransaction)
+	data.serverState = c.serverState
+	data.UserID = c.UserID
+	data.publishCreated()
 
 	return data, nil
 }
@@ -174,7 +201,7 @@ func (c *CardTransaction) GetCardTransactionsByUserID(userID int64) ([]*CardTran
 	dl := c.serverState.DataLayer
 	cardTransactions := make([]*CardTransaction, 0)
 
-	dbCardTransactions, err := dl.GetCardTransactionsByUserID(userID, c, c.filter)
+	dbCardTransactions, err := dl.GetCardTransactionsByUserIDs(c.ownerIDs(userID), c, c.filter)
 	if err == datalayer.ErrNoData {
 		return nil, err
 	} else if err != nil {
@@ -183,18 +210,122 @@ func (c *CardTransaction) GetCardTransactionsByUserID(userID int64) ([]*CardTran
 
 	for _, dbCardTransaction := range dbCardTransactions {
 		cardTransaction := newFromDBCardTransaction(dbCardTransaction)
+		if c.filter.Search.IsSet {
+			cardTransaction.highlight(c.filter.Search.Query)
+		}
 		cardTransactions = append(cardTransactions, cardTransaction)
 	}
 
 	return cardTransactions, err
 }
 
+// highlight marks where each searched field matched the query.
+func (c *CardTransaction) highlight(query search.Query) {
+	for name, value := range map[string]string{
+		"reference":            c.Reference,
+		"merchantName":         c.MerchantName,
+		"merchantCity":         c.MerchantCity,
+		"merchantCategoryName": c.MerchantCategoryName,
+		"notes":                c.Notes,
+	} {
+		snippet := query.Highlight(value)
+		if len(snippet) == 0 {
+			continue
+		}
+		if c.Highlights == nil {
+			c.Highlights = make(map[string]string)
+		}
+		c.Highlights[name] = snippet
+	}
+}
+
+// SetOwner chooses whose card transactions the user reads: their own when
+// owner is empty or "me", those of a member of one of their households who
+// has granted them access when it is that member's user ID, or their own
+// and those of everybody who has granted them access when it is
+// "household".
+func (c *CardTransaction) SetOwner(userID int64, owner string) error {
+	switch owner {
+	case "", "me":
+		c.owners = []int64{userID}
+		return nil
+	case "household":
+		owners, err := readableOwners(c.serverState, userID)
+		if err != nil {
+			return err
+		}
+		c.owners = owners
+		return nil
+	}
+
+	ownerID, err := strconv.ParseInt(owner, 10, 64)
+	if err != nil || ownerID <= 0 {
+		return e.NewError("Query parameter 'owner' is invalid", []types.ErrorField{
+			{Name: "owner", Message: "must be me, household or a user ID"},
+		}, http.StatusBadRequest)
+	}
+	access, err := CardTransactionAccess(c.serverState, userID, ownerID)
+	if err != nil {
+		return err
+	}
+	if access == datalayer.HouseholdAccessNone {
+		return ErrCardTransactionAccessDenied
+	}
+	c.owners = []int64{ownerID}
+
+	return nil
+}
+
+// WritableOwner returns whose card transactions the user writes: their own
+// when owner is empty or "me", otherwise those of the member whose user ID it
+// is, provided they have granted the user read-write access.
+func (c *CardTransaction) WritableOwner(userID int64, owner string) (int64, error) {
+	if owner == "" || owner == "me" {
+		return userID, nil
+	}
+
+	ownerID, err := strconv.ParseInt(owner, 10, 64)
+	if err != nil || ownerID <= 0 {
+		return 0, e.NewError("Query parameter 'owner' is invalid", []types.ErrorField{
+			{Name: "owner", Message: "must be me or a user ID"},
+		}, http.StatusBadRequest)
+	}
+	access, err := CardTransactionAccess(c.serverState, userID, ownerID)
+	if err != nil {
+		return 0, err
+	}
+	if access != datalayer.HouseholdAccessReadWrite {
+		return 0, ErrCardTransactionAccessDenied
+	}
+
+	return ownerID, nil
+}
+
+// ownerIDs returns the users chosen by SetOwner, or only the user when
+// SetOwner was not called.
+func (c *CardTransaction) ownerIDs(userID int64) []int64 {
+	if c.owners == nil {
+		return []int64{userID}
+	}
+	return c.owners
+}
+
 func (c *CardTransaction) SetFilterCriteria(queryParams url.Values) error {
 	err := c.filterAmount(queryParams)
 	if err != nil {
 		return err
 	}
 
+	err = c.filterSearch(queryParams)
+	if err != nil {
+		return err
+	}
+
+	err = c.filterExpression(queryParams)
+	if err != nil {
+		return err
+	}
+
 	err = c.filterDateTime(queryParams)
 	if err != nil {
 		return err
@@ -203,6 +334,111 @@ func (c *CardTransaction) SetFilterCriteria(queryParams url.Values) error {
 	return nil
 }
 
+// filterExpression parses the filter= expression.  It is combined with any
+// of the other filter parameters.
+func (c *CardTransaction) filterExpression(queryParams url.Values) error {
+	if _, ok := queryParams["filter"]; !ok {
+		return nil
+	}
+
+	expr, err := ParseCardTransactionFilter(queryParams.Get("filter"))
+	if err != nil {
+		return err
+	}
+	c.filter.Expression = expr
+
+	return nil
+}
+
+// ParseCardTransactionFilter parses a card transaction filter expression,
+// reporting problems against the filter field.
+func ParseCardTransactionFilter(filter string) (filters.Expression, error) {
+	expr, err := filters.ParseExpression(filter, filters.CardTransactionFields)
+	if exprErr, ok := err.(*filters.ExpressionError); ok {
+		name := "filter"
+		if len(exprErr.Field) > 0 {
+			name = "filter." + exprErr.Field
+		}
+		return nil, e.NewError("filter is invalid", []types.ErrorField{
+			{Name: name, Message: exprErr.Error()},
+		}, http.StatusBadRequest)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return expr, nil
+}
+
+// Matches reports whether the card transaction satisfies a parsed filter,
+// for transactions that have not been read back from the database.
+func (c *CardTransaction) Matches(expr filters.Expression) bool {
+	return filters.Evaluate(expr, func(field string) interface{} {
+		switch field {
+		case "id":
+			return c.ID
+		case "dateTime":
+			return c.DateTime
+		case "amount":
+			scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(c.Amount.Scale)), nil)
+			return new(big.Rat).SetFrac(big.NewInt(c.Amount.Value), scale)
+		case "currencyCode":
+			return c.CurrencyCode
+		case "reference":
+			return c.Reference
+		case "merchantName":
+			return c.MerchantName
+		case "merchantCity":
+			return c.MerchantCity
+		case "merchantCountryCode":
+			return c.MerchantCountryCode
+		case "merchantCountryName":
+			return c.MerchantCountryName
+		case "merchantCategoryCode":
+			return c.MerchantCategoryCode
+		case "merchantCategoryName":
+			return c.MerchantCategoryName
+		case "notes":
+			return c.Notes
+		case "anomalyScore":
+			return int64(c.AnomalyScore)
+		}
+		return nil
+	})
+}
+
+// filterSearch applies the q full-text search.  Results are ordered by
+// relevance unless another sort field was asked for, and relevance cannot be
+// sorted on without a search.
+func (c *CardTransaction) filterSearch(queryParams url.Values) error {
+	_, sortFieldSet := queryParams["sortField"]
+	if _, ok := queryParams["q"]; !ok {
+		if c.pagination.SortField == "relevance" {
+			return e.NewError("invalid sort field", []types.ErrorField{
+				{Name: "sortField", Message: "relevance can only be sorted on with a search", Direct: true},
+			}, http.StatusBadRequest)
+		}
+		return nil
+	}
+
+	query, err := search.Parse(queryParams.Get("q"))
+	if err != nil {
+		return e.NewError("search is invalid", []types.ErrorField{
+			{Name: "q", Message: err.Error()},
+		}, http.StatusBadRequest)
+	}
+	c.filter.Search.Query = query
+	c.filter.Search.IsSet = true
+
+	if !sortFieldSet {
+		c.pagination.SortField = "relevance"
+		if _, ok := queryParams["sortDir"]; !ok {
+			c.pagination.SortDir = pagination.SortDirectionDesc
+		}
+	}
+
+	return nil
+}
+
 func (c *CardTransaction) filterAmount(queryParams url.Values) error {
 	queryVal, ok := queryParams["amount"]
 	if !ok {
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+type CardTransactionSplit struct {
+	datalayer.Model
+	CardTransactionID int64         `json:"cardTransactionID"`
+	Amount            CurrencyValue `json:"amount"`
+	Category          string        `json:"category"`
+	Note              string        `json:"note"`
+	UserID            int64         `json:"userID,omitempty"`
+}
+
+type CardTransactionSplits struct {
+	serverState *state.ServerState
+	Splits      []*CardTransactionSplit `json:"splits"`
+}
+
+func NewCardTransactionSplits(state *state.ServerState) *CardTransactionSplits {
+	splits := new(CardTransactionSplits)
+	splits.serverState = state
+	return splits
+}
+
+func newFromDBCardTransactionSplit(split *datalayer.CardTransactionSplit) *CardTransactionSplit {
+	s := new(CardTransactionSplit)
+	s.ID = split.ID
+	s.CreatedAt = split.CreatedAt
+	s.UpdatedAt = split.UpdatedAt
+	s.DeletedAt = split.DeletedAt
+	s.CardTransactionID = split.CardTransactionID
+	s.Amount.Value = split.Amount
+	s.Amount.Scale = split.CurrencyScale
+	s.Category = split.Category
+	s.Note = split.Note
+	if split.UserID.Valid {
+		s.UserID = split.UserID.Int64
+	}
+	return s
+}
+
+func (s *CardTransactionSplit) convertToDB() *datalayer.CardTransactionSplit {
+	split := new(datalayer.CardTransactionSplit)
+	split.CardTransactionID = s.CardTransactionID
+	split.Amount = s.Amount.Value
+	split.CurrencyScale = s.Amount.Scale
+	split.Category = s.Category
+	split.Note = s.Note
+	split.UserID = sql.NullInt64{Int64: s.UserID, Valid: s.UserID > 0}
+	return split
+}
+
+// lookupCardTransaction fetches a card transaction that the user has at
+// least the given access to, hiding any other transaction behind the same not
+// found error.
+func (s *CardTransactionSplits) lookupCardTransaction(userID, cardTransactionID int64, access datalayer.HouseholdAccess) (*datalayer.CardTransaction, error) {
+	dl := s.serverState.DataLayer
+	cardTransaction, err := dl.GetCardTransactionByID(cardTransactionID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrCardTransactionNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query card transaction [%d] from database", cardTransactionID), http.StatusInternalServerError, err)
+	}
+
+	granted, err := CardTransactionAccess(s.serverState, userID, cardTransaction.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if granted == datalayer.HouseholdAccessNone || (access == datalayer.HouseholdAccessReadWrite && granted != access) {
+		return nil, ErrCardTransactionNotFound
+	}
+
+	return cardTransaction, nil
+}
+
+// validate checks the splits of a card transaction set by the user.  Splits
+// may only be attributed to the user or to those who share a household with
+// them, and any other user is reported as not existing.
+func (s *CardTransactionSplits) validate(userID int64, cardTransaction *datalayer.CardTransaction) error {
+	var fields []types.ErrorField
+	var total int64
+	for i, split := range s.Splits {
+		name := fmt.Sprintf("splits[%d]", i)
+		if len(split.Category) == 0 {
+			fields = append(fields, types.ErrorField{Name: name + ".category", Message: "category is required"})
+		}
+		if split.Amount.Value == 0 {
+			fields = append(fields, types.ErrorField{Name: name + ".amount", Message: "amount must not be zero"})
+		}
+		if split.Amount.Scale != cardTransaction.CurrencyScale {
+			fields = append(fields, types.ErrorField{Name: name + ".amount", Message: "scale must match the card transaction's scale"})
+		}
+		if split.UserID != 0 && split.UserID != userID {
+			shared, err := sharesHousehold(s.serverState, userID, split.UserID)
+			if err != nil {
+				return err
+			} else if !shared {
+				fields = append(fields, types.ErrorField{Name: name + ".userID", Message: "user does not exist"})
+			}
+		}
+		total += split.Amount.Value
+	}
+
+	if len(s.Splits) > 0 && total != cardTransaction.Amount {
+		fields = append(fields, types.ErrorField{
+			Name:    "splits",
+			Message: fmt.Sprintf("split amounts add up to %d but the card transaction amount is %d", total, cardTransaction.Amount),
+		})
+	}
+
+	if len(fields) > 0 {
+		return e.NewError("Card transaction splits are invalid", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// SetSplits replaces the allocations of a card transaction the user owns or
+// has been granted read-write access to.  An empty list removes the split so
+// the whole amount falls back to the merchant category.
+func (s *CardTransactionSplits) SetSplits(userID, cardTransactionID int64) error {
+	cardTransaction, err := s.lookupCardTransaction(userID, cardTransactionID, datalayer.HouseholdAccessReadWrite)
+	if err != nil {
+		return err
+	}
+
+	err = s.validate(userID, cardTransaction)
+	if err != nil {
+		return err
+	}
+
+	dbSplits := make([]*datalayer.CardTransactionSplit, 0, len(s.Splits))
+	for _, split := range s.Splits {
+		dbSplits = append(dbSplits, split.convertToDB())
+	}
+
+	dl := s.serverState.DataLayer
+	err = dl.ReplaceCardTransactionSplits(cardTransactionID, dbSplits)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to store splits for card transaction [%d]", cardTransactionID), http.StatusInternalServerError, err)
+	}
+
+	return s.load(cardTransactionID)
+}
+
+func (s *CardTransactionSplits) GetSplits(userID, cardTransactionID int64) error {
+	_, err := s.lookupCardTransaction(userID, cardTransactionID, datalayer.HouseholdAccessRead)
+	if err != nil {
+		return err
+	}
+
+	return s.load(cardTransactionID)
+}
+
+func (s *CardTransactionSplits) load(cardTransactionID int64) error {
+	dl := s.serverState.DataLayer
+	dbSplits, err := dl.GetCardTransactionSplits(cardTransactionID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query splits for card transaction [%d]", cardTransactionID), http.StatusInternalServerError, err)
+	}
+
+	s.Splits = make([]*CardTransactionSplit, 0, len(dbSplits))
+	for _, dbSplit := range dbSplits {
+		s.Splits = append(s.Splits, newFromDBCardTransactionSplit(dbSplit))
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// CashFlow is income received, or a payment made, on the same day of every
+// month.  Months shorter than DayOfMonth use their last day.  A payment made
+// by card names its MerchantName so that the forecast does not count it a
+// second time as discretionary spend.
+type CashFlow struct {
+	datalayer.Model
+	Name         string                 `json:"name"`
+	Kind         datalayer.CashFlowKind `json:"kind"`
+	Amount       CurrencyValue          `json:"amount"`
+	CurrencyCode string                 `json:"currencyCode"`
+	DayOfMonth   int                    `json:"dayOfMonth"`
+	MerchantName string                 `json:"merchantName"`
+	serverState  *state.ServerState
+}
+
+func NewCashFlow(state *state.ServerState) *CashFlow {
+	cashFlow := new(CashFlow)
+	cashFlow.serverState = state
+	return cashFlow
+}
+
+func newFromDBCashFlow(cashFlow *datalayer.CashFlow) *CashFlow {
+	c := new(CashFlow)
+	c.ID = cashFlow.ID
+	c.CreatedAt = cashFlow.CreatedAt
+	c.UpdatedAt = cashFlow.UpdatedAt
+	c.DeletedAt = cashFlow.DeletedAt
+	c.Name = cashFlow.Name
+	c.Kind = cashFlow.Kind
+	c.Amount = CurrencyValue{Value: cashFlow.Amount, Scale: cashFlow.CurrencyScale}
+	c.CurrencyCode = cashFlow.CurrencyCode
+	c.DayOfMonth = cashFlow.DayOfMonth
+	c.MerchantName = cashFlow.MerchantName
+	return c
+}
+
+func (c *CashFlow) convertToDB(userID int64) *datalayer.CashFlow {
+	cashFlow := new(datalayer.CashFlow)
+	cashFlow.ID = c.ID
+	cashFlow.UserID = userID
+	cashFlow.Name = c.Name
+	cashFlow.Kind = c.Kind
+	cashFlow.Amount = c.Amount.Value
+	cashFlow.CurrencyScale = c.Amount.Scale
+	cashFlow.CurrencyCode = c.CurrencyCode
+	cashFlow.DayOfMonth = c.DayOfMonth
+	cashFlow.MerchantName = c.MerchantName
+	return cashFlow
+}
+
+func (c *CashFlow) validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Kind = datalayer.CashFlowKind(strings.ToUpper(strings.TrimSpace(string(c.Kind))))
+	c.CurrencyCode = strings.ToUpper(strings.TrimSpace(c.CurrencyCode))
+	c.MerchantName = strings.TrimSpace(c.MerchantName)
+
+	var fields []types.ErrorField
+	if len(c.Name) == 0 || len(c.Name) > 255 {
+		fields = append(fields, types.ErrorField{Name: "name", Message: "a name of up to 255 characters is required"})
+	}
+	switch c.Kind {
+	case datalayer.CashFlowIncome, datalayer.CashFlowPayment:
+	default:
+		fields = append(fields, types.ErrorField{Name: "kind", Message: "must be INCOME or PAYMENT"})
+	}
+	if c.Amount.Value <= 0 || c.Amount.Scale < 0 || c.Amount.Scale > maxCurrencyScale {
+		fields = append(fields, types.ErrorField{Name: "amount", Message: "must be a positive amount"})
+	}
+	if !currencyCode.MatchString(c.CurrencyCode) {
+		fields = append(fields, types.ErrorField{Name: "currencyCode", Message: "must be a currency code such as ZAR"})
+	}
+	if c.DayOfMonth < 1 || c.DayOfMonth > 31 {
+		fields = append(fields, types.ErrorField{Name: "dayOfMonth", Message: "must be between 1 and 31"})
+	}
+	if len(c.MerchantName) > 255 {
+		fields = append(fields, types.ErrorField{Name: "merchantName", Message: "must be up to 255 characters"})
+	}
+	if len(fields) > 0 {
+		return e.NewError("Cash flow is invalid", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func (c *CashFlow) CreateCashFlow(userID int64) (*CashFlow, error) {
+	c.ID = 0
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	dl := c.serverState.DataLayer
+	id, err := dl.CreateCashFlow(c.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to store cash flow", http.StatusInternalServerError, err)
+	}
+
+	return c.GetCashFlow(userID, id)
+}
+
+// GetCashFlow looks up one of the user's cash flows.  Cash flows belonging
+// to somebody else are reported as not found.
+func (c *CashFlow) GetCashFlow(userID, id int64) (*CashFlow, error) {
+	dl := c.serverState.DataLayer
+	dbCashFlow, err := dl.GetCashFlowByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrCashFlowNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query cash flow [%d] from database", id), http.StatusInternalServerError, err)
+	}
+
+	if dbCashFlow.UserID != userID {
+		return nil, ErrCashFlowNotFound
+	}
+
+	cashFlow := newFromDBCashFlow(dbCashFlow)
+	cashFlow.serverState = c.serverState
+	return cashFlow, nil
+}
+
+func (c *CashFlow) GetCashFlowsByUserID(userID int64) ([]*CashFlow, error) {
+	dl := c.serverState.DataLayer
+	dbCashFlows, err := dl.GetCashFlowsByUserID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query cash flows from database", http.StatusInternalServerError, err)
+	}
+
+	cashFlows := make([]*CashFlow, 0, len(dbCashFlows))
+	for _, cashFlow := range dbCashFlows {
+		cashFlows = append(cashFlows, newFromDBCashFlow(cashFlow))
+	}
+
+	return cashFlows, nil
+}
+
+func (c *CashFlow) UpdateCashFlow(userID, id int64) (*CashFlow, error) {
+	_, err := c.GetCashFlow(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ID = id
+	err = c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	dl := c.serverState.DataLayer
+	err = dl.UpdateCashFlow(c.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to update cash flow", http.StatusInternalServerError, err)
+	}
+
+	return c.GetCashFlow(userID, id)
+}
+
+func (c *CashFlow) DeleteCashFlow(userID, id int64) error {
+	_, err := c.GetCashFlow(userID, id)
+	if err != nil {
+		return err
+	}
+
+	dl := c.serverState.DataLayer
+	err = dl.DeleteCashFlow(userID, id)
+	if err != nil {
+		return e.Wrap("Failed to delete cash flow", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
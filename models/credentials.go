@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// checkPassword looks up the user and checks their current password.
+func (u *User) checkPassword(userID int64, password string) (*datalayer.User, error) {
+	dl := u.serverState.DataLayer
+	dbUser, err := dl.GetUserByID(userID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrUserDoesNotExist
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", userID), http.StatusInternalServerError, err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(dbUser.Password.String), []byte(password))
+	if err != nil {
+		return nil, ErrCurrentPasswordIncorrect
+	}
+
+	return dbUser, nil
+}
+
+// ChangePassword sets a new password for a user who knows their current one.
+// Every token issued before is revoked, as on a password reset, so the caller
+// is given tokens for a new session.
+func (u *User) ChangePassword(userID int64, currentPassword, newPassword string) (*auth.TokenResponse, error) {
+	dbUser, err := u.checkPassword(userID, currentPassword)
+	if err != nil {
+		return nil, err
+	}
+	if len(newPassword) < 6 {
+		return nil, ErrValidationPassword
+	}
+
+	err = setPassword(u.serverState, dbUser, newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	u.convert(*dbUser)
+	return u.createTokens("")
+}
+
+// ChangeEmail starts moving a user who knows their password to a new
+// address.  The switch is made once a link sent to the new address is
+// followed; until then the user keeps signing in with the old one.
+func (u *User) ChangeEmail(userID int64, password, email string) error {
+	dbUser, err := u.checkPassword(userID, password)
+	if err != nil {
+		return err
+	}
+
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return ErrValidationEmail
+	}
+	dl := u.serverState.DataLayer
+	_, err = dl.GetUserByEmail(email)
+	if err != datalayer.ErrNoData {
+		return ErrEmailExists
+	}
+
+	err = dl.SetUserPendingEmailByID(dbUser.ID, email)
+	if err != nil {
+		return e.Wrap("Failed to store new email address", http.StatusInternalServerError, err)
+	}
+
+	dbUser.PendingEmail.String, dbUser.PendingEmail.Valid = email, true
+	queueConfirmation(u.serverState, *dbUser)
+
+	return nil
+}
+
+// confirmEmailChange switches the user to the address the confirmation was
+// sent to, provided it is still the one they are changing to and nobody has
+// taken it since.  The old address is told of the change.
+func (u *User) confirmEmailChange(confirmation *datalayer.SignUpConfirmation) error {
+	dl := u.serverState.DataLayer
+	dbUser, err := dl.GetUserByID(confirmation.UserID)
+	if err == datalayer.ErrNoData {
+		return ErrUserDoesNotExist
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", confirmation.UserID),
+			http.StatusInternalServerError, err)
+	}
+	if !dbUser.PendingEmail.Valid || dbUser.PendingEmail.String != confirmation.Email.String {
+		return ErrEmailChangeNotPending
+	}
+	_, err = dl.GetUserByEmail(confirmation.Email.String)
+	if err != datalayer.ErrNoData {
+		return ErrEmailExists
+	}
+
+	err = dl.ChangeUserEmailByID(dbUser.ID, confirmation.Email.String)
+	if err != nil {
+		return e.Wrap("Failed to change email address", http.StatusInternalServerError, err)
+	}
+	err = dl.DeleteSignUpConfirmation(confirmation.ID)
+	if err != nil {
+		u.serverState.Logger.Printf("Failed to delete confirmation [%d]: %v", confirmation.ID, err)
+	}
+
+	message := fmt.Sprintf("Hello,\n The email address of your account has been changed from %s to %s.  "+
+		"If you did not make this change, reset your password and contact us.", dbUser.Email.String,
+		confirmation.Email.String)
+	err = u.serverState.Providers.Email.SendMail([]string{dbUser.Email.String}, "noreply@someapp.com",
+		"Your email address has changed", message)
+	if err != nil {
+		u.serverState.Logger.Printf("Failed to notify user [%d] of email change: %v", dbUser.ID, err)
+	}
+	publishAccountEvent(u.serverState, events.UserEmailChanged, dbUser.ID, confirmation.Email.String)
+
+	return nil
+}
@@ -28,10 +28,103 @@ var (
 
 	ErrUserDoesNotExist = e.NewError("User does not exist", nil, http.StatusForbidden)
 
+	ErrUserNotFound = e.NewError("User not found", nil, http.StatusNotFound)
+
+	ErrUserDisabled = e.NewError("User account is disabled", nil, http.StatusForbidden)
+
+	ErrTokenRevoked = e.NewError("Token has been revoked", nil, http.StatusForbidden)
+
+	ErrRefreshTokenInvalid = e.NewError("Refresh token is not valid", nil, http.StatusUnauthorized)
+
+	ErrRefreshTokenRevoked = e.NewError("Refresh token has been revoked", nil, http.StatusUnauthorized)
+
+	ErrRefreshTokenReused = e.NewError("Refresh token has already been used, the session has been revoked", nil,
+		http.StatusUnauthorized)
+
+	ErrRefreshUserDisabled = e.NewError("User account is disabled", nil, http.StatusUnauthorized)
+
+	ErrTokenNotRevocable = e.NewError("Token cannot be revoked on its own, log out of all sessions instead", nil,
+		http.StatusBadRequest)
+
+	ErrUserAlreadyConfirmed = e.NewError("User has already confirmed their email address", nil, http.StatusConflict)
+
 	ErrEmailExists      = e.NewError("Email address already exists", []types.ErrorField{
 		{Name: "email", Message: "Email address already exists"},
 	}, http.StatusBadRequest)
 
+	ErrCardTransactionNotFound = e.NewError("Card transaction not found", nil, http.StatusNotFound)
+
+	ErrSavedViewNotFound = e.NewError("Saved view not found", nil, http.StatusNotFound)
+
+	ErrSavedViewNameExists = e.NewError("Saved view name already exists", []types.ErrorField{
+		{Name: "name", Message: "Saved view name already exists"},
+	}, http.StatusBadRequest)
+
+	ErrWebhookNotFound = e.NewError("Webhook not found", nil, http.StatusNotFound)
+
+	ErrWebhookDeliveryNotFound = e.NewError("Webhook delivery not found", nil, http.StatusNotFound)
+
+	ErrAlertRuleNotFound = e.NewError("Alert rule not found", nil, http.StatusNotFound)
+
+	ErrGoalNotFound = e.NewError("Goal not found", nil, http.StatusNotFound)
+
+	ErrCashFlowNotFound = e.NewError("Cash flow not found", nil, http.StatusNotFound)
+
+	ErrHouseholdNotFound = e.NewError("Household not found", nil, http.StatusNotFound)
+
+	ErrHouseholdMemberNotFound = e.NewError("Household member not found", nil, http.StatusNotFound)
+
+	ErrHouseholdInvitationNotFound = e.NewError("Household invitation not found", nil, http.StatusNotFound)
+
+	ErrHouseholdInvitationAccepted = e.NewError("Household invitation has already been accepted", nil, http.StatusConflict)
+
+	ErrHouseholdInvitationExpired = e.NewError("Household invitation has expired", nil, http.StatusGone)
+
+	ErrHouseholdOwnerOnly = e.NewError("Only the household owner may do that", nil, http.StatusForbidden)
+
+	ErrCardTransactionAccessDenied = e.NewError("You do not have access to that user's card transactions", []types.ErrorField{
+		{Name: "owner", Message: "access has not been granted"},
+	}, http.StatusForbidden)
+
+	ErrCurrentPasswordIncorrect = e.NewError("Current password is incorrect", []types.ErrorField{
+		{Name: "currentPassword", Message: "Current password is incorrect"},
+	}, http.StatusForbidden)
+
+	ErrConfirmationExpired = e.NewError("Confirmation link has expired or has already been used", []types.ErrorField{
+		{Name: "nonce", Message: "request a new confirmation email"},
+	}, http.StatusBadRequest)
+
+	ErrEmailChangeNotPending = e.NewError("Email change is no longer pending", nil, http.StatusConflict)
+
+	ErrPasswordResetInvalid = e.NewError("Password reset link is invalid or has expired", []types.ErrorField{
+		{Name: "token", Message: "request a new password reset"},
+	}, http.StatusBadRequest)
+
+	ErrTwoFactorEnabled = e.NewError("Two-factor authentication is already enabled", nil, http.StatusConflict)
+
+	ErrTwoFactorNotEnrolled = e.NewError("Two-factor authentication is not set up", nil, http.StatusConflict)
+
+	ErrTwoFactorNotEnabled = e.NewError("Two-factor authentication is not enabled", nil, http.StatusConflict)
+
+	ErrTwoFactorCodeInvalid = e.NewError("Two-factor code is incorrect", []types.ErrorField{
+		{Name: "code", Message: "Two-factor code is incorrect"},
+	}, http.StatusForbidden)
+
+	ErrChallengeCodeInvalid = e.NewError("Two-factor code is incorrect, sign in again", []types.ErrorField{
+		{Name: "code", Message: "Two-factor code is incorrect"},
+	}, http.StatusUnauthorized)
+
+	ErrChallengeInvalid = e.NewError("Two-factor challenge is invalid or has expired, sign in again", nil, http.StatusUnauthorized)
+	ErrTicketInvalid    = e.NewError("Ticket has expired or has already been used", nil, http.StatusForbidden)
+
+	ErrAPITokenNotFound = e.NewError("API token not found", nil, http.StatusNotFound)
+
+	ErrAPITokenInvalid = e.NewError("Token rejected, API token is not valid", nil, http.StatusForbidden)
+
+	ErrAPITokenRevoked = e.NewError("Token has been revoked", nil, http.StatusForbidden)
+
+	ErrAPITokenExpired = e.NewError("Token rejected, API token has expired", nil, http.StatusForbidden)
+
 	ErrValidationFailed = e.NewError("Invalid request, validation failed", nil, http.StatusBadRequest)
 
 	ErrValidationName = e.NewError("Contact name is required", []types.ErrorField{
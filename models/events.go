@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// publishCreated tells subscribers about a newly stored card transaction.
+func (c *CardTransaction) publishCreated() {
+	if c.serverState.Events == nil {
+		return
+	}
+
+	c.serverState.Events.Publish(events.Event{
+		ID:     c.ID,
+		Type:   events.CardTransactionCreated,
+		UserID: c.UserID,
+		Data:   c,
+	})
+}
+
+// AccountActivity is the data of account events such as logging in.
+type AccountActivity struct {
+	Email string    `json:"email"`
+	At    time.Time `json:"at"`
+}
+
+// publishAccountEvent tells subscribers about activity on a user's account.
+func publishAccountEvent(state *state.ServerState, eventType string, userID int64, email string) {
+	if state.Events == nil {
+		return
+	}
+
+	state.Events.Publish(events.Event{
+		Type:   eventType,
+		UserID: userID,
+		Data:   AccountActivity{Email: email, At: time.Now().UTC()},
+	})
+}
+
+// GetCardTransactionsAfterID returns the user's card transactions created
+// after the one with id afterID, oldest first, for replaying missed events.
+func (c *CardTransaction) GetCardTransactionsAfterID(userID, afterID int64, limit int) ([]*CardTransaction, error) {
+	dl := c.serverState.DataLayer
+	dbCardTransactions, err := dl.GetCardTransactionsAfterID(userID, afterID, limit)
+	if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query card transactions after [%d] from database", afterID), http.StatusInternalServerError, err)
+	}
+
+	cardTransactions := make([]*CardTransaction, 0, len(dbCardTransactions))
+	for _, dbCardTransaction := range dbCardTransactions {
+		cardTransactions = append(cardTransactions, newFromDBCardTransaction(dbCardTransaction))
+	}
+
+	return cardTransactions, nil
+}
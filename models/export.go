@@ -0,0 +1,109 @@
+package models
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/statement"
+)
+
+type ExportFormat string
+
+const (
+	ExportFormatCSV    ExportFormat = "csv"
+	ExportFormatOFX    ExportFormat = "ofx"
+	ExportFormatNDJSON ExportFormat = "ndjson"
+)
+
+// ParseExportFormat validates the requested export format, defaulting to CSV.
+func ParseExportFormat(format string) (ExportFormat, error) {
+	if len(format) == 0 {
+		return ExportFormatCSV, nil
+	}
+
+	switch f := ExportFormat(strings.ToLower(format)); f {
+	case ExportFormatCSV, ExportFormatOFX, ExportFormatNDJSON:
+		return f, nil
+	}
+
+	return "", e.NewError("Unsupported export format", []types.ErrorField{
+		{Name: "format", Message: "format must be one of csv, ofx or ndjson"},
+	}, http.StatusBadRequest)
+}
+
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportFormatOFX:
+		return "application/x-ofx"
+	case ExportFormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// FileName names the export after the day it was taken.
+func (f ExportFormat) FileName(now time.Time) string {
+	return "card-transactions-" + now.Format("20060102") + "." + string(f)
+}
+
+// ExportCardTransactionsByUserID writes every card transaction matching the
+// filter, in sort order, to w.  Rows are written as they are read from the
+// database.  CSV and OFX exports follow the statement sign convention, so
+// spend is negative, and can be imported again.
+func (c *CardTransaction) ExportCardTransactionsByUserID(userID int64, format ExportFormat, w io.Writer) error {
+	dl := c.serverState.DataLayer
+
+	if format == ExportFormatNDJSON {
+		encoder := json.NewEncoder(w)
+		return dl.StreamCardTransactionsByUserIDs(c.ownerIDs(userID), c, c.filter, func(dbCardTransaction *datalayer.CardTransaction) error {
+			cardTransaction := newFromDBCardTransaction(dbCardTransaction)
+			if c.filter.Search.IsSet {
+				cardTransaction.highlight(c.filter.Search.Query)
+			}
+			return encoder.Encode(cardTransaction)
+		})
+	}
+
+	start, end := time.Unix(0, 0), time.Now()
+	if c.filter.DateTime.IsSet {
+		start, end = c.filter.DateTime.LowerBound, c.filter.DateTime.UpperBound
+	}
+
+	writer, err := statement.NewWriter(statement.Format(format), w, start, end)
+	if err != nil {
+		return err
+	}
+
+	err = dl.StreamCardTransactionsByUserIDs(c.ownerIDs(userID), c, c.filter, func(dbCardTransaction *datalayer.CardTransaction) error {
+		return writer.Write(newFromDBCardTransaction(dbCardTransaction).toStatement())
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// toStatement is the inverse of Import.newCardTransaction.
+func (c *CardTransaction) toStatement() *statement.Transaction {
+	return &statement.Transaction{
+		ID:                   c.ID,
+		DateTime:             c.DateTime,
+		Amount:               -c.Amount.Value,
+		Scale:                c.Amount.Scale,
+		CurrencyCode:         c.CurrencyCode,
+		Reference:            c.Reference,
+		MerchantName:         c.MerchantName,
+		MerchantCity:         c.MerchantCity,
+		MerchantCountryCode:  c.MerchantCountryCode,
+		MerchantCountryName:  c.MerchantCountryName,
+		MerchantCategoryCode: c.MerchantCategoryCode,
+		MerchantCategoryName: c.MerchantCategoryName,
+	}
+}
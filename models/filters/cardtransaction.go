@@ -1,6 +1,10 @@
 package filters
 
-import "time"
+import (
+	"time"
+
+	"github.com/donohutcheon/gowebserver/lib/search"
+)
 
 type AmountRange struct {
 	LowerBound int64
@@ -20,6 +24,11 @@ type StringFilter struct {
 	IsSet bool
 }
 
+type SearchFilter struct {
+	Query search.Query
+	IsSet bool
+}
+
 type CardTransactionFilter struct {
 	Amount                AmountRange
 	CurrencyCodes         StringFilter
@@ -31,4 +40,8 @@ type CardTransactionFilter struct {
 	MerchantCountryNames  StringFilter
 	MerchantCategoryCodes StringFilter
 	MerchantCategoryNames StringFilter
+	Search                SearchFilter
+
+	// Expression is the parsed filter= expression, if any.
+	Expression Expression
 }
\ No newline at end of file
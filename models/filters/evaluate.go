@@ -0,0 +1,101 @@
+package filters
+
+import (
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Evaluate reports whether a record matches a parsed filter, for records that
+// are not read from the database.  value returns the record's value for a
+// field: an int64 for FieldInteger, a *big.Rat for FieldDecimal, a string for
+// FieldString and a time.Time for FieldTime.  Text is compared regardless of
+// case, as the database collation does.
+func Evaluate(expr Expression, value func(field string) interface{}) bool {
+	switch x := expr.(type) {
+	case And:
+		return Evaluate(x.Left, value) && Evaluate(x.Right, value)
+	case Or:
+		return Evaluate(x.Left, value) || Evaluate(x.Right, value)
+	case Not:
+		return !Evaluate(x.Expression, value)
+	case Comparison:
+		cmp, ok := compare(value(x.Field), x.Value)
+		if !ok {
+			return false
+		}
+		switch x.Operator {
+		case "=":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		}
+	case In:
+		fieldValue := value(x.Field)
+		for _, v := range x.Values {
+			if cmp, ok := compare(fieldValue, v); ok && cmp == 0 {
+				return !x.Negate
+			}
+		}
+		return x.Negate
+	}
+
+	return false
+}
+
+// compare orders a field's value against a value from a parsed filter.  It
+// reports false when the two cannot be compared.
+func compare(fieldValue, filterValue interface{}) (int, bool) {
+	switch v := fieldValue.(type) {
+	case int64:
+		f, ok := filterValue.(int64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case v < f:
+			return -1, true
+		case v > f:
+			return 1, true
+		}
+		return 0, true
+	case *big.Rat:
+		s, ok := filterValue.(string)
+		if !ok {
+			return 0, false
+		}
+		f, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return 0, false
+		}
+		return v.Cmp(f), true
+	case string:
+		f, ok := filterValue.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(strings.ToLower(v), strings.ToLower(f)), true
+	case time.Time:
+		f, ok := filterValue.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case v.Before(f):
+			return -1, true
+		case v.After(f):
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
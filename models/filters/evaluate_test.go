@@ -0,0 +1,48 @@
+package filters
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	record := map[string]interface{}{
+		"id":                  int64(7),
+		"dateTime":            time.Date(2020, 4, 25, 19, 46, 23, 0, time.UTC),
+		"amount":              big.NewRat(-125050, 100),
+		"currencyCode":        "ZAR",
+		"merchantName":        "Dwelms en Dinges",
+		"merchantCountryCode": "ZA",
+	}
+	value := func(field string) interface{} {
+		return record[field]
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expMatch bool
+	}{
+		{name: "Decimal amount", input: `amount < -1250.49`, expMatch: true},
+		{name: "Decimal amount equal", input: `amount = -1250.5`, expMatch: true},
+		{name: "Text ignores case", input: `merchantName = "dwelms en dinges"`, expMatch: true},
+		{name: "Text differs", input: `currencyCode != "ZAR"`, expMatch: false},
+		{name: "Date", input: `dateTime >= "2020-04-25" and dateTime < "2020-04-26"`, expMatch: true},
+		{name: "In list", input: `merchantCountryCode in ("NA", "za")`, expMatch: true},
+		{name: "Not in list", input: `id not in (7, 8)`, expMatch: false},
+		{name: "Or and not", input: `not id = 7 or amount > 0`, expMatch: false},
+		{name: "Missing field", input: `notes = ""`, expMatch: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := ParseExpression(test.input, CardTransactionFields)
+			require.NoError(t, err)
+			assert.Equal(t, test.expMatch, Evaluate(expr, value))
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package filters
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expression is a node of a parsed filter such as
+// `amount >= 100 and (merchantCountryCode in ("ZA", "NA") or not currencyCode = "ZAR")`.
+type Expression interface {
+	expression()
+}
+
+// And matches when both sides match.
+type And struct {
+	Left, Right Expression
+}
+
+// Or matches when either side matches.
+type Or struct {
+	Left, Right Expression
+}
+
+// Not matches when the expression does not.
+type Not struct {
+	Expression Expression
+}
+
+// Comparison compares a field with a value using one of =, !=, <, <=, > or >=.
+type Comparison struct {
+	Field    string
+	Operator string
+	Value    interface{}
+}
+
+// In matches when the field equals any of the values, or none of them when
+// negated.
+type In struct {
+	Field  string
+	Values []interface{}
+	Negate bool
+}
+
+func (And) expression()        {}
+func (Or) expression()         {}
+func (Not) expression()        {}
+func (Comparison) expression() {}
+func (In) expression()         {}
+
+// FieldType decides which operators a field supports and how its values are
+// read.  Values are checked and converted while parsing, so that a compiled
+// expression only has to bind them.
+type FieldType int
+
+const (
+	// FieldInteger values are whole numbers.
+	FieldInteger FieldType = iota
+	// FieldDecimal values are decimal numbers, such as "-12.50", kept as text
+	// so that no precision is lost before they reach the database.
+	FieldDecimal
+	// FieldString values are quoted strings and support only equality.
+	FieldString
+	// FieldTime values are RFC 3339 or ISO 8601 date strings, or unix times.
+	FieldTime
+)
+
+// CardTransactionFields lists the fields a card transaction filter may use,
+// named as they are in the JSON representation.  Amounts are compared in
+// whole currency units rather than their minor units.
+var CardTransactionFields = map[string]FieldType{
+	"id":                   FieldInteger,
+	"dateTime":             FieldTime,
+	"amount":               FieldDecimal,
+	"currencyCode":         FieldString,
+	"reference":            FieldString,
+	"merchantName":         FieldString,
+	"merchantCity":         FieldString,
+	"merchantCountryCode":  FieldString,
+	"merchantCountryName":  FieldString,
+	"merchantCategoryCode": FieldString,
+	"merchantCategoryName": FieldString,
+	"notes":                FieldString,
+	"anomalyScore":         FieldInteger,
+}
+
+// MaxExpressionLength and MaxExpressionDepth bound the size of a filter.
+const (
+	MaxExpressionLength = 2000
+	MaxExpressionDepth  = 32
+)
+
+// ExpressionError reports a problem with a filter.  Field is set when the
+// problem is with the use of a particular field, and Position is the offset
+// in characters of the offending token.
+type ExpressionError struct {
+	Field    string
+	Position int
+	Message  string
+}
+
+func (e *ExpressionError) Error() string {
+	if len(e.Field) > 0 {
+		return fmt.Sprintf("%s: %s at position %d", e.Field, e.Message, e.Position)
+	}
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	position int
+}
+
+func (t token) keyword(word string) bool {
+	return t.kind == tokenIdentifier && strings.EqualFold(t.text, word)
+}
+
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return "end of filter"
+	}
+	return strconv.Quote(t.text)
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenOpen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenClose, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &ExpressionError{Position: i, Message: `expected "!="`}
+			}
+			tokens = append(tokens, token{tokenOperator, op, i})
+			i += len(op)
+		case r == '"' || r == '\'':
+			start := i
+			b := new(strings.Builder)
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, &ExpressionError{Position: start, Message: "unterminated string"}
+			}
+			tokens = append(tokens, token{tokenString, b.String(), start})
+			i++
+		case r == '-' || r == '+' || r == '.' || unicode.IsDigit(r):
+			start := i
+			for i++; i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.'); i++ {
+			}
+			tokens = append(tokens, token{tokenNumber, string(runes[start:i]), start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for ; i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_'); i++ {
+			}
+			tokens = append(tokens, token{tokenIdentifier, string(runes[start:i]), start})
+		default:
+			return nil, &ExpressionError{Position: i, Message: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	at     int
+	depth  int
+	fields map[string]FieldType
+}
+
+// ParseExpression parses a filter and checks each comparison against the
+// fields it may use.
+func ParseExpression(input string, fields map[string]FieldType) (Expression, error) {
+	if len([]rune(input)) > MaxExpressionLength {
+		return nil, &ExpressionError{Position: MaxExpressionLength, Message: fmt.Sprintf("filter is longer than %d characters", MaxExpressionLength)}
+	}
+
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, fields: fields}
+	if p.peek().kind == tokenEOF {
+		return nil, &ExpressionError{Position: 0, Message: "filter is empty"}
+	}
+
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &ExpressionError{Position: t.position, Message: fmt.Sprintf(`expected "and", "or" or end of filter, found %s`, t.describe())}
+	}
+
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.at]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.at]
+	if t.kind != tokenEOF {
+		p.at++
+	}
+	return t
+}
+
+func (p *parser) or() (Expression, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("or") {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Expression, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("and") {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (Expression, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > MaxExpressionDepth {
+		return nil, &ExpressionError{Position: p.peek().position, Message: "filter is nested too deeply"}
+	}
+
+	t := p.peek()
+	switch {
+	case t.keyword("not"):
+		p.next()
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expression: expr}, nil
+	case t.kind == tokenOpen:
+		p.next()
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenClose {
+			return nil, &ExpressionError{Position: t.position, Message: fmt.Sprintf(`expected ")", found %s`, t.describe())}
+		}
+		return expr, nil
+	}
+
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expression, error) {
+	field := p.next()
+	if field.kind != tokenIdentifier {
+		return nil, &ExpressionError{Position: field.position, Message: fmt.Sprintf("expected a field name, found %s", field.describe())}
+	}
+	fieldType, ok := p.fields[field.text]
+	if !ok {
+		return nil, &ExpressionError{Field: field.text, Position: field.position, Message: "is not a field that can be filtered on"}
+	}
+
+	op := p.next()
+	negate := false
+	if op.keyword("not") {
+		negate = true
+		op = p.next()
+		if !op.keyword("in") {
+			return nil, &ExpressionError{Field: field.text, Position: op.position, Message: fmt.Sprintf(`expected "in", found %s`, op.describe())}
+		}
+	}
+
+	if op.keyword("in") {
+		values, err := p.list(field.text, fieldType)
+		if err != nil {
+			return nil, err
+		}
+		return In{Field: field.text, Values: values, Negate: negate}, nil
+	}
+
+	if op.kind != tokenOperator {
+		return nil, &ExpressionError{Field: field.text, Position: op.position, Message: fmt.Sprintf(`expected a comparison or "in", found %s`, op.describe())}
+	}
+	if fieldType == FieldString && op.text != "=" && op.text != "!=" {
+		return nil, &ExpressionError{Field: field.text, Position: op.position, Message: fmt.Sprintf("%s cannot be used on text, only = and !=", op.text)}
+	}
+
+	value, err := p.value(field.text, fieldType)
+	if err != nil {
+		return nil, err
+	}
+
+	return Comparison{Field: field.text, Operator: op.text, Value: value}, nil
+}
+
+func (p *parser) list(field string, fieldType FieldType) ([]interface{}, error) {
+	if t := p.next(); t.kind != tokenOpen {
+		return nil, &ExpressionError{Field: field, Position: t.position, Message: fmt.Sprintf(`expected "(", found %s`, t.describe())}
+	}
+
+	var values []interface{}
+	for {
+		value, err := p.value(field, fieldType)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		t := p.next()
+		if t.kind == tokenClose {
+			return values, nil
+		}
+		if t.kind != tokenComma {
+			return nil, &ExpressionError{Field: field, Position: t.position, Message: fmt.Sprintf(`expected "," or ")", found %s`, t.describe())}
+		}
+	}
+}
+
+var decimalValue = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)$`)
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// value reads a literal and converts it for the field's type.
+func (p *parser) value(field string, fieldType FieldType) (interface{}, error) {
+	t := p.next()
+	fail := func(message string) error {
+		return &ExpressionError{Field: field, Position: t.position, Message: message}
+	}
+
+	switch fieldType {
+	case FieldInteger:
+		if t.kind != tokenNumber {
+			return nil, fail(fmt.Sprintf("expected a whole number, found %s", t.describe()))
+		}
+		value, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fail(fmt.Sprintf("%s is not a whole number", t.describe()))
+		}
+		return value, nil
+	case FieldDecimal:
+		if t.kind != tokenNumber || !decimalValue.MatchString(t.text) {
+			return nil, fail(fmt.Sprintf("expected a number, found %s", t.describe()))
+		}
+		return strings.TrimPrefix(t.text, "+"), nil
+	case FieldTime:
+		if t.kind == tokenNumber {
+			value, err := strconv.ParseInt(t.text, 10, 64)
+			if err != nil {
+				return nil, fail(fmt.Sprintf("%s is not a unix time", t.describe()))
+			}
+			return time.Unix(value, 0).UTC(), nil
+		}
+		if t.kind == tokenString {
+			for _, layout := range timeLayouts {
+				value, err := time.Parse(layout, t.text)
+				if err == nil {
+					return value.UTC(), nil
+				}
+			}
+		}
+		return nil, fail(fmt.Sprintf(`expected a date such as "2020-04-25" or "2020-04-25T19:46:23Z", found %s`, t.describe()))
+	}
+
+	if t.kind != tokenString {
+		return nil, fail(fmt.Sprintf("expected a quoted string, found %s", t.describe()))
+	}
+	return t.text, nil
+}
@@ -0,0 +1,65 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expExpr Expression
+		expErr  *ExpressionError
+	}{
+		{
+			name:  "And binds tighter than or",
+			input: `currencyCode = 'ZAR' or amount > -1.5 AND not id in (1, 2)`,
+			expExpr: Or{
+				Left: Comparison{Field: "currencyCode", Operator: "=", Value: "ZAR"},
+				Right: And{
+					Left:  Comparison{Field: "amount", Operator: ">", Value: "-1.5"},
+					Right: Not{Expression: In{Field: "id", Values: []interface{}{int64(1), int64(2)}}},
+				},
+			},
+		},
+		{
+			name:  "Unix and ISO dates",
+			input: `dateTime >= 1587772800 and dateTime < "2020-04-26T00:00:00+02:00"`,
+			expExpr: And{
+				Left:  Comparison{Field: "dateTime", Operator: ">=", Value: time.Unix(1587772800, 0).UTC()},
+				Right: Comparison{Field: "dateTime", Operator: "<", Value: time.Date(2020, 4, 25, 22, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:   "Ordering text",
+			input:  `merchantName > "M"`,
+			expErr: &ExpressionError{Field: "merchantName", Position: 13, Message: "> cannot be used on text, only = and !="},
+		},
+		{
+			name:   "Trailing operator",
+			input:  `amount > 1 and`,
+			expErr: &ExpressionError{Position: 14, Message: "expected a field name, found end of filter"},
+		},
+		{
+			name:   "Unterminated string",
+			input:  `reference = "abc`,
+			expErr: &ExpressionError{Position: 12, Message: "unterminated string"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := ParseExpression(test.input, CardTransactionFields)
+			if test.expErr != nil {
+				assert.Equal(t, test.expErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expExpr, expr)
+		})
+	}
+}
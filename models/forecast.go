@@ -0,0 +1,192 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/statement"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// forecastLookbackDays is the number of days of card transactions that
+	// discretionary spend is averaged over.
+	forecastLookbackDays = 90
+	// forecastMaxDays bounds how far ahead a forecast may run.
+	forecastMaxDays = 366
+	// forecastMerchantLimit bounds the merchants summarised for the average.
+	forecastMerchantLimit = 10000
+)
+
+// Forecast projects the user's balance in one currency from today, in UTC,
+// to Until.  Income and payments are applied on their day of the month and
+// the average daily card spend of the last ninety days, excluding merchants
+// that are paid as recurring payments, is deducted every day.
+type Forecast struct {
+	CurrencyCode            string         `json:"currencyCode"`
+	From                    string         `json:"from"`
+	Until                   string         `json:"until"`
+	StartingBalance         CurrencyValue  `json:"startingBalance"`
+	DiscretionaryDailySpend CurrencyValue  `json:"discretionaryDailySpend"`
+	EndBalance              CurrencyValue  `json:"endBalance"`
+	Days                    []*ForecastDay `json:"days"`
+	serverState             *state.ServerState
+}
+
+// ForecastDay is one point of the projected balance.  The first day is today
+// and carries the starting balance unchanged.
+type ForecastDay struct {
+	Date          string        `json:"date"`
+	Income        CurrencyValue `json:"income"`
+	Payments      CurrencyValue `json:"payments"`
+	Discretionary CurrencyValue `json:"discretionary"`
+	Balance       CurrencyValue `json:"balance"`
+}
+
+func NewForecast(state *state.ServerState) *Forecast {
+	forecast := new(Forecast)
+	forecast.serverState = state
+	return forecast
+}
+
+// ForecastParameters are the inputs of a forecast as given in a request.
+// Balance defaults to zero and Until to the last day of the current month.
+type ForecastParameters struct {
+	Balance      string
+	CurrencyCode string
+	Until        string
+}
+
+func (p *ForecastParameters) validate(today time.Time) (int64, int, time.Time, error) {
+	p.CurrencyCode = strings.ToUpper(strings.TrimSpace(p.CurrencyCode))
+
+	var fields []types.ErrorField
+	var balance int64
+	scale := statement.MinimumScale
+	if len(p.Balance) > 0 {
+		var err error
+		balance, scale, err = statement.ParseAmount(p.Balance, false)
+		if err != nil || scale > maxCurrencyScale {
+			fields = append(fields, types.ErrorField{Name: "balance", Message: "must be an amount such as 1500.00"})
+		}
+	}
+	if !currencyCode.MatchString(p.CurrencyCode) {
+		fields = append(fields, types.ErrorField{Name: "currencyCode", Message: "must be a currency code such as ZAR"})
+	}
+	until := today.AddDate(0, 1, -today.Day())
+	if len(p.Until) > 0 {
+		var err error
+		until, err = time.Parse("2006-01-02", p.Until)
+		if err != nil || until.Before(today) || until.After(today.AddDate(0, 0, forecastMaxDays)) {
+			fields = append(fields, types.ErrorField{Name: "until", Message: "must be a date such as 2020-05-31 within a year from today"})
+		}
+	}
+	if len(fields) > 0 {
+		return 0, 0, time.Time{}, e.NewError("Forecast parameters are invalid", fields, http.StatusBadRequest)
+	}
+
+	return balance, scale, until, nil
+}
+
+// GetForecast projects the user's balance from now until the requested date.
+func (f *Forecast) GetForecast(userID int64, params ForecastParameters, now time.Time) (*Forecast, error) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	balance, balanceScale, until, err := params.validate(today)
+	if err != nil {
+		return nil, err
+	}
+	scale := balanceScale
+
+	dl := f.serverState.DataLayer
+	dbCashFlows, err := dl.GetCashFlowsByUserID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query cash flows from database", http.StatusInternalServerError, err)
+	}
+	var cashFlows []*datalayer.CashFlow
+	recurring := make(map[string]bool)
+	for _, cashFlow := range dbCashFlows {
+		if cashFlow.CurrencyCode != params.CurrencyCode {
+			continue
+		}
+		cashFlows = append(cashFlows, cashFlow)
+		scale = maxInt(scale, cashFlow.CurrencyScale)
+		if cashFlow.Kind == datalayer.CashFlowPayment && len(cashFlow.MerchantName) > 0 {
+			recurring[strings.ToLower(cashFlow.MerchantName)] = true
+		}
+	}
+
+	merchants, err := dl.GetMerchantSummaryByUserID(userID, now.AddDate(0, 0, -forecastLookbackDays), now, forecastMerchantLimit)
+	if err != nil {
+		return nil, e.Wrap("Failed to query merchant summary from database", http.StatusInternalServerError, err)
+	}
+	var spends []*datalayer.MerchantSummary
+	for _, merchant := range merchants {
+		if merchant.CurrencyCode != params.CurrencyCode || recurring[strings.ToLower(merchant.MerchantName)] {
+			continue
+		}
+		spends = append(spends, merchant)
+		scale = maxInt(scale, merchant.CurrencyScale)
+	}
+	var spend int64
+	for _, merchant := range spends {
+		spend += rescale(merchant.Amount, merchant.CurrencyScale, scale)
+	}
+
+	forecast := NewForecast(f.serverState)
+	forecast.CurrencyCode = params.CurrencyCode
+	forecast.From = today.Format("2006-01-02")
+	forecast.Until = until.Format("2006-01-02")
+	forecast.StartingBalance = CurrencyValue{Value: rescale(balance, balanceScale, scale), Scale: scale}
+	forecast.DiscretionaryDailySpend = CurrencyValue{Value: spend / forecastLookbackDays, Scale: scale}
+
+	current := forecast.StartingBalance.Value
+	forecast.Days = append(forecast.Days, &ForecastDay{
+		Date:          forecast.From,
+		Income:        CurrencyValue{Scale: scale},
+		Payments:      CurrencyValue{Scale: scale},
+		Discretionary: CurrencyValue{Scale: scale},
+		Balance:       CurrencyValue{Value: current, Scale: scale},
+	})
+	for n, day := int64(1), today.AddDate(0, 0, 1); !day.After(until); n, day = n+1, day.AddDate(0, 0, 1) {
+		var income, payments int64
+		lastDay := day.AddDate(0, 1, -day.Day()).Day()
+		for _, cashFlow := range cashFlows {
+			if minInt(cashFlow.DayOfMonth, lastDay) != day.Day() {
+				continue
+			}
+			amount := rescale(cashFlow.Amount, cashFlow.CurrencyScale, scale)
+			if cashFlow.Kind == datalayer.CashFlowIncome {
+				income += amount
+			} else {
+				payments += amount
+			}
+		}
+		// Spreading the running total rather than rounding each day keeps
+		// the remainder from being lost over a long forecast.
+		discretionary := spend*n/forecastLookbackDays - spend*(n-1)/forecastLookbackDays
+		current += income - payments - discretionary
+
+		forecast.Days = append(forecast.Days, &ForecastDay{
+			Date:          day.Format("2006-01-02"),
+			Income:        CurrencyValue{Value: income, Scale: scale},
+			Payments:      CurrencyValue{Value: payments, Scale: scale},
+			Discretionary: CurrencyValue{Value: discretionary, Scale: scale},
+			Balance:       CurrencyValue{Value: current, Scale: scale},
+		})
+	}
+	forecast.EndBalance = CurrencyValue{Value: current, Scale: scale}
+
+	return forecast, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
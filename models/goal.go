@@ -0,0 +1,221 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// maxCurrencyScale bounds the decimal places of goal and cash flow amounts.
+const maxCurrencyScale = 8
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Goal is an amount the user is saving towards, optionally by TargetDate.
+// Progress is the percentage saved so far and MonthlySavingRequired the
+// amount that must still be put away each month, counting the current one,
+// to reach the target in time.  Both are computed when the goal is read.
+type Goal struct {
+	datalayer.Model
+	Name                  string                 `json:"name"`
+	TargetAmount          CurrencyValue          `json:"targetAmount"`
+	SavedAmount           CurrencyValue          `json:"savedAmount"`
+	CurrencyCode          string                 `json:"currencyCode"`
+	TargetDate            datalayer.JsonNullTime `json:"targetDate"`
+	Progress              int                    `json:"progress"`
+	MonthlySavingRequired *CurrencyValue         `json:"monthlySavingRequired,omitempty"`
+	serverState           *state.ServerState
+}
+
+func NewGoal(state *state.ServerState) *Goal {
+	goal := new(Goal)
+	goal.serverState = state
+	return goal
+}
+
+func newFromDBGoal(goal *datalayer.Goal, now time.Time) *Goal {
+	g := new(Goal)
+	g.ID = goal.ID
+	g.CreatedAt = goal.CreatedAt
+	g.UpdatedAt = goal.UpdatedAt
+	g.DeletedAt = goal.DeletedAt
+	g.Name = goal.Name
+	g.TargetAmount = CurrencyValue{Value: goal.TargetAmount, Scale: goal.CurrencyScale}
+	g.SavedAmount = CurrencyValue{Value: goal.SavedAmount, Scale: goal.CurrencyScale}
+	g.CurrencyCode = goal.CurrencyCode
+	g.TargetDate = goal.TargetDate
+
+	if goal.TargetAmount > 0 {
+		g.Progress = int(minInt64(100, goal.SavedAmount*100/goal.TargetAmount))
+	}
+	if goal.TargetDate.Valid && !goal.TargetDate.Time.Before(now) {
+		target, from := goal.TargetDate.Time.UTC(), now.UTC()
+		months := int64((target.Year()-from.Year())*12 + int(target.Month()-from.Month()))
+		if months < 1 {
+			months = 1
+		}
+		remaining := goal.TargetAmount - goal.SavedAmount
+		if remaining < 0 {
+			remaining = 0
+		}
+		g.MonthlySavingRequired = &CurrencyValue{Value: (remaining + months - 1) / months, Scale: goal.CurrencyScale}
+	}
+
+	return g
+}
+
+func (g *Goal) convertToDB(userID int64) *datalayer.Goal {
+	scale := maxInt(g.TargetAmount.Scale, g.SavedAmount.Scale)
+	goal := new(datalayer.Goal)
+	goal.ID = g.ID
+	goal.UserID = userID
+	goal.Name = g.Name
+	goal.TargetAmount = rescale(g.TargetAmount.Value, g.TargetAmount.Scale, scale)
+	goal.SavedAmount = rescale(g.SavedAmount.Value, g.SavedAmount.Scale, scale)
+	goal.CurrencyScale = scale
+	goal.CurrencyCode = g.CurrencyCode
+	goal.TargetDate = g.TargetDate
+	return goal
+}
+
+func (g *Goal) validate() error {
+	g.Name = strings.TrimSpace(g.Name)
+	g.CurrencyCode = strings.ToUpper(strings.TrimSpace(g.CurrencyCode))
+
+	var fields []types.ErrorField
+	if len(g.Name) == 0 || len(g.Name) > 255 {
+		fields = append(fields, types.ErrorField{Name: "name", Message: "a name of up to 255 characters is required"})
+	}
+	if g.TargetAmount.Value <= 0 || g.TargetAmount.Scale < 0 || g.TargetAmount.Scale > maxCurrencyScale {
+		fields = append(fields, types.ErrorField{Name: "targetAmount", Message: "must be a positive amount"})
+	}
+	if g.SavedAmount.Value < 0 || g.SavedAmount.Scale < 0 || g.SavedAmount.Scale > maxCurrencyScale {
+		fields = append(fields, types.ErrorField{Name: "savedAmount", Message: "must not be negative"})
+	}
+	if !currencyCode.MatchString(g.CurrencyCode) {
+		fields = append(fields, types.ErrorField{Name: "currencyCode", Message: "must be a currency code such as ZAR"})
+	}
+	if len(fields) > 0 {
+		return e.NewError("Goal is invalid", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func (g *Goal) CreateGoal(userID int64) (*Goal, error) {
+	g.ID = 0
+	err := g.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	dl := g.serverState.DataLayer
+	id, err := dl.CreateGoal(g.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to store goal", http.StatusInternalServerError, err)
+	}
+
+	return g.GetGoal(userID, id)
+}
+
+// GetGoal looks up one of the user's goals.  Goals belonging to somebody
+// else are reported as not found.
+func (g *Goal) GetGoal(userID, id int64) (*Goal, error) {
+	dl := g.serverState.DataLayer
+	dbGoal, err := dl.GetGoalByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrGoalNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query goal [%d] from database", id), http.StatusInternalServerError, err)
+	}
+
+	if dbGoal.UserID != userID {
+		return nil, ErrGoalNotFound
+	}
+
+	goal := newFromDBGoal(dbGoal, time.Now())
+	goal.serverState = g.serverState
+	return goal, nil
+}
+
+func (g *Goal) GetGoalsByUserID(userID int64) ([]*Goal, error) {
+	dl := g.serverState.DataLayer
+	dbGoals, err := dl.GetGoalsByUserID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query goals from database", http.StatusInternalServerError, err)
+	}
+
+	now := time.Now()
+	goals := make([]*Goal, 0, len(dbGoals))
+	for _, goal := range dbGoals {
+		goals = append(goals, newFromDBGoal(goal, now))
+	}
+
+	return goals, nil
+}
+
+func (g *Goal) UpdateGoal(userID, id int64) (*Goal, error) {
+	_, err := g.GetGoal(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	g.ID = id
+	err = g.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	dl := g.serverState.DataLayer
+	err = dl.UpdateGoal(g.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to update goal", http.StatusInternalServerError, err)
+	}
+
+	return g.GetGoal(userID, id)
+}
+
+func (g *Goal) DeleteGoal(userID, id int64) error {
+	_, err := g.GetGoal(userID, id)
+	if err != nil {
+		return err
+	}
+
+	dl := g.serverState.DataLayer
+	err = dl.DeleteGoal(userID, id)
+	if err != nil {
+		return e.Wrap("Failed to delete goal", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// rescale converts a value from one number of decimal places to a larger
+// one.
+func rescale(value int64, from, to int) int64 {
+	for ; from < to; from++ {
+		value *= 10
+	}
+	return value
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,403 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/nonce"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// householdInvitationLifetime is how long an emailed invitation works for.
+const householdInvitationLifetime = 7 * 24 * time.Hour
+
+// Household is a group of users, such as partners, who may grant one another
+// read or read-write access to their card transactions.  The owner who
+// created it may remove members or delete it; anyone may leave it.
+type Household struct {
+	datalayer.Model
+	Name        string             `json:"name"`
+	OwnerUserID int64              `json:"ownerUserID"`
+	Members     []*HouseholdMember `json:"members"`
+	Grants      []*HouseholdGrant  `json:"grants"`
+	serverState *state.ServerState
+}
+
+type HouseholdMember struct {
+	UserID   int64                  `json:"userID"`
+	Email    string                 `json:"email"`
+	JoinedAt datalayer.JsonNullTime `json:"joinedAt"`
+}
+
+// HouseholdGrant lets the grantee read, or read and write, the grantor's
+// card transactions.
+type HouseholdGrant struct {
+	GrantorUserID int64                     `json:"grantorUserID"`
+	GranteeUserID int64                     `json:"granteeUserID"`
+	Access        datalayer.HouseholdAccess `json:"access"`
+}
+
+func NewHousehold(state *state.ServerState) *Household {
+	household := new(Household)
+	household.serverState = state
+	return household
+}
+
+func (h *Household) validate() error {
+	h.Name = strings.TrimSpace(h.Name)
+	if len(h.Name) == 0 || len(h.Name) > 255 {
+		return e.NewError("Household is invalid", []types.ErrorField{
+			{Name: "name", Message: "a name of up to 255 characters is required"},
+		}, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// load fills in the household's members and grants.
+func (h *Household) load(household *datalayer.Household) error {
+	h.ID = household.ID
+	h.CreatedAt = household.CreatedAt
+	h.UpdatedAt = household.UpdatedAt
+	h.DeletedAt = household.DeletedAt
+	h.Name = household.Name
+	h.OwnerUserID = household.OwnerUserID
+
+	dl := h.serverState.DataLayer
+	members, err := dl.GetHouseholdMembers(household.ID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query members of household [%d] from database", household.ID), http.StatusInternalServerError, err)
+	}
+	h.Members = make([]*HouseholdMember, 0, len(members))
+	for _, member := range members {
+		h.Members = append(h.Members, &HouseholdMember{
+			UserID:   member.UserID,
+			Email:    member.Email,
+			JoinedAt: member.CreatedAt,
+		})
+	}
+
+	grants, err := dl.GetHouseholdGrantsByHouseholdID(household.ID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query grants of household [%d] from database", household.ID), http.StatusInternalServerError, err)
+	}
+	h.Grants = make([]*HouseholdGrant, 0, len(grants))
+	for _, grant := range grants {
+		h.Grants = append(h.Grants, &HouseholdGrant{
+			GrantorUserID: grant.GrantorUserID,
+			GranteeUserID: grant.GranteeUserID,
+			Access:        grant.Access,
+		})
+	}
+
+	return nil
+}
+
+func (h *Household) isMember(userID int64) bool {
+	for _, member := range h.Members {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Household) CreateHousehold(userID int64) (*Household, error) {
+	err := h.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	dl := h.serverState.DataLayer
+	id, err := dl.CreateHousehold(&datalayer.Household{Name: h.Name, OwnerUserID: userID})
+	if err != nil {
+		return nil, e.Wrap("Failed to store household", http.StatusInternalServerError, err)
+	}
+
+	return h.GetHousehold(userID, id)
+}
+
+// GetHousehold looks up one of the user's households.  Households the user
+// is not a member of are reported as not found.
+func (h *Household) GetHousehold(userID, id int64) (*Household, error) {
+	dl := h.serverState.DataLayer
+	dbHousehold, err := dl.GetHouseholdByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrHouseholdNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query household [%d] from database", id), http.StatusInternalServerError, err)
+	}
+
+	household := NewHousehold(h.serverState)
+	err = household.load(dbHousehold)
+	if err != nil {
+		return nil, err
+	}
+	if !household.isMember(userID) {
+		return nil, ErrHouseholdNotFound
+	}
+
+	return household, nil
+}
+
+func (h *Household) GetHouseholdsByUserID(userID int64) ([]*Household, error) {
+	dl := h.serverState.DataLayer
+	dbHouseholds, err := dl.GetHouseholdsByUserID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query households from database", http.StatusInternalServerError, err)
+	}
+
+	households := make([]*Household, 0, len(dbHouseholds))
+	for _, dbHousehold := range dbHouseholds {
+		household := NewHousehold(h.serverState)
+		err = household.load(dbHousehold)
+		if err != nil {
+			return nil, err
+		}
+		households = append(households, household)
+	}
+
+	return households, nil
+}
+
+// DeleteHousehold removes the household, its members and their grants.
+// Only the owner may delete it.
+func (h *Household) DeleteHousehold(userID, id int64) error {
+	household, err := h.GetHousehold(userID, id)
+	if err != nil {
+		return err
+	}
+	if household.OwnerUserID != userID {
+		return ErrHouseholdOwnerOnly
+	}
+
+	dl := h.serverState.DataLayer
+	err = dl.DeleteHousehold(id)
+	if err != nil {
+		return e.Wrap("Failed to delete household", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// Invite emails an invitation to join the household.  Whoever signs in with
+// that email address may accept it within a week.  Only a hash of the
+// invitation's token is kept.
+func (h *Household) Invite(userID, id int64, email string) error {
+	household, err := h.GetHousehold(userID, id)
+	if err != nil {
+		return err
+	}
+
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") || len(email) > 255 {
+		return ErrValidationEmail
+	}
+
+	secret, err := nonce.GenerateSecret(32)
+	if err != nil {
+		return e.Wrap("Failed to generate invitation", http.StatusInternalServerError, err)
+	}
+
+	dl := h.serverState.DataLayer
+	_, err = dl.CreateHouseholdInvitation(&datalayer.HouseholdInvitation{
+		HouseholdID:     id,
+		InvitedByUserID: userID,
+		Email:           email,
+		TokenHash:       hashToken(secret),
+		ExpiresAt:       time.Now().UTC().Add(householdInvitationLifetime),
+	})
+	if err != nil {
+		return e.Wrap("Failed to store household invitation", http.StatusInternalServerError, err)
+	}
+
+	var inviter string
+	for _, member := range household.Members {
+		if member.UserID == userID {
+			inviter = member.Email
+		}
+	}
+	body := fmt.Sprintf("Hello %s,\n%s has invited you to join the household %q so that you can share card "+
+		"transactions.  Sign in and accept the invitation within a week at %s/household-invitation?token=%s", email,
+		inviter, household.Name, h.serverState.URL, url.QueryEscape(secret))
+	err = h.serverState.Providers.Email.SendMail([]string{email}, "noreply@someapp.com", "You have been invited to join "+household.Name, body)
+	if err != nil {
+		return e.Wrap("Failed to send household invitation", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// AcceptInvitation adds the user to the household they were invited to.
+// Invitations sent to another email address are reported as not found.
+func (h *Household) AcceptInvitation(userID int64, token string) (*Household, error) {
+	dl := h.serverState.DataLayer
+	invitation, err := dl.GetHouseholdInvitationByTokenHash(hashToken(token))
+	if err == datalayer.ErrNoData {
+		return nil, ErrHouseholdInvitationNotFound
+	} else if err != nil {
+		return nil, e.Wrap("Failed to query household invitation from database", http.StatusInternalServerError, err)
+	}
+
+	user, err := dl.GetUserByID(userID)
+	if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", userID), http.StatusInternalServerError, err)
+	}
+	if !strings.EqualFold(user.Email.String, invitation.Email) {
+		return nil, ErrHouseholdInvitationNotFound
+	}
+	now := time.Now().UTC()
+	if invitation.AcceptedAt.Valid {
+		return nil, ErrHouseholdInvitationAccepted
+	} else if !invitation.ExpiresAt.After(now) {
+		return nil, ErrHouseholdInvitationExpired
+	}
+
+	accepted, err := dl.AcceptHouseholdInvitation(invitation, userID, now)
+	if err != nil {
+		return nil, e.Wrap("Failed to accept household invitation", http.StatusInternalServerError, err)
+	}
+	if !accepted {
+		return nil, ErrHouseholdInvitationAccepted
+	}
+
+	return h.GetHousehold(userID, invitation.HouseholdID)
+}
+
+// RemoveMember takes a member out of the household, withdrawing every grant
+// they gave or were given in it.  Members may remove themselves; the owner
+// may remove anyone but themselves.
+func (h *Household) RemoveMember(userID, id, memberID int64) error {
+	household, err := h.GetHousehold(userID, id)
+	if err != nil {
+		return err
+	}
+	if memberID != userID && household.OwnerUserID != userID {
+		return ErrHouseholdOwnerOnly
+	}
+	if memberID == household.OwnerUserID {
+		return e.NewError("The household owner cannot leave it", []types.ErrorField{
+			{Name: "userID", Message: "delete the household instead"},
+		}, http.StatusBadRequest)
+	}
+	if !household.isMember(memberID) {
+		return ErrHouseholdMemberNotFound
+	}
+
+	dl := h.serverState.DataLayer
+	err = dl.RemoveHouseholdMember(id, memberID)
+	if err != nil {
+		return e.Wrap("Failed to remove household member", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// SetGrant gives another member of the household access to the user's card
+// transactions, or with HouseholdAccessNone takes it away.
+func (h *Household) SetGrant(userID, id, granteeID int64, access datalayer.HouseholdAccess) (*Household, error) {
+	household, err := h.GetHousehold(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if granteeID == userID || !household.isMember(granteeID) {
+		return nil, ErrHouseholdMemberNotFound
+	}
+
+	access = datalayer.HouseholdAccess(strings.ToUpper(strings.TrimSpace(string(access))))
+	switch access {
+	case datalayer.HouseholdAccessNone, datalayer.HouseholdAccessRead, datalayer.HouseholdAccessReadWrite:
+	default:
+		return nil, e.NewError("Household grant is invalid", []types.ErrorField{
+			{Name: "access", Message: "must be NONE, READ or READ_WRITE"},
+		}, http.StatusBadRequest)
+	}
+
+	dl := h.serverState.DataLayer
+	err = dl.SetHouseholdGrant(&datalayer.HouseholdGrant{
+		HouseholdID:   id,
+		GrantorUserID: userID,
+		GranteeUserID: granteeID,
+		Access:        access,
+	})
+	if err != nil {
+		return nil, e.Wrap("Failed to store household grant", http.StatusInternalServerError, err)
+	}
+
+	return h.GetHousehold(userID, id)
+}
+
+// CardTransactionAccess returns how much of the owner's card transactions
+// the user may see.  Users have full access to their own.
+func CardTransactionAccess(state *state.ServerState, userID, ownerID int64) (datalayer.HouseholdAccess, error) {
+	if userID == ownerID {
+		return datalayer.HouseholdAccessReadWrite, nil
+	}
+
+	grants, err := state.DataLayer.GetHouseholdGrantsByGranteeID(userID)
+	if err != nil {
+		return datalayer.HouseholdAccessNone, e.Wrap("Failed to query household grants from database", http.StatusInternalServerError, err)
+	}
+
+	access := datalayer.HouseholdAccessNone
+	for _, grant := range grants {
+		if grant.GrantorUserID != ownerID {
+			continue
+		}
+		if grant.Access == datalayer.HouseholdAccessReadWrite || access == datalayer.HouseholdAccessNone {
+			access = grant.Access
+		}
+	}
+
+	return access, nil
+}
+
+// sharesHousehold reports whether the two users are members of a household
+// together.
+func sharesHousehold(state *state.ServerState, userID, otherID int64) (bool, error) {
+	dl := state.DataLayer
+	households, err := dl.GetHouseholdsByUserID(userID)
+	if err != nil {
+		return false, e.Wrap("Failed to query households from database", http.StatusInternalServerError, err)
+	}
+
+	for _, household := range households {
+		members, err := dl.GetHouseholdMembers(household.ID)
+		if err != nil {
+			return false, e.Wrap(fmt.Sprintf("Failed to query members of household [%d] from database", household.ID), http.StatusInternalServerError, err)
+		}
+		for _, member := range members {
+			if member.UserID == otherID {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// readableOwners returns the user followed by everybody who has granted
+// them access to their card transactions.
+func readableOwners(state *state.ServerState, userID int64) ([]int64, error) {
+	grants, err := state.DataLayer.GetHouseholdGrantsByGranteeID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query household grants from database", http.StatusInternalServerError, err)
+	}
+
+	owners := []int64{userID}
+	seen := map[int64]bool{userID: true}
+	for _, grant := range grants {
+		if !seen[grant.GrantorUserID] {
+			seen[grant.GrantorUserID] = true
+			owners = append(owners, grant.GrantorUserID)
+		}
+	}
+
+	return owners, nil
+}
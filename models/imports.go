@@ -0,0 +1,206 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/statement"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// importPreviewLimit caps the number of transactions echoed back by a dry run.
+const importPreviewLimit = 100
+
+// importErrorLimit caps the number of row errors reported for one import.
+const importErrorLimit = 500
+
+type ImportRowError struct {
+	Row    int                `json:"row"`
+	Fields []types.ErrorField `json:"fields"`
+}
+
+type Import struct {
+	serverState  *state.ServerState
+	Format       statement.Format   `json:"format"`
+	DryRun       bool               `json:"dryRun"`
+	CurrencyCode string             `json:"currencyCode,omitempty"`
+	Parsed       int                `json:"parsed"`
+	Imported     int                `json:"imported"`
+	Duplicates   int                `json:"duplicates"`
+	Failed       int                `json:"failed"`
+	Errors       []ImportRowError   `json:"errors"`
+	Preview      []*CardTransaction `json:"preview,omitempty"`
+}
+
+func NewImport(state *state.ServerState) *Import {
+	i := new(Import)
+	i.serverState = state
+	i.Errors = make([]ImportRowError, 0)
+	return i
+}
+
+func (i *Import) addRowError(row int, fields []types.ErrorField) {
+	i.Failed++
+	if len(i.Errors) < importErrorLimit {
+		i.Errors = append(i.Errors, ImportRowError{Row: row, Fields: fields})
+	}
+}
+
+// Run reads every transaction from the statement and stores those that are
+// valid and not already on record for the user, all in one database
+// transaction.  A dry run only reports what would be imported.
+func (i *Import) Run(userID int64, reader statement.Reader) error {
+	dl := i.serverState.DataLayer
+	seen := make(map[string]bool)
+	var pending []*CardTransaction
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if rowErr, ok := err.(*statement.RowError); ok {
+			fields := make([]types.ErrorField, 0, len(rowErr.Fields))
+			for _, f := range rowErr.Fields {
+				fields = append(fields, types.ErrorField{Name: f.Field, Message: f.Message})
+			}
+			i.addRowError(rowErr.Row, fields)
+			continue
+		} else if err != nil {
+			return e.NewError("Statement could not be read", []types.ErrorField{
+				{Name: "file", Message: err.Error()},
+			}, http.StatusBadRequest)
+		}
+		i.Parsed++
+
+		cardTransaction := i.newCardTransaction(userID, record)
+		fields := cardTransaction.validateImport()
+		if len(fields) > 0 {
+			i.addRowError(record.Row, fields)
+			continue
+		}
+
+		key := fmt.Sprintf("%d|%d|%s|%s", cardTransaction.DateTime.Unix(), cardTransaction.Amount.Value,
+			cardTransaction.MerchantName, cardTransaction.Reference)
+		if seen[key] {
+			i.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		exists, err := dl.CardTransactionExists(userID, cardTransaction.DateTime, cardTransaction.Amount.Value,
+			cardTransaction.MerchantName, cardTransaction.Reference)
+		if err != nil {
+			return e.Wrap("Failed to check for duplicate card transactions", http.StatusInternalServerError, err)
+		}
+		if exists {
+			i.Duplicates++
+			continue
+		}
+
+		if i.DryRun {
+			if len(i.Preview) < importPreviewLimit {
+				i.Preview = append(i.Preview, cardTransaction)
+			}
+			i.Imported++
+			continue
+		}
+
+		pending = append(pending, cardTransaction)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	records := make([]*datalayer.CardTransaction, len(pending))
+	for n, cardTransaction := range pending {
+		records[n] = cardTransaction.convertToDB()
+	}
+	err := dl.CreateCardTransactions(records)
+	if err != nil {
+		return e.Wrap("Failed to store card transactions", http.StatusInternalServerError, err)
+	}
+
+	for n, cardTransaction := range pending {
+		cardTransaction.ID = records[n].ID
+		cardTransaction.publishCreated()
+	}
+	i.Imported = len(pending)
+
+	return nil
+}
+
+// newCardTransaction maps a statement entry onto a card transaction.  Card
+// transactions record spend as a positive amount, the opposite of a statement.
+func (i *Import) newCardTransaction(userID int64, record *statement.Transaction) *CardTransaction {
+	c := new(CardTransaction)
+	c.serverState = i.serverState
+	c.UserID = userID
+	c.DateTime = record.DateTime.UTC()
+	c.Amount.Value = -record.Amount
+	c.Amount.Scale = record.Scale
+	c.CurrencyCode = strings.ToUpper(record.CurrencyCode)
+	if len(c.CurrencyCode) == 0 {
+		c.CurrencyCode = strings.ToUpper(i.CurrencyCode)
+	}
+	c.Reference = record.Reference
+	c.MerchantName = record.MerchantName
+	c.MerchantCity = record.MerchantCity
+	c.MerchantCountryCode = record.MerchantCountryCode
+	c.MerchantCountryName = record.MerchantCountryName
+	c.MerchantCategoryCode = record.MerchantCategoryCode
+	c.MerchantCategoryName = record.MerchantCategoryName
+	return c
+}
+
+func (c *CardTransaction) validateImport() []types.ErrorField {
+	var fields []types.ErrorField
+	if len(c.CurrencyCode) != 3 {
+		fields = append(fields, types.ErrorField{Name: "currencyCode", Message: "a three letter currency code is required"})
+	}
+	if len(c.MerchantName) == 0 {
+		fields = append(fields, types.ErrorField{Name: "merchantName", Message: "merchant name is required"})
+	}
+	if c.Amount.Value == 0 {
+		fields = append(fields, types.ErrorField{Name: "amount", Message: "amount must not be zero"})
+	}
+
+	return fields
+}
+
+// ParseImportFormat resolves the statement format from an explicit value or,
+// failing that, the uploaded file's extension.
+func ParseImportFormat(format, fileName string) (statement.Format, error) {
+	if len(format) == 0 {
+		dot := strings.LastIndex(fileName, ".")
+		if dot >= 0 {
+			format = fileName[dot+1:]
+		}
+	}
+
+	switch f := statement.Format(strings.ToLower(format)); f {
+	case statement.FormatCSV, statement.FormatOFX, statement.FormatQIF:
+		return f, nil
+	}
+
+	return "", e.NewError("Unsupported statement format", []types.ErrorField{
+		{Name: "format", Message: "format must be one of csv, ofx or qif"},
+	}, http.StatusBadRequest)
+}
+
+// OpenStatement wraps the upload in a reader for the import's format.
+func (i *Import) OpenStatement(r io.Reader, mapping statement.ColumnMapping) (statement.Reader, error) {
+	reader, err := statement.NewReader(i.Format, r, mapping, i.CurrencyCode)
+	if err != nil {
+		return nil, e.NewError("Statement could not be read", []types.ErrorField{
+			{Name: "file", Message: err.Error()},
+		}, http.StatusBadRequest)
+	}
+
+	return reader, nil
+}
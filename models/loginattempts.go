@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// LockoutNoticeQueue is the number of lockout emails that may wait to be
+// sent.  Notices beyond it are dropped rather than hold up logins.
+const LockoutNoticeQueue = 100
+
+// checkLoginAttempts refuses a login as email from ip while failed logins of
+// the account or the address hold it back.
+func checkLoginAttempts(state *state.ServerState, email, ip string) error {
+	wait, err := state.LoginAttempts.Wait(email, ip)
+	if err != nil {
+		return e.Wrap("Failed to check login attempts", http.StatusInternalServerError, err)
+	} else if wait <= 0 {
+		return nil
+	}
+
+	seconds := int64(math.Ceil(wait.Seconds()))
+	return e.NewError(fmt.Sprintf("Too many failed login attempts, try again in %d seconds", seconds), []types.ErrorField{
+		{Name: "retryAfter", Message: strconv.FormatInt(seconds, 10)},
+	}, http.StatusTooManyRequests)
+}
+
+// failLogin counts a failed login as email from ip, and queues a notice to
+// the account's owner if it locked them out.  Failing to count only loses
+// the count, so it does not change the answer to the login.
+func failLogin(state *state.ServerState, email, ip string) {
+	locked, err := state.LoginAttempts.Fail(email, ip)
+	if err != nil {
+		state.Logger.Printf("Failed to count failed login: %v", err)
+		return
+	} else if !locked {
+		return
+	}
+
+	select {
+	case state.Channels.Lockouts <- email:
+	default:
+		state.Logger.Print("lockout notice queue is full, dropping notice")
+	}
+}
+
+// succeedLogin forgets the failed logins of the account.
+func succeedLogin(state *state.ServerState, email string) {
+	err := state.LoginAttempts.Succeed(email)
+	if err != nil {
+		state.Logger.Printf("Failed to reset failed logins: %v", err)
+	}
+}
+
+// SendLockoutNotice tells the owner of the account with the address, if
+// there is one, that failed logins have locked it out.
+func SendLockoutNotice(state *state.ServerState, email string) error {
+	dbUser, err := state.DataLayer.GetUserByEmail(email)
+	if err == datalayer.ErrNoData {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	until, locked, err := state.LoginAttempts.Locked(email)
+	if err != nil || !locked {
+		return err
+	}
+
+	to := []string{dbUser.Email.String}
+	from := "noreply@someapp.com"
+	message := fmt.Sprintf("Hello %s,\n Your account has been locked until %s after too many failed logins.  "+
+		"If they were not you, somebody may be guessing your password: reset it once the lock ends, "+
+		"or ask an administrator to unlock your account.",
+		dbUser.Email.String, until.UTC().Format(time.RFC1123))
+
+	return state.Providers.Email.SendMail(to, from, "Your account has been locked", message)
+}
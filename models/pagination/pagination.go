@@ -173,4 +173,10 @@ func (p *Parameters) BuildPagination(sortColumn string) string {
 	}
 	offset = copy.Page.Value * copy.FetchCount.Value
 	return fmt.Sprintf(" order by %s %s, id %s limit %d, %d", sortColumn, p.SortDir, p.SortDir, offset, copy.FetchCount.Value)
-}
\ No newline at end of file
+}
+
+// BuildOrdering returns only the order by clause of BuildPagination, for
+// queries that read every matching row.
+func (p *Parameters) BuildOrdering(sortColumn string) string {
+	return fmt.Sprintf(" order by %s %s, id %s", sortColumn, p.SortDir, p.SortDir)
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/lib/nonce"
+	"github.com/donohutcheon/gowebserver/state"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PasswordResetQueue is the number of requested resets that may wait to
+	// be sent.  Requests beyond it are dropped rather than held up.
+	PasswordResetQueue = 100
+	// passwordResetLifetime is how long an emailed link works for.
+	passwordResetLifetime = time.Hour
+	// passwordResetInterval is the least time between two emails to the same
+	// user, so that the form cannot be used to flood somebody's inbox.
+	passwordResetInterval = time.Minute
+)
+
+// RequestPasswordReset queues a password reset email for the address.  It
+// behaves the same whether or not the address has an account, and leaves the
+// lookup and the email to SendPasswordReset, so that neither the response
+// nor its timing gives away who has one.
+func RequestPasswordReset(state *state.ServerState, email string) error {
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return ErrValidationEmail
+	}
+
+	select {
+	case state.Channels.PasswordResets <- email:
+	default:
+		state.Logger.Print("password reset queue is full, dropping request")
+	}
+
+	return nil
+}
+
+// SendPasswordReset emails a reset link to the user with the address, if
+// there is one whose account is confirmed.
+func SendPasswordReset(state *state.ServerState, email string, now time.Time) error {
+	dl := state.DataLayer
+	dbUser, err := dl.GetUserByEmail(email)
+	if err == datalayer.ErrNoData {
+		return nil
+	} else if err != nil {
+		return err
+	} else if datalayer.UserState(dbUser.State.String) != datalayer.UserStateConfirmed {
+		return nil
+	}
+
+	latest, err := dl.GetLatestPasswordResetByUserID(dbUser.ID)
+	if err != nil && err != datalayer.ErrNoData {
+		return err
+	} else if err == nil && latest.CreatedAt.Valid && now.Sub(latest.CreatedAt.Time) < passwordResetInterval {
+		return nil
+	}
+
+	token, err := nonce.GenerateSecret(32)
+	if err != nil {
+		return err
+	}
+	_, err = dl.CreatePasswordReset(&datalayer.PasswordReset{
+		UserID:    dbUser.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(passwordResetLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	to := []string{dbUser.Email.String}
+	from := "noreply@someapp.com"
+	message := fmt.Sprintf("Hello %s,\n Somebody asked to reset the password of your account.  If it was you, "+
+		"choose a new password within the hour by following this link %s/reset-password?token=%s\n"+
+		"If it was not you, you can ignore this email.", dbUser.Email.String, state.URL, url.QueryEscape(token))
+
+	return state.Providers.Email.SendMail(to, from, "Reset your password", message)
+}
+
+// ResetPassword sets a new password using an emailed reset token.  Each
+// token works once, and every session and API token the user held is
+// revoked, in case the old password was known to somebody else.  Unknown,
+// used and expired tokens are refused alike.
+func ResetPassword(state *state.ServerState, token, password string) error {
+	if len(password) < 6 {
+		return ErrValidationPassword
+	}
+
+	dl := state.DataLayer
+	reset, err := dl.GetPasswordResetByTokenHash(hashToken(token))
+	if err == datalayer.ErrNoData {
+		return ErrPasswordResetInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to query password reset from database", http.StatusInternalServerError, err)
+	}
+
+	dbUser, err := dl.GetUserByID(reset.UserID)
+	if err == datalayer.ErrNoData {
+		return ErrPasswordResetInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to query user from database", http.StatusInternalServerError, err)
+	} else if datalayer.UserState(dbUser.State.String) == datalayer.UserStateDisabled {
+		return ErrPasswordResetInvalid
+	}
+
+	used, err := dl.UsePasswordReset(reset.ID, time.Now())
+	if err != nil {
+		return e.Wrap("Failed to use password reset", http.StatusInternalServerError, err)
+	} else if !used {
+		return ErrPasswordResetInvalid
+	}
+
+	err = setPassword(state, dbUser, password)
+	if err != nil {
+		return err
+	}
+
+	err = dl.DeletePasswordResetsByUserID(dbUser.ID)
+	if err != nil {
+		state.Logger.Printf("Failed to delete password resets of user [%d]: %v", dbUser.ID, err)
+	}
+
+	return nil
+}
+
+// setPassword stores the user's new password, revokes every token they
+// were issued before and tells their subscribers.
+func setPassword(state *state.ServerState, dbUser *datalayer.User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return e.Wrap("Failed to hash password", http.StatusInternalServerError, err)
+	}
+
+	err = state.DataLayer.SetUserPasswordByID(dbUser.ID, string(hashedPassword))
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to set password of user [%d]", dbUser.ID), http.StatusInternalServerError, err)
+	}
+
+	err = state.Revocations.RevokeAll(dbUser.ID)
+	if err != nil {
+		return e.Wrap("Failed to revoke tokens", http.StatusInternalServerError, err)
+	}
+	publishAccountEvent(state, events.UserPasswordChanged, dbUser.ID, dbUser.Email.String)
+
+	return nil
+}
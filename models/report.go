@@ -0,0 +1,398 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/statement"
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// reportHour is the local hour at which reports are sent.
+	reportHour = 8
+	// reportTopCount is the number of merchants and transactions listed.
+	reportTopCount = 5
+)
+
+// ReportPreferences choose whether the user is emailed a spend report every
+// week, sent on Monday morning for the week before, or every month, sent on
+// the first for the month before.  Reports are sent at eight in the morning
+// in the user's timezone.
+type ReportPreferences struct {
+	Cadence      datalayer.ReportCadence `json:"cadence"`
+	Timezone     string                  `json:"timezone"`
+	NextReportAt datalayer.JsonNullTime  `json:"nextReportAt"`
+	LastSentAt   datalayer.JsonNullTime  `json:"lastSentAt"`
+	serverState  *state.ServerState
+}
+
+// Report is a summary of the user's spend over a period.  Amounts are
+// formatted for display.
+type Report struct {
+	Cadence      string
+	Period       string
+	Totals       []ReportLine
+	Categories   []ReportLine
+	Merchants    []ReportLine
+	Transactions []ReportLine
+	URL          string
+}
+
+// ReportLine is one row of a report section.
+type ReportLine struct {
+	Name             string
+	Amount           string
+	TransactionCount int64
+}
+
+func NewReportPreferences(state *state.ServerState) *ReportPreferences {
+	preferences := new(ReportPreferences)
+	preferences.serverState = state
+	return preferences
+}
+
+func (p *ReportPreferences) validate() error {
+	p.Cadence = datalayer.ReportCadence(strings.ToUpper(strings.TrimSpace(string(p.Cadence))))
+	p.Timezone = strings.TrimSpace(p.Timezone)
+	if len(p.Cadence) == 0 {
+		p.Cadence = datalayer.ReportCadenceNone
+	}
+	if len(p.Timezone) == 0 {
+		p.Timezone = "UTC"
+	}
+
+	var fields []types.ErrorField
+	switch p.Cadence {
+	case datalayer.ReportCadenceNone, datalayer.ReportCadenceWeekly, datalayer.ReportCadenceMonthly:
+	default:
+		fields = append(fields, types.ErrorField{Name: "cadence", Message: "must be NONE, WEEKLY or MONTHLY"})
+	}
+	_, err := time.LoadLocation(p.Timezone)
+	if err != nil || p.Timezone == "Local" || len(p.Timezone) > 64 {
+		fields = append(fields, types.ErrorField{Name: "timezone", Message: "must be a timezone such as Africa/Johannesburg"})
+	}
+	if len(fields) > 0 {
+		return e.NewError("Report preferences are invalid", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// GetReportPreferences returns the user's preferences.  Users who have not
+// chosen are not sent reports.
+func (p *ReportPreferences) GetReportPreferences(userID int64) (*ReportPreferences, error) {
+	dl := p.serverState.DataLayer
+	preference, err := dl.GetReportPreferenceByUserID(userID)
+	if err == datalayer.ErrNoData {
+		preferences := NewReportPreferences(p.serverState)
+		preferences.Cadence = datalayer.ReportCadenceNone
+		preferences.Timezone = "UTC"
+		return preferences, nil
+	} else if err != nil {
+		return nil, e.Wrap("Failed to query report preferences from database", http.StatusInternalServerError, err)
+	}
+
+	preferences := NewReportPreferences(p.serverState)
+	preferences.Cadence = preference.Cadence
+	preferences.Timezone = preference.Timezone
+	preferences.NextReportAt = preference.NextReportAt
+	preferences.LastSentAt = preference.LastSentAt
+	return preferences, nil
+}
+
+// UpdateReportPreferences stores the user's preferences and schedules their
+// next report.
+func (p *ReportPreferences) UpdateReportPreferences(userID int64) (*ReportPreferences, error) {
+	err := p.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	preference := &datalayer.ReportPreference{
+		UserID:   userID,
+		Cadence:  p.Cadence,
+		Timezone: p.Timezone,
+	}
+	if p.Cadence != datalayer.ReportCadenceNone {
+		loc, _ := time.LoadLocation(p.Timezone)
+		preference.NextReportAt.Time = nextReportTime(p.Cadence, loc, time.Now().UTC())
+		preference.NextReportAt.Valid = true
+	}
+
+	dl := p.serverState.DataLayer
+	_, err = dl.GetReportPreferenceByUserID(userID)
+	if err == datalayer.ErrNoData {
+		_, err = dl.CreateReportPreference(preference)
+	} else if err == nil {
+		err = dl.UpdateReportPreference(preference)
+	}
+	if err != nil {
+		return nil, e.Wrap("Failed to store report preferences", http.StatusInternalServerError, err)
+	}
+
+	return p.GetReportPreferences(userID)
+}
+
+// nextReportTime returns when the first report due strictly after the given
+// time is sent.
+func nextReportTime(cadence datalayer.ReportCadence, loc *time.Location, after time.Time) time.Time {
+	local := after.In(loc)
+	var next time.Time
+	switch cadence {
+	case datalayer.ReportCadenceWeekly:
+		days := (int(time.Monday) - int(local.Weekday()) + 7) % 7
+		next = time.Date(local.Year(), local.Month(), local.Day()+days, reportHour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+	case datalayer.ReportCadenceMonthly:
+		next = time.Date(local.Year(), local.Month(), 1, reportHour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 1, 0)
+		}
+	}
+
+	return next.UTC()
+}
+
+// reportPeriod returns the local midnights that bound the period covered by
+// the latest report sent before next.
+func reportPeriod(cadence datalayer.ReportCadence, loc *time.Location, next time.Time) (time.Time, time.Time) {
+	local := next.In(loc)
+	if cadence == datalayer.ReportCadenceMonthly {
+		to := time.Date(local.Year(), local.Month()-1, 1, 0, 0, 0, 0, loc)
+		return to.AddDate(0, -1, 0), to
+	}
+
+	to := time.Date(local.Year(), local.Month(), local.Day()-7, 0, 0, 0, 0, loc)
+	return to.AddDate(0, 0, -7), to
+}
+
+// SendDueReports emails every report that is due.  Each report is claimed
+// before it is sent so that servers sharing a database send it once, and a
+// user whose reports were missed while the server was down is sent only
+// the latest.  A report that cannot be sent is released to be sent on a
+// later run, and the others are still sent.
+func SendDueReports(state *state.ServerState, now time.Time) (int, error) {
+	dl := state.DataLayer
+	preferences, err := dl.GetDueReportPreferences(now, 100)
+	if err != nil {
+		return 0, e.Wrap("Failed to query due reports", http.StatusInternalServerError, err)
+	}
+
+	sent := 0
+	for _, preference := range preferences {
+		loc, err := time.LoadLocation(preference.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+
+		scheduledAt := preference.NextReportAt.Time
+		next := nextReportTime(preference.Cadence, loc, now)
+		claimed, err := dl.ClaimReport(preference.ID, scheduledAt, next)
+		if err != nil {
+			state.Logger.Printf("failed to claim report [%d]: %v", preference.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		from, to := reportPeriod(preference.Cadence, loc, next)
+		err = sendReport(state, preference.UserID, preference.Cadence, from, to)
+		if err != nil {
+			state.Logger.Printf("failed to send report to user %d: %v", preference.UserID, err)
+			err = dl.ReleaseReport(preference.ID, scheduledAt, next)
+			if err != nil {
+				state.Logger.Printf("failed to release report [%d]: %v", preference.ID, err)
+			}
+			continue
+		}
+		err = dl.SetReportSent(preference.ID, now)
+		if err != nil {
+			state.Logger.Printf("failed to record report [%d] as sent: %v", preference.ID, err)
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+func sendReport(state *state.ServerState, userID int64, cadence datalayer.ReportCadence, from, to time.Time) error {
+	dl := state.DataLayer
+	user, err := dl.GetUserByID(userID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", userID), http.StatusInternalServerError, err)
+	}
+
+	report, err := BuildReport(state, userID, cadence, from, to)
+	if err != nil {
+		return err
+	}
+
+	text, html, err := report.Render()
+	if err != nil {
+		return e.Wrap("Failed to render report", http.StatusInternalServerError, err)
+	}
+
+	subject := fmt.Sprintf("Your %s spend report", report.Cadence)
+	err = state.Providers.Email.SendHTMLMail([]string{user.Email.String}, "noreply@someapp.com", subject, text, html)
+	if err != nil {
+		return e.Wrap("Failed to send report email", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// BuildReport summarises the user's spend from from up to, but excluding, to.
+// Budget status is not reported as budgets are not tracked.
+func BuildReport(state *state.ServerState, userID int64, cadence datalayer.ReportCadence, from, to time.Time) (*Report, error) {
+	report := &Report{
+		Cadence: strings.ToLower(string(cadence)),
+		Period:  from.Format("2 Jan 2006") + " to " + to.AddDate(0, 0, -1).Format("2 Jan 2006"),
+		URL:     state.URL,
+	}
+
+	dl := state.DataLayer
+	var filter filters.CardTransactionFilter
+	filter.DateTime = filters.DateRange{LowerBound: from.UTC(), UpperBound: to.UTC(), IsSet: true}
+	categories, err := dl.GetCategorySummaryByUserIDs([]int64{userID}, filter)
+	if err != nil {
+		return nil, e.Wrap("Failed to query category summary from database", http.StatusInternalServerError, err)
+	}
+
+	totals := make(map[string]*ReportLine)
+	totalAmounts := make(map[string]int64)
+	var totalKeys []string
+	for _, category := range categories {
+		name := category.Category
+		if len(name) == 0 {
+			name = "Uncategorised"
+		}
+		report.Categories = append(report.Categories, ReportLine{
+			Name:             name,
+			Amount:           formatReportAmount(category.Amount, category.CurrencyScale, category.CurrencyCode),
+			TransactionCount: category.TransactionCount,
+		})
+
+		key := fmt.Sprintf("%s/%d", category.CurrencyCode, category.CurrencyScale)
+		total, ok := totals[key]
+		if !ok {
+			total = &ReportLine{Name: category.CurrencyCode}
+			totals[key] = total
+			totalKeys = append(totalKeys, key)
+		}
+		totalAmounts[key] += category.Amount
+		total.Amount = formatReportAmount(totalAmounts[key], category.CurrencyScale, category.CurrencyCode)
+		total.TransactionCount += category.TransactionCount
+	}
+	for _, key := range totalKeys {
+		report.Totals = append(report.Totals, *totals[key])
+	}
+
+	merchants, err := dl.GetMerchantSummaryByUserID(userID, from.UTC(), to.UTC(), reportTopCount)
+	if err != nil {
+		return nil, e.Wrap("Failed to query merchant summary from database", http.StatusInternalServerError, err)
+	}
+	for _, merchant := range merchants {
+		report.Merchants = append(report.Merchants, ReportLine{
+			Name:             merchant.MerchantName,
+			Amount:           formatReportAmount(merchant.Amount, merchant.CurrencyScale, merchant.CurrencyCode),
+			TransactionCount: merchant.TransactionCount,
+		})
+	}
+
+	cardTransactions, err := dl.GetLargestCardTransactionsByUserID(userID, from.UTC(), to.UTC(), reportTopCount)
+	if err != nil {
+		return nil, e.Wrap("Failed to query card transactions from database", http.StatusInternalServerError, err)
+	}
+	for _, cardTransaction := range cardTransactions {
+		report.Transactions = append(report.Transactions, ReportLine{
+			Name:             cardTransaction.DateTime.In(from.Location()).Format("2 Jan") + " " + cardTransaction.MerchantName,
+			Amount:           formatReportAmount(cardTransaction.Amount, cardTransaction.CurrencyScale, cardTransaction.CurrencyCode),
+			TransactionCount: 1,
+		})
+	}
+
+	return report, nil
+}
+
+func formatReportAmount(value int64, scale int, currencyCode string) string {
+	return statement.FormatAmount(value, scale) + " " + currencyCode
+}
+
+// Render returns the plain text and HTML bodies of the report email.
+func (r *Report) Render() (string, string, error) {
+	var text bytes.Buffer
+	err := reportTextTemplate.Execute(&text, r)
+	if err != nil {
+		return "", "", err
+	}
+
+	var html bytes.Buffer
+	err = reportHTMLTemplate.Execute(&html, r)
+	if err != nil {
+		return "", "", err
+	}
+
+	return text.String(), html.String(), nil
+}
+
+var reportTextTemplate = texttemplate.Must(texttemplate.New("report.txt").Parse(`Your {{.Cadence}} spend report for {{.Period}}
+{{if .Totals}}
+Total spent
+{{range .Totals}}  {{.Amount}} over {{.TransactionCount}} transactions
+{{end}}
+By category
+{{range .Categories}}  {{.Name}}: {{.Amount}}
+{{end}}
+Top merchants
+{{range .Merchants}}  {{.Name}}: {{.Amount}} ({{.TransactionCount}})
+{{end}}
+Biggest transactions
+{{range .Transactions}}  {{.Name}}: {{.Amount}}
+{{end}}{{else}}
+You had no card transactions in this period.
+{{end}}
+Change how often you receive these reports at {{.URL}}
+`))
+
+var reportHTMLTemplate = htmltemplate.Must(htmltemplate.New("report.html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h1>Your {{.Cadence}} spend report</h1>
+<p>{{.Period}}</p>
+{{if .Totals}}
+<h2>Total spent</h2>
+<table>
+{{range .Totals}}<tr><td>{{.Amount}}</td><td>{{.TransactionCount}} transactions</td></tr>
+{{end}}</table>
+<h2>By category</h2>
+<table>
+{{range .Categories}}<tr><td>{{.Name}}</td><td align="right">{{.Amount}}</td></tr>
+{{end}}</table>
+<h2>Top merchants</h2>
+<table>
+{{range .Merchants}}<tr><td>{{.Name}}</td><td align="right">{{.Amount}}</td><td>{{.TransactionCount}}</td></tr>
+{{end}}</table>
+<h2>Biggest transactions</h2>
+<table>
+{{range .Transactions}}<tr><td>{{.Name}}</td><td align="right">{{.Amount}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>You had no card transactions in this period.</p>
+{{end}}
+<p><a href="{{.URL}}">Change how often you receive these reports</a></p>
+</body>
+</html>
+`))
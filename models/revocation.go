@@ -0,0 +1,41 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	models_auth "github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// IsRequestRevoked reports whether the token a request was authenticated
+// with has since been revoked, by signing out, a password change, the user
+// being disabled or the API token being revoked.  Event streams check it
+// from time to time, as they outlive the check made when they were opened.
+func IsRequestRevoked(state *state.ServerState, ctx context.Context) (bool, error) {
+	if tk, ok := ctx.Value(models_auth.TokenKey).(*models_auth.JSONWebToken); ok {
+		// A ticket is used up as it is redeemed, so only its session counts.
+		tokenID := tk.Id
+		if tk.Type == models_auth.TokenTypeTicket {
+			tokenID = ""
+		}
+		return state.Revocations.IsRevoked(tk.UserID, tk.Issued(), tokenID, tk.SessionID)
+	}
+
+	apiTokenID, ok := ctx.Value(models_auth.APITokenKey).(int64)
+	if !ok {
+		return false, nil
+	}
+	dbToken, err := state.DataLayer.GetAPITokenByID(apiTokenID)
+	if err == datalayer.ErrNoData {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if dbToken.RevokedAt.Valid || !time.Now().Before(dbToken.ExpiresAt) {
+		return true, nil
+	}
+
+	return state.Revocations.IsRevoked(dbToken.UserID, dbToken.CreatedAt.Time)
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/search"
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/models/pagination"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// savedViewColumns are the card transaction fields a view can display.
+var savedViewColumns = map[string]bool{
+	"id":                   true,
+	"dateTime":             true,
+	"amount":               true,
+	"currencyCode":         true,
+	"reference":            true,
+	"merchantName":         true,
+	"merchantCity":         true,
+	"merchantCountryCode":  true,
+	"merchantCountryName":  true,
+	"merchantCategoryCode": true,
+	"merchantCategoryName": true,
+	"notes":                true,
+}
+
+// SavedView is a named set of card transaction list parameters.
+type SavedView struct {
+	datalayer.Model
+	Name        string   `json:"name"`
+	Filter      string   `json:"filter"`
+	Search      string   `json:"search"`
+	SortField   string   `json:"sortField"`
+	SortDir     string   `json:"sortDir"`
+	Columns     []string `json:"columns"`
+	serverState *state.ServerState
+}
+
+func NewSavedView(state *state.ServerState) *SavedView {
+	view := new(SavedView)
+	view.serverState = state
+	return view
+}
+
+func newFromDBSavedView(view *datalayer.SavedView) *SavedView {
+	v := new(SavedView)
+	v.ID = view.ID
+	v.CreatedAt = view.CreatedAt
+	v.UpdatedAt = view.UpdatedAt
+	v.DeletedAt = view.DeletedAt
+	v.Name = view.Name
+	v.Filter = view.Filter
+	v.Search = view.Search
+	v.SortField = view.SortField
+	v.SortDir = view.SortDir
+	v.Columns = make([]string, 0)
+	if len(view.Columns) > 0 {
+		v.Columns = strings.Split(view.Columns, ",")
+	}
+	return v
+}
+
+func (v *SavedView) convertToDB(userID int64) *datalayer.SavedView {
+	view := new(datalayer.SavedView)
+	view.ID = v.ID
+	view.UserID = userID
+	view.Name = v.Name
+	view.Filter = v.Filter
+	view.Search = v.Search
+	view.SortField = v.SortField
+	view.SortDir = v.SortDir
+	view.Columns = strings.Join(v.Columns, ",")
+	return view
+}
+
+func (v *SavedView) validate(userID int64) error {
+	v.Name = strings.TrimSpace(v.Name)
+	var fields []types.ErrorField
+	if len(v.Name) == 0 || len(v.Name) > 255 {
+		fields = append(fields, types.ErrorField{Name: "name", Message: "a name of up to 255 characters is required"})
+	}
+	if len(v.Filter) > 0 {
+		_, err := filters.ParseExpression(v.Filter, filters.CardTransactionFields)
+		if err != nil {
+			fields = append(fields, types.ErrorField{Name: "filter", Message: err.Error()})
+		}
+	}
+	if len(v.Search) > 0 {
+		_, err := search.Parse(v.Search)
+		if err != nil {
+			fields = append(fields, types.ErrorField{Name: "search", Message: err.Error()})
+		}
+	}
+	if len(v.SortField) > 0 && (!new(CardTransaction).GetSortFields()[v.SortField] || v.SortField == "relevance" && len(v.Search) == 0) {
+		fields = append(fields, types.ErrorField{Name: "sortField", Message: "invalid sort field"})
+	}
+	if len(v.SortDir) > 0 && v.SortDir != string(pagination.SortDirectionAsc) && v.SortDir != string(pagination.SortDirectionDesc) {
+		fields = append(fields, types.ErrorField{Name: "sortDir", Message: "sort direction must be asc or desc"})
+	}
+	for _, column := range v.Columns {
+		if !savedViewColumns[column] {
+			fields = append(fields, types.ErrorField{Name: "columns", Message: fmt.Sprintf("%q is not a card transaction field", column)})
+		}
+	}
+	if len(fields) > 0 {
+		return e.NewError("Saved view is invalid", fields, http.StatusBadRequest)
+	}
+
+	exists, err := v.serverState.DataLayer.SavedViewNameExists(userID, v.Name, v.ID)
+	if err != nil {
+		return e.Wrap("Failed to check saved view names", http.StatusInternalServerError, err)
+	}
+	if exists {
+		return ErrSavedViewNameExists
+	}
+
+	return nil
+}
+
+func (v *SavedView) CreateSavedView(userID int64) (*SavedView, error) {
+	v.ID = 0
+	err := v.validate(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dl := v.serverState.DataLayer
+	id, err := dl.CreateSavedView(v.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to store saved view", http.StatusInternalServerError, err)
+	}
+
+	return v.GetSavedView(userID, id)
+}
+
+// GetSavedView looks up one of the user's views.  Views belonging to somebody
+// else are reported as not found.
+func (v *SavedView) GetSavedView(userID, id int64) (*SavedView, error) {
+	dl := v.serverState.DataLayer
+	view, err := dl.GetSavedViewByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrSavedViewNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query saved view [%d] from database", id), http.StatusInternalServerError, err)
+	}
+
+	if view.UserID != userID {
+		return nil, ErrSavedViewNotFound
+	}
+
+	saved := newFromDBSavedView(view)
+	saved.serverState = v.serverState
+	return saved, nil
+}
+
+func (v *SavedView) GetSavedViewsByUserID(userID int64) ([]*SavedView, error) {
+	dl := v.serverState.DataLayer
+	dbViews, err := dl.GetSavedViewsByUserID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query saved views from database", http.StatusInternalServerError, err)
+	}
+
+	views := make([]*SavedView, 0, len(dbViews))
+	for _, view := range dbViews {
+		views = append(views, newFromDBSavedView(view))
+	}
+
+	return views, nil
+}
+
+func (v *SavedView) UpdateSavedView(userID, id int64) (*SavedView, error) {
+	_, err := v.GetSavedView(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	v.ID = id
+	err = v.validate(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dl := v.serverState.DataLayer
+	err = dl.UpdateSavedView(v.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to update saved view", http.StatusInternalServerError, err)
+	}
+
+	return v.GetSavedView(userID, id)
+}
+
+func (v *SavedView) DeleteSavedView(userID, id int64) error {
+	_, err := v.GetSavedView(userID, id)
+	if err != nil {
+		return err
+	}
+
+	dl := v.serverState.DataLayer
+	err = dl.DeleteSavedView(userID, id)
+	if err != nil {
+		return e.Wrap("Failed to delete saved view", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// ApplySavedView resolves the view= query parameter.  The view's parameters
+// are returned merged with the ad-hoc ones, which take precedence, except
+// that filters and searches are combined so that both must match.  Without a
+// view the query parameters are returned unchanged with a nil view.
+func ApplySavedView(state *state.ServerState, userID int64, queryParams url.Values) (url.Values, *SavedView, error) {
+	if _, ok := queryParams["view"]; !ok {
+		return queryParams, nil, nil
+	}
+
+	id, err := strconv.ParseInt(queryParams.Get("view"), 10, 64)
+	if err != nil || id <= 0 {
+		return nil, nil, e.NewError("Saved view is invalid", []types.ErrorField{
+			{Name: "view", Message: "must be the id of a saved view"},
+		}, http.StatusBadRequest)
+	}
+
+	view, err := NewSavedView(state).GetSavedView(userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := make(url.Values)
+	set := func(key, value string) {
+		if len(value) > 0 {
+			merged.Set(key, value)
+		}
+	}
+	set("filter", view.Filter)
+	set("q", view.Search)
+	set("sortField", view.SortField)
+	set("sortDir", view.SortDir)
+
+	for key, values := range queryParams {
+		if key == "view" || len(values) == 0 {
+			continue
+		}
+		switch {
+		case key == "filter" && len(view.Filter) > 0:
+			merged.Set(key, "("+view.Filter+") and ("+values[0]+")")
+		case key == "q" && len(view.Search) > 0:
+			merged.Set(key, view.Search+" "+values[0])
+		default:
+			merged[key] = values
+		}
+	}
+
+	return merged, view, nil
+}
@@ -4,8 +4,26 @@ import (
 	e "github.com/donohutcheon/gowebserver/controllers/errors"
 	"github.com/donohutcheon/gowebserver/controllers/response/types"
 	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/nonce"
 	"github.com/donohutcheon/gowebserver/state"
 	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// ConfirmationLifetime is how long an emailed confirmation link works
+	// for.
+	ConfirmationLifetime = 48 * time.Hour
+	// ConfirmationQueue is the number of users whose confirmation email may
+	// wait to be sent.  Users beyond it are left to the sweep.
+	ConfirmationQueue = 100
+	// ConfirmationResendQueue is the number of asked for confirmation emails
+	// that may wait to be sent.  Requests beyond it are dropped.
+	ConfirmationResendQueue = 100
+	// ConfirmationResendInterval is the least time between two confirmation
+	// emails to the same user.
+	ConfirmationResendInterval = time.Minute
 )
 
 type SignUpConfirmation struct {
@@ -27,13 +45,12 @@ func (s *SignUpConfirmation) convert(signUp datalayer.SignUpConfirmation) {
 	s.UpdatedAt = signUp.UpdatedAt
 	s.DeletedAt = signUp.DeletedAt
 	s.UserID = signUp.UserID
-	s.Nonce = signUp.Nonce
 }
 
 func (s *SignUpConfirmation) LookupUsingNonce(nonce string) error {
 	dl := s.serverState.DataLayer
 
-	dbSignUp, err := dl.LookupSignUpConfirmation(nonce)
+	dbSignUp, err := dl.GetSignUpConfirmationByNonceHash(hashToken(nonce))
 	if err != nil {
 		return e.NewError("User confirmation not found", []types.ErrorField{
 			{Name: "nonce", Message: "Nonce not found"},
@@ -41,5 +58,46 @@ func (s *SignUpConfirmation) LookupUsingNonce(nonce string) error {
 	}
 
 	s.convert(*dbSignUp)
+	s.Nonce = nonce
+	return nil
+}
+
+// NewConfirmationNonce returns a nonce for a confirmation link along with
+// the hash of it to store.
+func NewConfirmationNonce() (string, string, error) {
+	confirmationNonce, err := nonce.GenerateSecret(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	return confirmationNonce, hashToken(confirmationNonce), nil
+}
+
+// queueConfirmation hands the user to the confirmation worker without
+// waiting.  When the queue is full the email is left to the sweep, which
+// sends those of users who were never sent one.
+func queueConfirmation(state *state.ServerState, dbUser datalayer.User) {
+	select {
+	case state.Channels.ConfirmUsers <- dbUser:
+	default:
+		state.Logger.Printf("confirmation queue is full, leaving user %d to the sweep", dbUser.ID)
+	}
+}
+
+// RequestConfirmationResend queues a new confirmation email for the address.
+// Like RequestPasswordReset it answers the same whether or not the address
+// has an account waiting to be confirmed.
+func RequestConfirmationResend(state *state.ServerState, email string) error {
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return ErrValidationEmail
+	}
+
+	select {
+	case state.Channels.ConfirmationResends <- email:
+	default:
+		state.Logger.Print("confirmation resend queue is full, dropping request")
+	}
+
 	return nil
-}
\ No newline at end of file
+}
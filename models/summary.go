@@ -0,0 +1,37 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+)
+
+type CategorySummary struct {
+	Category         string        `json:"category"`
+	CurrencyCode     string        `json:"currencyCode"`
+	Amount           CurrencyValue `json:"amount"`
+	TransactionCount int64         `json:"transactionCount"`
+}
+
+// GetCategorySummaryByUserID totals the user's spend per category honouring
+// the filter criteria.  Split transactions are counted per allocation.
+func (c *CardTransaction) GetCategorySummaryByUserID(userID int64) ([]*CategorySummary, error) {
+	dl := c.serverState.DataLayer
+	dbSummaries, err := dl.GetCategorySummaryByUserIDs(c.ownerIDs(userID), c.filter)
+	if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to summarise card transactions for user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	summaries := make([]*CategorySummary, 0, len(dbSummaries))
+	for _, dbSummary := range dbSummaries {
+		summaries = append(summaries, &CategorySummary{
+			Category:         dbSummary.Category,
+			CurrencyCode:     dbSummary.CurrencyCode,
+			Amount:           CurrencyValue{Value: dbSummary.Amount, Scale: dbSummary.CurrencyScale},
+			TransactionCount: dbSummary.TransactionCount,
+		})
+	}
+
+	return summaries, nil
+}
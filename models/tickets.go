@@ -0,0 +1,45 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// CreateTicket issues a ticket for a WebSocket handshake to the holder of an
+// access token.
+func CreateTicket(state *state.ServerState, accessToken *auth.JSONWebToken) (*auth.TicketResponse, error) {
+	ticket, err := auth.CreateTicket(state.Keys, accessToken)
+	if err != nil {
+		return nil, e.Wrap("Failed to create ticket", http.StatusInternalServerError, err)
+	}
+
+	return ticket, nil
+}
+
+// RedeemTicket checks a ticket and uses it up, returning its claims.  Like a
+// challenge it can be redeemed once, and not at all once its session has
+// been revoked.
+func RedeemTicket(state *state.ServerState, rawTicket string) (*auth.JSONWebToken, error) {
+	tk, err := auth.ParseTicket(state.Keys, rawTicket)
+	if err != nil {
+		return nil, err
+	}
+
+	revocations := state.Revocations
+	revoked, err := revocations.IsRevoked(tk.UserID, tk.Issued(), tk.Id, tk.SessionID)
+	if err != nil {
+		return nil, e.Wrap("Failed to check token revocation", http.StatusInternalServerError, err)
+	} else if revoked {
+		return nil, ErrTicketInvalid
+	}
+	err = revocations.RevokeToken(tk.UserID, tk.Id, time.Unix(tk.ExpiresAt, 0).UTC())
+	if err != nil {
+		return nil, e.Wrap("Failed to revoke ticket", http.StatusInternalServerError, err)
+	}
+
+	return tk, nil
+}
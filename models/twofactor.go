@@ -0,0 +1,279 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/lib/nonce"
+	"github.com/donohutcheon/gowebserver/lib/totp"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// twoFactorIssuer names the service in authenticator apps.
+	twoFactorIssuer = "Go Webserver"
+	// recoveryCodeCount is the number of recovery codes a user is given.
+	recoveryCodeCount = 10
+	// recoveryCodeSize is the length of a recovery code in bytes.  Codes are
+	// shown as two groups of five hex digits.
+	recoveryCodeSize = 5
+)
+
+// TwoFactor is the state of a user's two-factor authentication.  Secret and
+// URI are only set when an authenticator app is being set up, and
+// RecoveryCodes only when new ones are issued, as neither can be shown again.
+type TwoFactor struct {
+	serverState            *state.ServerState
+	Enabled                bool     `json:"enabled"`
+	RecoveryCodesRemaining int      `json:"recoveryCodesRemaining"`
+	Secret                 string   `json:"secret,omitempty"`
+	URI                    string   `json:"uri,omitempty"`
+	RecoveryCodes          []string `json:"recoveryCodes,omitempty"`
+}
+
+func NewTwoFactor(state *state.ServerState) *TwoFactor {
+	return &TwoFactor{
+		serverState: state,
+	}
+}
+
+// GetTwoFactor looks up whether the user has two-factor authentication
+// enabled and how many recovery codes they have left.
+func (f *TwoFactor) GetTwoFactor(userID int64) error {
+	dl := f.serverState.DataLayer
+	dbTOTP, err := dl.GetTOTPByUserID(userID)
+	if err == datalayer.ErrNoData {
+		return nil
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query two-factor authentication of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	f.Enabled = dbTOTP.EnabledAt.Valid
+
+	f.RecoveryCodesRemaining, err = dl.CountUnusedRecoveryCodes(userID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to count recovery codes of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// EnrolTOTP creates a new secret for the user to add to their authenticator
+// app.  It does not guard logins until EnableTOTP is given a code from the
+// app, so enrolling again before then replaces the secret.
+func (f *TwoFactor) EnrolTOTP(userID int64, password string) error {
+	dbUser, err := NewUser(f.serverState).checkPassword(userID, password)
+	if err != nil {
+		return err
+	}
+
+	dl := f.serverState.DataLayer
+	dbTOTP, err := dl.GetTOTPByUserID(userID)
+	if err == nil && dbTOTP.EnabledAt.Valid {
+		return ErrTwoFactorEnabled
+	} else if err != nil && err != datalayer.ErrNoData {
+		return e.Wrap(fmt.Sprintf("Failed to query two-factor authentication of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return e.Wrap("Failed to generate two-factor secret", http.StatusInternalServerError, err)
+	}
+	err = dl.DeleteTOTPByUserID(userID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to delete two-factor secret of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	_, err = dl.CreateTOTP(userID, secret)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to store two-factor secret of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	f.Secret = secret
+	f.URI = totp.URI(twoFactorIssuer, dbUser.Email.String, secret)
+
+	return nil
+}
+
+// EnableTOTP turns two-factor authentication on once the user shows a code
+// from the secret they enrolled, and issues their recovery codes.
+func (f *TwoFactor) EnableTOTP(userID int64, code string) error {
+	dl := f.serverState.DataLayer
+	dbTOTP, err := dl.GetTOTPByUserID(userID)
+	if err == datalayer.ErrNoData {
+		return ErrTwoFactorNotEnrolled
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query two-factor authentication of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	if dbTOTP.EnabledAt.Valid {
+		return ErrTwoFactorEnabled
+	}
+
+	now := time.Now().UTC()
+	step, ok := totp.Verify(dbTOTP.Secret, strings.TrimSpace(code), now, dbTOTP.LastUsedStep)
+	if !ok {
+		return ErrTwoFactorCodeInvalid
+	}
+	fresh, err := dl.UseTOTPStep(userID, step)
+	if err != nil {
+		return e.Wrap("Failed to record two-factor code use", http.StatusInternalServerError, err)
+	} else if !fresh {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	err = dl.EnableTOTP(userID, now)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to enable two-factor authentication of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	err = f.issueRecoveryCodes(userID)
+	if err != nil {
+		return err
+	}
+	f.Enabled = true
+
+	dbUser, err := dl.GetUserByID(userID)
+	if err == nil {
+		publishAccountEvent(f.serverState, events.UserTwoFactorEnabled, userID, dbUser.Email.String)
+	}
+
+	return nil
+}
+
+// DisableTOTP turns two-factor authentication off for a user who gives both
+// their password and a code, and discards their secret and recovery codes.
+func (f *TwoFactor) DisableTOTP(userID int64, password, code string) error {
+	dbUser, err := NewUser(f.serverState).checkPassword(userID, password)
+	if err != nil {
+		return err
+	}
+	err = f.checkCode(userID, code)
+	if err != nil {
+		return err
+	}
+
+	dl := f.serverState.DataLayer
+	err = dl.DeleteRecoveryCodesByUserID(userID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to delete recovery codes of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	err = dl.DeleteTOTPByUserID(userID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to delete two-factor secret of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	f.Enabled = false
+	publishAccountEvent(f.serverState, events.UserTwoFactorDisabled, userID, dbUser.Email.String)
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, used or not,
+// with new ones.
+func (f *TwoFactor) RegenerateRecoveryCodes(userID int64, code string) error {
+	err := f.checkCode(userID, code)
+	if err != nil {
+		return err
+	}
+
+	err = f.serverState.DataLayer.DeleteRecoveryCodesByUserID(userID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to delete recovery codes of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	f.Enabled = true
+
+	return f.issueRecoveryCodes(userID)
+}
+
+// checkCode checks a code for a change to a user's two-factor
+// authentication, which has to be enabled.
+func (f *TwoFactor) checkCode(userID int64, code string) error {
+	enabled, err := twoFactorEnabled(f.serverState, userID)
+	if err != nil {
+		return err
+	} else if !enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	ok, err := verifySecondFactor(f.serverState, userID, code)
+	if err != nil {
+		return err
+	} else if !ok {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	return nil
+}
+
+func (f *TwoFactor) issueRecoveryCodes(userID int64) error {
+	codes := make([]string, recoveryCodeCount)
+	codeHashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := nonce.GenerateSecret(recoveryCodeSize)
+		if err != nil {
+			return e.Wrap("Failed to generate recovery code", http.StatusInternalServerError, err)
+		}
+		codes[i] = code[:len(code)/2] + "-" + code[len(code)/2:]
+		codeHashes[i] = hashToken(code)
+	}
+
+	err := f.serverState.DataLayer.CreateRecoveryCodes(userID, codeHashes)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to store recovery codes of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	f.RecoveryCodes = codes
+	f.RecoveryCodesRemaining = len(codes)
+
+	return nil
+}
+
+// twoFactorEnabled reports whether logins of the user need a second factor.
+func twoFactorEnabled(state *state.ServerState, userID int64) (bool, error) {
+	dbTOTP, err := state.DataLayer.GetTOTPByUserID(userID)
+	if err == datalayer.ErrNoData {
+		return false, nil
+	} else if err != nil {
+		return false, e.Wrap(fmt.Sprintf("Failed to query two-factor authentication of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	return dbTOTP.EnabledAt.Valid, nil
+}
+
+// verifySecondFactor checks a code from the user's authenticator app, or
+// failing that one of their recovery codes, and uses it up.  Recovery codes
+// are matched regardless of case, spaces and dashes.
+func verifySecondFactor(state *state.ServerState, userID int64, code string) (bool, error) {
+	dl := state.DataLayer
+	dbTOTP, err := dl.GetTOTPByUserID(userID)
+	if err == datalayer.ErrNoData {
+		return false, nil
+	} else if err != nil {
+		return false, e.Wrap(fmt.Sprintf("Failed to query two-factor authentication of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	if !dbTOTP.EnabledAt.Valid {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Verify(dbTOTP.Secret, code, now, dbTOTP.LastUsedStep)
+		if !ok {
+			return false, nil
+		}
+		fresh, err := dl.UseTOTPStep(userID, step)
+		if err != nil {
+			return false, e.Wrap("Failed to record two-factor code use", http.StatusInternalServerError, err)
+		}
+		return fresh, nil
+	}
+
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(code))
+	used, err := dl.UseRecoveryCode(userID, hashToken(code), now)
+	if err != nil {
+		return false, e.Wrap("Failed to record recovery code use", http.StatusInternalServerError, err)
+	}
+
+	return used, nil
+}
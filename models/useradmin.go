@@ -0,0 +1,284 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/models/pagination"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// Actions recorded in the user audit.
+const (
+	UserAuditRolesChanged     = "ROLES_CHANGED"
+	UserAuditStateChanged     = "STATE_CHANGED"
+	UserAuditConfirmationSent = "CONFIRMATION_RESENT"
+	UserAuditDeleted          = "DELETED"
+	UserAuditLoginUnlocked    = "LOGIN_UNLOCKED"
+	userAuditRecordsLimit     = 100
+)
+
+// UserAuditRecord is an action an administrator took on a user.
+type UserAuditRecord struct {
+	ID          int64                  `json:"id"`
+	CreatedAt   datalayer.JsonNullTime `json:"createdAt"`
+	ActorUserID int64                  `json:"actorUserID"`
+	UserID      int64                  `json:"userID"`
+	Action      string                 `json:"action"`
+	Detail      string                 `json:"detail,omitempty"`
+}
+
+// UserSearch finds users for administrators.  Results are sorted and paged
+// with the pagination package like card transactions.
+type UserSearch struct {
+	serverState *state.ServerState
+	pagination  pagination.Parameters
+	query       string
+	state       datalayer.UserState
+}
+
+func NewUserSearch(state *state.ServerState) *UserSearch {
+	search := new(UserSearch)
+	search.serverState = state
+	return search
+}
+
+func (s *UserSearch) GetSortFields() map[string]bool {
+	return map[string]bool{
+		"id":        true,
+		"email":     true,
+		"state":     true,
+		"createdAt": true,
+	}
+}
+
+func (s *UserSearch) SetSortParameters(parameters pagination.Parameters) {
+	s.pagination = parameters
+}
+
+func (s *UserSearch) GetPagination() pagination.Parameters {
+	return s.pagination
+}
+
+// SetFilterCriteria reads the search text from q and an optional state.
+func (s *UserSearch) SetFilterCriteria(queryParams url.Values) error {
+	s.query = strings.TrimSpace(queryParams.Get("q"))
+	s.state = datalayer.UserState(strings.ToUpper(queryParams.Get("state")))
+	if len(s.state) > 0 && !knownUserState(s.state) {
+		return e.NewError("User search is invalid", []types.ErrorField{
+			{Name: "state", Message: fmt.Sprintf("%q is not a user state", s.state)},
+		}, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func (s *UserSearch) Search() ([]*User, error) {
+	dl := s.serverState.DataLayer
+	dbUsers, err := dl.SearchUsers(s.query, s.state, s)
+	if err != nil {
+		return nil, e.Wrap("Failed to search users", http.StatusInternalServerError, err)
+	}
+
+	users := make([]*User, 0, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		user := NewUser(s.serverState)
+		user.convert(*dbUser)
+		user.Password = ""
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// GetUserForAdmin loads any user for an administrator, answering 404 rather
+// than the 403 given to a user who is not found at sign in, along with
+// whether failed logins have locked them out.
+func (u *User) GetUserForAdmin(id int64) error {
+	err := u.GetUser(id)
+	if err == ErrUserDoesNotExist {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	until, locked, err := u.serverState.LoginAttempts.Locked(u.Email)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to check lockout of user [%d]", id), http.StatusInternalServerError, err)
+	} else if locked {
+		u.LockedUntil = &until
+	}
+
+	return nil
+}
+
+// SetState moves a user to another state on behalf of the administrator
+// adminID.  Administrators may confirm a user, disable them, or confirm a
+// disabled user to enable them again.  The tokens of a disabled user are
+// revoked, so that enabling them does not bring their sessions back.  The
+// remaining states belong to the sign-up flow.
+func (u *User) SetState(adminID, id int64, userState datalayer.UserState) error {
+	userState = datalayer.UserState(strings.ToUpper(string(userState)))
+	if userState != datalayer.UserStateConfirmed && userState != datalayer.UserStateDisabled {
+		return e.NewError("User state is invalid", []types.ErrorField{
+			{Name: "state", Message: "state must be CONFIRMED or DISABLED"},
+		}, http.StatusBadRequest)
+	}
+	if adminID == id && userState == datalayer.UserStateDisabled {
+		return e.NewError("User state is invalid", []types.ErrorField{
+			{Name: "state", Message: "you cannot disable yourself"},
+		}, http.StatusBadRequest)
+	}
+
+	err := u.GetUserForAdmin(id)
+	if err != nil {
+		return err
+	}
+	previous := u.State
+	if datalayer.UserState(previous) == userState {
+		return nil
+	}
+
+	dl := u.serverState.DataLayer
+	err = dl.SetUserStateByID(id, userState)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to update state of user [%d]", id), http.StatusInternalServerError, err)
+	}
+	u.State = string(userState)
+	if userState == datalayer.UserStateDisabled {
+		err = u.serverState.Revocations.RevokeAll(id)
+		if err != nil {
+			return e.Wrap(fmt.Sprintf("Failed to revoke tokens of user [%d]", id), http.StatusInternalServerError, err)
+		}
+		publishAccountEvent(u.serverState, events.UserDisabled, id, u.Email)
+	} else {
+		u.serverState.Revocations.Forget(id)
+	}
+
+	return recordUserAudit(u.serverState, adminID, id, UserAuditStateChanged, previous+" -> "+u.State)
+}
+
+// ResendConfirmation emails a new confirmation link to a user who has not
+// yet confirmed their email address.
+func (u *User) ResendConfirmation(adminID, id int64) error {
+	err := u.GetUserForAdmin(id)
+	if err != nil {
+		return err
+	}
+
+	switch datalayer.UserState(u.State) {
+	case datalayer.UserStateConfirmed:
+		return ErrUserAlreadyConfirmed
+	case datalayer.UserStateDisabled:
+		return ErrUserDisabled
+	}
+
+	dl := u.serverState.DataLayer
+	dbUser, err := dl.GetUserByID(id)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", id), http.StatusInternalServerError, err)
+	}
+	queueConfirmation(u.serverState, *dbUser)
+
+	return recordUserAudit(u.serverState, adminID, id, UserAuditConfirmationSent, u.Email)
+}
+
+// UnlockLogin forgets the failed logins of a user on behalf of the
+// administrator adminID, ending any lockout.  Failures counted against the
+// addresses they came from are kept.
+func (u *User) UnlockLogin(adminID, id int64) error {
+	err := u.GetUserForAdmin(id)
+	if err != nil {
+		return err
+	}
+
+	err = u.serverState.LoginAttempts.Unlock(u.Email)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to unlock user [%d]", id), http.StatusInternalServerError, err)
+	}
+	u.LockedUntil = nil
+
+	return recordUserAudit(u.serverState, adminID, id, UserAuditLoginUnlocked, u.Email)
+}
+
+// DeleteUser deletes a user on behalf of the administrator adminID.  The
+// user's data is kept for the audit, but they can no longer sign in and
+// their tokens are refused.
+func (u *User) DeleteUser(adminID, id int64) error {
+	if adminID == id {
+		return e.NewError("You cannot delete yourself", nil, http.StatusBadRequest)
+	}
+
+	err := u.GetUserForAdmin(id)
+	if err != nil {
+		return err
+	}
+
+	dl := u.serverState.DataLayer
+	err = dl.DeleteUserByID(id, time.Now().UTC())
+	if err == datalayer.ErrNoData {
+		return ErrUserNotFound
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to delete user [%d]", id), http.StatusInternalServerError, err)
+	}
+	u.serverState.Revocations.Forget(id)
+
+	return recordUserAudit(u.serverState, adminID, id, UserAuditDeleted, u.Email)
+}
+
+// GetAuditRecords returns the most recent actions taken on the user with the
+// given id, newest first.  Records of deleted users remain available.
+func (u *User) GetAuditRecords(id int64) ([]*UserAuditRecord, error) {
+	dl := u.serverState.DataLayer
+	dbRecords, err := dl.GetUserAuditRecordsByUserID(id, userAuditRecordsLimit)
+	if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query audit records of user [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	records := make([]*UserAuditRecord, 0, len(dbRecords))
+	for _, dbRecord := range dbRecords {
+		records = append(records, &UserAuditRecord{
+			ID:          dbRecord.ID,
+			CreatedAt:   dbRecord.CreatedAt,
+			ActorUserID: dbRecord.ActorUserID,
+			UserID:      dbRecord.UserID,
+			Action:      dbRecord.Action,
+			Detail:      dbRecord.Detail.String,
+		})
+	}
+
+	return records, nil
+}
+
+func recordUserAudit(state *state.ServerState, actorUserID, userID int64, action, detail string) error {
+	dl := state.DataLayer
+	_, err := dl.CreateUserAuditRecord(&datalayer.UserAuditRecord{
+		ActorUserID: actorUserID,
+		UserID:      userID,
+		Action:      action,
+		Detail:      sql.NullString{String: detail, Valid: len(detail) > 0},
+	})
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to record %s for user [%d]", action, userID), http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+func knownUserState(userState datalayer.UserState) bool {
+	switch userState {
+	case datalayer.UserStateUnconfirmed, datalayer.UserStateProcessing, datalayer.UserStatePending,
+		datalayer.UserStateConfirmed, datalayer.UserStateDisabled:
+		return true
+	}
+
+	return false
+}
@@ -6,13 +6,20 @@ import (
 	e "github.com/donohutcheon/gowebserver/controllers/errors"
 	"github.com/donohutcheon/gowebserver/controllers/response/types"
 	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	models_auth "github.com/donohutcheon/gowebserver/models/auth"
 	"github.com/donohutcheon/gowebserver/router/auth"
 	"github.com/donohutcheon/gowebserver/state"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// passwordCost is the bcrypt cost passwords are hashed with.  Hashes of a
+// lower cost are upgraded when their user next logs in.
+const passwordCost = bcrypt.DefaultCost
+
 type Settings struct {
 	ID int `json:"id"`
 	ThemeName string `json:"themeName"`
@@ -22,13 +29,18 @@ type User struct {
 	datalayer.Model
 	serverState  *state.ServerState
 	Email        string    `json:"email"`
+	PendingEmail string    `json:"pendingEmail,omitempty"`
 	FirstName    string    `json:"firstName"`
 	Surname      string    `json:"surname"`
 	Age          int       `json:"age"`
 	Address      string    `json:"address"`
 	Roles        []string  `json:"roles"`
+	State        string    `json:"state,omitempty"`
 	Settings     Settings  `json:"settings"`
 	Password     string    `json:"password,omitempty"`
+	// LockedUntil is only set for administrators, while failed logins lock
+	// the user out.
+	LockedUntil  *time.Time `json:"lockedUntil,omitempty"`
 	/*AccessToken  string    `json:"accessToken,omitempty" sql:"-"`
 	RefreshToken string    `json:"refreshToken,omitempty" sql:"-"`
 	LoggedOutAt  time.Time `json:"loggedOutAt,omitempty"`*/
@@ -48,10 +60,12 @@ func (u *User) convert(user datalayer.User) {
 	if user.Email.Valid {
 		u.Email = user.Email.String
 	}
+	u.PendingEmail = user.PendingEmail.String
 	if user.Password.Valid {
 		u.Password = user.Password.String
 	}
-	u.Roles = []string{"ADMIN","USER"}
+	u.Roles = parseRoles(user.Role.String)
+	u.State = user.State.String
 	u.Settings.ID = 0
 	u.Settings.ThemeName = "default"
 }
@@ -85,11 +99,10 @@ func (u *User) Create() (*User, error) {
 	}
 
 	// TODO: Add some sort of salt
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(u.Password), passwordCost)
 	u.Password = string(hashedPassword)
 
 	dl := u.serverState.DataLayer
-	// TODO: Include roles
 	id, err :=  dl.CreateUser(u.Email, u.Password)
 	if err != nil {
 		logger.Fatal(err) // TODO: remove
@@ -102,7 +115,7 @@ func (u *User) Create() (*User, error) {
 	}
 
 	// Send confirmation Email
-	u.serverState.Channels.ConfirmUsers <- *dbUser
+	queueConfirmation(u.serverState, *dbUser)
 
 	user := new(User)
 	user.convert(*dbUser)
@@ -112,37 +125,140 @@ func (u *User) Create() (*User, error) {
 	return user, nil
 }
 
-func (u *User) Login(email, password string) (*auth.TokenResponse, error) {
+// Login checks the user's password and issues tokens, or for a user with
+// two-factor authentication a challenge token to pass to LoginWithCode along
+// with a code.  Failed logins of the account, and from the address ip, slow
+// down and then lock out further logins.
+func (u *User) Login(email, password, ip string) (*auth.TokenResponse, *auth.ChallengeResponse, error) {
+	err := checkLoginAttempts(u.serverState, email, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	dataLayer := u.serverState.DataLayer
 	dbUser, err := dataLayer.GetUserByEmail(email)
 	if err == sql.ErrNoRows {
-		return nil, ErrLoginFailed
+		failLogin(u.serverState, email, ip)
+		return nil, nil, ErrLoginFailed
 	} else if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if datalayer.UserState(dbUser.State.String) != datalayer.UserStateConfirmed {
-		return nil, ErrUserNotConfirmed
+	if datalayer.UserState(dbUser.State.String) == datalayer.UserStateDisabled {
+		return nil, nil, ErrUserDisabled
+	} else if datalayer.UserState(dbUser.State.String) != datalayer.UserStateConfirmed {
+		return nil, nil, ErrUserNotConfirmed
 	}
 
 	u.convert(*dbUser)
 
 	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword { //Password does not match!
-		return nil, ErrLoginFailed
+	if err != nil { //Password does not match!
+		failLogin(u.serverState, email, ip)
+		return nil, nil, ErrLoginFailed
 	}
 	// Worked! Logged In
+	u.upgradePasswordHash(password)
 	u.Password = ""
 
+	enabled, err := twoFactorEnabled(u.serverState, u.ID)
+	if err != nil {
+		return nil, nil, err
+	} else if enabled {
+		challenge, err := auth.CreateChallengeToken(u.serverState.Keys, u.ID)
+		if err != nil {
+			return nil, nil, e.Wrap("token creation failed", http.StatusInternalServerError, err)
+		}
+		return nil, challenge, nil
+	}
+
 	// Create JWT token
-	tokenResp, err := auth.CreateToken(u.ID)
+	tokenResp, err := u.createTokens("")
 	if err != nil {
-		return nil, e.Wrap("token creation failed", http.StatusInternalServerError, err)
+		return nil, nil, err
+	}
+	succeedLogin(u.serverState, email)
+	publishAccountEvent(u.serverState, events.UserLoggedIn, u.ID, u.Email)
+
+	return tokenResp, nil, nil
+}
+
+// LoginWithCode exchanges a challenge token from Login and a code from the
+// user's authenticator app, or a recovery code, for tokens.  A challenge can
+// be answered once: a wrong code uses it up too, so that guessing codes also
+// means guessing the password.  Wrong codes count as failed logins of the
+// account, which are only forgotten once a code is right.
+func (u *User) LoginWithCode(rawChallenge, code, ip string) (*auth.TokenResponse, error) {
+	tk, err := auth.ParseChallengeToken(u.serverState.Keys, rawChallenge)
+	if err != nil {
+		return nil, err
 	}
 
+	revocations := u.serverState.Revocations
+	revoked, err := revocations.IsRevoked(tk.UserID, tk.Issued(), tk.Id)
+	if err != nil {
+		return nil, e.Wrap("Failed to check token revocation", http.StatusInternalServerError, err)
+	} else if revoked {
+		return nil, ErrChallengeInvalid
+	}
+	err = revocations.RevokeToken(tk.UserID, tk.Id, time.Unix(tk.ExpiresAt, 0).UTC())
+	if err != nil {
+		return nil, e.Wrap("Failed to revoke challenge token", http.StatusInternalServerError, err)
+	}
+
+	err = u.GetUser(tk.UserID)
+	if err == ErrUserDoesNotExist {
+		return nil, ErrChallengeInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	if datalayer.UserState(u.State) == datalayer.UserStateDisabled {
+		return nil, ErrUserDisabled
+	} else if datalayer.UserState(u.State) != datalayer.UserStateConfirmed {
+		return nil, ErrUserNotConfirmed
+	}
+	u.Password = ""
+	err = checkLoginAttempts(u.serverState, u.Email, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := verifySecondFactor(u.serverState, u.ID, code)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		failLogin(u.serverState, u.Email, ip)
+		return nil, ErrChallengeCodeInvalid
+	}
+
+	tokenResp, err := u.createTokens("")
+	if err != nil {
+		return nil, err
+	}
+	succeedLogin(u.serverState, u.Email)
+	publishAccountEvent(u.serverState, events.UserLoggedIn, u.ID, u.Email)
+
 	return tokenResp, nil
 }
 
+// upgradePasswordHash hashes the password again if its stored hash is of a
+// lower cost than passwords are now hashed with.  Failing only costs the
+// upgrade, so it does not fail the login.
+func (u *User) upgradePasswordHash(password string) {
+	cost, err := bcrypt.Cost([]byte(u.Password))
+	if err != nil || cost >= passwordCost {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err == nil {
+		err = u.serverState.DataLayer.SetUserPasswordByID(u.ID, string(hashedPassword))
+	}
+	if err != nil {
+		u.serverState.Logger.Printf("Failed to upgrade password hash of user [%d]: %v", u.ID, err)
+	}
+}
+
 func (u *User) GetUser(id int64) (error) {
 	dl := u.serverState.DataLayer
 	dbUser, err := dl.GetUserByID(id)
@@ -157,31 +273,248 @@ func (u *User) GetUser(id int64) (error) {
 	return nil
 }
 
+// ConfirmUser confirms the address a link was emailed to.  Each link works
+// once, and only until it expires.
 func (u *User) ConfirmUser(nonce string) error {
 	logger := u.serverState.Logger
 	dl := u.serverState.DataLayer
 
-	signUp, err := dl.LookupSignUpConfirmation(nonce)
+	signUp, err := dl.GetSignUpConfirmationByNonceHash(hashToken(nonce))
 	if err != nil {
 		return e.NewError("User confirmation not found", []types.ErrorField{
 			{Name: "nonce", Message: "Nonce not found"},
 		}, http.StatusNotFound)
 	}
-	logger.Printf("Received nonce confirmation for user %d %s", signUp.UserID, nonce)
+	logger.Printf("Received nonce confirmation for user %d", signUp.UserID)
+	fresh, err := dl.UseSignUpConfirmation(signUp.ID, time.Now().UTC())
+	if err != nil {
+		return e.Wrap("Failed to record confirmation use", http.StatusInternalServerError, err)
+	} else if !fresh {
+		return ErrConfirmationExpired
+	}
+	if signUp.Email.Valid {
+		return u.confirmEmailChange(signUp)
+	}
+
+	dbUser, err := dl.GetUserByID(signUp.UserID)
+	if err == datalayer.ErrNoData {
+		return ErrUserDoesNotExist
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", signUp.UserID), http.StatusInternalServerError, err)
+	}
+	switch datalayer.UserState(dbUser.State.String) {
+	case datalayer.UserStateConfirmed:
+		return ErrUserAlreadyConfirmed
+	case datalayer.UserStateDisabled:
+		return ErrUserDisabled
+	}
 
 	err = dl.SetUserStateByID(signUp.UserID, datalayer.UserStateConfirmed)
 	if err != nil {
 		return e.Wrap(fmt.Sprintf("Failed to confirm user [%d]", signUp.UserID), http.StatusInternalServerError, err)
 	}
 
+	publishAccountEvent(u.serverState, events.UserConfirmed, dbUser.ID, dbUser.Email.String)
+
 	return nil
 }
 
-func (u *User) GetAPIToken() (*auth.APITokenResponse, error) {
-	tokenResp, err := auth.CreateAPIToken(u.ID)
+// RefreshToken exchanges a refresh token for new tokens, carrying the roles
+// the user holds now rather than those in the refresh token.  Each refresh
+// token can be exchanged once: presenting one again means it was copied, so
+// the whole session it belongs to is revoked.
+func (u *User) RefreshToken(rawToken string) (*auth.TokenResponse, error) {
+	tk, err := auth.ParseRefreshToken(u.serverState.Keys, rawToken)
 	if err != nil {
-		return nil, e.Wrap("api token creation failed", http.StatusInternalServerError, err)
+		return nil, err
+	}
+
+	dl := u.serverState.DataLayer
+	dbToken, err := dl.GetRefreshTokenByTokenID(tk.Id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrRefreshTokenInvalid
+	} else if err != nil {
+		return nil, e.Wrap("Failed to query refresh token from database", http.StatusInternalServerError, err)
+	}
+
+	err = u.GetUser(dbToken.UserID)
+	if err == ErrUserDoesNotExist {
+		return nil, ErrRefreshTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	if datalayer.UserState(u.State) == datalayer.UserStateDisabled {
+		return nil, ErrRefreshUserDisabled
+	}
+
+	revocations := u.serverState.Revocations
+	revoked, err := revocations.IsRevoked(u.ID, tk.Issued(), tk.Id, dbToken.FamilyID)
+	if err != nil {
+		return nil, e.Wrap("Failed to check token revocation", http.StatusInternalServerError, err)
+	} else if revoked {
+		return nil, ErrRefreshTokenRevoked
+	}
+
+	now := time.Now().UTC()
+	fresh, err := dl.UseRefreshToken(tk.Id, now)
+	if err != nil {
+		return nil, e.Wrap("Failed to record refresh token use", http.StatusInternalServerError, err)
+	} else if !fresh {
+		err = revocations.RevokeToken(u.ID, dbToken.FamilyID, now.Add(auth.RefreshTokenLifeSpan*time.Second))
+		if err != nil {
+			return nil, e.Wrap("Failed to revoke session", http.StatusInternalServerError, err)
+		}
+		u.serverState.Logger.Printf("Refresh token reused, revoked session of user %d", u.ID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	return u.createTokens(dbToken.FamilyID)
+}
+
+// createTokens issues tokens in the given session, or a new session if it is
+// empty, and records the refresh token.
+func (u *User) createTokens(sessionID string) (*auth.TokenResponse, error) {
+	tokenResp, refreshClaims, err := auth.CreateToken(u.serverState.Keys, u.ID, u.Roles, sessionID)
+	if err != nil {
+		return nil, e.Wrap("token creation failed", http.StatusInternalServerError, err)
+	}
+
+	dl := u.serverState.DataLayer
+	_, err = dl.CreateRefreshToken(&datalayer.RefreshToken{
+		TokenID:   refreshClaims.Id,
+		FamilyID:  refreshClaims.SessionID,
+		UserID:    u.ID,
+		ExpiresAt: time.Unix(refreshClaims.ExpiresAt, 0).UTC(),
+	})
+	if err != nil {
+		return nil, e.Wrap("Failed to store refresh token", http.StatusInternalServerError, err)
+	}
+	err = dl.DeleteExpiredRefreshTokens(u.ID, time.Now().UTC())
+	if err != nil {
+		return nil, e.Wrap("Failed to delete expired refresh tokens", http.StatusInternalServerError, err)
 	}
 
 	return tokenResp, nil
-}
\ No newline at end of file
+}
+
+// Logout revokes the session of the token tk, or with allSessions every
+// token the user holds, including API tokens.  Event streams opened with the
+// revoked tokens end on the user.loggedOut event.
+func (u *User) Logout(tk *models_auth.JSONWebToken, allSessions bool) error {
+	revocations := u.serverState.Revocations
+	if allSessions {
+		err := revocations.RevokeAll(tk.UserID)
+		if err != nil {
+			return e.Wrap(fmt.Sprintf("Failed to log user [%d] out", tk.UserID), http.StatusInternalServerError, err)
+		}
+	}
+
+	// Revoking the token itself as well takes care of any session issued
+	// in the same second as a logout from every session.
+	sessionID := tk.SessionID
+	if len(sessionID) == 0 {
+		sessionID = tk.Id
+	}
+	if len(sessionID) == 0 {
+		if allSessions {
+			return u.publishLogout(tk.UserID)
+		}
+		return ErrTokenNotRevocable
+	}
+
+	// Tokens refreshed from the session expire no later than the last
+	// refresh token could have.
+	expiresAt := time.Now().Add(auth.RefreshTokenLifeSpan * time.Second)
+	if tokenExpiresAt := time.Unix(tk.ExpiresAt, 0); tokenExpiresAt.After(expiresAt) {
+		expiresAt = tokenExpiresAt
+	}
+	err := revocations.RevokeToken(tk.UserID, sessionID, expiresAt.UTC())
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to log user [%d] out", tk.UserID), http.StatusInternalServerError, err)
+	}
+
+	return u.publishLogout(tk.UserID)
+}
+
+func (u *User) publishLogout(userID int64) error {
+	dbUser, err := u.serverState.DataLayer.GetUserByID(userID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", userID), http.StatusInternalServerError, err)
+	}
+	publishAccountEvent(u.serverState, events.UserLoggedOut, dbUser.ID, dbUser.Email.String)
+
+	return nil
+}
+
+// SetRoles replaces the roles of the user with the given id on behalf of
+// the administrator adminID.  Every user keeps the USER role, and
+// administrators cannot take away their own ADMIN role.
+func (u *User) SetRoles(adminID, id int64, roles []string) error {
+	held := make(map[string]bool)
+	var fields []types.ErrorField
+	for _, role := range roles {
+		role = strings.ToUpper(strings.TrimSpace(role))
+		known := false
+		for _, r := range models_auth.KnownRoles {
+			known = known || r == role
+		}
+		if !known {
+			fields = append(fields, types.ErrorField{Name: "roles", Message: fmt.Sprintf("%q is not a role", role)})
+		}
+		held[role] = true
+	}
+	if adminID == id && !held[models_auth.RoleAdmin] {
+		fields = append(fields, types.ErrorField{Name: "roles", Message: "you cannot remove your own ADMIN role"})
+	}
+	if len(fields) > 0 {
+		return e.NewError("Roles are invalid", fields, http.StatusBadRequest)
+	}
+	held[models_auth.RoleUser] = true
+
+	err := u.GetUserForAdmin(id)
+	if err != nil {
+		return err
+	}
+
+	var stored []string
+	for _, role := range models_auth.KnownRoles {
+		if held[role] {
+			stored = append(stored, role)
+		}
+	}
+
+	dl := u.serverState.DataLayer
+	err = dl.SetUserRolesByID(id, strings.Join(stored, ","))
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to update roles of user [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	// Roles are carried by tokens, so those already issued are revoked for
+	// the change to take effect.
+	if strings.Join(u.Roles, ",") != strings.Join(stored, ",") {
+		err = u.serverState.Revocations.RevokeAll(id)
+		if err != nil {
+			return e.Wrap(fmt.Sprintf("Failed to revoke tokens of user [%d]", id), http.StatusInternalServerError, err)
+		}
+	}
+	u.Roles = stored
+
+	return recordUserAudit(u.serverState, adminID, id, UserAuditRolesChanged, strings.Join(stored, ","))
+}
+
+// parseRoles reads the stored list of roles.  Users stored before roles were
+// recorded hold only the USER role.
+func parseRoles(stored string) []string {
+	var roles []string
+	for _, role := range strings.Split(stored, ",") {
+		role = strings.TrimSpace(role)
+		if len(role) > 0 {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		roles = []string{models_auth.RoleUser}
+	}
+
+	return roles
+}
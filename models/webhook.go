@@ -0,0 +1,594 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/lib/nonce"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// WebhookMaxAttempts is the number of times a delivery is tried before it
+	// is given up on.
+	WebhookMaxAttempts = 8
+	// webhookBackoff is the wait after the first failed attempt.  It doubles
+	// with each further failure up to webhookMaxBackoff.
+	webhookBackoff    = 30 * time.Second
+	webhookMaxBackoff = 6 * time.Hour
+	// webhookLease is how long a claimed delivery is held before another
+	// server may try it, in case the attempt never completes.
+	webhookLease = 2 * time.Minute
+	// webhookDeliveryLog is the number of deliveries listed per webhook.
+	webhookDeliveryLog = 50
+	// webhookResponseLimit bounds the part of a response body that is read,
+	// so that the connection can be reused.  Bodies are not kept.
+	webhookResponseLimit = 1024
+)
+
+var (
+	webhookClient        = newWebhookClient(false)
+	privateWebhookClient = newWebhookClient(true)
+)
+
+// privateNetworks are the ranges, besides loopback, link-local, multicast
+// and unspecified addresses, that webhooks may not be delivered to.
+var privateNetworks = parseNetworks("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10",
+	"172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+// errWebhookAddress is returned when connecting to a webhook whose host
+// resolves to an address that webhooks may not be delivered to.
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// newWebhookClient returns a client that does not follow redirects, so that a
+// delivery only goes to the URL that was registered, and that does not use a
+// proxy.  Unless allowPrivate is set, it checks the address each connection
+// is made to, after the host has been resolved, so that a host cannot resolve
+// to an internal service.  Its timeout leaves a manual redelivery time to
+// respond within the route's write timeout.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); !allowPrivate && (ip == nil || !isPublicIP(ip)) {
+				return fmt.Errorf("%w: %s", errWebhookAddress, host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// isPublicIP reports whether webhooks may be delivered to ip.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// Webhook is a URL that the user's events are POSTed to.  An empty set of
+// event types selects every type.  The secret signs each payload and is only
+// shown when the webhook is created.
+type Webhook struct {
+	datalayer.Model
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"`
+	EventTypes  []string `json:"eventTypes"`
+	Active      bool     `json:"active"`
+	serverState *state.ServerState
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook.
+type WebhookDelivery struct {
+	datalayer.Model
+	WebhookID      int64                          `json:"webhookID"`
+	EventType      string                         `json:"eventType"`
+	Payload        json.RawMessage                `json:"payload"`
+	State          datalayer.WebhookDeliveryState `json:"state"`
+	Attempts       int                            `json:"attempts"`
+	NextAttemptAt  datalayer.JsonNullTime         `json:"nextAttemptAt"`
+	LastAttemptAt  datalayer.JsonNullTime         `json:"lastAttemptAt"`
+	ResponseStatus int                            `json:"responseStatus"`
+	Error          string                         `json:"error"`
+}
+
+// WebhookPayload is the body POSTed to a webhook.
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	EventID   int64       `json:"eventID,omitempty"`
+	UserID    int64       `json:"userID"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// NewWebhook returns a webhook that is active unless the request says
+// otherwise.
+func NewWebhook(state *state.ServerState) *Webhook {
+	webhook := new(Webhook)
+	webhook.serverState = state
+	webhook.Active = true
+	return webhook
+}
+
+func newFromDBWebhook(webhook *datalayer.Webhook) *Webhook {
+	w := new(Webhook)
+	w.ID = webhook.ID
+	w.CreatedAt = webhook.CreatedAt
+	w.UpdatedAt = webhook.UpdatedAt
+	w.DeletedAt = webhook.DeletedAt
+	w.URL = webhook.URL
+	w.Active = webhook.Active
+	w.EventTypes = make([]string, 0)
+	if len(webhook.EventTypes) > 0 {
+		w.EventTypes = strings.Split(webhook.EventTypes, ",")
+	}
+	return w
+}
+
+func (w *Webhook) convertToDB(userID int64) *datalayer.Webhook {
+	webhook := new(datalayer.Webhook)
+	webhook.ID = w.ID
+	webhook.UserID = userID
+	webhook.URL = w.URL
+	webhook.Secret = w.Secret
+	webhook.EventTypes = strings.Join(w.EventTypes, ",")
+	webhook.Active = w.Active
+	return webhook
+}
+
+func newFromDBWebhookDelivery(delivery *datalayer.WebhookDelivery) *WebhookDelivery {
+	d := new(WebhookDelivery)
+	d.ID = delivery.ID
+	d.CreatedAt = delivery.CreatedAt
+	d.UpdatedAt = delivery.UpdatedAt
+	d.DeletedAt = delivery.DeletedAt
+	d.WebhookID = delivery.WebhookID
+	d.EventType = delivery.EventType
+	d.Payload = json.RawMessage(delivery.Payload)
+	d.State = delivery.State
+	d.Attempts = delivery.Attempts
+	d.NextAttemptAt = delivery.NextAttemptAt
+	d.LastAttemptAt = delivery.LastAttemptAt
+	d.ResponseStatus = delivery.ResponseStatus
+	d.Error = delivery.Error
+	return d
+}
+
+func (w *Webhook) validate() error {
+	var fields []types.ErrorField
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 || len(w.URL) > 2048 {
+		fields = append(fields, types.ErrorField{Name: "url", Message: "an http or https URL of up to 2048 characters is required"})
+	} else if ip := net.ParseIP(u.Hostname()); ip != nil && !isPublicIP(ip) && !w.serverState.AllowPrivateWebhooks {
+		fields = append(fields, types.ErrorField{Name: "url", Message: "a loopback, private, link-local or multicast address is not allowed"})
+	}
+	for _, eventType := range w.EventTypes {
+		if !events.IsType(eventType) {
+			fields = append(fields, types.ErrorField{Name: "eventTypes", Message: fmt.Sprintf("%q is not an event type", eventType)})
+		}
+	}
+	if len(fields) > 0 {
+		return e.NewError("Webhook is invalid", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func (w *Webhook) CreateWebhook(userID int64) (*Webhook, error) {
+	w.ID = 0
+	err := w.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	w.Secret, err = nonce.GenerateSecret(32)
+	if err != nil {
+		return nil, e.Wrap("Failed to generate webhook secret", http.StatusInternalServerError, err)
+	}
+
+	dl := w.serverState.DataLayer
+	id, err := dl.CreateWebhook(w.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to store webhook", http.StatusInternalServerError, err)
+	}
+
+	webhook, err := w.GetWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = w.Secret
+
+	return webhook, nil
+}
+
+// GetWebhook looks up one of the user's webhooks.  Webhooks belonging to
+// somebody else are reported as not found.
+func (w *Webhook) GetWebhook(userID, id int64) (*Webhook, error) {
+	dbWebhook, err := w.getDBWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := newFromDBWebhook(dbWebhook)
+	webhook.serverState = w.serverState
+	return webhook, nil
+}
+
+func (w *Webhook) getDBWebhook(userID, id int64) (*datalayer.Webhook, error) {
+	dl := w.serverState.DataLayer
+	webhook, err := dl.GetWebhookByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrWebhookNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query webhook [%d] from database", id), http.StatusInternalServerError, err)
+	}
+
+	if webhook.UserID != userID {
+		return nil, ErrWebhookNotFound
+	}
+
+	return webhook, nil
+}
+
+func (w *Webhook) GetWebhooksByUserID(userID int64) ([]*Webhook, error) {
+	dl := w.serverState.DataLayer
+	dbWebhooks, err := dl.GetWebhooksByUserID(userID)
+	if err != nil {
+		return nil, e.Wrap("Failed to query webhooks from database", http.StatusInternalServerError, err)
+	}
+
+	webhooks := make([]*Webhook, 0, len(dbWebhooks))
+	for _, webhook := range dbWebhooks {
+		webhooks = append(webhooks, newFromDBWebhook(webhook))
+	}
+
+	return webhooks, nil
+}
+
+func (w *Webhook) UpdateWebhook(userID, id int64) (*Webhook, error) {
+	_, err := w.GetWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	w.ID = id
+	err = w.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	dl := w.serverState.DataLayer
+	err = dl.UpdateWebhook(w.convertToDB(userID))
+	if err != nil {
+		return nil, e.Wrap("Failed to update webhook", http.StatusInternalServerError, err)
+	}
+
+	return w.GetWebhook(userID, id)
+}
+
+func (w *Webhook) DeleteWebhook(userID, id int64) error {
+	_, err := w.GetWebhook(userID, id)
+	if err != nil {
+		return err
+	}
+
+	dl := w.serverState.DataLayer
+	err = dl.DeleteWebhook(userID, id)
+	if err != nil {
+		return e.Wrap("Failed to delete webhook", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveries returns the webhook's most recent deliveries, newest
+// first.
+func (w *Webhook) GetWebhookDeliveries(userID, id int64) ([]*WebhookDelivery, error) {
+	_, err := w.GetWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	dl := w.serverState.DataLayer
+	dbDeliveries, err := dl.GetWebhookDeliveriesByWebhookID(id, webhookDeliveryLog)
+	if err != nil {
+		return nil, e.Wrap("Failed to query webhook deliveries from database", http.StatusInternalServerError, err)
+	}
+
+	deliveries := make([]*WebhookDelivery, 0, len(dbDeliveries))
+	for _, delivery := range dbDeliveries {
+		deliveries = append(deliveries, newFromDBWebhookDelivery(delivery))
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver sends the payload of an earlier delivery again as a new delivery,
+// straight away, and returns its outcome.
+func (w *Webhook) Redeliver(userID, id, deliveryID int64) (*WebhookDelivery, error) {
+	webhook, err := w.getDBWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	dl := w.serverState.DataLayer
+	original, err := dl.GetWebhookDeliveryByID(deliveryID)
+	if err == datalayer.ErrNoData || err == nil && original.WebhookID != webhook.ID {
+		return nil, ErrWebhookDeliveryNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query webhook delivery [%d] from database", deliveryID), http.StatusInternalServerError, err)
+	}
+
+	delivery, err := createWebhookDelivery(w.serverState, webhook, original.EventType, original.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = attemptWebhookDelivery(w.serverState, webhook, delivery, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return newFromDBWebhookDelivery(delivery), nil
+}
+
+func createWebhookDelivery(state *state.ServerState, webhook *datalayer.Webhook, eventType, payload string) (*datalayer.WebhookDelivery, error) {
+	delivery := &datalayer.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventType: eventType,
+		Payload:   payload,
+		State:     datalayer.WebhookDeliveryPending,
+	}
+	// Timestamps are stored to the second, so round down to make sure the
+	// delivery is due straight away.
+	delivery.NextAttemptAt.Time = time.Now().UTC().Truncate(time.Second)
+	delivery.NextAttemptAt.Valid = true
+
+	dl := state.DataLayer
+	id, err := dl.CreateWebhookDelivery(delivery)
+	if err != nil {
+		return nil, e.Wrap("Failed to store webhook delivery", http.StatusInternalServerError, err)
+	}
+	delivery.ID = id
+
+	return delivery, nil
+}
+
+// EnqueueWebhookDeliveries stores a pending delivery of the event for each of
+// its user's active webhooks that selects it.
+func EnqueueWebhookDeliveries(state *state.ServerState, event events.Event) error {
+	dl := state.DataLayer
+	webhooks, err := dl.GetWebhooksByUserID(event.UserID)
+	if err != nil {
+		return e.Wrap("Failed to query webhooks from database", http.StatusInternalServerError, err)
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.Active || !webhookSelects(webhook, event.Type) {
+			continue
+		}
+
+		if payload == nil {
+			payload, err = json.Marshal(WebhookPayload{
+				Event:     event.Type,
+				EventID:   event.ID,
+				UserID:    event.UserID,
+				CreatedAt: time.Now().UTC(),
+				Data:      event.Data,
+			})
+			if err != nil {
+				return e.Wrap("Failed to encode webhook payload", http.StatusInternalServerError, err)
+			}
+		}
+
+		_, err = createWebhookDelivery(state, webhook, event.Type, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func webhookSelects(webhook *datalayer.Webhook, eventType string) bool {
+	if len(webhook.EventTypes) == 0 {
+		return true
+	}
+	for _, selected := range strings.Split(webhook.EventTypes, ",") {
+		if selected == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliverDueWebhooks attempts every pending delivery that is due, returning
+// the number attempted.  Deliveries are claimed first so that servers sharing
+// the database do not send the same one twice.
+func DeliverDueWebhooks(state *state.ServerState, now time.Time) (int, error) {
+	dl := state.DataLayer
+	deliveries, err := dl.GetDueWebhookDeliveries(now, 100)
+	if err != nil {
+		return 0, e.Wrap("Failed to query due webhook deliveries", http.StatusInternalServerError, err)
+	}
+
+	attempted := 0
+	for _, delivery := range deliveries {
+		claimed, err := dl.ClaimWebhookDelivery(delivery.ID, now, now.Add(webhookLease))
+		if err != nil {
+			return attempted, e.Wrap("Failed to claim webhook delivery", http.StatusInternalServerError, err)
+		}
+		if !claimed {
+			continue
+		}
+
+		webhook, err := dl.GetWebhookByID(delivery.WebhookID)
+		if err != nil {
+			return attempted, e.Wrap(fmt.Sprintf("Failed to query webhook [%d] from database", delivery.WebhookID), http.StatusInternalServerError, err)
+		}
+
+		err = attemptWebhookDelivery(state, webhook, delivery, now)
+		if err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+
+	return attempted, nil
+}
+
+// attemptWebhookDelivery POSTs the payload and records the outcome.  Any 2xx
+// response succeeds; otherwise the delivery is retried with exponential
+// backoff until it has been tried WebhookMaxAttempts times.
+func attemptWebhookDelivery(state *state.ServerState, webhook *datalayer.Webhook, delivery *datalayer.WebhookDelivery, now time.Time) error {
+	delivery.Attempts++
+	delivery.LastAttemptAt.Time = now
+	delivery.LastAttemptAt.Valid = true
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+
+	client := webhookClient
+	if state.AllowPrivateWebhooks {
+		client = privateWebhookClient
+	}
+	status, err := postWebhook(client, webhook, delivery, now)
+	delivery.ResponseStatus = status
+	switch {
+	case err != nil:
+		delivery.Error = truncateString(err.Error(), 1024)
+	case status < 200 || status > 299:
+		delivery.Error = fmt.Sprintf("webhook responded with status %d", status)
+	}
+
+	switch {
+	case len(delivery.Error) == 0:
+		delivery.State = datalayer.WebhookDeliverySucceeded
+		delivery.NextAttemptAt.Valid = false
+	case delivery.Attempts >= WebhookMaxAttempts:
+		delivery.State = datalayer.WebhookDeliveryFailed
+		delivery.NextAttemptAt.Valid = false
+	default:
+		delivery.State = datalayer.WebhookDeliveryPending
+		delivery.NextAttemptAt.Time = now.Add(WebhookRetryBackoff(delivery.Attempts))
+		delivery.NextAttemptAt.Valid = true
+	}
+
+	err = state.DataLayer.UpdateWebhookDeliveryAttempt(delivery)
+	if err != nil {
+		return e.Wrap("Failed to record webhook delivery", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+func postWebhook(client *http.Client, webhook *datalayer.Webhook, delivery *datalayer.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gowebserver-webhooks")
+	req.Header.Set("X-Webhook-ID", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(webhook.Secret, timestamp, []byte(delivery.Payload)))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	_, err = io.Copy(ioutil.Discard, io.LimitReader(res.Body, webhookResponseLimit))
+	if err != nil {
+		return res.StatusCode, err
+	}
+
+	return res.StatusCode, nil
+}
+
+// WebhookRetryBackoff is the wait before retrying a delivery that has failed
+// attempts times.
+func WebhookRetryBackoff(attempts int) time.Duration {
+	backoff := webhookBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+// SignWebhookPayload returns the X-Webhook-Signature of a payload: the hex
+// encoded HMAC-SHA256 of the timestamp, a full stop and the body, keyed with
+// the webhook's secret.  Receivers should recompute it and compare in
+// constant time, and reject stale timestamps to prevent replays.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
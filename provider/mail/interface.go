@@ -2,4 +2,6 @@ package mail
 
 type Client interface {
 	SendMail(to []string, from, subject, message string) error
+	// SendHTMLMail sends a message with plain text and HTML alternatives.
+	SendHTMLMail(to []string, from, subject, text, html string) error
 }
\ No newline at end of file
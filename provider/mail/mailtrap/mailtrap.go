@@ -1,12 +1,15 @@
 package mailtrap
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/smtp"
+	"net/textproto"
 	"os"
 	"strconv"
 	"strings"
@@ -103,3 +106,40 @@ func (m *MailTrap) SendMail(to []string, from, subject, message string) error {
 
 	return nil
 }
+
+func (m *MailTrap) SendHTMLMail(to []string, from, subject, text, html string) error {
+	config := &m.config
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain", text},
+		{"text/html", html},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType+"; charset=UTF-8")
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(part.content))
+		if err != nil {
+			return err
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return err
+	}
+
+	toList := strings.Join(to, ",")
+	msg := fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\nMIME-Version: 1.0\nContent-Type: multipart/alternative; boundary=%s\n\n%s",
+		from, toList, subject, writer.Boundary(), body.String())
+	auth := smtp.CRAMMD5Auth(config.Username, config.Password)
+	addr := config.Host + ":" + strconv.Itoa(config.SMTPPorts[3])
+
+	return smtp.SendMail(addr, auth, from, to, []byte(msg))
+}
@@ -14,6 +14,7 @@ type MockClient struct {
 	CallbackFunc CallbackFunc
 	Group        *sync.WaitGroup
 	Body         string
+	done         sync.Once
 }
 
 func New(client *MockClient) *MockClient {
@@ -23,8 +24,13 @@ func New(client *MockClient) *MockClient {
 }
 
 func (m *MockClient) SendMail(to []string, from, subject, message string) error {
-	defer m.Group.Done()
+	// Group waits for the first mail only; later ones must not take it below zero.
+	defer m.done.Do(m.Group.Done)
 	m.CallbackFunc(m.T, m.Context, to, from, subject, message)
 
 	return nil
-}
\ No newline at end of file
+}
+// SendHTMLMail hands the plain text alternative to the callback.
+func (m *MockClient) SendHTMLMail(to []string, from, subject, text, html string) error {
+	return m.SendMail(to, from, subject, text)
+}
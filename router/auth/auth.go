@@ -1,24 +1,24 @@
 package auth
 
 import (
-	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	e "github.com/donohutcheon/gowebserver/controllers/errors"
-
+	"github.com/donohutcheon/gowebserver/lib/nonce"
+	"github.com/donohutcheon/gowebserver/lib/signing"
+	models_auth "github.com/donohutcheon/gowebserver/models/auth"
 )
 
 const AccessTokenLifeSpan = 36000
 const RefreshTokenLifeSpan = 864000
-const APITokenLifeSpan = 31536000
+const ChallengeTokenLifeSpan = 300
+const TicketLifeSpan = 30
 
-type JSONWebToken struct {
-	UserID int64 `json:"userID"`
-	jwt.StandardClaims
-}
+// JSONWebToken is the claims of every token, shared with the middleware that
+// checks them.
+type JSONWebToken = models_auth.JSONWebToken
 
 type RefreshJWTReq struct {
 	GrantType    string `json:"grantType" sql:"-"`
@@ -31,91 +31,215 @@ type TokenResponse struct {
 	RefreshToken string  `json:"refreshToken" sql:"-"`
 }
 
-type APITokenResponse struct {
-	ExpiresIn int64 `json:"expiresIn"`
-	APIToken string `json:"apiToken" sql:"-"`
+// ChallengeResponse is given at sign in instead of tokens to users with
+// two-factor authentication, to be exchanged for tokens along with a code.
+type ChallengeResponse struct {
+	ExpiresIn      int64  `json:"expiresIn"`
+	ChallengeToken string `json:"challengeToken"`
+}
+
+// TicketResponse is given in exchange for an access token, to be passed as
+// the ticket query parameter of a WebSocket handshake.
+type TicketResponse struct {
+	ExpiresIn int64  `json:"expiresIn"`
+	Ticket    string `json:"ticket"`
 }
 
-func CreateToken(userID int64) (*TokenResponse, error){
+// CreateToken issues an access and a refresh token for a session, signed with
+// the active key, and returns the claims of the refresh token for the caller
+// to record.  Tokens refreshed from the same sign in keep its sessionID, so
+// that the session can be revoked as a whole; an empty sessionID starts a new
+// session.
+func CreateToken(keys *signing.KeySet, userID int64, roles []string, sessionID string) (*TokenResponse, *JSONWebToken, error){
+	var err error
+	if len(sessionID) == 0 {
+		sessionID, err = newTokenID()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	accessTokenID, err := newTokenID()
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshTokenID, err := newTokenID()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	token := new(TokenResponse)
 	now := time.Now()
 	epochSecs := now.Unix()
+	epochMicros := now.UnixNano() / int64(time.Microsecond)
 	expireDateTime := epochSecs + AccessTokenLifeSpan
 	token.ExpiresIn = expireDateTime
 	accessToken := &JSONWebToken{
-		UserID: userID,
+		UserID:    userID,
+		Roles:     roles,
+		SessionID:     sessionID,
+		Type:          models_auth.TokenTypeAccess,
+		IssuedAtMicro: epochMicros,
 		StandardClaims: jwt.StandardClaims{
+			Id:        accessTokenID,
 			ExpiresAt: expireDateTime,
 			IssuedAt:  epochSecs,
 		},
 	}
 
-	signedAccessToken := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), accessToken)
-	accessTokenString, _ := signedAccessToken.SignedString([]byte(os.Getenv("token_password")))
-	token.AccessToken = accessTokenString
+	token.AccessToken, err = keys.Sign(accessToken)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	refreshToken := &JSONWebToken{
-		UserID: userID,
+		UserID:    userID,
+		Roles:     roles,
+		SessionID:     sessionID,
+		Type:          models_auth.TokenTypeRefresh,
+		IssuedAtMicro: epochMicros,
 		StandardClaims: jwt.StandardClaims{
+			Id:        refreshTokenID,
 			ExpiresAt: epochSecs + RefreshTokenLifeSpan,
 			IssuedAt:  epochSecs,
 		},
 	}
-	signedRefreshToken := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), refreshToken)
-	refreshTokenString, _ := signedRefreshToken.SignedString([]byte(os.Getenv("token_password")))
-	token.RefreshToken = refreshTokenString
+	token.RefreshToken, err = keys.Sign(refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return token, nil
+	return token, refreshToken, nil
 }
 
-func RefreshToken(rawToken string) (*TokenResponse, error) {
+// ParseRefreshToken checks a refresh token and returns its claims.  The
+// caller issues the new tokens, so that they carry the user's current roles.
+// Every failure is a 401, telling the client to sign in again.
+func ParseRefreshToken(keys *signing.KeySet, rawToken string) (*JSONWebToken, error) {
 	tk := new(JSONWebToken)
 
-	token, err := jwt.ParseWithClaims(rawToken, tk, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("token_password")), nil
-	})
-	if err != nil { //Malformed token, returns with http code 403 as usual
-		return nil, e.Wrap("Token rejected", http.StatusForbidden, err)
+	token, err := jwt.ParseWithClaims(rawToken, tk, keys.Keyfunc)
+	if err != nil { //Malformed or expired token
+		return nil, e.Wrap("Token rejected", http.StatusUnauthorized, err)
 	}
 
 	if !token.Valid { //Token is invalid, maybe not signed on this server
-		return nil, e.NewError("token is not valid", nil, http.StatusForbidden)
+		return nil, e.NewError("token is not valid", nil, http.StatusUnauthorized)
 	}
 
-	fmt.Printf("UserID %d", tk.UserID)
+	if tk.Type != models_auth.TokenTypeRefresh || len(tk.Id) == 0 {
+		return nil, e.NewError("token is not a refresh token", nil, http.StatusUnauthorized)
+	}
+
+	return tk, nil
+}
 
-	//Create JWT token
-	tokenResp, err := CreateToken(tk.UserID)
+// CreateChallengeToken issues a challenge token for a user who has given
+// their password but still has to give a second factor.  It carries no
+// roles, as it grants nothing by itself.
+func CreateChallengeToken(keys *signing.KeySet, userID int64) (*ChallengeResponse, error) {
+	tokenID, err := newTokenID()
 	if err != nil {
-		return nil, e.Wrap("token creation failed", http.StatusInternalServerError, err)
+		return nil, err
+	}
+
+	now := time.Now()
+	epochSecs := now.Unix()
+	challengeToken := &JSONWebToken{
+		UserID:        userID,
+		Type:          models_auth.TokenTypeChallenge,
+		IssuedAtMicro: now.UnixNano() / int64(time.Microsecond),
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			ExpiresAt: epochSecs + ChallengeTokenLifeSpan,
+			IssuedAt:  epochSecs,
+		},
 	}
 
-	return tokenResp, nil
+	challenge := &ChallengeResponse{ExpiresIn: challengeToken.ExpiresAt}
+	challenge.ChallengeToken, err = keys.Sign(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// ParseChallengeToken checks a challenge token and returns its claims.  Every
+// failure is a 401, telling the client to sign in again.
+func ParseChallengeToken(keys *signing.KeySet, rawToken string) (*JSONWebToken, error) {
+	tk := new(JSONWebToken)
+
+	token, err := jwt.ParseWithClaims(rawToken, tk, keys.Keyfunc)
+	if err != nil { //Malformed or expired token
+		return nil, e.Wrap("Token rejected", http.StatusUnauthorized, err)
+	}
+
+	if !token.Valid {
+		return nil, e.NewError("token is not valid", nil, http.StatusUnauthorized)
+	}
+
+	if tk.Type != models_auth.TokenTypeChallenge || len(tk.Id) == 0 {
+		return nil, e.NewError("token is not a challenge token", nil, http.StatusUnauthorized)
+	}
+
+	return tk, nil
 }
 
-func CreateAPIToken(userID int64) (*APITokenResponse, error){
+// CreateTicket issues a ticket for the session of an access token.  It
+// carries the token's user, roles and session, so that it is revoked along
+// with the session.
+func CreateTicket(keys *signing.KeySet, accessToken *JSONWebToken) (*TicketResponse, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	epochSecs := now.Unix()
-	expireDateTime := epochSecs + APITokenLifeSpan
-
-	accessToken := &JSONWebToken{
-		UserID: userID,
+	ticket := &JSONWebToken{
+		UserID:        accessToken.UserID,
+		Roles:         accessToken.Roles,
+		SessionID:     accessToken.SessionID,
+		Type:          models_auth.TokenTypeTicket,
+		IssuedAtMicro: now.UnixNano() / int64(time.Microsecond),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expireDateTime,
+			Id:        tokenID,
+			ExpiresAt: epochSecs + TicketLifeSpan,
 			IssuedAt:  epochSecs,
 		},
 	}
 
-	signedAccessToken := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), accessToken)
-	apiTokenString, err := signedAccessToken.SignedString([]byte(os.Getenv("token_password")))
+	resp := &TicketResponse{ExpiresIn: ticket.ExpiresAt}
+	resp.Ticket, err = keys.Sign(ticket)
 	if err != nil {
 		return nil, err
 	}
 
-	token := &APITokenResponse{
-		ExpiresIn: expireDateTime,
-		APIToken: apiTokenString,
+	return resp, nil
+}
+
+// ParseTicket checks a ticket and returns its claims.  Every failure is a
+// 403, like that of any other token rejected by the middleware.
+func ParseTicket(keys *signing.KeySet, rawTicket string) (*JSONWebToken, error) {
+	tk := new(JSONWebToken)
+
+	token, err := jwt.ParseWithClaims(rawTicket, tk, keys.Keyfunc)
+	if err != nil { //Malformed or expired ticket
+		return nil, e.Wrap("Ticket rejected", http.StatusForbidden, err)
+	}
+
+	if !token.Valid {
+		return nil, e.NewError("ticket is not valid", nil, http.StatusForbidden)
 	}
 
-	return token, nil
+	if tk.Type != models_auth.TokenTypeTicket || len(tk.Id) == 0 {
+		return nil, e.NewError("token is not a ticket", nil, http.StatusForbidden)
+	}
+
+	return tk, nil
+}
+
+// newTokenID returns a random, unguessable token or session ID.
+func newTokenID() (string, error) {
+	return nonce.GenerateSecret(16)
 }
@@ -15,10 +15,12 @@ import (
 	"time"
 
 	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
 	"github.com/donohutcheon/gowebserver/models/auth"
 	"github.com/donohutcheon/gowebserver/router/routes"
 	"github.com/donohutcheon/gowebserver/state"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 )
 
 type Handlers struct {
@@ -30,6 +32,12 @@ const (
 	indexPath = "index.html"
 )
 
+// writeTimeout bounds how long a non-streaming route may take to respond.  It
+// replaces the server's WriteTimeout, which would also cut streaming routes off.
+const writeTimeout = 10 * time.Second
+
+const timeoutMessage = `{"status":false,"message":"Request timed out"}`
+
 func getFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
@@ -39,7 +47,9 @@ func (h *Handlers) WrapHandlerFunc(next routes.HandlerFunc) http.HandlerFunc {
 		startTime := time.Now()
 		logger := h.serverState.Logger
 		//TODO: Format time
-		defer logger.Printf("request processed in %v, %v\n", getFunctionName(next),  time.Since(startTime))
+		defer func() {
+			logger.Printf("request processed in %v, %v\n", getFunctionName(next), time.Since(startTime))
+		}()
 		err := next(w, r, h.serverState)
 		if err != nil {
 			logger.Printf("Controller error: %v", err)
@@ -52,7 +62,9 @@ func (h *Handlers) WrapMiddlewareFunc(next routes.MiddlewareFunc, registry map[s
 		startTime := time.Now()
 		logger := h.serverState.Logger
 		//TODO: Format time
-		defer logger.Printf("request processed in %v, %v\n", getFunctionName(next), time.Since(startTime))
+		defer func() {
+			logger.Printf("request processed in %v, %v\n", getFunctionName(next), time.Since(startTime))
+		}()
 
 		return next(mwf, h.serverState, registry)
 	}
@@ -73,7 +85,15 @@ func (h *Handlers) SetupRoutes(router *mux.Router, options ...func() error) erro
 		if e.Handler == nil {
 			continue
 		}
-		router.HandleFunc(r, h.WrapHandlerFunc(e.Handler)).Methods(e.Methods...)
+		var handler http.Handler = h.WrapHandlerFunc(e.Handler)
+		if !e.Streaming {
+			timeout := writeTimeout
+			if e.Timeout > 0 {
+				timeout = e.Timeout
+			}
+			handler = http.TimeoutHandler(handler, timeout, timeoutMessage)
+		}
+		router.Handle(r, handler).Methods(e.Methods...)
 	}
 
 	router.Use(mux.CORSMethodMiddleware(router))
@@ -127,6 +147,8 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 
 		//check if request does not need authentication, serve the request if it doesn't need it
 		var isPublicMatch bool
+		var requiredRoles []string
+		var routeScope string
 		err := state.Router.Walk(func (route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 			pathTemplate, err := route.GetPathTemplate()
 			if err != nil {
@@ -152,6 +174,8 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 					return nil
 				}
 				isPublicMatch = v.Public
+				requiredRoles = v.Roles
+				routeScope = v.Scope
 				return nil
 			}
 
@@ -173,6 +197,18 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 		}
 
 		tokenHeader := r.Header.Get("Authorization")
+		if tokenHeader == "" && websocket.IsWebSocketUpgrade(r) {
+			// Browsers cannot set headers on a WebSocket handshake, so they
+			// pass a single-use ticket as a query parameter instead.  Unlike
+			// an access token it is of no use once it has leaked into a log.
+			if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+				ctx, ok := ticketAuthentication(w, r, state, ticket, requiredRoles)
+				if ok {
+					next.ServeHTTP(w, r.WithContext(ctx))
+				}
+				return
+			}
+		}
 		if tokenHeader == "" {
 			resp := response.New(false, "Missing auth token")
 			w.WriteHeader(http.StatusForbidden)
@@ -197,11 +233,17 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 		}
 
 		tokenPart := splitted[1] //Grab the token part, what we are truly interested in
+		if strings.HasPrefix(tokenPart, models.APITokenPrefix) {
+			ctx, ok := apiTokenAuthentication(w, r, state, tokenPart, routeScope)
+			if ok {
+				next.ServeHTTP(w, r.WithContext(ctx))
+			}
+			return
+		}
+
 		tk := &auth.JSONWebToken{}
 
-		token, err := jwt.ParseWithClaims(tokenPart, tk, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("token_password")), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenPart, tk, state.Keys.Keyfunc)
 
 		if err != nil { //Malformed token, returns with http code 403 as usual
 			message := fmt.Sprintf("Token rejected, %s", err.Error())
@@ -226,14 +268,147 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 			return
 		}
 
+		if tk.Type != auth.TokenTypeAccess {
+			resp := response.New(false, "Token rejected, only access and API tokens authenticate requests")
+			w.WriteHeader(http.StatusForbidden)
+			w.Header().Add("Content-Type", "application/json")
+			err := resp.Respond(w)
+			if err != nil {
+				logger.Println(err)
+			}
+			return
+		}
+
+		revoked, err := state.Revocations.IsRevoked(tk.UserID, tk.Issued(), tk.Id, tk.SessionID)
+		if err != nil {
+			resp := response.New(false, "Internal server error.  Token revocation check failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Add("Content-Type", "application/json")
+			err := resp.Respond(w)
+			if err != nil {
+				logger.Println(err)
+			}
+			return
+		} else if revoked {
+			resp := response.New(false, "Token has been revoked")
+			w.WriteHeader(http.StatusForbidden)
+			w.Header().Add("Content-Type", "application/json")
+			err := resp.Respond(w)
+			if err != nil {
+				logger.Println(err)
+			}
+			return
+		}
+
+		for _, role := range requiredRoles {
+			if !hasRole(tk.Roles, role) {
+				resp := response.New(false, fmt.Sprintf("Forbidden, the %s role is required", role))
+				w.WriteHeader(http.StatusForbidden)
+				w.Header().Add("Content-Type", "application/json")
+				err := resp.Respond(w)
+				if err != nil {
+					logger.Println(err)
+				}
+				return
+			}
+		}
+
 		//Everything went well, proceed with the request and set the caller to the user retrieved from the parsed token
 		fmt.Printf("User %d", tk.UserID) //Useful for monitoring
 		ctx := context.WithValue(r.Context(), auth.UserKey, tk.UserID)
+		ctx = context.WithValue(ctx, auth.RolesKey, tk.Roles)
+		ctx = context.WithValue(ctx, auth.TokenKey, tk)
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r) //proceed in the middleware chain!
 	})
 }
 
+// apiTokenAuthentication checks an API token and that its scopes cover the
+// route, writing the response if not.  API tokens carry no roles.
+func apiTokenAuthentication(w http.ResponseWriter, r *http.Request, state *state.ServerState, rawToken,
+	routeScope string) (context.Context, bool) {
+	logger := state.Logger
+	apiToken, err := models.AuthenticateAPIToken(state, rawToken)
+	if err != nil {
+		errors.WriteError(w, err)
+		return nil, false
+	}
+
+	revoked, err := state.Revocations.IsRevoked(apiToken.UserID, apiToken.CreatedAt.Time)
+	if err != nil {
+		resp := response.New(false, "Internal server error.  Token revocation check failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		err := resp.Respond(w)
+		if err != nil {
+			logger.Println(err)
+		}
+		return nil, false
+	} else if revoked {
+		errors.WriteError(w, models.ErrAPITokenRevoked)
+		return nil, false
+	}
+
+	var message string
+	if len(routeScope) == 0 {
+		message = "Forbidden, API tokens cannot be used here"
+	} else if scope := auth.RequiredScope(routeScope, r.Method); !apiToken.HasScope(scope) {
+		message = fmt.Sprintf("Forbidden, the %s scope is required", scope)
+	}
+	if len(message) > 0 {
+		resp := response.New(false, message)
+		w.WriteHeader(http.StatusForbidden)
+		err := resp.Respond(w)
+		if err != nil {
+			logger.Println(err)
+		}
+		return nil, false
+	}
+
+	ctx := context.WithValue(r.Context(), auth.UserKey, apiToken.UserID)
+	ctx = context.WithValue(ctx, auth.RolesKey, []string{})
+	ctx = context.WithValue(ctx, auth.ScopesKey, apiToken.Scopes)
+	ctx = context.WithValue(ctx, auth.APITokenKey, apiToken.ID)
+	return ctx, true
+}
+
+// ticketAuthentication redeems a WebSocket ticket and checks that it carries
+// the roles the route requires, writing the response if not.
+func ticketAuthentication(w http.ResponseWriter, r *http.Request, state *state.ServerState, rawTicket string,
+	requiredRoles []string) (context.Context, bool) {
+	tk, err := models.RedeemTicket(state, rawTicket)
+	if err != nil {
+		errors.WriteError(w, err)
+		return nil, false
+	}
+
+	for _, role := range requiredRoles {
+		if !hasRole(tk.Roles, role) {
+			resp := response.New(false, fmt.Sprintf("Forbidden, the %s role is required", role))
+			w.WriteHeader(http.StatusForbidden)
+			err := resp.Respond(w)
+			if err != nil {
+				state.Logger.Println(err)
+			}
+			return nil, false
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), auth.UserKey, tk.UserID)
+	ctx = context.WithValue(ctx, auth.RolesKey, tk.Roles)
+	ctx = context.WithValue(ctx, auth.TokenKey, tk)
+	return ctx, true
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ServeHTTP inspects the URL path to locate a file within the static dir
 // on the SPA handler. If a file is found, it will be served. If not, the
 // file located at the index path on the SPA handler will be served. This
@@ -2,18 +2,30 @@ package routes
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/donohutcheon/gowebserver/controllers"
+	"github.com/donohutcheon/gowebserver/models/auth"
 	"github.com/donohutcheon/gowebserver/state"
 )
 
 type MiddlewareFunc func(next http.Handler, state *state.ServerState, registry map[string]RouteEntry) http.Handler
 type HandlerFunc func(w http.ResponseWriter, r *http.Request, handlerState *state.ServerState) error
 
+// RouteEntry describes a route.  Streaming routes hold their response open
+// and are exempt from the write timeout applied to every other route.  A
+// Timeout replaces that write timeout for routes that need longer.  The
+// caller of a route with Roles must hold every one of them.  API tokens may
+// only call routes with a Scope, the resource the route belongs to, and need
+// read or write access to it depending on the method.
 type RouteEntry struct {
-	Handler HandlerFunc
-	Methods []string
-	Public bool
+	Handler   HandlerFunc
+	Methods   []string
+	Public    bool
+	Streaming bool
+	Timeout   time.Duration
+	Roles     []string
+	Scope     string
 }
 
 func GetRouteRegistry() map[string]RouteEntry {
@@ -26,6 +38,11 @@ func GetRouteRegistry() map[string]RouteEntry {
 			Methods: []string{http.MethodGet},
 			Public:  true,
 		},
+		"/.well-known/jwks.json" : {
+			Handler: controllers.GetJWKS,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Public:  true,
+		},
 		"/api/auth/sign-up" : {
 			Handler: controllers.CreateUser,
 			Methods: []string{http.MethodPost, http.MethodOptions},
@@ -34,12 +51,42 @@ func GetRouteRegistry() map[string]RouteEntry {
 		"/api/users/current" : {
 			Handler: controllers.GetCurrentUser,
 			Methods: []string{http.MethodGet, http.MethodOptions},
+			Scope:   auth.ResourceProfile,
+		},
+		"/api/me/password" : {
+			Handler: controllers.ChangePassword,
+			Methods: []string{http.MethodPut, http.MethodOptions},
+		},
+		"/api/me/email" : {
+			Handler: controllers.ChangeEmail,
+			Methods: []string{http.MethodPut, http.MethodOptions},
+		},
+		"/api/me/2fa" : {
+			Handler: controllers.GetTwoFactor,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+		},
+		"/api/me/2fa/totp" : {
+			Handler: controllers.TOTP,
+			Methods: []string{http.MethodPost, http.MethodDelete, http.MethodOptions},
+		},
+		"/api/me/2fa/totp/verify" : {
+			Handler: controllers.EnableTOTP,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+		},
+		"/api/me/2fa/recovery-codes" : {
+			Handler: controllers.RegenerateRecoveryCodes,
+			Methods: []string{http.MethodPost, http.MethodOptions},
 		},
 		"/api/auth/login" : {
 			Handler: controllers.Authenticate,
 			Methods: []string{http.MethodPost, http.MethodOptions},
 			Public:  true,
 		},
+		"/api/auth/2fa" : {
+			Handler: controllers.AuthenticateTwoFactor,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
 		"/api/auth/api-token" : {
 			Handler: controllers.GetAPIToken,
 			Methods: []string{http.MethodGet, http.MethodOptions},
@@ -49,13 +96,220 @@ func GetRouteRegistry() map[string]RouteEntry {
 			Methods: []string{http.MethodPost, http.MethodOptions},
 			Public:  true,
 		},
+		"/api/auth/password-reset" : {
+			Handler: controllers.RequestPasswordReset,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/password-reset/confirm" : {
+			Handler: controllers.ConfirmPasswordReset,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/resend-confirmation" : {
+			Handler: controllers.ResendConfirmation,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/logout" : {
+			Handler: controllers.Logout,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+		},
 		"/api/card-transactions/new" : {
 			Handler: controllers.CreateCardTransaction,
 			Methods: []string{http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourceTransactions,
 		},
 		"/api/me/card-transactions" : {
 			Handler: controllers.GetCardTransactions,
 			Methods: []string{http.MethodGet, http.MethodOptions},
+			Scope:   auth.ResourceTransactions,
+		},
+		"/api/me/card-transactions/summary" : {
+			Handler: controllers.GetCardTransactionSummary,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Scope:   auth.ResourceTransactions,
+		},
+		"/api/me/card-transactions/export" : {
+			Handler:   controllers.ExportCardTransactions,
+			Methods:   []string{http.MethodGet, http.MethodOptions},
+			Streaming: true,
+			Scope:     auth.ResourceTransactions,
+		},
+		"/api/me/card-transactions/{id:[0-9]+}/splits" : {
+			Handler: controllers.CardTransactionSplits,
+			Methods: []string{http.MethodGet, http.MethodPut, http.MethodOptions},
+			Scope:   auth.ResourceTransactions,
+		},
+		"/api/me/views" : {
+			Handler: controllers.SavedViews,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourceTransactions,
+		},
+		"/api/me/views/{id:[0-9]+}" : {
+			Handler: controllers.SavedView,
+			Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions},
+			Scope:   auth.ResourceTransactions,
+		},
+		"/api/me/events" : {
+			Handler:   controllers.GetEvents,
+			Methods:   []string{http.MethodGet, http.MethodOptions},
+			Streaming: true,
+			Scope:     auth.ResourceEvents,
+		},
+		"/api/me/socket" : {
+			Handler:   controllers.GetWebSocket,
+			Methods:   []string{http.MethodGet, http.MethodOptions},
+			Streaming: true,
+			Scope:     auth.ResourceEvents,
+		},
+		"/api/me/socket/tickets" : {
+			Handler: controllers.CreateWebSocketTicket,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+		},
+		"/api/me/webhooks" : {
+			Handler: controllers.Webhooks,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourceWebhooks,
+		},
+		"/api/me/webhooks/{id:[0-9]+}" : {
+			Handler: controllers.Webhook,
+			Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions},
+			Scope:   auth.ResourceWebhooks,
+		},
+		"/api/me/webhooks/{id:[0-9]+}/deliveries" : {
+			Handler: controllers.GetWebhookDeliveries,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Scope:   auth.ResourceWebhooks,
+		},
+		"/api/me/webhooks/{id:[0-9]+}/deliveries/{deliveryID:[0-9]+}/redeliver" : {
+			Handler: controllers.RedeliverWebhook,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourceWebhooks,
+		},
+		"/api/me/alerts" : {
+			Handler: controllers.AlertRules,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourceAlerts,
+		},
+		"/api/me/alerts/{id:[0-9]+}" : {
+			Handler: controllers.AlertRule,
+			Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions},
+			Scope:   auth.ResourceAlerts,
+		},
+		"/api/me/alerts/history" : {
+			Handler: controllers.GetAlertHistory,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Scope:   auth.ResourceAlerts,
+		},
+		"/api/me/report-preferences" : {
+			Handler: controllers.ReportPreferences,
+			Methods: []string{http.MethodGet, http.MethodPut, http.MethodOptions},
+			Scope:   auth.ResourceReports,
+		},
+		"/api/me/goals" : {
+			Handler: controllers.Goals,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourcePlanning,
+		},
+		"/api/me/goals/{id:[0-9]+}" : {
+			Handler: controllers.Goal,
+			Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions},
+			Scope:   auth.ResourcePlanning,
+		},
+		"/api/me/cash-flows" : {
+			Handler: controllers.CashFlows,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourcePlanning,
+		},
+		"/api/me/cash-flows/{id:[0-9]+}" : {
+			Handler: controllers.CashFlow,
+			Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions},
+			Scope:   auth.ResourcePlanning,
+		},
+		"/api/me/forecast" : {
+			Handler: controllers.GetForecast,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Scope:   auth.ResourcePlanning,
+		},
+		"/api/me/households" : {
+			Handler: controllers.Households,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourceHouseholds,
+		},
+		"/api/me/households/{id:[0-9]+}" : {
+			Handler: controllers.Household,
+			Methods: []string{http.MethodGet, http.MethodDelete, http.MethodOptions},
+			Scope:   auth.ResourceHouseholds,
+		},
+		"/api/me/households/{id:[0-9]+}/invitations" : {
+			Handler: controllers.InviteToHousehold,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourceHouseholds,
+		},
+		"/api/me/households/{id:[0-9]+}/members/{userID:[0-9]+}" : {
+			Handler: controllers.RemoveHouseholdMember,
+			Methods: []string{http.MethodDelete, http.MethodOptions},
+			Scope:   auth.ResourceHouseholds,
+		},
+		"/api/me/households/{id:[0-9]+}/grants/{userID:[0-9]+}" : {
+			Handler: controllers.SetHouseholdGrant,
+			Methods: []string{http.MethodPut, http.MethodOptions},
+			Scope:   auth.ResourceHouseholds,
+		},
+		"/api/me/household-invitations/{token}" : {
+			Handler: controllers.AcceptHouseholdInvitation,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Scope:   auth.ResourceHouseholds,
+		},
+		"/api/me/api-tokens" : {
+			Handler: controllers.APITokens,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+		},
+		"/api/me/api-tokens/{id:[0-9]+}" : {
+			Handler: controllers.APIToken,
+			Methods: []string{http.MethodDelete, http.MethodOptions},
+		},
+		"/api/admin/users" : {
+			Handler: controllers.AdminUsers,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id:[0-9]+}" : {
+			Handler: controllers.AdminUser,
+			Methods: []string{http.MethodGet, http.MethodDelete, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id:[0-9]+}/state" : {
+			Handler: controllers.SetUserState,
+			Methods: []string{http.MethodPut, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id:[0-9]+}/audit" : {
+			Handler: controllers.GetUserAudit,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id:[0-9]+}/confirmation" : {
+			Handler: controllers.ResendUserConfirmation,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id:[0-9]+}/unlock" : {
+			Handler: controllers.UnlockUserLogin,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id:[0-9]+}/roles" : {
+			Handler: controllers.SetUserRoles,
+			Methods: []string{http.MethodPut, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/me/imports" : {
+			Handler: controllers.CreateImport,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Timeout: 2 * time.Minute,
+			Scope:   auth.ResourceTransactions,
 		},
 		"/api/users/confirm/{nonce}" : {
 			Handler: controllers.ConfirmUserSignUp,
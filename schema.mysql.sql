@@ -8,8 +8,9 @@ CREATE TABLE `users` (
   `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
   `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
   `deleted_at` timestamp NULL DEFAULT NULL,
-  `logged_out_at` timestamp NULL DEFAULT NULL,
+  `logged_out_at` timestamp(6) NULL DEFAULT NULL,
   `email` varchar(255) DEFAULT NULL,
+  `pending_email` varchar(255) DEFAULT NULL,
   `password` varchar(255) DEFAULT NULL,
   `role` varchar(255) DEFAULT NULL,
   `state` varchar(16) DEFAULT NULL,
@@ -23,10 +24,13 @@ CREATE TABLE `sign_up_confirmations` (
   `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
   `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
   `deleted_at` timestamp NULL DEFAULT NULL,
-  `nonce` varchar(32) NOT NULL,
+  `nonce_hash` varchar(64) NOT NULL,
   `user_id` int(10) unsigned DEFAULT NULL,
+  `email` varchar(255) DEFAULT NULL,
+  `expires_at` timestamp NOT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
   PRIMARY KEY (`id`),
-  UNIQUE KEY `nonce` (`nonce`),
+  UNIQUE KEY `nonce_hash` (`nonce_hash`),
   FOREIGN KEY (user_id)
         REFERENCES users(id)
         ON DELETE CASCADE,
@@ -48,10 +52,425 @@ CREATE TABLE `card_transactions` (
   `merchant_country_name` varchar(255) NOT NULL,
   `merchant_category_code` varchar(255) NOT NULL,
   `merchant_category_name` varchar(255) NOT NULL,
+  `notes` varchar(1024) NOT NULL DEFAULT '',
+  `user_id` int(10) unsigned DEFAULT NULL,
+  `anomaly_score` TINYINT NOT NULL DEFAULT 0,
+  `anomaly_reasons` varchar(255) NOT NULL DEFAULT '',
+  `evaluated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_contacts_user_id` (`user_id`),
+  KEY `idx_card_transactions_evaluated_at` (`evaluated_at`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;;
+
+CREATE FULLTEXT INDEX `idx_card_transactions_search`
+ON card_transactions(reference, merchant_name, merchant_city, merchant_category_name, notes);
+
+CREATE TABLE `card_transaction_splits` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `card_transaction_id` int(10) unsigned NOT NULL,
+  `amount` BIGINT NOT NULL,
+  `currency_scale` TINYINT NOT NULL,
+  `category` varchar(255) NOT NULL,
+  `note` varchar(1024) NOT NULL DEFAULT '',
   `user_id` int(10) unsigned DEFAULT NULL,
   PRIMARY KEY (`id`),
+  FOREIGN KEY (card_transaction_id)
+        REFERENCES card_transactions(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE SET NULL,
+  KEY `idx_card_transaction_splits_card_transaction_id` (`card_transaction_id`),
+  KEY `idx_card_transaction_splits_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `saved_views` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `filter` varchar(2000) NOT NULL DEFAULT '',
+  `search` varchar(255) NOT NULL DEFAULT '',
+  `sort_field` varchar(64) NOT NULL DEFAULT '',
+  `sort_dir` varchar(4) NOT NULL DEFAULT '',
+  `columns` varchar(1024) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  UNIQUE KEY `idx_saved_views_user_id_name` (`user_id`, `name`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `webhooks` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `url` varchar(2048) NOT NULL,
+  `secret` varchar(64) NOT NULL,
+  `event_types` varchar(1024) NOT NULL DEFAULT '',
+  `active` tinyint(1) NOT NULL DEFAULT 1,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_webhooks_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `webhook_deliveries` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `webhook_id` int(10) unsigned NOT NULL,
+  `event_type` varchar(64) NOT NULL,
+  `payload` mediumtext NOT NULL,
+  `state` varchar(16) NOT NULL,
+  `attempts` int(10) NOT NULL DEFAULT 0,
+  `next_attempt_at` timestamp NULL DEFAULT NULL,
+  `last_attempt_at` timestamp NULL DEFAULT NULL,
+  `response_status` int(10) NOT NULL DEFAULT 0,
+  `error` varchar(1024) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (webhook_id)
+        REFERENCES webhooks(id)
+        ON DELETE CASCADE,
+  KEY `idx_webhook_deliveries_webhook_id` (`webhook_id`),
+  KEY `idx_webhook_deliveries_state_next_attempt_at` (`state`, `next_attempt_at`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `alert_rules` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `amount_above` varchar(32) NOT NULL DEFAULT '',
+  `home_country_code` varchar(3) NOT NULL DEFAULT '',
+  `category_codes` varchar(1024) NOT NULL DEFAULT '',
+  `new_merchant` tinyint(1) NOT NULL DEFAULT 0,
+  `filter` varchar(2000) NOT NULL DEFAULT '',
+  `notify_email` tinyint(1) NOT NULL DEFAULT 1,
+  `cooldown_minutes` int(10) NOT NULL DEFAULT 0,
+  `active` tinyint(1) NOT NULL DEFAULT 1,
+  `last_fired_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_alert_rules_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `alert_firings` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `alert_rule_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `card_transaction_id` int(10) unsigned NOT NULL,
+  `message` varchar(1024) NOT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (alert_rule_id)
+        REFERENCES alert_rules(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (card_transaction_id)
+        REFERENCES card_transactions(id)
+        ON DELETE CASCADE,
+  KEY `idx_alert_firings_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `report_preferences` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `cadence` varchar(16) NOT NULL DEFAULT 'NONE',
+  `timezone` varchar(64) NOT NULL DEFAULT 'UTC',
+  `next_report_at` timestamp NULL DEFAULT NULL,
+  `last_sent_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  UNIQUE KEY `idx_report_preferences_user_id` (`user_id`),
+  KEY `idx_report_preferences_next_report_at` (`next_report_at`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `spending_statistics` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `dimension` varchar(16) NOT NULL,
+  `stat_key` varchar(255) NOT NULL,
+  `currency_code` varchar(255) NOT NULL DEFAULT '',
+  `observations` BIGINT NOT NULL DEFAULT 0,
+  `log_mean` DOUBLE NOT NULL DEFAULT 0,
+  `log_variance` DOUBLE NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  UNIQUE KEY `idx_spending_statistics_key` (`user_id`, `dimension`, `stat_key`, `currency_code`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `goals` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `target_amount` BIGINT NOT NULL,
+  `saved_amount` BIGINT NOT NULL DEFAULT 0,
+  `currency_scale` TINYINT NOT NULL,
+  `currency_code` varchar(255) NOT NULL,
+  `target_date` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_goals_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `cash_flows` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `kind` varchar(16) NOT NULL,
+  `amount` BIGINT NOT NULL,
+  `currency_scale` TINYINT NOT NULL,
+  `currency_code` varchar(255) NOT NULL,
+  `day_of_month` TINYINT NOT NULL,
+  `merchant_name` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
   FOREIGN KEY (user_id)
         REFERENCES users(id)
         ON DELETE CASCADE,
-  KEY `idx_contacts_user_id` (`user_id`)
-) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
\ No newline at end of file
+  KEY `idx_cash_flows_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `households` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `name` varchar(255) NOT NULL,
+  `owner_user_id` int(10) unsigned NOT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (owner_user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `household_members` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `household_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_household_members_household_id_user_id` (`household_id`, `user_id`),
+  FOREIGN KEY (household_id)
+        REFERENCES households(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_household_members_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `household_invitations` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `household_id` int(10) unsigned NOT NULL,
+  `invited_by_user_id` int(10) unsigned NOT NULL,
+  `email` varchar(255) NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  `accepted_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_household_invitations_token_hash` (`token_hash`),
+  FOREIGN KEY (household_id)
+        REFERENCES households(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (invited_by_user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `household_grants` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `household_id` int(10) unsigned NOT NULL,
+  `grantor_user_id` int(10) unsigned NOT NULL,
+  `grantee_user_id` int(10) unsigned NOT NULL,
+  `access` varchar(16) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_household_grants_household_id_grantor_grantee` (`household_id`, `grantor_user_id`, `grantee_user_id`),
+  FOREIGN KEY (household_id)
+        REFERENCES households(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (grantor_user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (grantee_user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_household_grants_grantee_user_id` (`grantee_user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `user_audit_records` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `actor_user_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `action` varchar(32) NOT NULL,
+  `detail` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_user_audit_records_user_id` (`user_id`),
+  KEY `idx_user_audit_records_actor_user_id` (`actor_user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `revoked_tokens` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `token_id` varchar(64) NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_revoked_tokens_token_id` (`token_id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_revoked_tokens_expires_at` (`expires_at`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `refresh_tokens` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `token_id` varchar(64) NOT NULL,
+  `family_id` varchar(64) NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_refresh_tokens_token_id` (`token_id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_refresh_tokens_family_id` (`family_id`),
+  KEY `idx_refresh_tokens_user_id_expires_at` (`user_id`, `expires_at`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `api_tokens` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp(6) DEFAULT CURRENT_TIMESTAMP(6),
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `hint` varchar(16) NOT NULL,
+  `scopes` varchar(512) NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  `last_used_at` timestamp NULL DEFAULT NULL,
+  `revoked_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_api_tokens_token_hash` (`token_hash`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_api_tokens_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `password_resets` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_password_resets_token_hash` (`token_hash`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_password_resets_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `user_totp` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `secret` varchar(64) NOT NULL,
+  `enabled_at` timestamp NULL DEFAULT NULL,
+  `last_used_step` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_user_totp_user_id` (`user_id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `recovery_codes` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  KEY `idx_recovery_codes_user_id` (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+
+CREATE TABLE `login_attempts` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `attempt_key` varchar(255) NOT NULL,
+  `failures` int(10) unsigned NOT NULL DEFAULT 0,
+  `last_failure_at` timestamp NULL DEFAULT NULL,
+  `blocked_until` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_login_attempts_attempt_key` (`attempt_key`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
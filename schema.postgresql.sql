@@ -18,6 +18,7 @@ CREATE TABLE users (
   deleted_at TIMESTAMPTZ,
   logged_out_at TIMESTAMPTZ,
   email VARCHAR(255),
+  pending_email VARCHAR(255),
   password VARCHAR(255),
   role VARCHAR(255),
   state VARCHAR(16)
@@ -39,8 +40,11 @@ CREATE TABLE sign_up_confirmations (
   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   deleted_at TIMESTAMPTZ,
-  nonce VARCHAR(32) UNIQUE NOT NULL,
+  nonce_hash VARCHAR(64) UNIQUE NOT NULL,
   user_id BIGINT NOT NULL,
+  email VARCHAR(255),
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
   FOREIGN KEY (user_id)
         REFERENCES users(id)
         ON DELETE CASCADE
@@ -54,8 +58,8 @@ EXECUTE PROCEDURE trigger_set_timestamp();
 CREATE INDEX idx_sign_up_confirmations_user_id
 ON sign_up_confirmations(user_id);
 
-CREATE INDEX idx_sign_up_confirmations_nonce
-ON sign_up_confirmations(nonce);
+CREATE INDEX idx_sign_up_confirmations_nonce_hash
+ON sign_up_confirmations(nonce_hash);
 
 CREATE INDEX idx_sign_up_confirmations_deleted_at
 ON sign_up_confirmations(deleted_at);
@@ -74,7 +78,11 @@ CREATE TABLE card_transactions (
   merchant_country_name VARCHAR(255) NOT NULL,
   merchant_category_code VARCHAR(255) NOT NULL,
   merchant_category_name VARCHAR(255) NOT NULL,
+  notes VARCHAR(1024) NOT NULL DEFAULT '',
   user_id BIGINT NOT NULL,
+  anomaly_score SMALLINT NOT NULL DEFAULT 0,
+  anomaly_reasons VARCHAR(255) NOT NULL DEFAULT '',
+  evaluated_at TIMESTAMPTZ,
   FOREIGN KEY (user_id)
         REFERENCES users(id)
         ON DELETE CASCADE
@@ -83,3 +91,535 @@ CREATE TABLE card_transactions (
 CREATE INDEX idx_card_transactions_user_id
 ON card_transactions(user_id);
 
+CREATE INDEX idx_card_transactions_unevaluated
+ON card_transactions(id) WHERE evaluated_at IS NULL;
+
+CREATE TABLE card_transaction_splits (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  card_transaction_id BIGINT NOT NULL,
+  amount BIGINT NOT NULL,
+  currency_scale SMALLINT NOT NULL,
+  category VARCHAR(255) NOT NULL,
+  note VARCHAR(1024) NOT NULL DEFAULT '',
+  user_id BIGINT,
+  FOREIGN KEY (card_transaction_id)
+        REFERENCES card_transactions(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE SET NULL
+);
+
+CREATE TRIGGER card_transaction_split_updated
+BEFORE UPDATE ON card_transaction_splits
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_card_transaction_splits_card_transaction_id
+ON card_transaction_splits(card_transaction_id);
+
+CREATE INDEX idx_card_transaction_splits_user_id
+ON card_transaction_splits(user_id);
+
+CREATE TABLE saved_views (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  filter VARCHAR(2000) NOT NULL DEFAULT '',
+  search VARCHAR(255) NOT NULL DEFAULT '',
+  sort_field VARCHAR(64) NOT NULL DEFAULT '',
+  sort_dir VARCHAR(4) NOT NULL DEFAULT '',
+  columns VARCHAR(1024) NOT NULL DEFAULT '',
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  UNIQUE (user_id, name)
+);
+
+CREATE TRIGGER saved_view_updated
+BEFORE UPDATE ON saved_views
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE TABLE webhooks (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  url VARCHAR(2048) NOT NULL,
+  secret VARCHAR(64) NOT NULL,
+  event_types VARCHAR(1024) NOT NULL DEFAULT '',
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER webhook_updated
+BEFORE UPDATE ON webhooks
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_webhooks_user_id
+ON webhooks(user_id);
+
+CREATE TABLE webhook_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  webhook_id BIGINT NOT NULL,
+  event_type VARCHAR(64) NOT NULL,
+  payload TEXT NOT NULL,
+  state VARCHAR(16) NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ,
+  last_attempt_at TIMESTAMPTZ,
+  response_status INTEGER NOT NULL DEFAULT 0,
+  error VARCHAR(1024) NOT NULL DEFAULT '',
+  FOREIGN KEY (webhook_id)
+        REFERENCES webhooks(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER webhook_delivery_updated
+BEFORE UPDATE ON webhook_deliveries
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_webhook_deliveries_webhook_id
+ON webhook_deliveries(webhook_id);
+
+CREATE INDEX idx_webhook_deliveries_state_next_attempt_at
+ON webhook_deliveries(state, next_attempt_at);
+
+CREATE TABLE alert_rules (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  amount_above VARCHAR(32) NOT NULL DEFAULT '',
+  home_country_code VARCHAR(3) NOT NULL DEFAULT '',
+  category_codes VARCHAR(1024) NOT NULL DEFAULT '',
+  new_merchant BOOLEAN NOT NULL DEFAULT FALSE,
+  filter VARCHAR(2000) NOT NULL DEFAULT '',
+  notify_email BOOLEAN NOT NULL DEFAULT TRUE,
+  cooldown_minutes INTEGER NOT NULL DEFAULT 0,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  last_fired_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER alert_rule_updated
+BEFORE UPDATE ON alert_rules
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_alert_rules_user_id
+ON alert_rules(user_id);
+
+CREATE TABLE alert_firings (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  alert_rule_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  card_transaction_id BIGINT NOT NULL,
+  message VARCHAR(1024) NOT NULL,
+  FOREIGN KEY (alert_rule_id)
+        REFERENCES alert_rules(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (card_transaction_id)
+        REFERENCES card_transactions(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER alert_firing_updated
+BEFORE UPDATE ON alert_firings
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_alert_firings_user_id
+ON alert_firings(user_id);
+
+CREATE TABLE report_preferences (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL UNIQUE,
+  cadence VARCHAR(16) NOT NULL DEFAULT 'NONE',
+  timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+  next_report_at TIMESTAMPTZ,
+  last_sent_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER report_preference_updated
+BEFORE UPDATE ON report_preferences
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_report_preferences_next_report_at
+ON report_preferences(next_report_at);
+
+CREATE TABLE spending_statistics (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  dimension VARCHAR(16) NOT NULL,
+  stat_key VARCHAR(255) NOT NULL,
+  currency_code VARCHAR(255) NOT NULL DEFAULT '',
+  observations BIGINT NOT NULL DEFAULT 0,
+  log_mean DOUBLE PRECISION NOT NULL DEFAULT 0,
+  log_variance DOUBLE PRECISION NOT NULL DEFAULT 0,
+  UNIQUE (user_id, dimension, stat_key, currency_code),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER spending_statistic_updated
+BEFORE UPDATE ON spending_statistics
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE TABLE goals (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  target_amount BIGINT NOT NULL,
+  saved_amount BIGINT NOT NULL DEFAULT 0,
+  currency_scale SMALLINT NOT NULL,
+  currency_code VARCHAR(255) NOT NULL,
+  target_date TIMESTAMPTZ,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER goal_updated
+BEFORE UPDATE ON goals
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_goals_user_id
+ON goals(user_id);
+
+CREATE TABLE cash_flows (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  amount BIGINT NOT NULL,
+  currency_scale SMALLINT NOT NULL,
+  currency_code VARCHAR(255) NOT NULL,
+  day_of_month SMALLINT NOT NULL,
+  merchant_name VARCHAR(255) NOT NULL DEFAULT '',
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER cash_flow_updated
+BEFORE UPDATE ON cash_flows
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_cash_flows_user_id
+ON cash_flows(user_id);
+
+CREATE TABLE households (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  name VARCHAR(255) NOT NULL,
+  owner_user_id BIGINT NOT NULL,
+  FOREIGN KEY (owner_user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER household_updated
+BEFORE UPDATE ON households
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE TABLE household_members (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  household_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  UNIQUE (household_id, user_id),
+  FOREIGN KEY (household_id)
+        REFERENCES households(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER household_member_updated
+BEFORE UPDATE ON household_members
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_household_members_user_id
+ON household_members(user_id);
+
+CREATE TABLE household_invitations (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  household_id BIGINT NOT NULL,
+  invited_by_user_id BIGINT NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  token_hash VARCHAR(64) UNIQUE NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  accepted_at TIMESTAMPTZ,
+  FOREIGN KEY (household_id)
+        REFERENCES households(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (invited_by_user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER household_invitation_updated
+BEFORE UPDATE ON household_invitations
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE TABLE household_grants (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  household_id BIGINT NOT NULL,
+  grantor_user_id BIGINT NOT NULL,
+  grantee_user_id BIGINT NOT NULL,
+  access VARCHAR(16) NOT NULL,
+  UNIQUE (household_id, grantor_user_id, grantee_user_id),
+  FOREIGN KEY (household_id)
+        REFERENCES households(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (grantor_user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+  FOREIGN KEY (grantee_user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER household_grant_updated
+BEFORE UPDATE ON household_grants
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_household_grants_grantee_user_id
+ON household_grants(grantee_user_id);
+
+CREATE TABLE user_audit_records (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  actor_user_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  action VARCHAR(32) NOT NULL,
+  detail VARCHAR(255),
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER user_audit_record_updated
+BEFORE UPDATE ON user_audit_records
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_user_audit_records_user_id
+ON user_audit_records(user_id);
+
+CREATE INDEX idx_user_audit_records_actor_user_id
+ON user_audit_records(actor_user_id);
+
+CREATE TABLE revoked_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  token_id VARCHAR(64) UNIQUE NOT NULL,
+  user_id BIGINT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER revoked_token_updated
+BEFORE UPDATE ON revoked_tokens
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_revoked_tokens_expires_at
+ON revoked_tokens(expires_at);
+
+CREATE TABLE refresh_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  token_id VARCHAR(64) UNIQUE NOT NULL,
+  family_id VARCHAR(64) NOT NULL,
+  user_id BIGINT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER refresh_token_updated
+BEFORE UPDATE ON refresh_tokens
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_refresh_tokens_family_id
+ON refresh_tokens(family_id);
+
+CREATE INDEX idx_refresh_tokens_user_id_expires_at
+ON refresh_tokens(user_id, expires_at);
+
+CREATE TABLE api_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  token_hash VARCHAR(64) UNIQUE NOT NULL,
+  hint VARCHAR(16) NOT NULL,
+  scopes VARCHAR(512) NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER api_token_updated
+BEFORE UPDATE ON api_tokens
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_api_tokens_user_id
+ON api_tokens(user_id);
+
+CREATE TABLE password_resets (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  token_hash VARCHAR(64) UNIQUE NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER password_reset_updated
+BEFORE UPDATE ON password_resets
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_password_resets_user_id
+ON password_resets(user_id);
+
+CREATE TABLE user_totp (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT UNIQUE NOT NULL,
+  secret VARCHAR(64) NOT NULL,
+  enabled_at TIMESTAMPTZ,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER user_totp_updated
+BEFORE UPDATE ON user_totp
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE TABLE recovery_codes (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  user_id BIGINT NOT NULL,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TRIGGER recovery_code_updated
+BEFORE UPDATE ON recovery_codes
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_recovery_codes_user_id
+ON recovery_codes(user_id);
+
+CREATE TABLE login_attempts (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ,
+  attempt_key VARCHAR(255) UNIQUE NOT NULL,
+  failures INT NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMPTZ,
+  blocked_until TIMESTAMPTZ
+);
+
+CREATE TRIGGER login_attempt_updated
+BEFORE UPDATE ON login_attempts
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_login_attempts_last_failure_at
+ON login_attempts(last_failure_at);
@@ -8,6 +8,11 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// readTimeout bounds reading a whole request, body included.  It is long
+// enough for a statement import to upload; slow clients are still cut off by
+// ReadHeaderTimeout before a route is chosen.
+const readTimeout = 2 * time.Minute
+
 //NewServer returns a configured TLS HTTP server.
 func New(router *mux.Router, bindAddress, port string) *http.Server {
 
@@ -34,9 +39,8 @@ func New(router *mux.Router, bindAddress, port string) *http.Server {
 		Addr:              serviceAddress,
 		Handler:           router,
 		//TLSConfig:         tlsConfig,
-		ReadTimeout:       5 * time.Second,
+		ReadTimeout:       readTimeout,
 		ReadHeaderTimeout: 5 * time.Second,
-		WriteTimeout:      10 * time.Second,
 		IdleTimeout:       120 * time.Second,
 	}
 
@@ -67,9 +71,8 @@ func NewForTesting(router *mux.Router, port string) *http.Server {
 		Addr:              ":0",
 		Handler:           router,
 		//TLSConfig:         tlsConfig,
-		ReadTimeout:       5 * time.Second,
+		ReadTimeout:       readTimeout,
 		ReadHeaderTimeout: 5 * time.Second,
-		WriteTimeout:      10 * time.Second,
 		IdleTimeout:       120 * time.Second,
 	}
 
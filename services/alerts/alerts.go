@@ -0,0 +1,74 @@
+package alerts
+
+import (
+	"time"
+
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// eventBuffer is the number of events that may queue up while card
+	// transactions are being evaluated.
+	eventBuffer = 1024
+	// batchSize is the number of card transactions evaluated per query.
+	batchSize = 100
+	// pollInterval is how often card transactions stored by other servers, or
+	// whose events were missed, are looked for.
+	pollInterval = 5 * time.Second
+)
+
+// EvaluateAlertsForever scores each new card transaction for anomalies and
+// evaluates its owner's alert rules against it.  The transactions to evaluate
+// are read from the database, so none are skipped when the event bus drops
+// this subscriber during a bulk import; events only wake it up sooner.
+func EvaluateAlertsForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+
+	sub := state.Events.SubscribeAll(eventBuffer)
+	defer func() {
+		sub.Unsubscribe()
+	}()
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				if !sub.Dropped() {
+					logger.Print("EvaluateAlertsForever done")
+					return
+				}
+				sub = state.Events.SubscribeAll(eventBuffer)
+				evaluate(state)
+				continue
+			}
+			if event.Type == events.CardTransactionCreated {
+				evaluate(state)
+			}
+		case <-poll.C:
+			evaluate(state)
+		case <-state.Channels.Quit:
+			logger.Print("EvaluateAlertsForever done")
+			return
+		}
+	}
+}
+
+// evaluate works through the unevaluated card transactions a batch at a time.
+func evaluate(state *state.ServerState) {
+	for {
+		n, err := models.EvaluateCardTransactions(state, time.Now().UTC(), batchSize)
+		if err != nil {
+			state.Logger.Printf("failed to evaluate card transactions: %v", err)
+			return
+		}
+		if n < batchSize {
+			return
+		}
+	}
+}
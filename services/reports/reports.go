@@ -0,0 +1,34 @@
+package reports
+
+import (
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// pollInterval is how often due reports are looked for.
+const pollInterval = time.Minute
+
+// SendReportsForever emails users their weekly or monthly spend reports as
+// they fall due.
+func SendReportsForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-poll.C:
+			_, err := models.SendDueReports(state, time.Now().UTC())
+			if err != nil {
+				logger.Printf("failed to send reports: %v", err)
+			}
+		case <-state.Channels.Quit:
+			logger.Print("SendReportsForever done")
+			return
+		}
+	}
+}
@@ -1,11 +1,40 @@
 package services
 
 import (
+	"github.com/donohutcheon/gowebserver/services/alerts"
+	"github.com/donohutcheon/gowebserver/services/reports"
+	"github.com/donohutcheon/gowebserver/services/signing"
 	"github.com/donohutcheon/gowebserver/services/users"
+	"github.com/donohutcheon/gowebserver/services/webhooks"
 	"github.com/donohutcheon/gowebserver/state"
 )
 
 func StartServices(state *state.ServerState) {
 	state.ShutdownWG.Add(1)
 	go users.ConfirmUsersForever(state)
+
+	state.ShutdownWG.Add(1)
+	go users.ResendConfirmationsForever(state)
+
+	state.ShutdownWG.Add(1)
+	go users.SendPasswordResetsForever(state)
+
+	state.ShutdownWG.Add(1)
+	go users.SendLockoutNoticesForever(state)
+
+	queuedWebhooks := make(chan struct{}, 1)
+	state.ShutdownWG.Add(1)
+	go webhooks.QueueWebhooksForever(state, queuedWebhooks)
+
+	state.ShutdownWG.Add(1)
+	go webhooks.DeliverWebhooksForever(state, queuedWebhooks)
+
+	state.ShutdownWG.Add(1)
+	go alerts.EvaluateAlertsForever(state)
+
+	state.ShutdownWG.Add(1)
+	go reports.SendReportsForever(state)
+
+	state.ShutdownWG.Add(1)
+	go signing.ReloadKeysForever(state)
 }
\ No newline at end of file
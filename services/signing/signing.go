@@ -0,0 +1,33 @@
+package signing
+
+import (
+	"time"
+
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// reloadInterval is how often the signing keys are read again, so that keys
+// added to or retired from the key directory are picked up without a restart.
+const reloadInterval = 5 * time.Minute
+
+// ReloadKeysForever keeps the signing keys in step with the key directory.
+func ReloadKeysForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+
+	reload := time.NewTicker(reloadInterval)
+	defer reload.Stop()
+
+	for {
+		select {
+		case <-reload.C:
+			err := state.Keys.Reload()
+			if err != nil {
+				logger.Printf("failed to reload signing keys: %v", err)
+			}
+		case <-state.Channels.Quit:
+			logger.Print("ReloadKeysForever done")
+			return
+		}
+	}
+}
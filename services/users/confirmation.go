@@ -3,7 +3,7 @@ package users
 import (
 	"fmt"
 	"github.com/donohutcheon/gowebserver/datalayer"
-	"github.com/donohutcheon/gowebserver/lib/nonce"
+	"github.com/donohutcheon/gowebserver/models"
 	"github.com/donohutcheon/gowebserver/state"
 	"math/rand"
 	"time"
@@ -13,48 +13,232 @@ func init() {
 	rand.Seed(time.Now().Unix())
 }
 
+const (
+	// confirmationSweepInterval is how often users whose confirmation email
+	// was never sent are looked for.
+	confirmationSweepInterval = 10 * time.Minute
+	// confirmationSweepDelay leaves users who have just signed up to
+	// ConfirmUsersForever.
+	confirmationSweepDelay = 5 * time.Minute
+	// confirmationRetryPeriod is how long after signing up a user's
+	// confirmation email is retried for.
+	confirmationRetryPeriod = 7 * 24 * time.Hour
+)
+
+// ConfirmUsersForever sends the confirmation emails of users queued on sign
+// up, on changing their email address or by an administrator.
 func ConfirmUsersForever(state *state.ServerState) {
 	defer state.ShutdownWG.Done()
 	logger := state.Logger
-	dl := state.DataLayer
 
-	email := state.Providers.Email
+	for {
+		select {
+		case u := <-state.Channels.ConfirmUsers:
+			if u.PendingEmail.Valid {
+				sendEmailChangeConfirmation(state, u)
+				continue
+			}
 
-	for u := range state.Channels.ConfirmUsers {
-		logger.Printf("Received user to confirm from channel %s %s %s", u.Email.String, u.Password.String, u.State.String)
-		confirmationNonce := nonce.GenerateNonce(32)
+			logger.Printf("Received user to confirm from channel %s %s", u.Email.String, u.State.String)
+			sendSignUpConfirmation(state, u)
+		case <-state.Channels.Quit:
+			logger.Print("ConfirmUsersForever done")
+			return
+		}
+	}
+}
 
-		err := dl.SetUserStateByID(u.ID, datalayer.UserStateProcessing)
-		if err != nil {
-			logger.Printf("failed to update user's state to %s %+v", u.Email.String, datalayer.UserStatePending)
-			continue
+// ResendConfirmationsForever resends the confirmation emails users ask for
+// again, and now and then sends those of users whose email was never sent.
+func ResendConfirmationsForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+	ticker := time.NewTicker(confirmationSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case email := <-state.Channels.ConfirmationResends:
+			err := resendConfirmation(state, email, time.Now())
+			if err != nil {
+				logger.Printf("failed to resend confirmation: %v", err)
+			}
+		case now := <-ticker.C:
+			SweepConfirmations(state, now)
+		case <-state.Channels.Quit:
+			logger.Print("ResendConfirmationsForever done")
+			return
 		}
+	}
+}
+
+// SweepConfirmations sends the confirmation emails of users who signed up
+// or changed their email address in the week before now but were never sent
+// one, because sending failed, the queue was full or the server stopped
+// first, and deletes confirmations that have expired.
+func SweepConfirmations(state *state.ServerState, now time.Time) {
+	logger := state.Logger
+	dl := state.DataLayer
+
+	users, err := dl.GetUnconfirmedUsers(now.Add(-confirmationRetryPeriod), now.Add(-confirmationSweepDelay))
+	if err != nil && err != datalayer.ErrNoData {
+		logger.Printf("failed to query unconfirmed users: %v", err)
+		return
+	}
+	for _, u := range users {
+		logger.Printf("Resending stalled confirmation email for user %d", u.ID)
+		sendSignUpConfirmation(state, u)
+	}
+
+	users, err = dl.GetUnsentEmailChanges(now.Add(-confirmationRetryPeriod), now.Add(-confirmationSweepDelay), now)
+	if err != nil && err != datalayer.ErrNoData {
+		logger.Printf("failed to query unsent email changes: %v", err)
+		return
+	}
+	for _, u := range users {
+		logger.Printf("Resending stalled email change confirmation for user %d", u.ID)
+		sendEmailChangeConfirmation(state, u)
+	}
+
+	err = dl.DeleteExpiredSignUpConfirmations(now)
+	if err != nil {
+		logger.Printf("failed to delete expired confirmations: %v", err)
+	}
+}
+
+// resendConfirmation sends a new confirmation email to the user with the
+// address, if there is one who has yet to confirm it and was not sent one in
+// the last minute.
+func resendConfirmation(state *state.ServerState, email string, now time.Time) error {
+	dl := state.DataLayer
+	dbUser, err := dl.GetUserByEmail(email)
+	if err == datalayer.ErrNoData {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	switch datalayer.UserState(dbUser.State.String) {
+	case datalayer.UserStateUnconfirmed, datalayer.UserStateProcessing, datalayer.UserStatePending:
+	default:
+		return nil
+	}
 
-		nonceID, err := dl.CreateSignUpConfirmation(confirmationNonce, u.ID)
+	latest, err := dl.GetLatestSignUpConfirmationByUserID(dbUser.ID)
+	if err != nil && err != datalayer.ErrNoData {
+		return err
+	} else if err == nil && latest.CreatedAt.Valid && now.Sub(latest.CreatedAt.Time) < models.ConfirmationResendInterval {
+		return nil
+	}
+
+	sendSignUpConfirmation(state, *dbUser)
+	return nil
+}
+
+// sendSignUpConfirmation emails a link to confirm the address a user signed
+// up with.  If the email cannot be sent the user is left UNCONFIRMED, so
+// that SweepConfirmations tries again.
+func sendSignUpConfirmation(state *state.ServerState, u datalayer.User) {
+	logger := state.Logger
+	dl := state.DataLayer
+
+	// Users found stuck by SweepConfirmations may already be PROCESSING.  The
+	// user may confirm at any point while the email is being sent, so each
+	// change of state only applies if the user is still where it was left.
+	current := datalayer.UserState(u.State.String)
+	if current != datalayer.UserStateProcessing {
+		changed, err := dl.ChangeUserStateByID(u.ID, current, datalayer.UserStateProcessing)
 		if err != nil {
-			logger.Printf("failed to create sign-up confirmation for user %s %+v", u.Email.String, confirmationNonce)
-			continue
+			logger.Printf("failed to update user's state to %s %+v", u.Email.String, datalayer.UserStateProcessing)
+			return
+		} else if !changed {
+			logger.Printf("user %s is no longer %s, not sending confirmation", u.Email.String, current)
+			return
 		}
+	}
 
-		to := u.Email.String
-		toList := []string{to}
-		from := "noreply@someapp.com"
-		message := fmt.Sprintf("Hello %s,\n Welcome to this app - whatever it is.  Please confirm your registration by clicking on this link " +
-		"%s/api/users/confirm/%s", u.Email.String, state.URL, confirmationNonce)
+	confirmationNonce, nonceHash, err := models.NewConfirmationNonce()
+	if err != nil {
+		logger.Printf("failed to generate sign-up confirmation for user %s: %v", u.Email.String, err)
+		resetUnconfirmed(state, u)
+		return
+	}
+
+	nonceID, err := dl.CreateSignUpConfirmation(nonceHash, u.ID, time.Now().Add(models.ConfirmationLifetime))
+	if err != nil {
+		logger.Printf("failed to create sign-up confirmation for user %s: %v", u.Email.String, err)
+		resetUnconfirmed(state, u)
+		return
+	}
+
+	to := u.Email.String
+	toList := []string{to}
+	from := "noreply@someapp.com"
+	message := fmt.Sprintf("Hello %s,\n Welcome to this app - whatever it is.  Please confirm your registration by clicking on this link " +
+	"%s/api/users/confirm/%s\nThe link works once, within %d hours.", u.Email.String, state.URL, confirmationNonce,
+		int(models.ConfirmationLifetime.Hours()))
 
-		err = email.SendMail(toList, from, "Welcome to this app!", message)
+	err = state.Providers.Email.SendMail(toList, from, "Welcome to this app!", message)
+	if err != nil {
+		logger.Printf("failed to send confirmation mail to user %d: %v", u.ID, err)
+		err = dl.DeleteSignUpConfirmation(nonceID)
 		if err != nil {
-			logger.Print("failed to send mail")
-			continue
+			logger.Printf("failed to delete unsent confirmation [%d]: %v", nonceID, err)
 		}
+		resetUnconfirmed(state, u)
+		return
+	}
+
+	_, err = dl.ChangeUserStateByID(u.ID, datalayer.UserStateProcessing, datalayer.UserStatePending)
+	if err != nil {
+		logger.Printf("failed to update user's state to %s %+v", u.Email.String, datalayer.UserStatePending)
+		return
+	}
 
-		err = dl.SetUserStateByID(u.ID, datalayer.UserStatePending)
+	logger.Printf("Sent confirmation email for user %s nonceID %d", u.Email.String, nonceID)
+}
+
+// resetUnconfirmed returns a user whose confirmation email could not be sent
+// to UNCONFIRMED, unless they have since moved on from PROCESSING.
+func resetUnconfirmed(state *state.ServerState, u datalayer.User) {
+	_, err := state.DataLayer.ChangeUserStateByID(u.ID, datalayer.UserStateProcessing, datalayer.UserStateUnconfirmed)
+	if err != nil {
+		state.Logger.Printf("failed to update user's state to %s %+v", u.Email.String, datalayer.UserStateUnconfirmed)
+	}
+}
+
+// sendEmailChangeConfirmation emails a link to the address the user is
+// changing to.  The user's state is left alone; they stay confirmed at their
+// old address until the link is followed.
+func sendEmailChangeConfirmation(state *state.ServerState, u datalayer.User) {
+	logger := state.Logger
+	dl := state.DataLayer
+
+	confirmationNonce, nonceHash, err := models.NewConfirmationNonce()
+	if err != nil {
+		logger.Printf("failed to generate email change confirmation for user %d: %v", u.ID, err)
+		return
+	}
+
+	confirmationID, err := dl.CreateEmailChangeConfirmation(nonceHash, u.ID, u.PendingEmail.String,
+		time.Now().Add(models.ConfirmationLifetime))
+	if err != nil {
+		logger.Printf("failed to create email change confirmation for user %d: %v", u.ID, err)
+		return
+	}
+
+	toList := []string{u.PendingEmail.String}
+	from := "noreply@someapp.com"
+	message := fmt.Sprintf("Hello %s,\n Please confirm the new email address of your account by clicking on this link "+
+		"%s/api/users/confirm/%s", u.PendingEmail.String, state.URL, confirmationNonce)
+
+	err = state.Providers.Email.SendMail(toList, from, "Confirm your new email address", message)
+	if err != nil {
+		logger.Printf("failed to send email change confirmation for user %d: %v", u.ID, err)
+		// Without a confirmation on record the sweep tries again.
+		err = dl.DeleteSignUpConfirmation(confirmationID)
 		if err != nil {
-			logger.Printf("failed to update user's state to %s %+v", u.Email.String, datalayer.UserStatePending)
-			continue
+			logger.Printf("failed to delete unsent confirmation [%d]: %v", confirmationID, err)
 		}
-
-		logger.Printf("Sent confirmation email for user %s with confirmationNonce %s nonceID %d", u.Email.String, confirmationNonce, nonceID)
 	}
-	logger.Print("ConfirmUsersForever done")
 }
@@ -0,0 +1,26 @@
+package users
+
+import (
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// SendLockoutNoticesForever emails the owners of accounts that failed logins
+// have locked out.
+func SendLockoutNoticesForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+
+	for {
+		select {
+		case email := <-state.Channels.Lockouts:
+			err := models.SendLockoutNotice(state, email)
+			if err != nil {
+				logger.Printf("failed to send lockout notice: %v", err)
+			}
+		case <-state.Channels.Quit:
+			logger.Print("SendLockoutNoticesForever done")
+			return
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package users
+
+import (
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// SendPasswordResetsForever emails the password reset links that have been
+// asked for.
+func SendPasswordResetsForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+
+	for {
+		select {
+		case email := <-state.Channels.PasswordResets:
+			err := models.SendPasswordReset(state, email, time.Now())
+			if err != nil {
+				logger.Printf("failed to send password reset: %v", err)
+			}
+		case <-state.Channels.Quit:
+			logger.Print("SendPasswordResetsForever done")
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"time"
+
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// eventBuffer is the number of events that may queue up while deliveries
+	// are being stored.
+	eventBuffer = 1024
+	// pollInterval is how often deliveries awaiting a retry are looked for.
+	pollInterval = 5 * time.Second
+)
+
+// QueueWebhooksForever stores a pending delivery for each webhook that
+// selects an event published on the bus, and wakes the delivery worker.  It
+// never sends anything itself, so slow endpoints cannot hold up the bus.
+func QueueWebhooksForever(state *state.ServerState, queued chan<- struct{}) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+
+	sub := state.Events.SubscribeAll(eventBuffer)
+	defer func() {
+		sub.Unsubscribe()
+	}()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				if !sub.Dropped() {
+					logger.Print("QueueWebhooksForever done")
+					return
+				}
+				logger.Print("webhook queueing fell behind the event bus, events were missed")
+				sub = state.Events.SubscribeAll(eventBuffer)
+				continue
+			}
+			enqueue(state, event)
+			select {
+			case queued <- struct{}{}:
+			default:
+			}
+		case <-state.Channels.Quit:
+			logger.Print("QueueWebhooksForever done")
+			return
+		}
+	}
+}
+
+// DeliverWebhooksForever sends the deliveries that are due whenever new ones
+// are queued, and polls for those awaiting a retry.  Deliveries live in the
+// database, so they survive a restart.
+func DeliverWebhooksForever(state *state.ServerState, queued <-chan struct{}) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-queued:
+			deliver(state)
+		case <-poll.C:
+			deliver(state)
+		case <-state.Channels.Quit:
+			logger.Print("DeliverWebhooksForever done")
+			return
+		}
+	}
+}
+
+func enqueue(state *state.ServerState, event events.Event) {
+	err := models.EnqueueWebhookDeliveries(state, event)
+	if err != nil {
+		state.Logger.Printf("failed to queue webhook deliveries for %s event of user %d: %v", event.Type, event.UserID, err)
+	}
+}
+
+func deliver(state *state.ServerState) {
+	_, err := models.DeliverDueWebhooks(state, time.Now().UTC())
+	if err != nil {
+		state.Logger.Printf("failed to deliver webhooks: %v", err)
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"context"
 	"fmt"
 	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/lib/lockout"
+	"github.com/donohutcheon/gowebserver/lib/revocation"
+	"github.com/donohutcheon/gowebserver/lib/signing"
+	"github.com/donohutcheon/gowebserver/models"
 	"github.com/donohutcheon/gowebserver/provider/mail"
 	"github.com/donohutcheon/gowebserver/provider/mail/mailtrap"
 	"github.com/donohutcheon/gowebserver/provider/mail/mockmail"
@@ -41,18 +46,40 @@ func newState(env environment, logger *log.Logger, mainThreadWG *sync.WaitGroup)
 		return nil, err
 	}
 
+	keys, err := signing.New(os.Getenv("token_keys"), os.Getenv("token_password"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Failed logins are kept in the database, so that lockouts outlast
+	// restarts and hold across instances, unless configured otherwise.
+	var loginAttempts lockout.Source = dataLayer
+	if os.Getenv("login_attempts_store") == "memory" {
+		loginAttempts = lockout.NewMemorySource()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &state.ServerState{
 		URL: os.Getenv("URL"),
 		Channels: state.Channels{
-			ConfirmUsers: make(chan datalayer.User, 1),
+			ConfirmUsers:   make(chan datalayer.User, models.ConfirmationQueue),
+			PasswordResets: make(chan string, models.PasswordResetQueue),
+			Lockouts:       make(chan string, models.LockoutNoticeQueue),
+			ConfirmationResends: make(chan string, models.ConfirmationResendQueue),
+			Quit:           make(chan struct{}),
 		},
 		Context: ctx,
 		Logger:    logger,
 		DataLayer: dataLayer,
 		ShutdownWG: new(sync.WaitGroup),
 		Router: mux.NewRouter(),
+		Events: events.NewBus(),
+		Revocations: revocation.New(dataLayer, revocation.DefaultTTL),
+		LoginAttempts: lockout.New(loginAttempts),
+		Keys: keys,
 		Cancel: cancel,
+		BehindProxy: os.Getenv("behind_proxy") == "true",
+		AllowPrivateWebhooks: os.Getenv("webhooks_allow_private") == "true",
 	}
 
 	if env == prod {
@@ -92,15 +119,38 @@ type SeedFunction func(t *testing.T, layer datalayer.DataLayer)
 
 func NewForTesting(t *testing.T, callbacks *state.MockCallbacks, seedFunctions ...SeedFunction) *state.ServerState {
 	t.Helper()
-	logger := log.New(os.Stdout, "microservice", log.LstdFlags|log.Lshortfile)
+	loadTestingEnv()
+
+	mockDataLayer, err := datalayer.NewForTesting(t, context.Background())
+	require.NoError(t, err)
 
+	return newForTesting(t, callbacks, mockDataLayer, seedFunctions...)
+}
+
+// NewCommittedForTesting is NewForTesting with a database that commits what
+// is written to it, for tests of full-text search, which does not see rows
+// that have not been committed.
+func NewCommittedForTesting(t *testing.T, callbacks *state.MockCallbacks, seedFunctions ...SeedFunction) *state.ServerState {
+	t.Helper()
+	loadTestingEnv()
+
+	dataLayer, err := datalayer.NewCommittedForTesting(t, context.Background())
+	require.NoError(t, err)
+
+	return newForTesting(t, callbacks, dataLayer, seedFunctions...)
+}
+
+func loadTestingEnv() {
 	_, b, _, _ := runtime.Caller(0)
 	envFile := fmt.Sprintf("%s/../../.env", filepath.Dir(b))
 	godotenv.Load(envFile) //nolint:errcheck
+}
 
+func newForTesting(t *testing.T, callbacks *state.MockCallbacks, mockDataLayer datalayer.DataLayer,
+	seedFunctions ...SeedFunction) *state.ServerState {
+	t.Helper()
+	logger := log.New(os.Stdout, "microservice", log.LstdFlags|log.Lshortfile)
 	ctx := context.Background()
-	mockDataLayer, err := datalayer.NewForTesting(t, ctx)
-	require.NoError(t, err)
 
 	mail := &mockmail.MockClient{
 		T:            t,
@@ -109,10 +159,17 @@ func NewForTesting(t *testing.T, callbacks *state.MockCallbacks, seedFunctions .
 		Group:        callbacks.MockMailWG,
 	}
 
+	keys, err := signing.Generate("test")
+	require.NoError(t, err)
+
 	r := mux.NewRouter()
 	state := &state.ServerState{
 		Channels: state.Channels{
-			ConfirmUsers: make(chan datalayer.User, 1),
+			ConfirmUsers:   make(chan datalayer.User, models.ConfirmationQueue),
+			PasswordResets: make(chan string, models.PasswordResetQueue),
+			Lockouts:       make(chan string, models.LockoutNoticeQueue),
+			ConfirmationResends: make(chan string, models.ConfirmationResendQueue),
+			Quit:           make(chan struct{}),
 		},
 		Context:    ctx,
 		Logger:     logger,
@@ -122,6 +179,10 @@ func NewForTesting(t *testing.T, callbacks *state.MockCallbacks, seedFunctions .
 		Providers: state.Providers{
 			Email: mockmail.New(mail),
 		},
+		Events: events.NewBus(),
+		Revocations: revocation.New(mockDataLayer, revocation.DefaultTTL),
+		LoginAttempts: lockout.New(mockDataLayer),
+		Keys:        keys,
 	}
 
 	h := router.NewHandlers(state)
@@ -133,6 +194,9 @@ func NewForTesting(t *testing.T, callbacks *state.MockCallbacks, seedFunctions .
 	require.NoError(t, err)
 
 	services.StartServices(state)
+	t.Cleanup(func() {
+		close(state.Channels.Quit)
+	})
 	go func() {
 		err := srv.Serve(l)
 		require.NoError(t, err)
@@ -200,8 +264,9 @@ func handleSignals(state *state.ServerState, mainThreadWG *sync.WaitGroup) {
 	log.Printf("waiting for system call...")
 	signalChan := <-c
 	log.Printf("system call: %+v", signalChan)
-	// Close all channels here and then wait for the wait group to unlock.
-	close(state.Channels.ConfirmUsers)
+	// Stop the services and then wait for the wait group to unlock.
+	close(state.Channels.Quit)
 	state.ShutdownWG.Wait() //Wait for consumers to finish processing messages and exit
+	state.Events.Close()
 	state.Cancel()
 }
\ No newline at end of file
@@ -3,6 +3,10 @@ package state
 import (
 	"context"
 	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/lib/events"
+	"github.com/donohutcheon/gowebserver/lib/lockout"
+	"github.com/donohutcheon/gowebserver/lib/revocation"
+	"github.com/donohutcheon/gowebserver/lib/signing"
 	"github.com/donohutcheon/gowebserver/provider/mail"
 	"github.com/donohutcheon/gowebserver/provider/mail/mockmail"
 	"github.com/gorilla/mux"
@@ -12,6 +16,18 @@ import (
 
 type Channels struct {
 	ConfirmUsers chan  datalayer.User
+	// PasswordResets carries the email addresses password resets were
+	// requested for.
+	PasswordResets chan string
+	// ConfirmationResends carries the email addresses new confirmation
+	// emails were asked for.
+	ConfirmationResends chan string
+	// Lockouts carries the email addresses of accounts that have just been
+	// locked out by failed logins.
+	Lockouts chan string
+	// Quit is closed at shutdown to stop services that do not consume a
+	// channel of their own.
+	Quit         chan struct{}
 }
 
 type Providers struct {
@@ -27,7 +43,17 @@ type ServerState struct {
 	ShutdownWG *sync.WaitGroup
 	Router     *mux.Router
 	Providers  Providers
+	Events     *events.Bus
+	Revocations *revocation.Store
+	LoginAttempts *lockout.Guard
+	Keys       *signing.KeySet
 	Cancel     context.CancelFunc
+	// BehindProxy trusts X-Forwarded-For to name the address requests come
+	// from, as set by a router in front of the server.
+	BehindProxy bool
+	// AllowPrivateWebhooks lets webhooks be delivered to loopback, private
+	// and link-local addresses, which are otherwise refused.
+	AllowPrivateWebhooks bool
 }
 
 type MockCallbacks struct {